@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/export"
+	"jb.favre/mikrotik-fleet-autopilot/core"
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+var outputDir string
+var password string
+var retention core.RetentionPolicy
+
+// timestampFormat is the layout of the timestamp in backup file names
+const timestampFormat = "20060102-150405"
+
+// backupFailureRe matches error messages in the output of the backup command
+var backupFailureRe = regexp.MustCompile(`(?i)failure|error`)
+
+// now returns the current time, overridden in tests
+var now = time.Now
+
+// sshConnectionFactory is the factory function for creating SSH connections
+// This can be overridden in tests to inject mock SSH manager
+var sshConnectionFactory = core.CreateConnection
+
+var Command = []*cli.Command{
+	{
+		Name:  "backup",
+		Usage: "Save, download and rotate MikroTik binary backups",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "output-dir",
+				Value:       ".",
+				Usage:       "Directory where to save the backup files",
+				Destination: &outputDir,
+			},
+			&cli.StringFlag{
+				Name:        "password",
+				Value:       "",
+				Usage:       "Encrypt backups with this password (unencrypted if empty)",
+				Sources:     cli.EnvVars("MIKROTIK_BACKUP_PASSWORD"),
+				Destination: &password,
+			},
+			&cli.IntFlag{
+				Name:        "keep",
+				Value:       7,
+				Usage:       "Number of backups to keep per router, older ones are deleted",
+				Destination: &retention.Last,
+			},
+			&cli.IntFlag{
+				Name:        "keep-daily",
+				Value:       0,
+				Usage:       "Also keep the most recent backup of each of the last N days",
+				Destination: &retention.Daily,
+			},
+			&cli.IntFlag{
+				Name:        "keep-weekly",
+				Value:       0,
+				Usage:       "Also keep the most recent backup of each of the last N weeks",
+				Destination: &retention.Weekly,
+			},
+			&cli.IntFlag{
+				Name:        "keep-monthly",
+				Value:       0,
+				Usage:       "Also keep the most recent backup of each of the last N months",
+				Destination: &retention.Monthly,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := core.GetConfig(ctx)
+			if err != nil {
+				slog.Debug("failed to get global config", "error", err)
+				return err
+			}
+			if err := retention.Validate(); err != nil {
+				return err
+			}
+
+			// Process all hosts, failures on one host don't stop the others
+			results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, backup)
+			core.GetReporter(ctx).Summary(results)
+			return results.Err()
+		},
+	},
+}
+
+// backup saves a binary backup on the router, downloads it next to the .rsc export
+// and removes it from the router
+func backup(ctx context.Context, host string) error {
+	slog.Info("backing up router", "host", host)
+	reporter := core.GetReporter(ctx)
+	start := time.Now()
+	fail := func(status string, err error) {
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "backup",
+			Status:   status,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Backup failed", host),
+		})
+	}
+
+	slog.Debug("initializing SSH connection", "host", host)
+	conn, err := sshConnectionFactory(ctx, host)
+	if err != nil {
+		slog.Error("failed to create SSH connection", "host", host, "error", err)
+		fail(core.StatusUnreachable, err)
+		return fmt.Errorf("failed to create SSH connection: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	transferer, ok := conn.(core.FileTransferer)
+	if !ok {
+		err := fmt.Errorf("connection does not support file transfer")
+		fail(core.StatusFailed, err)
+		return err
+	}
+
+	hostInfo := core.ParseHost(host)
+	name := fmt.Sprintf("%s-%s", hostInfo.ShortName, now().Format(timestampFormat))
+	remote := name + ".backup"
+	dir := export.ConfigDir(ctx, host, outputDir)
+	local := filepath.Join(dir, remote)
+
+	reporter.Progress(host, fmt.Sprintf("⏳ %s: Saving backup %s", host, remote))
+	if err := saveBackup(ctx, conn, name, password); err != nil {
+		slog.Error("failed to save backup", "host", host, "error", err)
+		fail(core.StatusFailed, err)
+		return fmt.Errorf("failed to save backup: %w", err)
+	}
+	// The backup must not stay on the router, whatever happens with the download,
+	// even when the run is interrupted (the command timeout still applies)
+	defer removeRemoteBackup(context.WithoutCancel(ctx), conn, remote)
+
+	if err := transferer.Download(ctx, remote, local); err != nil {
+		slog.Error("failed to download backup", "host", host, "error", err)
+		fail(core.StatusFailed, err)
+		return fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	deleted, err := pruneBackups(dir, hostInfo.ShortName, retention)
+	if err != nil {
+		// Backup itself succeeded, retention is retried on next run
+		slog.Warn("failed to apply backup retention", "host", host, "error", err)
+	}
+
+	slog.Info("backup saved successfully", "host", host, "file", local, "pruned", len(deleted))
+	reporter.Report(core.Result{
+		Host:     host,
+		Command:  "backup",
+		Status:   core.StatusOK,
+		File:     local,
+		Duration: time.Since(start),
+		Message:  fmt.Sprintf("✅ %s: Backup saved to %s", host, local),
+	})
+	return nil
+}
+
+// saveBackup runs the backup command on the router, encrypted when a password is given.
+// The password is quoted as a RouterOS string, so that "$" or quotes are taken literally.
+func saveBackup(ctx context.Context, conn core.SshRunner, name, password string) error {
+	cmd := fmt.Sprintf("/system/backup/save name=%s dont-encrypt=yes", name)
+	if password != "" {
+		cmd = fmt.Sprintf("/system/backup/save name=%s password=%s", name, rsc.Quote(password))
+	}
+	slog.Debug("executing backup command", "name", name, "encrypted", password != "")
+	output, err := conn.RunContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if backupFailureRe.MatchString(output) {
+		return fmt.Errorf("%s", output)
+	}
+	return nil
+}
+
+// removeRemoteBackup deletes the backup file from the router
+func removeRemoteBackup(ctx context.Context, conn core.SshRunner, remote string) {
+	cmd := fmt.Sprintf("/file/remove [find name=%s]", rsc.Quote(remote))
+	slog.Debug("removing backup from router", "command", cmd)
+	if _, err := conn.RunContext(ctx, cmd); err != nil {
+		slog.Warn("failed to remove backup from router", "file", remote, "error", err)
+	}
+}
+
+// pruneBackups deletes the backups of a router in dir not kept by the retention policy.
+// Only files named <shortName>-<timestamp>.backup are considered. It returns the deleted files.
+func pruneBackups(dir, shortName string, policy core.RetentionPolicy) ([]string, error) {
+	if policy.IsZero() {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(shortName) + `-(\d{8}-\d{6})\.backup$`)
+	var backups []string
+	var times []time.Time
+	for _, entry := range entries {
+		match := pattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		t, err := time.ParseInLocation(timestampFormat, match[1], time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, entry.Name())
+		times = append(times, t)
+	}
+
+	var deleted []string
+	for i, keep := range policy.Keep(times) {
+		if keep {
+			continue
+		}
+		path := filepath.Join(dir, backups[i])
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		slog.Debug("old backup deleted", "file", path)
+		deleted = append(deleted, path)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,241 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// MockSshRunner is a mock implementation of SshRunner and FileTransferer for testing
+type MockSshRunner struct {
+	RunFunc      func(cmd string) (string, error)
+	DownloadFunc func(remotePath, localPath string) error
+}
+
+func (m *MockSshRunner) Close() error {
+	return nil
+}
+
+func (m *MockSshRunner) IsAlreadyClosedError(err error) bool {
+	return false
+}
+
+func (m *MockSshRunner) Run(cmd string) (string, error) {
+	if m.RunFunc != nil {
+		return m.RunFunc(cmd)
+	}
+	return "", nil
+}
+
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	return m.Run(cmd)
+}
+
+func (m *MockSshRunner) Upload(ctx context.Context, localPath, remotePath string) error {
+	return fmt.Errorf("mock Upload not implemented")
+}
+
+func (m *MockSshRunner) Download(ctx context.Context, remotePath, localPath string) error {
+	if m.DownloadFunc != nil {
+		return m.DownloadFunc(remotePath, localPath)
+	}
+	return os.WriteFile(localPath, []byte("backup"), 0600)
+}
+
+func (m *MockSshRunner) Checksum(ctx context.Context, remotePath string) (int64, string, error) {
+	return 0, "", fmt.Errorf("mock Checksum not implemented")
+}
+
+func TestBackup(t *testing.T) {
+	tests := []struct {
+		name          string
+		password      string
+		saveOutput    string
+		downloadError error
+		existing      []string
+		keep          int
+		keepMonthly   int
+		wantErr       bool
+		wantStatus    string
+		wantCommands  []string
+		wantFiles     []string
+	}{
+		{
+			name:     "unencrypted backup",
+			keep:     7,
+			existing: []string{"router1-20240101-000000.backup"},
+			wantCommands: []string{
+				"/system/backup/save name=router1-20241231-235959 dont-encrypt=yes",
+				`/file/remove [find name="router1-20241231-235959.backup"]`,
+			},
+			wantStatus: core.StatusOK,
+			wantFiles:  []string{"router1-20240101-000000.backup", "router1-20241231-235959.backup"},
+		},
+		{
+			name:         "encrypted backup",
+			password:     "s3cret",
+			keep:         7,
+			wantCommands: []string{`/system/backup/save name=router1-20241231-235959 password="s3cret"`},
+			wantStatus:   core.StatusOK,
+			wantFiles:    []string{"router1-20241231-235959.backup"},
+		},
+		{
+			name:         "password quoted for RouterOS",
+			password:     `pa$s"word`,
+			keep:         7,
+			wantCommands: []string{`/system/backup/save name=router1-20241231-235959 password="pa\$s\"word"`},
+			wantStatus:   core.StatusOK,
+		},
+		{
+			name: "retention deletes oldest backups",
+			keep: 2,
+			existing: []string{
+				"router1-20240101-000000.backup",
+				"router1-20240201-000000.backup",
+				"router10-20240101-000000.backup",
+				"router1.rsc",
+			},
+			wantStatus: core.StatusOK,
+			wantFiles: []string{
+				"router1-20240201-000000.backup",
+				"router1-20241231-235959.backup",
+				"router1.rsc",
+				"router10-20240101-000000.backup",
+			},
+		},
+		{
+			name:        "retention keeps monthly backups",
+			keep:        1,
+			keepMonthly: 2,
+			existing: []string{
+				"router1-20241105-000000.backup",
+				"router1-20241120-000000.backup",
+				"router1-20241201-000000.backup",
+			},
+			wantStatus: core.StatusOK,
+			wantFiles: []string{
+				"router1-20241120-000000.backup",
+				"router1-20241231-235959.backup",
+			},
+		},
+		{
+			name:       "backup command fails",
+			keep:       7,
+			saveOutput: "failure: not enough space",
+			wantErr:    true,
+			wantStatus: core.StatusFailed,
+		},
+		{
+			name:          "download failure still removes backup from router",
+			keep:          7,
+			downloadError: fmt.Errorf("sftp: permission denied"),
+			wantErr:       true,
+			wantStatus:    core.StatusFailed,
+			wantCommands:  []string{`/file/remove [find name="router1-20241231-235959.backup"]`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			originalDir, originalPassword, originalRetention, originalNow := outputDir, password, retention, now
+			originalFactory := sshConnectionFactory
+			defer func() {
+				outputDir, password, retention, now = originalDir, originalPassword, originalRetention, originalNow
+				sshConnectionFactory = originalFactory
+			}()
+			outputDir, password, retention = dir, tt.password, core.RetentionPolicy{Last: tt.keep, Monthly: tt.keepMonthly}
+			now = func() time.Time { return time.Date(2024, 12, 31, 23, 59, 59, 0, time.Local) }
+
+			var executed []string
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				mock := &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						executed = append(executed, cmd)
+						if strings.HasPrefix(cmd, "/system/backup/save") {
+							return tt.saveOutput, nil
+						}
+						return "", nil
+					},
+				}
+				if tt.downloadError != nil {
+					mock.DownloadFunc = func(remotePath, localPath string) error { return tt.downloadError }
+				}
+				return mock, nil
+			}
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+
+			err := backup(ctx, "router1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("backup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(buf.String(), fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, buf.String())
+			}
+			for _, cmd := range tt.wantCommands {
+				if !slices.Contains(executed, cmd) {
+					t.Errorf("expected command %q to be executed, got %q", cmd, executed)
+				}
+			}
+			if tt.wantFiles != nil {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var files []string
+				for _, entry := range entries {
+					files = append(files, entry.Name())
+				}
+				if !slices.Equal(files, tt.wantFiles) {
+					t.Errorf("files = %v, want %v", files, tt.wantFiles)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupUnreachable(t *testing.T) {
+	originalFactory := sshConnectionFactory
+	defer func() { sshConnectionFactory = originalFactory }()
+	sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	var buf bytes.Buffer
+	ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+	if err := backup(ctx, "router1"); err == nil {
+		t.Fatal("backup() error = nil, want error")
+	}
+	if !strings.Contains(buf.String(), `"status":"unreachable"`) {
+		t.Errorf("result status should be unreachable, got %s", buf.String())
+	}
+}
+
+func TestRemoveRemoteBackupQuotesName(t *testing.T) {
+	var executed string
+	conn := &MockSshRunner{RunFunc: func(cmd string) (string, error) {
+		executed = cmd
+		return "", nil
+	}}
+	removeRemoteBackup(context.Background(), conn, `r$1 "lab".backup`)
+	want := `/file/remove [find name="r\$1 \"lab\".backup"]`
+	if executed != want {
+		t.Errorf("executed %q, want %q", executed, want)
+	}
+}
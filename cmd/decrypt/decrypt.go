@@ -0,0 +1,149 @@
+package decrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+var passphrase string
+var identity string
+var outputDir string
+
+var Command = []*cli.Command{
+	{
+		Name:      "decrypt",
+		Usage:     "Decrypt files encrypted by export (local files only, no router involved)",
+		ArgsUsage: "<file.enc>...",
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			// Local files only, no router to select
+			return context.WithValue(ctx, core.LocalModeKey, true), nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "passphrase",
+				Value:       "",
+				Usage:       "Passphrase the files were encrypted with",
+				Sources:     cli.EnvVars("MIKROTIK_EXPORT_PASSPHRASE"),
+				Destination: &passphrase,
+			},
+			&cli.StringFlag{
+				Name:        "identity",
+				Value:       "",
+				Usage:       "X25519 private key (PEM file or base64) the files or secrets were encrypted to",
+				Destination: &identity,
+			},
+			&cli.StringFlag{
+				Name:        "output-dir",
+				Value:       "",
+				Usage:       "Directory where to write decrypted files (default: next to the encrypted files)",
+				Destination: &outputDir,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			files := cmd.Args().Slice()
+			if len(files) == 0 {
+				return fmt.Errorf("no file to decrypt")
+			}
+			decrypter := core.FileDecrypter{Passphrase: passphrase}
+			if identity != "" {
+				var err error
+				if decrypter.PublicKey, decrypter.PrivateKey, err = core.ParseIdentity(identity); err != nil {
+					return err
+				}
+			}
+			if decrypter.Passphrase == "" && decrypter.PrivateKey == nil {
+				return fmt.Errorf("--passphrase or --identity is required")
+			}
+
+			var errs []error
+			for _, file := range files {
+				if err := decryptFile(ctx, decrypter, file); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", file, err))
+				}
+			}
+			return errors.Join(errs...)
+		},
+	},
+}
+
+// decryptFile restores an encrypted file. With an identity, secrets encrypted
+// inline by export --redact-recipient are revealed too.
+func decryptFile(ctx context.Context, decrypter core.FileDecrypter, file string) error {
+	reporter := core.GetReporter(ctx)
+	output, err := decryptedPath(file, outputDir)
+	if err == nil {
+		err = decryptTo(decrypter, file, output)
+	}
+	if err != nil {
+		slog.Error("failed to decrypt file", "file", file, "error", err)
+		reporter.Report(core.Result{
+			Command: "decrypt",
+			Status:  core.StatusFailed,
+			File:    file,
+			Error:   err.Error(),
+			Message: fmt.Sprintf("❌ %s: Decryption failed", file),
+		})
+		return err
+	}
+
+	slog.Info("file decrypted", "file", file, "output", output)
+	reporter.Report(core.Result{
+		Command: "decrypt",
+		Status:  core.StatusOK,
+		File:    output,
+		Message: fmt.Sprintf("✅ %s: Decrypted to %s", file, output),
+	})
+	return nil
+}
+
+// decryptTo writes the decrypted content of file to output, readable by the owner only
+func decryptTo(decrypter core.FileDecrypter, file, output string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if core.IsEncrypted(data) {
+		if data, err = decrypter.Decrypt(data); err != nil {
+			return err
+		}
+	} else if decrypter.PrivateKey == nil {
+		return fmt.Errorf("not an encrypted file")
+	}
+	if decrypter.PrivateKey != nil {
+		revealed, err := core.RevealSecrets(string(data), decrypter.PublicKey, decrypter.PrivateKey)
+		if err != nil {
+			return err
+		}
+		data = []byte(revealed)
+	}
+
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(output, 0600)
+}
+
+// decryptedPath returns the path of the decrypted file: the encrypted extension is
+// removed, or ".dec" is added to files without it (inline secrets only)
+func decryptedPath(file, dir string) (string, error) {
+	name := filepath.Base(file)
+	if trimmed, ok := strings.CutSuffix(name, core.EncryptedExt); ok && trimmed != "" {
+		name = trimmed
+	} else {
+		name += ".dec"
+	}
+	if dir == "" {
+		dir = filepath.Dir(file)
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
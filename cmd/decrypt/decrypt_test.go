@@ -0,0 +1,120 @@
+package decrypt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+const plainExport = "/ppp secret\nadd name=alice password=\"p4ss\" service=pppoe\n"
+
+func TestDecryptFile(t *testing.T) {
+	identityFile := filepath.Join("..", "..", "core", "testdata", "keys", "identity.pem")
+	public, private, err := core.ParseIdentity(identityFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted, _, err := core.Redactor{Recipient: public}.Redact(plainExport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPassphrase, err := core.FileEncrypter{Passphrase: "correct horse"}.Encrypt([]byte(plainExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toRecipient, err := core.FileEncrypter{Recipient: public}.Encrypt([]byte(redacted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		content    []byte
+		decrypter  core.FileDecrypter
+		outputDir  string
+		wantOutput string
+		wantErr    bool
+	}{
+		{
+			name:       "passphrase",
+			file:       "router1.rsc.enc",
+			content:    withPassphrase,
+			decrypter:  core.FileDecrypter{Passphrase: "correct horse"},
+			wantOutput: "router1.rsc",
+		},
+		{
+			name:       "identity also reveals inline secrets",
+			file:       "router1.rsc.enc",
+			content:    toRecipient,
+			decrypter:  core.FileDecrypter{PublicKey: public, PrivateKey: private},
+			outputDir:  "restored",
+			wantOutput: filepath.Join("restored", "router1.rsc"),
+		},
+		{
+			name:       "identity on a plain file with inline secrets",
+			file:       "router1.rsc",
+			content:    []byte(redacted),
+			decrypter:  core.FileDecrypter{PublicKey: public, PrivateKey: private},
+			wantOutput: "router1.rsc.dec",
+		},
+		{
+			name:      "wrong passphrase",
+			file:      "router1.rsc.enc",
+			content:   withPassphrase,
+			decrypter: core.FileDecrypter{Passphrase: "battery staple"},
+			wantErr:   true,
+		},
+		{
+			name:      "passphrase on a plain file",
+			file:      "router1.rsc",
+			content:   []byte(plainExport),
+			decrypter: core.FileDecrypter{Passphrase: "correct horse"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalOutputDir := outputDir
+			defer func() { outputDir = originalOutputDir }()
+			outputDir = ""
+			if tt.outputDir != "" {
+				outputDir = filepath.Join(tmpDir, tt.outputDir)
+			}
+
+			file := filepath.Join(tmpDir, tt.file)
+			if err := os.WriteFile(file, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := decryptFile(context.Background(), tt.decrypter, file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decryptFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			output := filepath.Join(tmpDir, tt.wantOutput)
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != plainExport {
+				t.Errorf("decrypted content = %q, want %q", got, plainExport)
+			}
+			info, err := os.Stat(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("file permissions = %o, want 600", info.Mode().Perm())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package diff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/export"
+	"jb.favre/mikrotik-fleet-autopilot/core"
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+var showSensitive bool
+
+// errDiff is returned when the compared configurations differ
+var errDiff = errors.New("configurations differ")
+
+// sshConnectionFactory is the factory function for creating SSH connections
+// This can be overridden in tests to inject mock SSH manager
+var sshConnectionFactory = core.CreateConnection
+
+var Command = []*cli.Command{
+	{
+		Name:      "diff",
+		Usage:     "Compare two .rsc files, or a .rsc file with the live configuration of routers, item by item",
+		ArgsUsage: "<old.rsc> [<new.rsc>]",
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			// Two files are compared without routers, a single file with the live routers
+			if cmd.Args().Len() == 2 {
+				ctx = context.WithValue(ctx, core.LocalModeKey, true)
+			}
+			return ctx, nil
+		},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "show-sensitive",
+				Value:       false,
+				Usage:       "Include sensitive information in the live export (use when the file was exported with --show-sensitive)",
+				Destination: &showSensitive,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			files := cmd.Args().Slice()
+			switch len(files) {
+			case 2:
+				return diffFiles(ctx, files[0], files[1])
+			case 1:
+				cfg, err := core.GetConfig(ctx)
+				if err != nil {
+					slog.Debug("failed to get global config", "error", err)
+					return err
+				}
+
+				// Process all hosts, failures on one host don't stop the others
+				results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, func(ctx context.Context, host string) error {
+					return diffLive(ctx, files[0], host)
+				})
+				core.GetReporter(ctx).Summary(results)
+				return results.Err()
+			}
+			return fmt.Errorf("expected one or two .rsc files, got %d", len(files))
+		},
+	},
+}
+
+// diffFiles compares two configuration files, no router involved
+func diffFiles(ctx context.Context, oldFile, newFile string) error {
+	slog.Info("comparing configurations", "old", oldFile, "new", newFile)
+	reporter := core.GetReporter(ctx)
+	start := time.Now()
+
+	oldScript, err := parseFile(oldFile)
+	var newScript *rsc.Script
+	if err == nil {
+		newScript, err = parseFile(newFile)
+	}
+	if err != nil {
+		slog.Error("failed to read configuration", "error", err)
+		reporter.Report(core.Result{
+			Command:  "diff",
+			Status:   core.StatusFailed,
+			File:     newFile,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Comparison with %s failed", newFile, oldFile),
+		})
+		return err
+	}
+
+	return report(reporter, core.Result{Command: "diff", File: newFile, Duration: time.Since(start)},
+		newFile, oldFile, rsc.Diff(oldScript, newScript))
+}
+
+// diffLive compares a configuration file with the live configuration of a router
+func diffLive(ctx context.Context, file, host string) error {
+	slog.Info("comparing live configuration", "host", host, "file", file)
+	reporter := core.GetReporter(ctx)
+	start := time.Now()
+
+	// Read the file first, no need to connect if it's missing or invalid
+	stored, err := parseFile(file)
+	if err != nil {
+		slog.Error("failed to read configuration", "host", host, "file", file, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "diff",
+			Status:   core.StatusFailed,
+			File:     file,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Configuration %s not readable", host, file),
+		})
+		return err
+	}
+
+	slog.Debug("initializing SSH connection", "host", host)
+	conn, err := sshConnectionFactory(ctx, host)
+	if err != nil {
+		slog.Error("failed to create SSH connection", "host", host, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "diff",
+			Status:   core.StatusUnreachable,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❓ %s is unreachable", host),
+		})
+		return fmt.Errorf("failed to create SSH connection: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	output, err := export.FetchConfig(ctx, conn, showSensitive)
+	var live *rsc.Script
+	if err == nil {
+		if live, err = rsc.Parse(output); err != nil {
+			err = fmt.Errorf("failed to parse live export: %w", err)
+		}
+	}
+	if err != nil {
+		slog.Error("failed to export configuration", "host", host, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "diff",
+			Status:   core.StatusFailed,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Export failed", host),
+		})
+		return fmt.Errorf("failed to export configuration: %w", err)
+	}
+
+	return report(reporter, core.Result{Host: host, Command: "diff", File: file, Duration: time.Since(start)},
+		host, file, rsc.Diff(stored, live))
+}
+
+// report emits the result of a comparison of name against reference
+func report(reporter core.Reporter, res core.Result, name, reference string, changes []rsc.Change) error {
+	if len(changes) == 0 {
+		slog.Info("configurations match", "name", name, "reference", reference)
+		res.Status = core.StatusInSync
+		res.Message = fmt.Sprintf("✅ %s: Configuration matches %s", name, reference)
+		reporter.Report(res)
+		return nil
+	}
+
+	slog.Warn("configurations differ", "name", name, "reference", reference, "changes", len(changes))
+	res.Status = core.StatusDrift
+	res.Changes = changes
+	res.Message = fmt.Sprintf("⚠️  %s: %d changes from %s\n%s", name, len(changes), reference, strings.TrimSuffix(rsc.FormatChanges(changes), "\n"))
+	reporter.Report(res)
+	return errDiff
+}
+
+// parseFile reads and parses a configuration file
+func parseFile(file string) (*rsc.Script, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	script, err := rsc.Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return script, nil
+}
@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// MockSshRunner is a mock implementation of SshRunner for testing
+type MockSshRunner struct {
+	CloseFunc                func() error
+	IsAlreadyClosedErrorFunc func(err error) bool
+	RunFunc                  func(cmd string) (string, error)
+}
+
+func (m *MockSshRunner) Close() error {
+	if m.CloseFunc != nil {
+		return m.CloseFunc()
+	}
+	return nil
+}
+
+func (m *MockSshRunner) IsAlreadyClosedError(err error) bool {
+	if m.IsAlreadyClosedErrorFunc != nil {
+		return m.IsAlreadyClosedErrorFunc(err)
+	}
+	return false
+}
+
+func (m *MockSshRunner) Run(cmd string) (string, error) {
+	if m.RunFunc != nil {
+		return m.RunFunc(cmd)
+	}
+	return "", nil
+}
+
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	return m.Run(cmd)
+}
+
+func TestDiffFiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		old          string
+		new          string
+		wantErr      bool
+		wantDiff     bool
+		wantStatus   string
+		wantInOutput []string
+	}{
+		{
+			name:       "same items in another order",
+			old:        "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge\nadd name=bridge1 auto-mac=no\nadd name=bridge2\n",
+			new:        "/interface bridge add name=bridge2\r\n/interface bridge add auto-mac=no name=bridge1\r\n",
+			wantStatus: core.StatusInSync,
+		},
+		{
+			name:       "items changed",
+			old:        "/interface bridge add name=bridge1\n/ip dns set servers=1.1.1.1\n",
+			new:        "/interface bridge add name=bridge1 vlan-filtering=yes\n/interface bridge add name=bridge2\n/ip dns set servers=8.8.8.8\n",
+			wantErr:    true,
+			wantDiff:   true,
+			wantStatus: core.StatusDrift,
+			wantInOutput: []string{
+				"3 changes from",
+				"/interface bridge\n  ~ name=bridge1\n      vlan-filtering: (unset) -> yes\n  + name=bridge2\n",
+				"/ip dns\n  ~ (settings)\n      servers: 1.1.1.1 -> 8.8.8.8",
+			},
+		},
+		{
+			name:       "invalid file",
+			old:        "/interface bridge add name=bridge1\n",
+			new:        "/interface bridge add comment=\"unterminated\n",
+			wantErr:    true,
+			wantStatus: core.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			oldFile := filepath.Join(tmpDir, "old.rsc")
+			newFile := filepath.Join(tmpDir, "new.rsc")
+			if err := os.WriteFile(oldFile, []byte(tt.old), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(newFile, []byte(tt.new), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+			err := diffFiles(ctx, oldFile, newFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("diffFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, errDiff) != tt.wantDiff {
+				t.Errorf("diffFiles() error = %v, want diff error %v", err, tt.wantDiff)
+			}
+			output := buf.String()
+			if !strings.Contains(output, fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, output)
+			}
+			if tt.wantDiff && !strings.Contains(output, `"changes":[{"menu":"/interface bridge","key":"name=bridge1","kind":"changed"`) {
+				t.Errorf("JSON result should hold the changes, got %s", output)
+			}
+
+			if len(tt.wantInOutput) > 0 {
+				var text bytes.Buffer
+				ctx = context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputText, &text))
+				_ = diffFiles(ctx, oldFile, newFile)
+				for _, want := range tt.wantInOutput {
+					if !strings.Contains(text.String(), want) {
+						t.Errorf("text output missing %q:\n%s", want, text.String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDiffLive(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     string
+		noFile     bool
+		live       string
+		sshError   error
+		runError   error
+		wantErr    bool
+		wantDiff   bool
+		wantStatus string
+	}{
+		{
+			name:       "live configuration matches",
+			stored:     "/ip address\nadd address=10.0.0.1/24 interface=ether1\n",
+			live:       "# 2024-01-03 08:00:00 by RouterOS 7.13\r\n/ip address add interface=ether1 address=10.0.0.1/24\r\n",
+			wantStatus: core.StatusInSync,
+		},
+		{
+			name:       "live configuration differs",
+			stored:     "/ip address add address=10.0.0.1/24 interface=ether1\n",
+			live:       "/ip address add address=10.0.0.1/24 interface=ether2\n",
+			wantErr:    true,
+			wantDiff:   true,
+			wantStatus: core.StatusDrift,
+		},
+		{
+			name:       "missing file",
+			noFile:     true,
+			wantErr:    true,
+			wantStatus: core.StatusFailed,
+		},
+		{
+			name:       "SSH connection fails",
+			stored:     "/interface bridge add name=bridge1\n",
+			sshError:   fmt.Errorf("connection refused"),
+			wantErr:    true,
+			wantStatus: core.StatusUnreachable,
+		},
+		{
+			name:       "export command fails",
+			stored:     "/interface bridge add name=bridge1\n",
+			runError:   fmt.Errorf("session closed"),
+			wantErr:    true,
+			wantStatus: core.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "golden.rsc")
+			if !tt.noFile {
+				if err := os.WriteFile(file, []byte(tt.stored), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var executedCmd string
+			originalFactory := sshConnectionFactory
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				if tt.sshError != nil {
+					return nil, tt.sshError
+				}
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						executedCmd = cmd
+						return tt.live, tt.runError
+					},
+				}, nil
+			}
+			defer func() { sshConnectionFactory = originalFactory }()
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+			err := diffLive(ctx, file, "router1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("diffLive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, errDiff) != tt.wantDiff {
+				t.Errorf("diffLive() error = %v, want diff error %v", err, tt.wantDiff)
+			}
+			if tt.sshError == nil && !tt.noFile && executedCmd != "/export terse" {
+				t.Errorf("executed command = %q, want /export terse", executedCmd)
+			}
+			output := buf.String()
+			if !strings.Contains(output, fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/export"
+	"jb.favre/mikrotik-fleet-autopilot/core"
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+var showSensitive bool
+var configDir string
+var archiveLayout string
+var passphrase string
+var identity string
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// errDrift is returned when the live configuration differs from the stored one
+var errDrift = errors.New("configuration drift detected")
+
+// decrypter opens encrypted stored configurations
+var decrypter core.FileDecrypter
+
+// sshConnectionFactory is the factory function for creating SSH connections
+// This can be overridden in tests to inject mock SSH manager
+var sshConnectionFactory = core.CreateConnection
+
+var Command = []*cli.Command{
+	{
+		Name:  "drift",
+		Usage: "Detect configuration drift between routers and their stored .rsc files",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "show-sensitive",
+				Value:       false,
+				Usage:       "Include sensitive information in the live export (use when stored files were exported with --show-sensitive)",
+				Destination: &showSensitive,
+			},
+			&cli.StringFlag{
+				Name:        "config-dir",
+				Value:       ".",
+				Usage:       "Directory where the stored configurations are read from",
+				Destination: &configDir,
+			},
+			&cli.StringFlag{
+				Name:        "archive-layout",
+				Value:       "",
+				Usage:       "Compare with the most recent archive written by export --archive with this layout, instead of <router>.rsc",
+				Destination: &archiveLayout,
+			},
+			&cli.StringFlag{
+				Name:        "passphrase",
+				Value:       "",
+				Usage:       "Passphrase the stored configurations were encrypted with",
+				Sources:     cli.EnvVars("MIKROTIK_EXPORT_PASSPHRASE"),
+				Destination: &passphrase,
+			},
+			&cli.StringFlag{
+				Name:        "identity",
+				Value:       "",
+				Usage:       "X25519 private key (PEM file or base64) the stored configurations were encrypted to",
+				Destination: &identity,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			cfg, err := core.GetConfig(ctx)
+			if err != nil {
+				slog.Debug("failed to get global config", "error", err)
+				return err
+			}
+			decrypter = core.FileDecrypter{Passphrase: passphrase}
+			if identity != "" {
+				if decrypter.PublicKey, decrypter.PrivateKey, err = core.ParseIdentity(identity); err != nil {
+					return err
+				}
+			}
+
+			// Process all hosts, failures on one host don't stop the others
+			results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, drift)
+			core.GetReporter(ctx).Summary(results)
+			return results.Err()
+		},
+	},
+}
+
+func drift(ctx context.Context, host string) error {
+	slog.Info("checking configuration drift", "host", host)
+	reporter := core.GetReporter(ctx)
+	start := time.Now()
+
+	// Read stored configuration first, no need to connect if it's missing
+	storedFile, stored, err := readStored(ctx, host)
+	if err != nil {
+		slog.Error("failed to read stored configuration", "host", host, "file", storedFile, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "drift",
+			Status:   core.StatusFailed,
+			File:     storedFile,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Stored configuration %s not readable: %v", host, storedFile, err),
+		})
+		return fmt.Errorf("failed to read stored configuration: %w", err)
+	}
+	// Secrets of redacted configurations can only be compared once redacted on both sides
+	redacted := core.IsRedacted(stored)
+
+	slog.Debug("initializing SSH connection", "host", host)
+	conn, err := sshConnectionFactory(ctx, host)
+	if err != nil {
+		slog.Error("failed to create SSH connection", "host", host, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "drift",
+			Status:   core.StatusUnreachable,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❓ %s is unreachable", host),
+		})
+		return fmt.Errorf("failed to create SSH connection: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	live, err := export.FetchConfig(ctx, conn, showSensitive || redacted)
+	if err != nil {
+		slog.Error("failed to export configuration", "host", host, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "drift",
+			Status:   core.StatusFailed,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Export failed", host),
+		})
+		return fmt.Errorf("failed to export configuration: %w", err)
+	}
+
+	if redacted {
+		stored, _, _ = core.Redactor{}.Redact(stored)
+		live, _, _ = core.Redactor{}.Redact(live)
+	}
+
+	var diff string
+	storedCommands, err := normalizeExport(stored)
+	if err == nil {
+		var liveCommands []string
+		if liveCommands, err = normalizeExport(live); err == nil {
+			diff = core.UnifiedDiff(storedFile, host+" (live)", storedCommands, liveCommands, diffContext)
+		}
+	}
+	if err != nil {
+		slog.Error("failed to parse configuration", "host", host, "error", err)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "drift",
+			Status:   core.StatusFailed,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Failed to parse configuration", host),
+		})
+		return fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	if diff == "" {
+		slog.Info("no configuration drift", "host", host)
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "drift",
+			Status:   core.StatusInSync,
+			File:     storedFile,
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("✅ %s: Configuration matches %s", host, storedFile),
+		})
+		return nil
+	}
+
+	slog.Warn("configuration drift detected", "host", host, "file", storedFile)
+	reporter.Report(core.Result{
+		Host:     host,
+		Command:  "drift",
+		Status:   core.StatusDrift,
+		File:     storedFile,
+		Diff:     diff,
+		Duration: time.Since(start),
+		Message:  fmt.Sprintf("⚠️  %s: Configuration drift detected\n%s", host, diff),
+	})
+	return errDrift
+}
+
+// readStored returns the path and the content of the stored configuration of a host:
+// <router>.rsc, its encrypted <router>.rsc.enc counterpart, or the most recent archive
+// with --archive-layout. Encrypted files are decrypted with --passphrase or --identity.
+func readStored(ctx context.Context, host string) (string, string, error) {
+	dir := export.ConfigDir(ctx, host, configDir)
+	shortName := core.ParseHost(host).ShortName
+	file := filepath.Join(dir, fmt.Sprintf("%s.rsc", shortName))
+	if archiveLayout != "" {
+		latest, err := export.LatestArchive(dir, archiveLayout, shortName)
+		if err != nil {
+			return dir, "", err
+		}
+		file = latest
+	} else if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(file + core.EncryptedExt); err == nil {
+			file += core.EncryptedExt
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return file, "", err
+	}
+	if core.IsEncrypted(data) {
+		if decrypter.Passphrase == "" && decrypter.PrivateKey == nil {
+			return file, "", fmt.Errorf("file is encrypted, --passphrase or --identity is required")
+		}
+		if data, err = decrypter.Decrypt(data); err != nil {
+			return file, "", err
+		}
+	}
+	return file, string(data), nil
+}
+
+// normalizeExport prints the commands of an export (terse or not) one per line with their
+// menu path, as the rsc printer does, so that two exports of the same configuration compare
+// equal: comments and line continuations are dropped, quoted values are kept as they are.
+// Commands are sorted within each menu, menus keep their order of appearance.
+func normalizeExport(export string) ([]string, error) {
+	script, err := rsc.Parse(export)
+	if err != nil {
+		return nil, err
+	}
+	var menus []string
+	commands := map[string][]string{}
+	for _, statement := range rsc.Resolve(script) {
+		menu := ""
+		if command, ok := statement.(*rsc.Command); ok && command.Absolute {
+			menu = strings.Join(command.Path, " ")
+		}
+		if _, ok := commands[menu]; !ok {
+			menus = append(menus, menu)
+		}
+		commands[menu] = append(commands[menu], statement.String())
+	}
+
+	var normalized []string
+	for _, menu := range menus {
+		slices.Sort(commands[menu])
+		normalized = append(normalized, commands[menu]...)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,377 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// MockSshRunner is a mock implementation of SshRunner for testing
+type MockSshRunner struct {
+	CloseFunc                func() error
+	IsAlreadyClosedErrorFunc func(err error) bool
+	RunFunc                  func(cmd string) (string, error)
+}
+
+func (m *MockSshRunner) Close() error {
+	if m.CloseFunc != nil {
+		return m.CloseFunc()
+	}
+	return nil
+}
+
+func (m *MockSshRunner) IsAlreadyClosedError(err error) bool {
+	if m.IsAlreadyClosedErrorFunc != nil {
+		return m.IsAlreadyClosedErrorFunc(err)
+	}
+	return false
+}
+
+func (m *MockSshRunner) Run(cmd string) (string, error) {
+	if m.RunFunc != nil {
+		return m.RunFunc(cmd)
+	}
+	return "", nil
+}
+
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	return m.Run(cmd)
+}
+
+func TestDrift(t *testing.T) {
+	tests := []struct {
+		name         string
+		host         string
+		stored       string
+		noStoredFile bool
+		live         string
+		sshError     error
+		runError     error
+		wantErr      bool
+		wantDrift    bool
+		wantStatus   string
+		wantInOutput []string
+	}{
+		{
+			name:       "no drift",
+			host:       "router1",
+			stored:     "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge add name=bridge1\n",
+			live:       "# 2024-01-03 08:00:00 by RouterOS 7.13\r\n/interface bridge add name=bridge1\r\n",
+			wantStatus: core.StatusInSync,
+		},
+		{
+			name:       "no drift between non-terse stored file and terse export",
+			host:       "router1.home.local",
+			stored:     "/interface bridge\nadd name=bridge1\nadd name=bridge2\n",
+			live:       "/interface bridge add name=bridge2\n/interface bridge add name=bridge1\n",
+			wantStatus: core.StatusInSync,
+		},
+		{
+			name:         "drift detected",
+			host:         "router1",
+			stored:       "/interface bridge add name=bridge1\n/ip dns set servers=1.1.1.1\n",
+			live:         "/interface bridge add name=bridge1\n/ip dns set servers=8.8.8.8\n",
+			wantErr:      true,
+			wantDrift:    true,
+			wantStatus:   core.StatusDrift,
+			wantInOutput: []string{"Configuration drift detected", "-/ip dns set servers=1.1.1.1", "+/ip dns set servers=8.8.8.8"},
+		},
+		{
+			name:         "missing stored file",
+			host:         "router1",
+			noStoredFile: true,
+			wantErr:      true,
+			wantStatus:   core.StatusFailed,
+		},
+		{
+			name:       "SSH connection fails",
+			host:       "router1",
+			stored:     "/interface bridge add name=bridge1\n",
+			sshError:   fmt.Errorf("connection refused"),
+			wantErr:    true,
+			wantStatus: core.StatusUnreachable,
+		},
+		{
+			name:       "export command fails",
+			host:       "router1",
+			stored:     "/interface bridge add name=bridge1\n",
+			runError:   fmt.Errorf("session closed"),
+			wantErr:    true,
+			wantStatus: core.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalConfigDir := configDir
+			configDir = tmpDir
+			defer func() { configDir = originalConfigDir }()
+
+			if !tt.noStoredFile {
+				storedFile := filepath.Join(tmpDir, core.ParseHost(tt.host).ShortName+".rsc")
+				if err := os.WriteFile(storedFile, []byte(tt.stored), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var executedCmd string
+			originalFactory := sshConnectionFactory
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				if tt.sshError != nil {
+					return nil, tt.sshError
+				}
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						executedCmd = cmd
+						return tt.live, tt.runError
+					},
+				}, nil
+			}
+			defer func() { sshConnectionFactory = originalFactory }()
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+
+			err := drift(ctx, tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("drift() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, errDrift) != tt.wantDrift {
+				t.Errorf("drift() error = %v, want drift error %v", err, tt.wantDrift)
+			}
+			if tt.sshError == nil && !tt.noStoredFile && executedCmd != "/export terse" {
+				t.Errorf("executed command = %q, want /export terse", executedCmd)
+			}
+
+			output := buf.String()
+			if !strings.Contains(output, fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, output)
+			}
+
+			// Text rendering includes the diff
+			if len(tt.wantInOutput) > 0 {
+				var text bytes.Buffer
+				ctx = context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputText, &text))
+				_ = drift(ctx, tt.host)
+				for _, want := range tt.wantInOutput {
+					if !strings.Contains(text.String(), want) {
+						t.Errorf("text output missing %q:\n%s", want, text.String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDriftStoredFormats(t *testing.T) {
+	const live = "/user\nadd name=backup password=s3cret\n"
+
+	tests := []struct {
+		name          string
+		files         map[string]string
+		encrypt       bool
+		passphrase    string
+		archiveLayout string
+		wantStatus    string
+		wantFile      string
+		wantCmd       string
+		wantInOutput  string
+	}{
+		{
+			name:       "encrypted export",
+			files:      map[string]string{"router1.rsc.enc": live},
+			encrypt:    true,
+			passphrase: "correct horse",
+			wantStatus: core.StatusInSync,
+			wantFile:   "router1.rsc.enc",
+			wantCmd:    "/export terse",
+		},
+		{
+			name:         "encrypted export without passphrase",
+			files:        map[string]string{"router1.rsc.enc": live},
+			encrypt:      true,
+			wantStatus:   core.StatusFailed,
+			wantInOutput: "--passphrase or --identity is required",
+		},
+		{
+			name:       "redacted export",
+			files:      map[string]string{"router1.rsc": "/user\nadd name=backup password=\"REDACTED\"\n"},
+			wantStatus: core.StatusInSync,
+			wantFile:   "router1.rsc",
+			wantCmd:    "/export terse show-sensitive",
+		},
+		{
+			name: "most recent archive",
+			files: map[string]string{
+				"router1/2024-01-01/router1-080000.rsc": "/user\nadd name=old\n",
+				"router1/2024-01-02/router1-080000.rsc": live,
+			},
+			archiveLayout: "{host}/{date}/{host}-{time}.rsc",
+			wantStatus:    core.StatusInSync,
+			wantFile:      "router1/2024-01-02/router1-080000.rsc",
+			wantCmd:       "/export terse",
+		},
+		{
+			name:          "no archive",
+			archiveLayout: "{host}/{date}/{host}-{time}.rsc",
+			wantStatus:    core.StatusFailed,
+			wantInOutput:  "no archive of router1 found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalConfigDir, originalLayout, originalDecrypter, originalShowSensitive := configDir, archiveLayout, decrypter, showSensitive
+			defer func() {
+				configDir, archiveLayout, decrypter, showSensitive = originalConfigDir, originalLayout, originalDecrypter, originalShowSensitive
+			}()
+			configDir, archiveLayout, showSensitive = tmpDir, tt.archiveLayout, false
+			decrypter = core.FileDecrypter{Passphrase: tt.passphrase}
+
+			for name, content := range tt.files {
+				data := []byte(content)
+				if tt.encrypt {
+					var err error
+					if data, err = (core.FileEncrypter{Passphrase: "correct horse"}).Encrypt(data); err != nil {
+						t.Fatal(err)
+					}
+				}
+				path := filepath.Join(tmpDir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var executedCmd string
+			originalFactory := sshConnectionFactory
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						executedCmd = cmd
+						return live, nil
+					},
+				}, nil
+			}
+			defer func() { sshConnectionFactory = originalFactory }()
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+			err := drift(ctx, "router1")
+			if (err != nil) != (tt.wantStatus != core.StatusInSync) {
+				t.Fatalf("drift() error = %v, want status %s", err, tt.wantStatus)
+			}
+
+			output := buf.String()
+			if !strings.Contains(output, fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, output)
+			}
+			if tt.wantFile != "" && !strings.Contains(output, fmt.Sprintf(`"file":%q`, filepath.Join(tmpDir, filepath.FromSlash(tt.wantFile)))) {
+				t.Errorf("result file should be %s, got %s", tt.wantFile, output)
+			}
+			if executedCmd != tt.wantCmd {
+				t.Errorf("executed command = %q, want %q", executedCmd, tt.wantCmd)
+			}
+			if !strings.Contains(output, tt.wantInOutput) {
+				t.Errorf("output should contain %q, got %s", tt.wantInOutput, output)
+			}
+		})
+	}
+}
+
+func TestNormalizeExport(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+		want   []string
+	}{
+		{
+			name:   "empty export",
+			export: "",
+			want:   nil,
+		},
+		{
+			name:   "header comments are dropped",
+			export: "# 2024-01-02 12:34:56 by RouterOS 7.13\n# software id = ABCD-1234\n/system identity set name=router1\n",
+			want:   []string{"/system identity set name=router1"},
+		},
+		{
+			name:   "CRLF line endings",
+			export: "/system identity set name=router1\r\n/ip dns set servers=1.1.1.1\r\n",
+			want:   []string{"/system identity set name=router1", "/ip dns set servers=1.1.1.1"},
+		},
+		{
+			name:   "non-terse export is converted to terse commands",
+			export: "/interface bridge\nadd name=bridge1\n/ip address\nadd address=192.168.1.1/24 interface=bridge1\n",
+			want: []string{
+				"/interface bridge add name=bridge1",
+				"/ip address add address=192.168.1.1/24 interface=bridge1",
+			},
+		},
+		{
+			name:   "line continuations are joined",
+			export: "/ip address\nadd address=192.168.1.1/24 \\\n    interface=bridge1\n",
+			want:   []string{"/ip address add address=192.168.1.1/24 interface=bridge1"},
+		},
+		{
+			name: "commands are sorted within a menu, menus keep their order",
+			export: `/interface bridge add name=bridge2
+/ip address add address=10.0.0.1/24 interface=bridge2
+/interface bridge add name=bridge1
+/ip address add address=10.0.0.2/24 interface=bridge1`,
+			want: []string{
+				"/interface bridge add name=bridge1",
+				"/interface bridge add name=bridge2",
+				"/ip address add address=10.0.0.1/24 interface=bridge2",
+				"/ip address add address=10.0.0.2/24 interface=bridge1",
+			},
+		},
+		{
+			name:   "extra whitespace is collapsed outside quoted values",
+			export: "/system   identity   set  name=router1 comment=\"a  b\"  \n",
+			want:   []string{`/system identity set name=router1 comment="a  b"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeExport(tt.export)
+			if err != nil {
+				t.Fatalf("normalizeExport() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeExport() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeExportTerseAndNonTerseMatch(t *testing.T) {
+	terse := "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge add name=bridge1\n/ip address add address=192.168.1.1/24 interface=bridge1\n"
+	nonTerse := "# 2024-01-03 08:00:00 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n/ip address\nadd address=192.168.1.1/24 interface=bridge1\n"
+
+	got, _ := normalizeExport(terse)
+	want, _ := normalizeExport(nonTerse)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("terse and non-terse exports should normalize identically:\n%q\n%q", got, want)
+	}
+
+	// Whitespace inside quoted values is a real change
+	spaced, _ := normalizeExport(`/interface bridge add name=bridge1 comment="a  b"`)
+	single, _ := normalizeExport(`/interface bridge add name=bridge1 comment="a b"`)
+	if reflect.DeepEqual(spaced, single) {
+		t.Error("whitespace inside quoted values should not be collapsed")
+	}
+}
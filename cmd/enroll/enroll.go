@@ -1,17 +1,19 @@
 package enroll
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	"jb.favre/mikrotik-fleet-autopilot/cmd/export"
 	"jb.favre/mikrotik-fleet-autopilot/cmd/updates"
 	"jb.favre/mikrotik-fleet-autopilot/core"
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
 )
 
 var hostname string
@@ -105,6 +107,7 @@ var Command = []*cli.Command{
 			// Set enrollment mode in context to allow host key capture
 			ctx = context.WithValue(ctx, core.EnrollmentModeKey, true)
 			slog.Debug("enrollment mode enabled in context")
+			reporter := core.GetReporter(ctx)
 
 			// Handle update-hostkey-only mode (supports batch processing)
 			if updateHostKeyOnly {
@@ -112,29 +115,39 @@ var Command = []*cli.Command{
 				if len(cfg.Hosts) > 1 {
 					slog.Info("batch updating SSH host keys", "count", len(cfg.Hosts))
 
-					successCount := 0
-					failCount := 0
-					var lastErr error
-
-					for _, host := range cfg.Hosts {
+					results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, func(ctx context.Context, host string) error {
+						start := time.Now()
 						fingerprint, err := updateHostKey(ctx, host)
 						if err != nil {
 							slog.Error("host key update failed", "host", host, "error", err)
-							fmt.Printf("❌ %s: Host key update failed\n", host)
-							failCount++
-							lastErr = err
-							// Continue with other hosts
-						} else {
-							slog.Info("host key update completed successfully", "host", host)
-							fmt.Printf("✅ %s: Host key updated (%s)\n", host, fingerprint)
-							successCount++
+							reporter.Report(core.Result{
+								Host:     host,
+								Command:  "enroll",
+								Status:   core.StatusFailed,
+								Error:    err.Error(),
+								Duration: time.Since(start),
+								Message:  fmt.Sprintf("❌ %s: Host key update failed", host),
+							})
+							return err
 						}
-					}
-
-					if failCount > 0 && successCount == 0 {
+						slog.Info("host key update completed successfully", "host", host)
+						reporter.Report(core.Result{
+							Host:        host,
+							Command:     "enroll",
+							Status:      core.StatusOK,
+							Fingerprint: fingerprint,
+							Duration:    time.Since(start),
+							Message:     fmt.Sprintf("✅ %s: Host key updated (%s)", host, fingerprint),
+						})
+						return nil
+					})
+					reporter.Summary(results)
+
+					failCount := results.Failed()
+					if failCount > 0 && failCount == len(results) {
 						return fmt.Errorf("all host key updates failed")
 					} else if failCount > 0 {
-						return fmt.Errorf("some host key updates failed: %w", lastErr)
+						return fmt.Errorf("some host key updates failed: %w", results.Err())
 					}
 					return nil
 				}
@@ -146,14 +159,29 @@ var Command = []*cli.Command{
 
 				host := cfg.Hosts[0]
 				slog.Info("updating SSH host key only", "host", host)
+				start := time.Now()
 				fingerprint, err := updateHostKey(ctx, host)
 				if err != nil {
 					slog.Error("host key update failed", "host", host, "error", err)
-					fmt.Printf("❌ Host key update failed\n")
+					reporter.Report(core.Result{
+						Host:     host,
+						Command:  "enroll",
+						Status:   core.StatusFailed,
+						Error:    err.Error(),
+						Duration: time.Since(start),
+						Message:  "❌ Host key update failed",
+					})
 					return err
 				}
 				slog.Info("host key update completed successfully", "host", host)
-				fmt.Printf("✅ Host key updated (%s)\n", fingerprint)
+				reporter.Report(core.Result{
+					Host:        host,
+					Command:     "enroll",
+					Status:      core.StatusOK,
+					Fingerprint: fingerprint,
+					Duration:    time.Since(start),
+					Message:     fmt.Sprintf("✅ Host key updated (%s)", fingerprint),
+				})
 				return nil
 			}
 
@@ -172,35 +200,65 @@ var Command = []*cli.Command{
 			// Handle force re-enrollment
 			if force {
 				slog.Info("force re-enrollment requested", "host", host)
-				if err := deleteExistingEnrollment(host); err != nil {
+				if err := deleteExistingEnrollment(ctx, host); err != nil {
 					slog.Error("failed to remove existing enrollment", "host", host, "error", err)
 					return fmt.Errorf("failed to remove existing enrollment: %w", err)
 				}
 			}
 
 			// Perform normal enrollment
+			start := time.Now()
 			if err := enroll(ctx, host); err != nil {
 				slog.Error("enrollment failed", "host", host, "error", err)
-				fmt.Printf("❌ Enrollment failed\n")
-			} else {
-				slog.Info("enrollment completed successfully", "host", host)
-				fmt.Printf("✅ Enrollment completed successfully\n")
+				reporter.Report(core.Result{
+					Host:     host,
+					Command:  "enroll",
+					Status:   core.StatusFailed,
+					Error:    err.Error(),
+					Duration: time.Since(start),
+					Message:  "❌ Enrollment failed",
+				})
+				return err
 			}
-
-			return err
+			slog.Info("enrollment completed successfully", "host", host)
+			result := core.Result{
+				Host:     host,
+				Command:  "enroll",
+				Status:   core.StatusOK,
+				Duration: time.Since(start),
+				Message:  "✅ Enrollment completed successfully",
+			}
+			if !skipExport {
+				result.File = filepath.Join(outputDir, hostname+".rsc")
+			}
+			reporter.Report(result)
+			return nil
 		},
 	},
 }
 
 func enroll(ctx context.Context, host string) error {
 	slog.Info("starting enrollment", "host", host)
+	reporter := core.GetReporter(ctx)
+
+	// Inventory may override enrollment scripts per host
+	preScript, postScript := preEnrollScript, postEnrollScript
+	if cfg, err := core.GetConfig(ctx); err == nil {
+		overrides := cfg.HostOverrides(host)
+		if overrides.PreEnrollScript != "" {
+			preScript = overrides.PreEnrollScript
+		}
+		if overrides.PostEnrollScript != "" {
+			postScript = overrides.PostEnrollScript
+		}
+	}
 
 	// Connect to router
 	slog.Debug("connecting to router", "host", host)
 	conn, err := sshConnectionFactory(ctx, host)
 	if err != nil {
 		slog.Error("failed to connect to router", "host", host, "error", err)
-		fmt.Printf("❌ Failed to connect\n")
+		reporter.Progress(host, "❌ Failed to connect")
 		return fmt.Errorf("failed to connect to router: %w", err)
 	}
 	defer func() {
@@ -210,117 +268,113 @@ func enroll(ctx context.Context, host string) error {
 
 	// Step 1: Apply pre-enroll configuration file
 	slog.Debug("applying pre-enroll configuration file")
-	if err := applyConfigFile(conn, preEnrollScript); err != nil {
+	if err := applyConfigFile(ctx, conn, preScript); err != nil {
 		slog.Error("failed to apply pre-enroll configuration file", "error", err)
-		fmt.Printf("❌ Pre-enroll configuration failed\n")
+		reporter.Progress(host, "❌ Pre-enroll configuration failed")
 		return fmt.Errorf("failed to apply pre-enroll configuration file: %w", err)
 	}
 	slog.Debug("pre-enroll configuration applied")
-	fmt.Printf("✅ Pre-enroll configuration applied\n")
+	reporter.Progress(host, "✅ Pre-enroll configuration applied")
 
 	// Step 2: Set router identity
 	slog.Debug("setting router identity", "hostname", hostname)
-	if err := setRouterIdentity(conn, hostname); err != nil {
+	if err := setRouterIdentity(ctx, conn, hostname); err != nil {
 		slog.Error("failed to set router identity", "error", err)
-		fmt.Printf("❌ Identity set failed\n")
+		reporter.Progress(host, "❌ Identity set failed")
 		return fmt.Errorf("failed to set router identity: %w", err)
 	}
 	slog.Debug("router identity set", "host", host, "hostname", hostname)
-	fmt.Printf("✅ Router identity set\n")
+	reporter.Progress(host, "✅ Router identity set")
 
 	// Step 3: Apply updates (unless skipped)
 	if !skipUpdates {
 		slog.Debug("checking and applying updates", "host", host)
 		if err := applyUpdatesFunc(ctx, host); err != nil {
 			slog.Error("failed to apply updates", "host", host, "error", err)
-			fmt.Printf("⚠️  Updates failed (non-fatal)\n")
+			reporter.Progress(host, "⚠️  Updates failed (non-fatal)")
 			// Non fatal error, no return
 		}
 		// No need for a specific status here since it's already managed by the updates subcommand
 	} else {
 		slog.Debug("skipping updates")
-		fmt.Printf("❓ Updates skipped\n")
+		reporter.Progress(host, "❓ Updates skipped")
 	}
 
 	// Step 4: Export configuration (unless skipped)
-	// Export properly manages its own SSH connection
+	// Export shares the pooled SSH connection of the host
 	if !skipExport {
 		slog.Debug("exporting final configuration", "host", host)
 		if err := exportConfigFunc(ctx, host, outputDir, false, hostname); err != nil {
 			slog.Error("failed to export configuration", "host", host, "error", err)
+			reporter.Progress(host, "❌ Export failed")
 			return fmt.Errorf("failed to export configuration: %w", err)
 		}
-		// Export closes its SSH connection, invalidating our SSH connection
-		// Recreate the connection to ensure subsequent steps work properly
-		slog.Debug("recreating SSH connection after export", "host", host)
-		_ = conn.Close()
-		conn, err = sshConnectionFactory(ctx, host)
-		if err != nil {
-			slog.Error("failed to reconnect after export", "host", host, "error", err)
-			return fmt.Errorf("failed to reconnect after export: %w", err)
-		}
-		slog.Debug("reconnected after export", "host", host)
-		// No need for a specific status here since it's already managed by the export subcommand
+		// Export reports nothing, the enrollment is the single result of the host
+		reporter.Progress(host, "✅ Configuration exported")
 	} else {
 		slog.Debug("skipping export")
-		fmt.Printf("❓ Export skipped\n")
+		reporter.Progress(host, "❓ Export skipped")
 	}
 
 	// Step 5: Apply post-enroll configuration file
 	slog.Debug("applying post-enroll configuration file")
-	if err := applyConfigFile(conn, postEnrollScript); err != nil {
+	if err := applyConfigFile(ctx, conn, postScript); err != nil {
 		slog.Error("failed to apply post-enroll configuration file", "error", err)
-		fmt.Printf("❌ Post-enroll configuration failed\n")
+		reporter.Progress(host, "❌ Post-enroll configuration failed")
 		return fmt.Errorf("failed to apply post-enroll configuration file: %w", err)
 	}
 	slog.Debug("post-enroll configuration file applied")
-	fmt.Printf("✅ Post-enroll configuration applied\n")
+	reporter.Progress(host, "✅ Post-enroll configuration applied")
 
 	return nil
 }
 
-// applyConfigFile reads and executes RouterOS commands from a file
-func applyConfigFile(conn core.SshRunner, filePath string) error {
-	// Read file
-	file, err := os.Open(filePath)
+// applyConfigFile reads and executes RouterOS commands from a file. The file is parsed as a
+// RouterOS script: continued lines and multi-line blocks run as a single command, commands
+// following a menu line run in that menu.
+func applyConfigFile(ctx context.Context, conn core.SshRunner, filePath string) error {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open config file %s: %w", filePath, err)
 	}
-	defer func() {
-		_ = file.Close()
-	}()
-
-	// Parse and execute commands line by line
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+	script, err := rsc.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", filePath, err)
+	}
 
-		slog.Debug("executing command", "line", lineNum, "command", line)
-		_, err := conn.Run(line)
+	for _, statement := range rsc.Resolve(script) {
+		lineNum := statement.Pos().Line
+		command := statement.String()
+		// Config files may set passwords, keep them out of logs and errors
+		logged := core.RedactCommand(command)
+		slog.Debug("executing command", "line", lineNum, "command", logged)
+		_, err := conn.RunContext(ctx, command)
 		if err != nil {
-			return fmt.Errorf("failed to execute command at line %d (%s): %w", lineNum, line, err)
+			// Keep what RouterOS printed, it tells why the command was rejected
+			var remoteErr *core.RemoteCommandError
+			if errors.As(err, &remoteErr) {
+				slog.Error("RouterOS rejected command", "line", lineNum, "command", logged,
+					"exitCode", remoteErr.Result.ExitCode, "stderr", remoteErr.Result.Stderr, "stdout", remoteErr.Result.Stdout)
+			}
+			return fmt.Errorf("failed to execute command at line %d (%s): %w", lineNum, logged, err)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading config file: %w", err)
-	}
-
 	return nil
 }
 
 // setRouterIdentity sets the system identity (hostname) on the router
-func setRouterIdentity(conn core.SshRunner, hostname string) error {
+func setRouterIdentity(ctx context.Context, conn core.SshRunner, hostname string) error {
+	if caller, ok := conn.(core.RESTCaller); ok {
+		slog.Debug("setting identity over REST API", "hostname", hostname)
+		if err := core.SetIdentity(ctx, caller, hostname); err != nil {
+			return fmt.Errorf("failed to set identity: %w", err)
+		}
+		return nil
+	}
 	cmd := fmt.Sprintf("/system identity set name=%s", hostname)
 	slog.Debug("setting identity with command", "hostname", hostname, "command", cmd)
-	_, err := conn.Run(cmd)
+	_, err := conn.RunContext(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to set identity: %w", err)
 	}
@@ -374,7 +428,8 @@ func updateHostKey(ctx context.Context, host string) (string, error) {
 }
 
 // deleteExistingEnrollment removes all enrollment artifacts for a host
-func deleteExistingEnrollment(host string) error {
+func deleteExistingEnrollment(ctx context.Context, host string) error {
+	reporter := core.GetReporter(ctx)
 	slog.Info("deleting existing enrollment artifacts", "host", host)
 
 	// Delete host key
@@ -384,7 +439,17 @@ func deleteExistingEnrollment(host string) error {
 			slog.Error("failed to delete host key", "host", host, "error", err)
 			return fmt.Errorf("failed to delete host key: %w", err)
 		}
-		fmt.Printf("Removed existing host key for %s\n", host)
+		reporter.Progress(host, fmt.Sprintf("Removed existing host key for %s", host))
+	}
+
+	// Delete pinned REST API certificate
+	if core.HostCertExists(host) {
+		slog.Debug("deleting certificate pin", "host", host)
+		if err := core.DeleteHostCert(host); err != nil {
+			slog.Error("failed to delete certificate pin", "host", host, "error", err)
+			return fmt.Errorf("failed to delete certificate pin: %w", err)
+		}
+		reporter.Progress(host, fmt.Sprintf("Removed existing certificate pin for %s", host))
 	}
 
 	// Delete config file
@@ -396,7 +461,7 @@ func deleteExistingEnrollment(host string) error {
 			slog.Error("failed to delete config file", "file", configFile, "error", err)
 			return fmt.Errorf("failed to delete config file: %w", err)
 		}
-		fmt.Printf("Removed existing config file %s\n", configFile)
+		reporter.Progress(host, fmt.Sprintf("Removed existing config file %s", configFile))
 	}
 
 	slog.Info("existing enrollment artifacts deleted", "host", host)
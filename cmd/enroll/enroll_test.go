@@ -50,6 +50,10 @@ func (m *MockSshRunner) Run(cmd string) (string, error) {
 	return "", nil
 }
 
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	return m.Run(cmd)
+}
+
 func TestApplyConfigFile(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -89,12 +93,36 @@ func TestApplyConfigFile(t *testing.T) {
 				"/ip address add address=192.168.1.1/24 interface=bridge1",
 			},
 		},
+		{
+			name: "continued lines, menus and blocks",
+			configContent: `/ip address
+add address=192.168.1.1/24 comment=\
+    "management" interface=bridge1
+:if ([:len [/interface find name=wg0]] = 0) do={
+    /interface wireguard add name=wg0
+}
+`,
+			runFunc: func(cmd string) (string, error) {
+				return "", nil
+			},
+			wantErr: false,
+			expectedCmds: []string{
+				`/ip address add address=192.168.1.1/24 comment="management" interface=bridge1`,
+				":if ([:len [/interface find name=wg0]] = 0) do={ /interface wireguard add name=wg0 }",
+			},
+		},
+		{
+			name:          "syntax error",
+			configContent: "/interface bridge add name=bridge1\n:if (true) do={\n",
+			wantErr:       true,
+			errContains:   "failed to parse config file",
+		},
 		{
 			name: "command execution error",
 			configContent: `/interface bridge add name=bridge1
-/invalid command here`,
+/ip address add address=invalid`,
 			runFunc: func(cmd string) (string, error) {
-				if cmd == "/invalid command here" {
+				if cmd == "/ip address add address=invalid" {
 					return "", fmt.Errorf("syntax error")
 				}
 				return "", nil
@@ -102,6 +130,18 @@ func TestApplyConfigFile(t *testing.T) {
 			wantErr:     true,
 			errContains: "failed to execute command at line 2",
 		},
+		{
+			name:          "RouterOS error text is reported",
+			configContent: `/interface bridge add nme=bridge1`,
+			runFunc: func(cmd string) (string, error) {
+				return "", &core.RemoteCommandError{Command: cmd, Result: core.CommandResult{
+					Stderr:   "expected end of command (line 1 column 24)\n",
+					ExitCode: 1,
+				}}
+			},
+			wantErr:     true,
+			errContains: "line 1 (/interface bridge add nme=bridge1): failed to run command: exit status 1: expected end of command (line 1 column 24)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -120,7 +160,7 @@ func TestApplyConfigFile(t *testing.T) {
 			}
 
 			// Test applyConfigFile
-			err = applyConfigFile(mockConn, configFile)
+			err = applyConfigFile(context.Background(), mockConn, configFile)
 
 			// Check error expectation
 			if (err != nil) != tt.wantErr {
@@ -155,7 +195,7 @@ func TestApplyConfigFile(t *testing.T) {
 
 func TestApplyConfigFileInvalidFile(t *testing.T) {
 	mockConn := &MockSshRunner{}
-	err := applyConfigFile(mockConn, "/nonexistent/file.rsc")
+	err := applyConfigFile(context.Background(), mockConn, "/nonexistent/file.rsc")
 	if err == nil {
 		t.Error("applyConfigFile() should fail with nonexistent file")
 	}
@@ -199,7 +239,7 @@ func TestSetRouterIdentity(t *testing.T) {
 				RunFunc: tt.runFunc,
 			}
 
-			err := setRouterIdentity(mockConn, tt.hostname)
+			err := setRouterIdentity(context.Background(), mockConn, tt.hostname)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("setRouterIdentity() error = %v, wantErr %v", err, tt.wantErr)
@@ -392,7 +432,7 @@ func TestEnroll(t *testing.T) {
 			setupPreConfig: func() string {
 				tmpDir := os.TempDir()
 				configFile := filepath.Join(tmpDir, "test-pre-enroll-configerr.rsc")
-				_ = os.WriteFile(configFile, []byte("/invalid command"), 0644)
+				_ = os.WriteFile(configFile, []byte("/system note set invalid=pre"), 0644)
 				return configFile
 			},
 			setupPostConfig: func() string {
@@ -402,7 +442,7 @@ func TestEnroll(t *testing.T) {
 				return configFile
 			},
 			commandErrors: map[string]error{
-				"/invalid command": fmt.Errorf("syntax error"),
+				"/system note set invalid=pre": fmt.Errorf("syntax error"),
 			},
 			wantErr:     true,
 			errContains: "failed to apply pre-enroll configuration file",
@@ -446,11 +486,11 @@ func TestEnroll(t *testing.T) {
 			setupPostConfig: func() string {
 				tmpDir := os.TempDir()
 				configFile := filepath.Join(tmpDir, "test-post-enroll-post-configerr.rsc")
-				_ = os.WriteFile(configFile, []byte("/invalid post command"), 0644)
+				_ = os.WriteFile(configFile, []byte("/system note set invalid=post"), 0644)
 				return configFile
 			},
 			commandErrors: map[string]error{
-				"/invalid post command": fmt.Errorf("syntax error"),
+				"/system note set invalid=post": fmt.Errorf("syntax error"),
 			},
 			wantErr:     true,
 			errContains: "failed to apply post-enroll configuration file",
@@ -769,7 +809,7 @@ func TestDeleteExistingEnrollment(t *testing.T) {
 			}
 
 			// Execute
-			err := deleteExistingEnrollment(tt.host)
+			err := deleteExistingEnrollment(context.Background(), tt.host)
 
 			// Verify
 			if (err != nil) != tt.wantErr {
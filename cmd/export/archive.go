@@ -0,0 +1,260 @@
+package export
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// defaultArchiveLayout stores one directory per router and per day
+const defaultArchiveLayout = "{host}/{date}/{host}-{time}.rsc"
+
+// latestLinkName is the symlink to the most recent archive, in the router directory
+// of the layout. Layouts without router directory prefix it with the router name.
+const latestLinkName = "latest.rsc"
+
+// Archive layout placeholders and the time format they stand for
+const (
+	archiveDateFormat = "2006-01-02"
+	archiveTimeFormat = "150405"
+)
+
+// now returns the current time, overridden in tests
+var now = time.Now
+
+// validateArchiveLayout checks the layout identifies the router and the export time
+func validateArchiveLayout(layout string) error {
+	for _, placeholder := range []string{"{host}", "{date}", "{time}"} {
+		if !strings.Contains(layout, placeholder) {
+			return fmt.Errorf("invalid archive layout %q: %s placeholder is required", layout, placeholder)
+		}
+	}
+	if filepath.IsAbs(layout) || strings.HasPrefix(filepath.Clean(layout), "..") {
+		return fmt.Errorf("invalid archive layout %q: must be relative to the output directory", layout)
+	}
+	return nil
+}
+
+// archivePath returns the path of an archive, relative to the output directory
+func archivePath(layout, shortName string, t time.Time) string {
+	return filepath.FromSlash(strings.NewReplacer(
+		"{host}", shortName,
+		"{date}", t.Format(archiveDateFormat),
+		"{time}", t.Format(archiveTimeFormat),
+	).Replace(layout))
+}
+
+// archivePattern returns a regexp matching the archives of a router (slash separated relative paths),
+// encrypted or not, with the date and time as submatches
+func archivePattern(layout, shortName string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	dateSeen, timeSeen := false, false
+	for rest := layout; rest != ""; {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		if start < 0 || end < start {
+			pattern.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		pattern.WriteString(regexp.QuoteMeta(rest[:start]))
+		switch rest[start : end+1] {
+		case "{host}":
+			pattern.WriteString(regexp.QuoteMeta(shortName))
+		case "{date}":
+			pattern.WriteString(placeholderGroup("date", &dateSeen, `\d{4}-\d{2}-\d{2}`))
+		case "{time}":
+			pattern.WriteString(placeholderGroup("time", &timeSeen, `\d{6}`))
+		default:
+			pattern.WriteString(regexp.QuoteMeta(rest[start : end+1]))
+		}
+		rest = rest[end+1:]
+	}
+	pattern.WriteString("(?:" + regexp.QuoteMeta(core.EncryptedExt) + ")?$")
+	return regexp.MustCompile(pattern.String())
+}
+
+// placeholderGroup returns a named group the first time a placeholder is seen.
+// Go regexps have no back-references, later occurrences just match the same format.
+func placeholderGroup(name string, seen *bool, format string) string {
+	if *seen {
+		return format
+	}
+	*seen = true
+	return fmt.Sprintf("(?P<%s>%s)", name, format)
+}
+
+// archive is an export file found in the archive tree
+type archive struct {
+	Path string
+	Time time.Time
+}
+
+// listArchives returns the archives of a router found under dir
+func listArchives(dir, layout, shortName string) ([]archive, error) {
+	pattern := archivePattern(layout, shortName)
+	var archives []archive
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		match := pattern.FindStringSubmatch(filepath.ToSlash(rel))
+		if match == nil {
+			return nil
+		}
+		t, err := time.ParseInLocation(archiveDateFormat+archiveTimeFormat,
+			match[pattern.SubexpIndex("date")]+match[pattern.SubexpIndex("time")], time.Local)
+		if err != nil {
+			return nil
+		}
+		archives = append(archives, archive{Path: path, Time: t})
+		return nil
+	})
+	return archives, err
+}
+
+// LatestArchive returns the most recent archive of a router found under dir, for the given layout
+func LatestArchive(dir, layout, shortName string) (string, error) {
+	if err := validateArchiveLayout(layout); err != nil {
+		return "", err
+	}
+	archives, err := listArchives(dir, layout, shortName)
+	if err != nil {
+		return "", fmt.Errorf("failed to list archives: %w", err)
+	}
+	if len(archives) == 0 {
+		return "", fmt.Errorf("no archive of %s found in %s", shortName, dir)
+	}
+	latest := archives[0]
+	for _, a := range archives[1:] {
+		if a.Time.After(latest.Time) {
+			latest = a
+		}
+	}
+	return latest.Path, nil
+}
+
+// newArchiveFile returns the path of a new archive for a router, creating its directories
+func newArchiveFile(dir, layout, shortName string, t time.Time) (string, error) {
+	path := filepath.Join(dir, archivePath(layout, shortName, t))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return path, nil
+}
+
+// finishArchive points the latest symlink to a new archive and applies the retention policy.
+// Failures are only logged, the export itself succeeded.
+func finishArchive(dir, layout, shortName, path string, policy core.RetentionPolicy) {
+	if err := updateLatestLink(dir, layout, shortName, path); err != nil {
+		slog.Warn("failed to update latest archive link", "router", shortName, "error", err)
+	}
+	deleted, err := pruneArchives(dir, layout, shortName, policy)
+	if err != nil {
+		slog.Warn("failed to apply archive retention", "router", shortName, "error", err)
+	}
+	slog.Debug("archive retention applied", "router", shortName, "deleted", len(deleted))
+}
+
+// latestLinkPath returns the path of the latest symlink of a router: it sits in the last
+// directory of the layout that does not depend on the export time, such as {host} in
+// {host}/{date}/{host}-{time}.rsc. Without {host} in that directory, the link is named
+// after the router: {date}/{host}-{time}.rsc gives <host>-latest.rsc in the output directory.
+func latestLinkPath(dir, layout, shortName string) string {
+	segments := strings.Split(layout, "/")
+	var fixed []string
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.Contains(segment, "{date}") || strings.Contains(segment, "{time}") {
+			break
+		}
+		fixed = append(fixed, segment)
+	}
+	linkDir := strings.Join(fixed, "/")
+	name := latestLinkName
+	if !strings.Contains(linkDir, "{host}") {
+		name = shortName + "-" + latestLinkName
+	}
+	linkDir = strings.ReplaceAll(linkDir, "{host}", shortName)
+	return filepath.Join(dir, filepath.FromSlash(linkDir), name)
+}
+
+// updateLatestLink points the latest symlink of a router to its most recent archive.
+// The link of encrypted archives gets the encrypted extension too.
+func updateLatestLink(dir, layout, shortName, target string) error {
+	link := latestLinkPath(dir, layout, shortName)
+	linkDir := filepath.Dir(link)
+	if err := os.MkdirAll(linkDir, 0755); err != nil {
+		return err
+	}
+	relTarget, err := filepath.Rel(linkDir, target)
+	if err != nil {
+		return err
+	}
+
+	// Replace the link atomically
+	if strings.HasSuffix(target, core.EncryptedExt) {
+		link += core.EncryptedExt
+	}
+	tmp := link + ".tmp"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(relTarget, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, link)
+}
+
+// pruneArchives deletes the archives of a router not kept by the retention policy,
+// and the directories left empty. It returns the deleted files.
+func pruneArchives(dir, layout, shortName string, policy core.RetentionPolicy) ([]string, error) {
+	if policy.IsZero() {
+		return nil, nil
+	}
+	archives, err := listArchives(dir, layout, shortName)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Time, len(archives))
+	for i, a := range archives {
+		times[i] = a.Time
+	}
+	var deleted []string
+	for i, keep := range policy.Keep(times) {
+		if keep {
+			continue
+		}
+		path := archives[i].Path
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		slog.Debug("old archive deleted", "file", path)
+		deleted = append(deleted, path)
+		removeEmptyParents(dir, filepath.Dir(path))
+	}
+	return deleted, nil
+}
+
+// removeEmptyParents removes empty directories from path up to root (excluded)
+func removeEmptyParents(root, path string) {
+	for path != root && strings.HasPrefix(path, root) {
+		if err := os.Remove(path); err != nil {
+			// Not empty (or not removable), stop there
+			return
+		}
+		path = filepath.Dir(path)
+	}
+}
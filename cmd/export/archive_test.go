@@ -0,0 +1,182 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+func TestValidateArchiveLayout(t *testing.T) {
+	tests := []struct {
+		layout  string
+		wantErr bool
+	}{
+		{layout: defaultArchiveLayout},
+		{layout: "{date}/{host}-{time}.rsc"},
+		{layout: "{host}/{host}.rsc", wantErr: true},
+		{layout: "/srv/{host}/{date}/{time}.rsc", wantErr: true},
+		{layout: "../{host}/{date}/{time}.rsc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			if err := validateArchiveLayout(tt.layout); (err != nil) != tt.wantErr {
+				t.Errorf("validateArchiveLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListArchives(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"router1/2024-03-01/router1-101500.rsc",
+		"router1/2024-03-02/router1-090000.rsc",
+		"router10/2024-03-02/router10-090000.rsc",
+		"router1/2024-03-02/notes.txt",
+		"router1.rsc",
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archives, err := listArchives(dir, defaultArchiveLayout, "router1")
+	if err != nil {
+		t.Fatalf("listArchives() error = %v", err)
+	}
+	want := []archive{
+		{Path: filepath.Join(dir, "router1", "2024-03-01", "router1-101500.rsc"), Time: time.Date(2024, 3, 1, 10, 15, 0, 0, time.Local)},
+		{Path: filepath.Join(dir, "router1", "2024-03-02", "router1-090000.rsc"), Time: time.Date(2024, 3, 2, 9, 0, 0, 0, time.Local)},
+	}
+	if len(archives) != len(want) {
+		t.Fatalf("listArchives() = %v, want %v", archives, want)
+	}
+	for i := range want {
+		if archives[i].Path != want[i].Path || !archives[i].Time.Equal(want[i].Time) {
+			t.Errorf("listArchives()[%d] = %v, want %v", i, archives[i], want[i])
+		}
+	}
+}
+
+func TestExportArchiveMode(t *testing.T) {
+	dir := t.TempDir()
+
+	originalDir, originalArchive, originalLayout, originalRetention, originalNow := outputDir, archiveMode, archiveLayout, retention, now
+	originalFactory := sshConnectionFactory
+	defer func() {
+		outputDir, archiveMode, archiveLayout, retention, now = originalDir, originalArchive, originalLayout, originalRetention, originalNow
+		sshConnectionFactory = originalFactory
+	}()
+	outputDir, archiveMode, archiveLayout = dir, true, defaultArchiveLayout
+	retention = core.RetentionPolicy{Last: 1, Daily: 2}
+
+	sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+		return &MockSshRunner{
+			RunFunc: func(cmd string) (string, error) {
+				return "/system identity\nset name=router1\n", nil
+			},
+		}, nil
+	}
+
+	// Four runs over three days: the first day's archives are pruned
+	runs := []time.Time{
+		time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local),
+		time.Date(2024, 3, 2, 10, 0, 0, 0, time.Local),
+		time.Date(2024, 3, 3, 10, 0, 0, 0, time.Local),
+		time.Date(2024, 3, 3, 18, 0, 0, 0, time.Local),
+	}
+	for _, run := range runs {
+		now = func() time.Time { return run }
+		if err := export(context.Background(), "router1", ""); err != nil {
+			t.Fatalf("export() error = %v", err)
+		}
+	}
+
+	archives, err := listArchives(dir, defaultArchiveLayout, "router1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range archives {
+		rel, _ := filepath.Rel(dir, a.Path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"router1/2024-03-02/router1-100000.rsc", "router1/2024-03-03/router1-180000.rsc"}
+	if !slices.Equal(got, want) {
+		t.Errorf("archives = %v, want %v", got, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "router1", "2024-03-01")); !os.IsNotExist(err) {
+		t.Errorf("empty archive directory should be removed, stat error = %v", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dir, "router1", latestLinkName))
+	if err != nil {
+		t.Fatalf("latest link missing: %v", err)
+	}
+	if want := filepath.Join("2024-03-03", "router1-180000.rsc"); target != want {
+		t.Errorf("latest link target = %q, want %q", target, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "router1.rsc")); !os.IsNotExist(err) {
+		t.Error("archive mode should not write router1.rsc")
+	}
+}
+
+func TestLatestLinkPath(t *testing.T) {
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{layout: defaultArchiveLayout, want: "router1/latest.rsc"},
+		{layout: "archives/{host}/{date}/{time}.rsc", want: "archives/router1/latest.rsc"},
+		{layout: "{date}/{host}-{time}.rsc", want: "router1-latest.rsc"},
+		{layout: "{host}-{date}/{time}.rsc", want: "router1-latest.rsc"},
+		{layout: "exports/{date}/{host}/{time}.rsc", want: "exports/router1-latest.rsc"},
+		{layout: "{host}/{host}-{date}-{time}.rsc", want: "router1/latest.rsc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			got := latestLinkPath("out", tt.layout, "router1")
+			if want := filepath.Join("out", filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("latestLinkPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestListArchivesEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "router1", "2024-03-01", "router1-101500.rsc"+core.EncryptedExt)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := listArchives(dir, defaultArchiveLayout, "router1")
+	if err != nil {
+		t.Fatalf("listArchives() error = %v", err)
+	}
+	if len(archives) != 1 || archives[0].Path != path {
+		t.Fatalf("listArchives() = %v, want %s", archives, path)
+	}
+
+	if err := updateLatestLink(dir, defaultArchiveLayout, "router1", path); err != nil {
+		t.Fatalf("updateLatestLink() error = %v", err)
+	}
+	if _, err := os.Readlink(filepath.Join(dir, "router1", latestLinkName+core.EncryptedExt)); err != nil {
+		t.Errorf("encrypted latest link missing: %v", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	"jb.favre/mikrotik-fleet-autopilot/core"
@@ -14,6 +16,22 @@ import (
 
 var showSensitive bool
 var outputDir string
+var gitHistory bool
+var gitAuthor string
+var gitTag string
+var archiveMode bool
+var archiveLayout string
+var retention core.RetentionPolicy
+var redact bool
+var redactRecipient string
+var encryptPassphrase string
+var encryptRecipient string
+
+// recipientKey is the parsed --redact-recipient, secrets are replaced by a placeholder when nil
+var recipientKey *[32]byte
+
+// fileEncrypter encrypts written files when a passphrase or a recipient is configured
+var fileEncrypter core.FileEncrypter
 
 // sshConnectionFactory is the factory function for creating SSH connections
 // This can be overridden in tests to inject mock SSH manager
@@ -36,6 +54,85 @@ var Command = []*cli.Command{
 				Usage:       "Directory where to save the exported configuration",
 				Destination: &outputDir,
 			},
+			&cli.BoolFlag{
+				Name:        "git",
+				Value:       false,
+				Usage:       "Commit changed exports into a git repository in the output directory (initialized if needed)",
+				Destination: &gitHistory,
+			},
+			&cli.StringFlag{
+				Name:        "git-author",
+				Value:       defaultGitAuthor,
+				Usage:       "Author of the git history commits, as \"Name <email>\"",
+				Destination: &gitAuthor,
+			},
+			&cli.StringFlag{
+				Name:        "git-tag",
+				Value:       "",
+				Usage:       "Tag the git history commit of this run with the given name",
+				Destination: &gitTag,
+			},
+			&cli.BoolFlag{
+				Name:        "redact",
+				Value:       false,
+				Usage:       "Replace secrets (passwords, pre-shared keys...) of sensitive exports with a placeholder",
+				Destination: &redact,
+			},
+			&cli.StringFlag{
+				Name:        "redact-recipient",
+				Value:       "",
+				Usage:       "Encrypt redacted secrets to this X25519 public key (PEM file or base64) instead of using a placeholder",
+				Destination: &redactRecipient,
+			},
+			&cli.StringFlag{
+				Name:        "encrypt-passphrase",
+				Value:       "",
+				Usage:       "Encrypt written files with this passphrase, adding the .enc extension",
+				Sources:     cli.EnvVars("MIKROTIK_EXPORT_PASSPHRASE"),
+				Destination: &encryptPassphrase,
+			},
+			&cli.StringFlag{
+				Name:        "encrypt-recipient",
+				Value:       "",
+				Usage:       "Encrypt written files to this X25519 public key (PEM file or base64), adding the .enc extension",
+				Destination: &encryptRecipient,
+			},
+			&cli.BoolFlag{
+				Name:        "archive",
+				Value:       false,
+				Usage:       "Keep every export as a timestamped archive instead of overwriting <router>.rsc",
+				Destination: &archiveMode,
+			},
+			&cli.StringFlag{
+				Name:        "archive-layout",
+				Value:       defaultArchiveLayout,
+				Usage:       "Path of archives in the output directory, using {host}, {date} and {time} placeholders",
+				Destination: &archiveLayout,
+			},
+			&cli.IntFlag{
+				Name:        "keep-last",
+				Value:       0,
+				Usage:       "Keep the N most recent archives of each router",
+				Destination: &retention.Last,
+			},
+			&cli.IntFlag{
+				Name:        "keep-daily",
+				Value:       0,
+				Usage:       "Keep the most recent archive of each of the last N days",
+				Destination: &retention.Daily,
+			},
+			&cli.IntFlag{
+				Name:        "keep-weekly",
+				Value:       0,
+				Usage:       "Keep the most recent archive of each of the last N weeks",
+				Destination: &retention.Weekly,
+			},
+			&cli.IntFlag{
+				Name:        "keep-monthly",
+				Value:       0,
+				Usage:       "Keep the most recent archive of each of the last N months",
+				Destination: &retention.Monthly,
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			cfg, err := core.GetConfig(ctx)
@@ -43,22 +140,69 @@ var Command = []*cli.Command{
 				slog.Debug("failed to get global config", "error", err)
 				return err
 			}
+			if redactRecipient != "" {
+				if recipientKey, err = core.ParseRecipient(redactRecipient); err != nil {
+					return err
+				}
+				redact = true
+			}
+			fileEncrypter = core.FileEncrypter{Passphrase: encryptPassphrase}
+			if encryptRecipient != "" {
+				if fileEncrypter.Recipient, err = core.ParseRecipient(encryptRecipient); err != nil {
+					return err
+				}
+			}
+			if err := fileEncrypter.Validate(); err != nil {
+				return err
+			}
+			if archiveMode {
+				if gitHistory {
+					return fmt.Errorf("--archive and --git can't be used together")
+				}
+				if err := validateArchiveLayout(archiveLayout); err != nil {
+					return err
+				}
+				if err := retention.Validate(); err != nil {
+					return err
+				}
+			}
+
+			// Process all hosts, failures on one host don't stop the others
+			var mu sync.Mutex
+			exported := make(map[string]string, len(cfg.Hosts))
+			results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, func(ctx context.Context, host string) error {
+				file, err := exportHost(ctx, host, "", core.GetReporter(ctx).Report) // Empty string = derive from host
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				exported[host] = file
+				mu.Unlock()
+				return nil
+			})
+			core.GetReporter(ctx).Summary(results)
 
-			// Iterate over all hosts
-			var lastErr error
-			for _, host := range cfg.Hosts {
-				if err := export(ctx, host, ""); err != nil { // Empty string = derive from host
-					lastErr = err
-					// Continue with other hosts even if one fails
+			if gitHistory {
+				// Keep commit message in host order whatever the completion order
+				var files []exportedFile
+				for _, host := range cfg.Hosts {
+					if file, ok := exported[host]; ok {
+						files = append(files, exportedFile{Host: host, Path: file})
+					}
+				}
+				if _, err := commitExports(outputDir, files, gitAuthor, gitTag); err != nil {
+					slog.Error("failed to record exports in git history", "dir", outputDir, "error", err)
+					return fmt.Errorf("failed to record exports in git history: %w", err)
 				}
 			}
-			return lastErr
+			return results.Err()
 		},
 	},
 }
 
 // ExportConfig is a public wrapper that exports configuration for a single host
-// This function is intended to be called from other subcommands like enroll
+// This function is intended to be called from other subcommands like enroll,
+// it reports nothing: the caller reports the result of the host
 func ExportConfig(ctx context.Context, host string, exportOutputDir string, exportShowSensitive bool, preferredFilename string) error {
 	// Temporarily override package-level flags for programmatic calls
 	originalOutputDir := outputDir
@@ -70,58 +214,177 @@ func ExportConfig(ctx context.Context, host string, exportOutputDir string, expo
 		showSensitive = originalShowSensitive
 	}()
 
-	return export(ctx, host, preferredFilename)
+	_, err := exportHost(ctx, host, preferredFilename, func(core.Result) {})
+	return err
 }
 
 func export(ctx context.Context, host string, preferredFilename string) error {
+	_, err := exportHost(ctx, host, preferredFilename, core.GetReporter(ctx).Report)
+	return err
+}
+
+// exportHost exports the configuration of a single host, passes its result to report
+// and returns the path of the written file
+func exportHost(ctx context.Context, host string, preferredFilename string, report func(core.Result)) (string, error) {
 	slog.Info("exporting configuration", "host", host)
+	start := time.Now()
+	fail := func(status string, err error) {
+		report(core.Result{
+			Host:     host,
+			Command:  "export",
+			Status:   status,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("❌ %s: Export failed", host),
+		})
+	}
 
 	slog.Debug("initializing SSH connection", "host", host)
 	conn, err := sshConnectionFactory(ctx, host)
 	if err != nil {
 		slog.Error("failed to create SSH connection", "host", host, "error", err)
-		return fmt.Errorf("failed to create SSH connection: %w", err)
+		fail(core.StatusUnreachable, err)
+		return "", fmt.Errorf("failed to create SSH connection: %w", err)
 	}
 	defer func() {
 		_ = conn.Close()
 	}()
 
-	sshCmd := "/export terse"
-	if showSensitive {
-		sshCmd += " show-sensitive"
-	}
-	slog.Debug("executing export command", "command", sshCmd, "show-sensitive", showSensitive)
-
-	result, err := conn.Run(sshCmd)
+	result, err := FetchConfig(ctx, conn, showSensitive)
 	if err != nil {
 		slog.Error("failed to export configuration", "host", host, "error", err)
-		fmt.Printf("❌ %s: Export failed\n", host)
-		return fmt.Errorf("failed to export configuration: %w", err)
+		fail(core.StatusFailed, err)
+		return "", fmt.Errorf("failed to export configuration: %w", err)
 	}
 
-	// Clean up Windows line endings (CRLF -> LF)
-	result = strings.ReplaceAll(result, "\r\n", "\n")
+	// Secrets only show up in sensitive exports: redact them, or keep the file private
+	fileMode := os.FileMode(0644)
+	if showSensitive {
+		if redact {
+			var count int
+			if result, count, err = (core.Redactor{Recipient: recipientKey}).Redact(result); err != nil {
+				slog.Error("failed to redact configuration", "host", host, "error", err)
+				fail(core.StatusFailed, err)
+				return "", fmt.Errorf("failed to redact configuration: %w", err)
+			}
+			slog.Debug("secrets redacted", "host", host, "count", count, "encrypted", recipientKey != nil)
+		} else {
+			fileMode = 0600
+		}
+	}
 
 	// Generate output filename
 	var filename string
+	shortName := core.ParseHost(host).ShortName
 	if preferredFilename != "" {
 		// Use provided name (from enroll's --hostname)
 		filename = fmt.Sprintf("%s.rsc", preferredFilename)
 	} else {
 		// Derive from host using HostInfo
-		hostInfo := core.ParseHost(host)
-		filename = fmt.Sprintf("%s.rsc", hostInfo.ShortName)
+		filename = fmt.Sprintf("%s.rsc", shortName)
+	}
+	dir := ConfigDir(ctx, host, outputDir)
+	filepath := filepath.Join(dir, filename)
+
+	// In archive mode, every export gets its own timestamped file
+	archived := archiveMode && preferredFilename == ""
+	if archived {
+		exportTime := now()
+		if filepath, err = newArchiveFile(dir, archiveLayout, shortName, exportTime); err != nil {
+			slog.Error("failed to prepare archive", "host", host, "error", err)
+			fail(core.StatusFailed, err)
+			return "", err
+		}
+		filename = archivePath(archiveLayout, shortName, exportTime)
+	}
+
+	// Encrypted files can be stored anywhere, whatever they hold
+	data := []byte(result)
+	if fileEncrypter.Enabled() {
+		if data, err = fileEncrypter.Encrypt(data); err != nil {
+			slog.Error("failed to encrypt configuration", "host", host, "error", err)
+			fail(core.StatusFailed, err)
+			return "", fmt.Errorf("failed to encrypt configuration: %w", err)
+		}
+		filepath += core.EncryptedExt
+		filename += core.EncryptedExt
+		fileMode = 0644
+	}
+
+	// In git mode, keep the previous file when only the timestamp header changed
+	// so that no history commit is created for it.
+	// Encrypted files always differ, their content can't be compared.
+	if gitHistory && !fileEncrypter.Enabled() {
+		if previous, err := os.ReadFile(filepath); err == nil && onlyHeaderChanged(string(previous), result) {
+			slog.Info("configuration unchanged", "host", host, "file", filepath)
+			report(core.Result{
+				Host:     host,
+				Command:  "export",
+				Status:   core.StatusOK,
+				File:     filepath,
+				Duration: time.Since(start),
+				Message:  fmt.Sprintf("✅ %s: Configuration unchanged in %s", host, filename),
+			})
+			return filepath, nil
+		}
 	}
-	filepath := filepath.Join(outputDir, filename)
 
-	slog.Debug("writing configuration", "file", filepath, "size", len(result))
-	if err := os.WriteFile(filepath, []byte(result), 0644); err != nil {
+	slog.Debug("writing configuration", "file", filepath, "size", len(data), "encrypted", fileEncrypter.Enabled())
+	if err := writeFile(filepath, data, fileMode); err != nil {
 		slog.Error("failed to write configuration file", "host", host, "file", filepath, "error", err)
-		fmt.Printf("❌ %s: Export failed\n", host)
-		return fmt.Errorf("failed to write configuration file: %w", err)
+		fail(core.StatusFailed, err)
+		return "", fmt.Errorf("failed to write configuration file: %w", err)
+	}
+	if archived {
+		finishArchive(dir, archiveLayout, shortName, filepath, retention)
 	}
 
 	slog.Info("configuration exported successfully", "host", host, "file", filename)
-	fmt.Printf("✅ %s: Configuration exported to %s\n", host, filename)
-	return nil
+	report(core.Result{
+		Host:     host,
+		Command:  "export",
+		Status:   core.StatusOK,
+		File:     filepath,
+		Duration: time.Since(start),
+		Message:  fmt.Sprintf("✅ %s: Configuration exported to %s", host, filename),
+	})
+	return filepath, nil
+}
+
+// writeFile writes data to path with the given permissions, also applied to an existing file
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// FetchConfig runs the terse export command on the router and returns the
+// configuration with Unix line endings
+func FetchConfig(ctx context.Context, conn core.SshRunner, showSensitive bool) (string, error) {
+	sshCmd := "/export terse"
+	if showSensitive {
+		sshCmd += " show-sensitive"
+	}
+	slog.Debug("executing export command", "command", sshCmd, "show-sensitive", showSensitive)
+
+	result, err := conn.RunContext(ctx, sshCmd)
+	if err != nil {
+		return "", err
+	}
+
+	// Clean up Windows line endings (CRLF -> LF)
+	return strings.ReplaceAll(result, "\r\n", "\n"), nil
+}
+
+// ConfigDir returns the directory holding the configuration file of a host:
+// the inventory output-dir override if any, defaultDir otherwise
+func ConfigDir(ctx context.Context, host, defaultDir string) string {
+	if cfg, err := core.GetConfig(ctx); err == nil {
+		if override := cfg.HostOverrides(host).OutputDir; override != "" {
+			slog.Debug("using output directory from inventory", "host", host, "dir", override)
+			return override
+		}
+	}
+	return defaultDir
 }
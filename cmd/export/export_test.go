@@ -1,6 +1,7 @@
 package export
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -39,6 +40,10 @@ func (m *MockSshRunner) Run(cmd string) (string, error) {
 	return "", nil
 }
 
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	return m.Run(cmd)
+}
+
 // MockSshManager is a mock implementation of SshManager for testing
 type MockSshManager struct {
 	CreateConnectionFunc func(host string) (core.SshRunner, error)
@@ -237,6 +242,10 @@ add name=bridge1`,
 					}
 					mode := info.Mode().Perm()
 					expectedMode := os.FileMode(0644)
+					if tt.showSensitive {
+						// Secrets in clear text, file kept private
+						expectedMode = 0600
+					}
 					if mode != expectedMode {
 						t.Errorf("file permissions = %o, want %o", mode, expectedMode)
 					}
@@ -323,9 +332,13 @@ add name=admin password=secret`,
 				}, nil
 			}
 
-			// Call the wrapper function
-			ctx := context.Background()
+			// Call the wrapper function, the caller reports the result
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
 			err := ExportConfig(ctx, tt.host, tt.exportOutputDir, tt.exportShowSensitive, "")
+			if buf.Len() != 0 {
+				t.Errorf("ExportConfig() should not report results, got %s", buf.String())
+			}
 
 			// Verify error expectations
 			if (err != nil) != tt.wantErr {
@@ -550,3 +563,160 @@ func TestExport_CloseError(t *testing.T) {
 		t.Error("Close() was not called")
 	}
 }
+
+func TestExportRedaction(t *testing.T) {
+	sshOutput := "/ppp secret\nadd name=alice password=p4ss service=pppoe\n"
+
+	tests := []struct {
+		name          string
+		showSensitive bool
+		redact        bool
+		recipient     string
+		wantMode      os.FileMode
+		wantContains  string
+		wantMissing   string
+	}{
+		{
+			name:          "sensitive export without redaction is private",
+			showSensitive: true,
+			wantMode:      0600,
+			wantContains:  "password=p4ss",
+		},
+		{
+			name:          "secrets replaced by placeholder",
+			showSensitive: true,
+			redact:        true,
+			wantMode:      0644,
+			wantContains:  `password="REDACTED"`,
+			wantMissing:   "p4ss",
+		},
+		{
+			name:          "secrets encrypted to recipient",
+			showSensitive: true,
+			recipient:     filepath.Join("..", "..", "core", "testdata", "keys", "recipient.pem"),
+			wantMode:      0644,
+			wantContains:  `password="ENC[x25519,`,
+			wantMissing:   "p4ss",
+		},
+		{
+			name:         "non sensitive export is left as-is",
+			wantMode:     0644,
+			wantContains: "password=p4ss",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalDir, originalSensitive, originalRedact, originalKey := outputDir, showSensitive, redact, recipientKey
+			originalFactory := sshConnectionFactory
+			defer func() {
+				outputDir, showSensitive, redact, recipientKey = originalDir, originalSensitive, originalRedact, originalKey
+				sshConnectionFactory = originalFactory
+			}()
+			outputDir, showSensitive, redact, recipientKey = tmpDir, tt.showSensitive, tt.redact, nil
+			if tt.recipient != "" {
+				key, err := core.ParseRecipient(tt.recipient)
+				if err != nil {
+					t.Fatal(err)
+				}
+				redact, recipientKey = true, key
+			}
+
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) { return sshOutput, nil },
+				}, nil
+			}
+
+			if err := export(context.Background(), "router1", ""); err != nil {
+				t.Fatalf("export() error = %v", err)
+			}
+
+			path := filepath.Join(tmpDir, "router1.rsc")
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(content), tt.wantContains) {
+				t.Errorf("file content = %q, want it to contain %q", content, tt.wantContains)
+			}
+			if tt.wantMissing != "" && strings.Contains(string(content), tt.wantMissing) {
+				t.Errorf("file content = %q, should not contain %q", content, tt.wantMissing)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Errorf("file permissions = %o, want %o", info.Mode().Perm(), tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestExportEncryption(t *testing.T) {
+	sshOutput := "/ppp secret\nadd name=alice password=p4ss service=pppoe\n"
+	public, private, err := core.ParseIdentity(filepath.Join("..", "..", "core", "testdata", "keys", "identity.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		encrypter core.FileEncrypter
+		decrypter core.FileDecrypter
+	}{
+		{
+			name:      "passphrase",
+			encrypter: core.FileEncrypter{Passphrase: "correct horse"},
+			decrypter: core.FileDecrypter{Passphrase: "correct horse"},
+		},
+		{
+			name:      "recipient",
+			encrypter: core.FileEncrypter{Recipient: public},
+			decrypter: core.FileDecrypter{PublicKey: public, PrivateKey: private},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalDir, originalSensitive, originalEncrypter := outputDir, showSensitive, fileEncrypter
+			originalFactory := sshConnectionFactory
+			defer func() {
+				outputDir, showSensitive, fileEncrypter = originalDir, originalSensitive, originalEncrypter
+				sshConnectionFactory = originalFactory
+			}()
+			outputDir, showSensitive, fileEncrypter = tmpDir, true, tt.encrypter
+
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) { return sshOutput, nil },
+				}, nil
+			}
+
+			if err := export(context.Background(), "router1", ""); err != nil {
+				t.Fatalf("export() error = %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(tmpDir, "router1.rsc")); !os.IsNotExist(err) {
+				t.Error("plain router1.rsc should not be written")
+			}
+			content, err := os.ReadFile(filepath.Join(tmpDir, "router1.rsc"+core.EncryptedExt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(content), "p4ss") {
+				t.Error("encrypted file contains a secret in clear text")
+			}
+			plain, err := tt.decrypter.Decrypt(content)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if string(plain) != sshOutput {
+				t.Errorf("decrypted content = %q, want %q", plain, sshOutput)
+			}
+		})
+	}
+}
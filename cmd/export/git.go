@@ -0,0 +1,184 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultGitAuthor is used for history commits when --git-author is not provided
+const defaultGitAuthor = "MikroTik Fleet Autopilot <autopilot@localhost>"
+
+// exportHeaderRe matches the timestamp part of the header RouterOS puts on top of every export
+// (e.g. "# 2024-01-02 12:34:56 by RouterOS 7.13" or "# jan/02/2024 12:34:56 by RouterOS 6.49")
+var exportHeaderRe = regexp.MustCompile(`(?m)^# .*? by RouterOS`)
+
+// gitRun executes a git command in dir and returns its stdout
+// This can be overridden in tests
+var gitRun = func(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// onlyHeaderChanged reports whether two exports only differ by their RouterOS timestamp header
+func onlyHeaderChanged(previous, current string) bool {
+	if previous == current {
+		return true
+	}
+	return exportHeaderRe.ReplaceAllString(previous, "# by RouterOS") == exportHeaderRe.ReplaceAllString(current, "# by RouterOS")
+}
+
+// gitIdentityEnv parses a "Name <email>" author and returns the matching git environment
+func gitIdentityEnv(author string) ([]string, error) {
+	addr, err := mail.ParseAddress(author)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git author %q (expected \"Name <email>\"): %w", author, err)
+	}
+	name := addr.Name
+	if name == "" {
+		name = addr.Address
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + addr.Address,
+		"GIT_COMMITTER_NAME=" + name,
+		"GIT_COMMITTER_EMAIL=" + addr.Address,
+	}, nil
+}
+
+// ensureGitRepository initializes a git repository in dir if needed
+func ensureGitRepository(dir string) error {
+	if _, err := gitRun(dir, nil, "rev-parse", "--git-dir"); err == nil {
+		return nil
+	}
+	slog.Info("initializing git repository", "dir", dir)
+	if _, err := gitRun(dir, nil, "init", "--quiet"); err != nil {
+		return fmt.Errorf("failed to initialize git repository: %w", err)
+	}
+	return nil
+}
+
+// exportedFile associates a host with the configuration file written for it
+type exportedFile struct {
+	Host string
+	Path string
+}
+
+// commitExports commits the given export files into the git repository found in dir.
+// It creates a single commit listing changed hosts, and optionally tags it. Files outside
+// of the repository are left out of the commit. When nothing changed, the tag is put on
+// the current commit, or an error is returned if the repository has none yet.
+// Returns false if there was nothing to commit.
+func commitExports(dir string, exports []exportedFile, author, tag string) (bool, error) {
+	env, err := gitIdentityEnv(author)
+	if err != nil {
+		return false, err
+	}
+	if err := ensureGitRepository(dir); err != nil {
+		return false, err
+	}
+
+	exports, err = exportsInRepository(dir, exports)
+	if err != nil {
+		return false, err
+	}
+	if len(exports) == 0 {
+		slog.Info("no exported files to commit")
+		return false, tagExports(dir, env, tag)
+	}
+	paths := make([]string, 0, len(exports))
+	for _, exported := range exports {
+		paths = append(paths, exported.Path)
+	}
+	if _, err := gitRun(dir, env, append([]string{"add", "--"}, paths...)...); err != nil {
+		return false, fmt.Errorf("failed to stage exports: %w", err)
+	}
+
+	// Only list hosts whose export actually changed
+	var changedHosts []string
+	for _, exported := range exports {
+		staged, err := gitRun(dir, env, "diff", "--cached", "--name-only", "--", exported.Path)
+		if err != nil {
+			return false, fmt.Errorf("failed to list staged exports: %w", err)
+		}
+		if strings.TrimSpace(staged) != "" {
+			changedHosts = append(changedHosts, exported.Host)
+		}
+	}
+	if len(changedHosts) == 0 {
+		slog.Info("exported configurations unchanged, nothing to commit")
+		return false, tagExports(dir, env, tag)
+	}
+
+	message := fmt.Sprintf("Export configuration of %d router(s)\n\n", len(changedHosts))
+	for _, host := range changedHosts {
+		message += fmt.Sprintf("- %s\n", host)
+	}
+
+	if _, err := gitRun(dir, env, append([]string{"commit", "--quiet", "-m", message, "--"}, paths...)...); err != nil {
+		return false, fmt.Errorf("failed to commit exports: %w", err)
+	}
+	slog.Info("exports committed", "dir", dir, "hosts", changedHosts)
+
+	return true, tagExports(dir, env, tag)
+}
+
+// exportsInRepository returns the exports lying inside the work tree of the git repository found in dir,
+// with absolute paths. Exports outside of it (e.g. an inventory host with its own output dir) are skipped.
+func exportsInRepository(dir string, exports []exportedFile) ([]exportedFile, error) {
+	out, err := gitRun(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git repository: %w", err)
+	}
+	root, err := filepath.EvalSymlinks(strings.TrimSpace(out))
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git repository: %w", err)
+	}
+
+	inside := make([]exportedFile, 0, len(exports))
+	for _, exported := range exports {
+		// git runs from dir, use absolute paths so relative output dirs resolve properly
+		absPath, err := filepath.Abs(exported.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve export path: %w", err)
+		}
+		realPath, err := filepath.EvalSymlinks(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve export path: %w", err)
+		}
+		if rel, err := filepath.Rel(root, realPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			slog.Warn("export outside of the git repository, not committed", "host", exported.Host, "file", absPath, "repository", root)
+			continue
+		}
+		inside = append(inside, exportedFile{Host: exported.Host, Path: realPath})
+	}
+	return inside, nil
+}
+
+// tagExports tags the current commit of the repository found in dir, if a tag is given
+func tagExports(dir string, env []string, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	if _, err := gitRun(dir, env, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return fmt.Errorf("failed to tag exports: no commit to tag %s on, nothing was exported", tag)
+	}
+	if _, err := gitRun(dir, env, "tag", tag); err != nil {
+		return fmt.Errorf("failed to tag exports: %w", err)
+	}
+	slog.Info("exports tagged", "tag", tag)
+	return nil
+}
@@ -0,0 +1,237 @@
+package export
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+}
+
+func TestOnlyHeaderChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		current  string
+		want     bool
+	}{
+		{
+			name:     "identical exports",
+			previous: "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n",
+			current:  "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n",
+			want:     true,
+		},
+		{
+			name:     "only RouterOS 7 timestamp changed",
+			previous: "# 2024-01-02 12:34:56 by RouterOS 7.13\n# software id = ABCD-1234\n/interface bridge\nadd name=bridge1\n",
+			current:  "# 2024-01-03 08:00:00 by RouterOS 7.13\n# software id = ABCD-1234\n/interface bridge\nadd name=bridge1\n",
+			want:     true,
+		},
+		{
+			name:     "only RouterOS 6 timestamp changed",
+			previous: "# jan/02/2024 12:34:56 by RouterOS 6.49.10\n/interface bridge\nadd name=bridge1\n",
+			current:  "# jan/03/2024 08:00:00 by RouterOS 6.49.10\n/interface bridge\nadd name=bridge1\n",
+			want:     true,
+		},
+		{
+			name:     "RouterOS version changed",
+			previous: "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n",
+			current:  "# 2024-01-03 08:00:00 by RouterOS 7.14\n/interface bridge\nadd name=bridge1\n",
+			want:     false,
+		},
+		{
+			name:     "configuration changed",
+			previous: "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n",
+			current:  "# 2024-01-03 08:00:00 by RouterOS 7.13\n/interface bridge\nadd name=bridge2\n",
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onlyHeaderChanged(tt.previous, tt.current); got != tt.want {
+				t.Errorf("onlyHeaderChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitIdentityEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		author  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "name and email",
+			author: "Network Team <netops@example.com>",
+			want: []string{
+				"GIT_AUTHOR_NAME=Network Team",
+				"GIT_AUTHOR_EMAIL=netops@example.com",
+				"GIT_COMMITTER_NAME=Network Team",
+				"GIT_COMMITTER_EMAIL=netops@example.com",
+			},
+		},
+		{
+			name:   "email only",
+			author: "netops@example.com",
+			want: []string{
+				"GIT_AUTHOR_NAME=netops@example.com",
+				"GIT_AUTHOR_EMAIL=netops@example.com",
+				"GIT_COMMITTER_NAME=netops@example.com",
+				"GIT_COMMITTER_EMAIL=netops@example.com",
+			},
+		},
+		{
+			name:    "invalid author",
+			author:  "Network Team",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gitIdentityEnv(tt.author)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("gitIdentityEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("gitIdentityEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitExports(t *testing.T) {
+	requireGit(t)
+	tmpDir := t.TempDir()
+
+	writeExport := func(name, content string) exportedFile {
+		path := filepath.Join(tmpDir, name+".rsc")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return exportedFile{Host: name, Path: path}
+	}
+	gitOutput := func(args ...string) string {
+		out, err := gitRun(tmpDir, nil, args...)
+		if err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+		return strings.TrimSpace(out)
+	}
+
+	// First run initializes the repository and commits all exports
+	files := []exportedFile{
+		writeExport("router1", "/interface bridge\nadd name=bridge1\n"),
+		writeExport("router2", "/interface bridge\nadd name=bridge2\n"),
+	}
+	committed, err := commitExports(tmpDir, files, "Network Team <netops@example.com>", "run-1")
+	if err != nil {
+		t.Fatalf("commitExports() error = %v", err)
+	}
+	if !committed {
+		t.Fatal("commitExports() should commit on first run")
+	}
+	if msg := gitOutput("log", "-1", "--format=%B"); !strings.Contains(msg, "- router1") || !strings.Contains(msg, "- router2") {
+		t.Errorf("commit message should list changed hosts, got %q", msg)
+	}
+	if author := gitOutput("log", "-1", "--format=%an <%ae>"); author != "Network Team <netops@example.com>" {
+		t.Errorf("commit author = %q, want Network Team <netops@example.com>", author)
+	}
+	if tags := gitOutput("tag", "--list"); tags != "run-1" {
+		t.Errorf("tags = %q, want run-1", tags)
+	}
+
+	// Second run without changes: no commit, the run is tagged on the current commit
+	committed, err = commitExports(tmpDir, files, defaultGitAuthor, "run-2")
+	if err != nil {
+		t.Fatalf("commitExports() error = %v", err)
+	}
+	if committed {
+		t.Error("commitExports() should not commit unchanged exports")
+	}
+	if tagged, head := gitOutput("rev-list", "-n", "1", "run-2"), gitOutput("rev-parse", "HEAD"); tagged != head {
+		t.Errorf("run-2 tag = %s, want HEAD %s", tagged, head)
+	}
+
+	// Third run with a single changed host, and a host exported outside of the repository
+	files[1] = writeExport("router2", "/interface bridge\nadd name=bridge3\n")
+	outside := filepath.Join(t.TempDir(), "router3.rsc")
+	if err := os.WriteFile(outside, []byte("/interface bridge\nadd name=bridge4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	committed, err = commitExports(tmpDir, append(files, exportedFile{Host: "router3", Path: outside}), defaultGitAuthor, "")
+	if err != nil {
+		t.Fatalf("commitExports() error = %v", err)
+	}
+	if !committed {
+		t.Fatal("commitExports() should commit changed exports")
+	}
+	msg := gitOutput("log", "-1", "--format=%B")
+	if strings.Contains(msg, "router1") || strings.Contains(msg, "router3") || !strings.Contains(msg, "- router2") {
+		t.Errorf("commit message should only list router2, got %q", msg)
+	}
+	if count := gitOutput("rev-list", "--count", "HEAD"); count != "2" {
+		t.Errorf("commit count = %s, want 2", count)
+	}
+}
+
+func TestCommitExportsTagWithoutCommit(t *testing.T) {
+	requireGit(t)
+
+	committed, err := commitExports(t.TempDir(), nil, defaultGitAuthor, "run-1")
+	if committed {
+		t.Error("commitExports() should not commit without exports")
+	}
+	if err == nil || !strings.Contains(err.Error(), "no commit to tag run-1") {
+		t.Errorf("commitExports() error = %v, want error about the missing commit", err)
+	}
+}
+
+func TestExportGitModeSkipsHeaderOnlyChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	originalOutputDir, originalGitHistory, originalFactory := outputDir, gitHistory, sshConnectionFactory
+	defer func() {
+		outputDir, gitHistory, sshConnectionFactory = originalOutputDir, originalGitHistory, originalFactory
+	}()
+	outputDir = tmpDir
+	gitHistory = true
+
+	previous := "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, "router1.rsc"), []byte(previous), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+		return &MockSshRunner{
+			RunFunc: func(cmd string) (string, error) {
+				return "# 2024-01-03 08:00:00 by RouterOS 7.13\n/interface bridge\nadd name=bridge1\n", nil
+			},
+		}, nil
+	}
+
+	file, err := exportHost(context.Background(), "router1", "", core.GetReporter(context.Background()).Report)
+	if err != nil {
+		t.Fatalf("exportHost() error = %v", err)
+	}
+	if file != filepath.Join(tmpDir, "router1.rsc") {
+		t.Errorf("exportHost() file = %s, want %s", file, filepath.Join(tmpDir, "router1.rsc"))
+	}
+	content, _ := os.ReadFile(file)
+	if string(content) != previous {
+		t.Errorf("file should be left untouched when only the header changed, got %q", string(content))
+	}
+}
@@ -0,0 +1,180 @@
+package push
+
+import (
+	"fmt"
+	"strings"
+
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+// exportCommands parses an export (terse or not) into its commands with their menu path,
+// in the order of the export
+func exportCommands(export string) ([]rsc.Statement, error) {
+	script, err := rsc.Parse(export)
+	if err != nil {
+		return nil, err
+	}
+	return rsc.Resolve(script), nil
+}
+
+// computePlan returns the commands to run so that the live configuration matches the desired one.
+// Both sides are export commands in their order of appearance (see exportCommands): desired
+// commands are applied in that order, which matters for firewall rules and other ordered items.
+// An item added on both sides with the same natural key (see rsc.ItemKeys) is updated with set
+// when its attributes differ, attributes only present on the router are left as is.
+// Other commands only present in the desired configuration are applied as-is. Items only present
+// in the live configuration are removed when prune is set, before anything else is applied.
+func computePlan(desired, live []rsc.Statement, prune bool) []string {
+	liveSet := make(map[string]bool, len(live))
+	for _, statement := range live {
+		liveSet[statement.String()] = true
+	}
+	desiredSet := make(map[string]bool, len(desired))
+	for _, statement := range desired {
+		desiredSet[statement.String()] = true
+	}
+	liveByKey := map[string]int{}
+	for i, key := range itemKeys(live) {
+		if key != "" {
+			liveByKey[menuPath(live[i])+" "+key] = i
+		}
+	}
+
+	// Items of both sides matched by natural key are updated, never removed
+	matched := map[int]bool{}
+	var apply []string
+	desiredKeys := itemKeys(desired)
+	for i, statement := range desired {
+		cmd := statement.String()
+		if liveSet[cmd] {
+			continue
+		}
+		if j, ok := liveByKey[menuPath(statement)+" "+desiredKeys[i]]; ok && desiredKeys[i] != "" {
+			matched[j] = true
+			if set, ok := setCommand(statement.(*rsc.Command), live[j].(*rsc.Command), desiredKeys[i]); ok {
+				apply = append(apply, set)
+			}
+			continue
+		}
+		apply = append(apply, cmd)
+	}
+
+	var plan []string
+	if prune {
+		// Remove in reverse order so dependent items go before what they depend on
+		for i := len(live) - 1; i >= 0; i-- {
+			if desiredSet[live[i].String()] || matched[i] {
+				continue
+			}
+			if remove, ok := removeCommand(live[i]); ok {
+				plan = append(plan, remove)
+			}
+		}
+	}
+	return append(plan, apply...)
+}
+
+// addCommand returns the command of a statement if it adds an item with attributes
+func addCommand(statement rsc.Statement) (*rsc.Command, bool) {
+	cmd, ok := statement.(*rsc.Command)
+	if !ok || !cmd.Absolute || cmd.Name != "add" {
+		return nil, false
+	}
+	for _, arg := range cmd.Args {
+		if arg.Name != "" {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// menuPath returns the menu path of a command (/ip address)
+func menuPath(statement rsc.Statement) string {
+	cmd, ok := statement.(*rsc.Command)
+	if !ok {
+		return ""
+	}
+	return "/" + strings.Join(cmd.Path, " ")
+}
+
+// itemKeys returns the find condition matching the item added by each command on its natural key,
+// by command index. Commands that don't add an item told apart by a natural key are left empty.
+func itemKeys(statements []rsc.Statement) []string {
+	menus := map[string][]int{}
+	var paths []string
+	for i, statement := range statements {
+		if _, ok := addCommand(statement); !ok {
+			continue
+		}
+		path := menuPath(statement)
+		if _, ok := menus[path]; !ok {
+			paths = append(paths, path)
+		}
+		menus[path] = append(menus[path], i)
+	}
+
+	keys := make([]string, len(statements))
+	for _, path := range paths {
+		commands := make([]*rsc.Command, len(menus[path]))
+		for n, i := range menus[path] {
+			commands[n] = statements[i].(*rsc.Command)
+		}
+		for n, name := range rsc.ItemKeys(commands) {
+			if value, ok := argValue(commands[n], name); ok && name != "" {
+				keys[menus[path][n]] = condition(name, value)
+			}
+		}
+	}
+	return keys
+}
+
+// argValue returns the value of the last named argument of a command
+func argValue(cmd *rsc.Command, name string) (rsc.Value, bool) {
+	var value rsc.Value
+	for _, arg := range cmd.Args {
+		if arg.Name == name {
+			value = arg.Value
+		}
+	}
+	return value, value != nil
+}
+
+// setCommand builds the command updating the live item of an add command, selected by key,
+// with the desired attributes that differ. It returns false when there is nothing to update.
+func setCommand(desired, live *rsc.Command, key string) (string, bool) {
+	var changed []string
+	for _, arg := range desired.Args {
+		if arg.Name == "" {
+			continue
+		}
+		if value, ok := argValue(live, arg.Name); !ok || rsc.Text(value) != rsc.Text(arg.Value) {
+			changed = append(changed, arg.String())
+		}
+	}
+	if len(changed) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%s set [find where %s] %s", menuPath(desired), key, strings.Join(changed, " ")), true
+}
+
+// removeCommand builds the command removing the item created by an "add" command.
+// The item is matched on all the attributes of the add command.
+func removeCommand(statement rsc.Statement) (string, bool) {
+	add, ok := addCommand(statement)
+	if !ok {
+		return "", false
+	}
+
+	var conditions []string
+	for _, arg := range add.Args {
+		if arg.Name != "" {
+			conditions = append(conditions, condition(arg.Name, arg.Value))
+		}
+	}
+	return fmt.Sprintf("%s remove [find where %s]", menuPath(add), strings.Join(conditions, " ")), true
+}
+
+// condition builds a find condition on an attribute, quoting its value
+func condition(name string, value rsc.Value) string {
+	return name + "=" + rsc.Quote(rsc.Text(value))
+}
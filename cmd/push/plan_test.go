@@ -0,0 +1,189 @@
+package push
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+// statements parses export lines into the statements compared by computePlan
+func statements(t *testing.T, lines ...string) []rsc.Statement {
+	t.Helper()
+	statements, err := exportCommands(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatalf("exportCommands() error = %v", err)
+	}
+	return statements
+}
+
+func TestComputePlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired []string
+		live    []string
+		prune   bool
+		want    []string
+	}{
+		{
+			name:    "in sync",
+			desired: []string{"/system identity set name=router1"},
+			live:    []string{"/system identity set name=router1"},
+			want:    nil,
+		},
+		{
+			name:    "changed setting is applied",
+			desired: []string{"/ip dns set servers=1.1.1.1"},
+			live:    []string{"/ip dns set servers=8.8.8.8"},
+			want:    []string{"/ip dns set servers=1.1.1.1"},
+		},
+		{
+			name:    "missing item is added",
+			desired: []string{"/interface bridge add name=bridge1", "/interface bridge add name=bridge2"},
+			live:    []string{"/interface bridge add name=bridge1"},
+			want:    []string{"/interface bridge add name=bridge2"},
+		},
+		{
+			name:    "extra item is kept without prune",
+			desired: []string{"/interface bridge add name=bridge1"},
+			live:    []string{"/interface bridge add name=bridge1", "/interface bridge add name=bridge2"},
+			want:    nil,
+		},
+		{
+			name:    "extra item is removed with prune, before additions",
+			desired: []string{"/interface bridge add name=bridge1", "/ip address add address=10.0.0.1/24 interface=bridge1"},
+			live:    []string{"/interface bridge add name=bridge1", "/interface bridge add name=bridge2", "/ip address add address=10.0.0.2/24 interface=bridge2"},
+			prune:   true,
+			want: []string{
+				`/ip address remove [find where address="10.0.0.2/24" interface="bridge2"]`,
+				`/interface bridge remove [find where name="bridge2"]`,
+				"/ip address add address=10.0.0.1/24 interface=bridge1",
+			},
+		},
+		{
+			name: "desired order is kept",
+			desired: []string{
+				"/ip firewall filter add action=accept chain=input protocol=icmp",
+				"/ip firewall filter add action=drop chain=input",
+				"/interface bridge add name=bridge1",
+			},
+			live: []string{"/interface bridge add name=bridge1"},
+			want: []string{
+				"/ip firewall filter add action=accept chain=input protocol=icmp",
+				"/ip firewall filter add action=drop chain=input",
+			},
+		},
+		{
+			name:    "changed item is updated by natural key",
+			desired: []string{"/interface bridge add name=bridge1 vlan-filtering=yes", `/ip firewall filter add action=drop chain=forward comment="block guests"`},
+			live:    []string{"/interface bridge add name=bridge1 vlan-filtering=no", `/ip firewall filter add action=accept chain=forward comment="block guests"`},
+			want: []string{
+				`/interface bridge set [find where name="bridge1"] vlan-filtering=yes`,
+				`/ip firewall filter set [find where comment="block guests"] action=drop`,
+			},
+		},
+		{
+			name:    "changed item is updated, not removed, with prune",
+			desired: []string{"/ip address add address=10.0.0.1/24 interface=ether2"},
+			live:    []string{"/ip address add address=10.0.0.1/24 interface=ether1"},
+			prune:   true,
+			want:    []string{`/ip address set [find where address="10.0.0.1/24"] interface=ether2`},
+		},
+		{
+			name:    "items sharing a comment are matched by interface",
+			desired: []string{"/interface bridge port add bridge=bridge comment=defconf interface=ether2 pvid=10", "/interface bridge port add bridge=bridge comment=defconf interface=ether3"},
+			live:    []string{"/interface bridge port add bridge=bridge comment=defconf interface=ether2", "/interface bridge port add bridge=bridge comment=defconf interface=ether3"},
+			want:    []string{`/interface bridge port set [find where interface="ether2"] pvid=10`},
+		},
+		{
+			name:    "attributes only set on the router are left as is",
+			desired: []string{"/interface bridge add name=bridge1"},
+			live:    []string{"/interface bridge add auto-mac=no name=bridge1"},
+			prune:   true,
+			want:    nil,
+		},
+		{
+			name:    "duplicate natural keys are matched on all attributes",
+			desired: []string{"/ip route add dst-address=10.1.0.0/16 gateway=10.0.0.2 comment=vpn", "/ip route add dst-address=10.2.0.0/16 gateway=10.0.0.2 comment=vpn"},
+			live:    []string{"/ip route add dst-address=10.1.0.0/16 gateway=10.0.0.1 comment=vpn", "/ip route add dst-address=10.2.0.0/16 gateway=10.0.0.2 comment=vpn"},
+			want:    []string{"/ip route add dst-address=10.1.0.0/16 gateway=10.0.0.2 comment=vpn"},
+		},
+		{
+			name:    "live-only settings are never removed",
+			desired: []string{},
+			live:    []string{"/ip dns set servers=8.8.8.8"},
+			prune:   true,
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computePlan(statements(t, tt.desired...), statements(t, tt.live...), tt.prune)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("computePlan() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmd    string
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "simple add",
+			cmd:    "/interface bridge add name=bridge1",
+			want:   `/interface bridge remove [find where name="bridge1"]`,
+			wantOk: true,
+		},
+		{
+			name:   "quoted value with spaces",
+			cmd:    `/ip firewall filter add action=accept chain=input comment="allow mgmt"`,
+			want:   `/ip firewall filter remove [find where action="accept" chain="input" comment="allow mgmt"]`,
+			wantOk: true,
+		},
+		{
+			name:   "not an add command",
+			cmd:    "/ip dns set servers=1.1.1.1",
+			wantOk: false,
+		},
+		{
+			name:   "add without attributes",
+			cmd:    "/interface bridge add",
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := removeCommand(statements(t, tt.cmd)[0])
+			if ok != tt.wantOk {
+				t.Fatalf("removeCommand() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("removeCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportCommandsKeepOrder(t *testing.T) {
+	export := "# 2024-01-02 12:34:56 by RouterOS 7.13\n/ip firewall filter\nadd action=accept chain=input protocol=icmp\nadd action=drop chain=input\n/ip dns set servers=1.1.1.1\n"
+	want := []string{
+		"/ip firewall filter add action=accept chain=input protocol=icmp",
+		"/ip firewall filter add action=drop chain=input",
+		"/ip dns set servers=1.1.1.1",
+	}
+	var got []string
+	for _, statement := range statements(t, export) {
+		got = append(got, statement.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exportCommands() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,297 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/export"
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+var configDir string
+var dryRun bool
+var prune bool
+var showSensitive bool
+var rollbackTimeout time.Duration
+
+// rollbackName is the name of the RouterOS script and scheduler restoring the pre-push backup
+const rollbackName = "autopilot-rollback"
+
+// rollbackBackup is the name of the backup saved on the router before applying changes
+const rollbackBackup = "autopilot-prepush"
+
+// sshConnectionFactory is the factory function for creating SSH connections
+// This can be overridden in tests to inject mock SSH manager
+var sshConnectionFactory = core.CreateConnection
+
+var Command = []*cli.Command{
+	{
+		Name:  "push",
+		Usage: "Apply desired .rsc configurations to routers, with automatic rollback",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config-dir",
+				Value:       ".",
+				Usage:       "Directory where the desired configurations are read from",
+				Destination: &configDir,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Value:       false,
+				Usage:       "Only display the commands that would be applied",
+				Destination: &dryRun,
+			},
+			&cli.BoolFlag{
+				Name:        "prune",
+				Value:       false,
+				Usage:       "Remove items present on the router but missing from the desired configuration",
+				Destination: &prune,
+			},
+			&cli.BoolFlag{
+				Name:        "show-sensitive",
+				Value:       false,
+				Usage:       "Include sensitive information in the live export and in the reported commands (use when desired files contain secrets)",
+				Destination: &showSensitive,
+			},
+			&cli.DurationFlag{
+				Name:        "rollback-timeout",
+				Value:       5 * time.Minute,
+				Usage:       "Restore the pre-push backup if the router can't be reached within this delay after applying changes (0 disables rollback)",
+				Destination: &rollbackTimeout,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			// RouterOS schedules the rollback with a precision of one second
+			if rollbackTimeout > 0 && rollbackTimeout < time.Second {
+				return fmt.Errorf("--rollback-timeout must be 0 or at least 1s, got %s", rollbackTimeout)
+			}
+			cfg, err := core.GetConfig(ctx)
+			if err != nil {
+				slog.Debug("failed to get global config", "error", err)
+				return err
+			}
+
+			// Process all hosts, failures on one host don't stop the others
+			results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, push)
+			core.GetReporter(ctx).Summary(results)
+			return results.Err()
+		},
+	},
+}
+
+func push(ctx context.Context, host string) error {
+	slog.Info("pushing configuration", "host", host)
+	reporter := core.GetReporter(ctx)
+	start := time.Now()
+	fail := func(status string, err error, msg string) {
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "push",
+			Status:   status,
+			Error:    err.Error(),
+			Duration: time.Since(start),
+			Message:  msg,
+		})
+	}
+
+	// Read desired configuration first, no need to connect if it's missing
+	hostInfo := core.ParseHost(host)
+	desiredFile := filepath.Join(export.ConfigDir(ctx, host, configDir), fmt.Sprintf("%s.rsc", hostInfo.ShortName))
+	desired, err := os.ReadFile(desiredFile)
+	if err != nil {
+		slog.Error("failed to read desired configuration", "host", host, "file", desiredFile, "error", err)
+		fail(core.StatusFailed, err, fmt.Sprintf("❌ %s: Desired configuration %s not readable", host, desiredFile))
+		return fmt.Errorf("failed to read desired configuration: %w", err)
+	}
+
+	slog.Debug("initializing SSH connection", "host", host)
+	conn, err := sshConnectionFactory(ctx, host)
+	if err != nil {
+		slog.Error("failed to create SSH connection", "host", host, "error", err)
+		fail(core.StatusUnreachable, err, fmt.Sprintf("❓ %s is unreachable", host))
+		return fmt.Errorf("failed to create SSH connection: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	live, err := export.FetchConfig(ctx, conn, showSensitive)
+	if err != nil {
+		slog.Error("failed to export configuration", "host", host, "error", err)
+		fail(core.StatusFailed, err, fmt.Sprintf("❌ %s: Export failed", host))
+		return fmt.Errorf("failed to export configuration: %w", err)
+	}
+
+	desiredCommands, err := exportCommands(string(desired))
+	if err != nil {
+		slog.Error("failed to parse desired configuration", "host", host, "file", desiredFile, "error", err)
+		fail(core.StatusFailed, err, fmt.Sprintf("❌ %s: Failed to parse %s", host, desiredFile))
+		return fmt.Errorf("failed to parse desired configuration: %w", err)
+	}
+	liveCommands, err := exportCommands(live)
+	if err != nil {
+		slog.Error("failed to parse live configuration", "host", host, "error", err)
+		fail(core.StatusFailed, err, fmt.Sprintf("❌ %s: Failed to parse live configuration", host))
+		return fmt.Errorf("failed to parse live configuration: %w", err)
+	}
+	plan := computePlan(desiredCommands, liveCommands, prune)
+	slog.Debug("push plan computed", "host", host, "commands", len(plan))
+	if len(plan) == 0 {
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "push",
+			Status:   core.StatusInSync,
+			File:     desiredFile,
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("✅ %s: Configuration already matches %s", host, desiredFile),
+		})
+		return nil
+	}
+
+	planText := reportedPlan(plan)
+	if dryRun {
+		reporter.Report(core.Result{
+			Host:     host,
+			Command:  "push",
+			Status:   core.StatusDrift,
+			File:     desiredFile,
+			Diff:     planText,
+			Duration: time.Since(start),
+			Message:  fmt.Sprintf("⚠️  %s: %d command(s) to apply\n%s", host, len(plan), planText),
+		})
+		return nil
+	}
+
+	armed := time.Now()
+	if rollbackTimeout > 0 {
+		reporter.Progress(host, fmt.Sprintf("⏳ %s: Arming rollback (%s)", host, rollbackTimeout))
+		if err := armRollback(ctx, conn, rollbackTimeout); err != nil {
+			slog.Error("failed to arm rollback", "host", host, "error", err)
+			fail(core.StatusFailed, err, fmt.Sprintf("❌ %s: Failed to arm rollback, nothing applied", host))
+			return fmt.Errorf("failed to arm rollback: %w", err)
+		}
+	}
+
+	// Apply the plan, stop at first failure
+	for i, cmd := range plan {
+		// Once the rollback fires, the router restores its backup and reboots: stop there
+		if rollbackTimeout > 0 && time.Since(armed) >= rollbackTimeout {
+			err := fmt.Errorf("rollback timeout expired after %d of %d command(s)", i, len(plan))
+			slog.Error("push too slow, rollback fired", "host", host, "error", err)
+			fail(core.StatusRolledBack, err, fmt.Sprintf("❌ %s: Push did not complete within %s, configuration rolled back", host, rollbackTimeout))
+			return err
+		}
+		slog.Debug("applying command", "host", host, "step", i+1, "command", core.RedactCommand(cmd))
+		if _, err := conn.RunContext(ctx, cmd); err != nil {
+			slog.Error("failed to apply command", "host", host, "command", core.RedactCommand(cmd), "error", err)
+			applyErr := fmt.Errorf("failed to apply command %d (%s): %w", i+1, core.RedactCommand(cmd), err)
+			if rollbackTimeout > 0 {
+				triggerRollback(ctx, conn)
+				fail(core.StatusRolledBack, applyErr, fmt.Sprintf("❌ %s: Push failed, configuration rolled back", host))
+			} else {
+				fail(core.StatusFailed, applyErr, fmt.Sprintf("❌ %s: Push failed after %d command(s)", host, i))
+			}
+			return applyErr
+		}
+	}
+
+	if rollbackTimeout > 0 {
+		// Management access must still work through a brand new connection,
+		// otherwise the router restores its backup on its own
+		if err := confirmAccess(ctx, host); err != nil {
+			slog.Error("router unreachable after push", "host", host, "error", err)
+			fail(core.StatusRolledBack, err, fmt.Sprintf("❌ %s: Router unreachable after push, rollback in %s", host, rollbackTimeout))
+			return fmt.Errorf("router unreachable after push: %w", err)
+		}
+	}
+
+	slog.Info("configuration pushed successfully", "host", host, "commands", len(plan))
+	reporter.Report(core.Result{
+		Host:     host,
+		Command:  "push",
+		Status:   core.StatusApplied,
+		File:     desiredFile,
+		Diff:     planText,
+		Duration: time.Since(start),
+		Message:  fmt.Sprintf("✅ %s: %d command(s) applied from %s", host, len(plan), desiredFile),
+	})
+	return nil
+}
+
+// reportedPlan prints the commands of a plan for reports, with their secrets redacted
+// unless --show-sensitive is set
+func reportedPlan(plan []string) string {
+	var b strings.Builder
+	for _, cmd := range plan {
+		if !showSensitive {
+			cmd = core.RedactCommand(cmd)
+		}
+		b.WriteString(cmd + "\n")
+	}
+	return b.String()
+}
+
+// armRollback saves a backup and schedules its restoration after timeout.
+// The rollback is a one-shot: the script removes its scheduler before loading the backup,
+// so that it never runs again, whatever happens to the push afterwards.
+func armRollback(ctx context.Context, conn core.SshRunner, timeout time.Duration) error {
+	commands := []string{
+		fmt.Sprintf("/system backup save name=%s dont-encrypt=yes", rollbackBackup),
+		fmt.Sprintf(`/system script add name=%s dont-require-permissions=yes source="/system scheduler remove %s; /system backup load name=%s.backup password=\"\""`, rollbackName, rollbackName, rollbackBackup),
+		fmt.Sprintf("/system scheduler add name=%s interval=%ds on-event=%s", rollbackName, int(math.Ceil(timeout.Seconds())), rollbackName),
+	}
+	for _, cmd := range commands {
+		slog.Debug("arming rollback", "command", cmd)
+		if _, err := conn.RunContext(ctx, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// triggerRollback restores the pre-push backup immediately. The router reboots.
+func triggerRollback(ctx context.Context, conn core.SshRunner) {
+	cmd := fmt.Sprintf("/system script run %s", rollbackName)
+	slog.Warn("triggering rollback", "command", cmd)
+	if _, err := conn.RunContext(ctx, cmd); err != nil && !conn.IsAlreadyClosedError(err) {
+		// The scheduler will restore the backup anyway once the timeout expires
+		slog.Warn("failed to trigger rollback, waiting for scheduled rollback", "error", err)
+	}
+}
+
+// confirmAccess checks the router is reachable through a new connection and disarms the rollback
+func confirmAccess(ctx context.Context, host string) error {
+	// The pooled connection predates the changes, management access must be proven with a new one
+	core.ResetConnection(ctx, host)
+	conn, err := sshConnectionFactory(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.RunContext(ctx, "/system identity print"); err != nil {
+		return err
+	}
+
+	commands := []string{
+		fmt.Sprintf("/system scheduler remove [find name=%s]", rollbackName),
+		fmt.Sprintf("/system script remove [find name=%s]", rollbackName),
+		fmt.Sprintf("/file remove [find name=%s.backup]", rollbackBackup),
+	}
+	for _, cmd := range commands {
+		slog.Debug("disarming rollback", "command", cmd)
+		if _, err := conn.RunContext(ctx, cmd); err != nil {
+			return fmt.Errorf("failed to disarm rollback: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// MockSshRunner is a mock implementation of SshRunner for testing
+type MockSshRunner struct {
+	CloseFunc                func() error
+	IsAlreadyClosedErrorFunc func(err error) bool
+	RunFunc                  func(cmd string) (string, error)
+	RunContextFunc           func(ctx context.Context, cmd string) (string, error)
+}
+
+func (m *MockSshRunner) Close() error {
+	if m.CloseFunc != nil {
+		return m.CloseFunc()
+	}
+	return nil
+}
+
+func (m *MockSshRunner) IsAlreadyClosedError(err error) bool {
+	if m.IsAlreadyClosedErrorFunc != nil {
+		return m.IsAlreadyClosedErrorFunc(err)
+	}
+	return false
+}
+
+func (m *MockSshRunner) Run(cmd string) (string, error) {
+	if m.RunFunc != nil {
+		return m.RunFunc(cmd)
+	}
+	return "", nil
+}
+
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	if m.RunContextFunc != nil {
+		return m.RunContextFunc(ctx, cmd)
+	}
+	return m.Run(cmd)
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name            string
+		desired         string
+		live            string
+		dryRun          bool
+		rollbackTimeout time.Duration
+		failCommand     string
+		failReconnect   bool
+		wantErr         bool
+		wantStatus      string
+		wantCommands    []string
+		notWantCommands []string
+	}{
+		{
+			name:            "already in sync",
+			desired:         "/interface bridge\nadd name=bridge1\n",
+			live:            "# 2024-01-02 12:34:56 by RouterOS 7.13\n/interface bridge add name=bridge1\n",
+			rollbackTimeout: 5 * time.Minute,
+			wantStatus:      core.StatusInSync,
+			notWantCommands: []string{"/system backup save name=autopilot-prepush dont-encrypt=yes"},
+		},
+		{
+			name:            "dry run does not apply anything",
+			desired:         "/ip dns set servers=1.1.1.1\n",
+			live:            "/ip dns set servers=8.8.8.8\n",
+			dryRun:          true,
+			rollbackTimeout: 5 * time.Minute,
+			wantStatus:      core.StatusDrift,
+			notWantCommands: []string{"/ip dns set servers=1.1.1.1"},
+		},
+		{
+			name:            "changes applied with rollback armed and disarmed",
+			desired:         "/ip dns set servers=1.1.1.1\n",
+			live:            "/ip dns set servers=8.8.8.8\n",
+			rollbackTimeout: 5 * time.Minute,
+			wantStatus:      core.StatusApplied,
+			wantCommands: []string{
+				"/system backup save name=autopilot-prepush dont-encrypt=yes",
+				`/system script add name=autopilot-rollback dont-require-permissions=yes source="/system scheduler remove autopilot-rollback; /system backup load name=autopilot-prepush.backup password=\"\""`,
+				"/system scheduler add name=autopilot-rollback interval=300s on-event=autopilot-rollback",
+				"/ip dns set servers=1.1.1.1",
+				"/system identity print",
+				"/system scheduler remove [find name=autopilot-rollback]",
+			},
+		},
+		{
+			name:            "changes applied without rollback",
+			desired:         "/ip dns set servers=1.1.1.1\n",
+			live:            "/ip dns set servers=8.8.8.8\n",
+			rollbackTimeout: 0,
+			wantStatus:      core.StatusApplied,
+			wantCommands:    []string{"/ip dns set servers=1.1.1.1"},
+			notWantCommands: []string{"/system backup save name=autopilot-prepush dont-encrypt=yes"},
+		},
+		{
+			name:            "failed command triggers rollback",
+			desired:         "/ip dns set servers=1.1.1.1\n/system identity set name=router1\n",
+			live:            "/ip dns set servers=8.8.8.8\n",
+			rollbackTimeout: 5 * time.Minute,
+			failCommand:     "/ip dns set servers=1.1.1.1",
+			wantErr:         true,
+			wantStatus:      core.StatusRolledBack,
+			wantCommands:    []string{"/system script run autopilot-rollback"},
+			notWantCommands: []string{"/system identity set name=router1"},
+		},
+		{
+			name:            "rollback timeout expired while applying",
+			desired:         "/ip dns set servers=1.1.1.1\n",
+			live:            "/ip dns set servers=8.8.8.8\n",
+			rollbackTimeout: time.Nanosecond,
+			wantErr:         true,
+			wantStatus:      core.StatusRolledBack,
+			notWantCommands: []string{"/ip dns set servers=1.1.1.1"},
+		},
+		{
+			name:            "unreachable after push leaves scheduled rollback",
+			desired:         "/ip address add address=10.0.0.1/24 interface=ether1\n",
+			live:            "",
+			rollbackTimeout: 5 * time.Minute,
+			failReconnect:   true,
+			wantErr:         true,
+			wantStatus:      core.StatusRolledBack,
+			notWantCommands: []string{"/system scheduler remove [find name=autopilot-rollback]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalConfigDir, originalDryRun, originalTimeout := configDir, dryRun, rollbackTimeout
+			defer func() { configDir, dryRun, rollbackTimeout = originalConfigDir, originalDryRun, originalTimeout }()
+			configDir, dryRun, rollbackTimeout = tmpDir, tt.dryRun, tt.rollbackTimeout
+
+			if err := os.WriteFile(filepath.Join(tmpDir, "router1.rsc"), []byte(tt.desired), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var executed []string
+			connections := 0
+			originalFactory := sshConnectionFactory
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				connections++
+				if connections > 1 && tt.failReconnect {
+					return nil, fmt.Errorf("connection timeout")
+				}
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						executed = append(executed, cmd)
+						if cmd == "/export terse" {
+							return tt.live, nil
+						}
+						if cmd == tt.failCommand {
+							return "", fmt.Errorf("failure: bad value")
+						}
+						return "", nil
+					},
+				}, nil
+			}
+			defer func() { sshConnectionFactory = originalFactory }()
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+
+			err := push(ctx, "router1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("push() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(buf.String(), fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, buf.String())
+			}
+			for _, cmd := range tt.wantCommands {
+				if !slices.Contains(executed, cmd) {
+					t.Errorf("expected command %q to be executed, got %q", cmd, executed)
+				}
+			}
+			for _, cmd := range tt.notWantCommands {
+				if slices.Contains(executed, cmd) {
+					t.Errorf("command %q should not be executed", cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestPushCommandTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalConfigDir, originalDryRun, originalTimeout := configDir, dryRun, rollbackTimeout
+	defer func() { configDir, dryRun, rollbackTimeout = originalConfigDir, originalDryRun, originalTimeout }()
+	configDir, dryRun, rollbackTimeout = tmpDir, false, 5*time.Minute
+	if err := os.WriteFile(filepath.Join(tmpDir, "router1.rsc"), []byte("/ip dns set servers=1.1.1.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every command must run with the context holding --command-timeout,
+	// the hung one times out and the armed rollback is triggered
+	var executed []string
+	originalFactory := sshConnectionFactory
+	defer func() { sshConnectionFactory = originalFactory }()
+	sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+		return &MockSshRunner{
+			RunFunc: func(cmd string) (string, error) {
+				t.Errorf("command %q runs without the command timeout", cmd)
+				return "", nil
+			},
+			RunContextFunc: func(ctx context.Context, cmd string) (string, error) {
+				executed = append(executed, cmd)
+				cfg, err := core.GetConfig(ctx)
+				if err != nil || cfg.CommandTimeout == 0 {
+					t.Errorf("command %q runs without the command timeout", cmd)
+				}
+				switch cmd {
+				case "/export terse":
+					return "/ip dns set servers=8.8.8.8\n", nil
+				case "/ip dns set servers=1.1.1.1":
+					return "", &core.CommandTimeoutError{Command: cmd, Elapsed: cfg.CommandTimeout}
+				}
+				return "", nil
+			},
+		}, nil
+	}
+
+	var buf bytes.Buffer
+	ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+	ctx = context.WithValue(ctx, core.ConfigKey, &core.Config{CommandTimeout: time.Second})
+	if err := push(ctx, "router1"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("push() error = %v, want a command timeout", err)
+	}
+	if !strings.Contains(buf.String(), `"status":"rolled-back"`) {
+		t.Errorf("result status should be rolled-back, got %s", buf.String())
+	}
+	if !slices.Contains(executed, "/system script run autopilot-rollback") {
+		t.Errorf("rollback should be triggered, got %q", executed)
+	}
+}
+
+func TestPushMissingDesiredFile(t *testing.T) {
+	originalConfigDir := configDir
+	defer func() { configDir = originalConfigDir }()
+	configDir = t.TempDir()
+
+	originalFactory := sshConnectionFactory
+	defer func() { sshConnectionFactory = originalFactory }()
+	sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+		t.Error("should not connect when desired configuration is missing")
+		return &MockSshRunner{}, nil
+	}
+
+	var buf bytes.Buffer
+	ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+	if err := push(ctx, "router1"); err == nil || !strings.Contains(err.Error(), "failed to read desired configuration") {
+		t.Errorf("push() error = %v, want desired configuration error", err)
+	}
+}
+
+func TestPushRollbackTimeoutValidation(t *testing.T) {
+	originalTimeout := rollbackTimeout
+	defer func() { rollbackTimeout = originalTimeout }()
+
+	err := Command[0].Run(context.Background(), []string{"push", "--rollback-timeout", "500ms"})
+	if err == nil || !strings.Contains(err.Error(), "--rollback-timeout") {
+		t.Errorf("Run() error = %v, want a --rollback-timeout error", err)
+	}
+}
+
+func TestArmRollbackRoundsUp(t *testing.T) {
+	var executed []string
+	conn := &MockSshRunner{
+		RunFunc: func(cmd string) (string, error) {
+			executed = append(executed, cmd)
+			return "", nil
+		},
+	}
+	if err := armRollback(context.Background(), conn, 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	want := "/system scheduler add name=autopilot-rollback interval=2s on-event=autopilot-rollback"
+	if !slices.Contains(executed, want) {
+		t.Errorf("expected %q, got %q", want, executed)
+	}
+}
+
+func TestPushRedactsPlan(t *testing.T) {
+	tests := []struct {
+		name          string
+		showSensitive bool
+		wantSecret    bool
+	}{
+		{name: "redacted by default"},
+		{name: "shown with --show-sensitive", showSensitive: true, wantSecret: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			originalConfigDir, originalDryRun, originalShowSensitive := configDir, dryRun, showSensitive
+			defer func() { configDir, dryRun, showSensitive = originalConfigDir, originalDryRun, originalShowSensitive }()
+			configDir, dryRun, showSensitive = tmpDir, true, tt.showSensitive
+
+			desired := "/interface wireless security-profiles add name=guests wpa2-pre-shared-key=hunter22\n"
+			if err := os.WriteFile(filepath.Join(tmpDir, "router1.rsc"), []byte(desired), 0644); err != nil {
+				t.Fatal(err)
+			}
+			originalFactory := sshConnectionFactory
+			defer func() { sshConnectionFactory = originalFactory }()
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockSshRunner{}, nil
+			}
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+			if err := push(ctx, "router1"); err != nil {
+				t.Fatalf("push() error = %v", err)
+			}
+			if got := strings.Contains(buf.String(), "hunter22"); got != tt.wantSecret {
+				t.Errorf("secret in report = %v, want %v: %s", got, tt.wantSecret, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package updates
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// routerResource holds the RouterOS version and CPU architecture reported by /system/resource/print
+type routerResource struct {
+	Version      string
+	Architecture string
+}
+
+// getRouterResource reads the installed RouterOS version and architecture of a router
+func getRouterResource(ctx context.Context, conn core.SshRunner) (routerResource, error) {
+	output, err := conn.RunContext(ctx, "/system/resource/print")
+	if err != nil {
+		return routerResource{}, fmt.Errorf("failed to run SSH command: %w", err)
+	}
+	records, err := core.ParsePrint(output)
+	if err != nil || len(records) == 0 {
+		return routerResource{}, fmt.Errorf("failed to parse RouterOS version and architecture from resource output")
+	}
+	// The version is followed by its channel: 7.15.3 (stable)
+	version := strings.Fields(records[0].Get("version"))
+	arch := records[0].Get("architecture-name")
+	if len(version) == 0 || arch == "" {
+		return routerResource{}, fmt.Errorf("failed to parse RouterOS version and architecture from resource output")
+	}
+	return routerResource{Version: version[0], Architecture: arch}, nil
+}
+
+// getInstalledPackages returns the names of the packages installed on a router
+func getInstalledPackages(ctx context.Context, conn core.SshRunner) ([]string, error) {
+	output, err := conn.RunContext(ctx, "/system/package/print terse")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run SSH command: %w", err)
+	}
+	records, err := core.ParsePrint(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse package list: %w", err)
+	}
+	var names []string
+	for _, record := range records {
+		if name := record.Get("name"); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no installed package found in package list")
+	}
+	return names, nil
+}
+
+// packageFileNames returns the candidate .npk file names of a RouterOS 7 package, most specific first.
+// x86 packages are published without architecture suffix.
+func packageFileNames(name, version, arch string) []string {
+	names := []string{fmt.Sprintf("%s-%s-%s.npk", name, version, arch)}
+	if strings.HasPrefix(arch, "x86") {
+		names = append(names, fmt.Sprintf("%s-%s.npk", name, version))
+	}
+	return names
+}
+
+// findPackageFile returns the path of a package .npk file in dir
+func findPackageFile(dir, name, version, arch string) (string, error) {
+	for _, file := range packageFileNames(name, version, arch) {
+		path := filepath.Join(dir, file)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("package %s %s for %s not found in %s", name, version, arch, dir)
+}
+
+// availableVersions lists RouterOS versions available for arch in dir
+func availableVersions(dir, arch string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package directory: %w", err)
+	}
+	var versions []string
+	for _, entry := range entries {
+		version, ok := strings.CutPrefix(entry.Name(), "routeros-")
+		if !ok {
+			continue
+		}
+		if v, ok := strings.CutSuffix(version, "-"+arch+".npk"); ok {
+			versions = append(versions, v)
+		} else if v, ok := strings.CutSuffix(version, ".npk"); ok && strings.HasPrefix(arch, "x86") && !strings.Contains(v, "-") {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// compareVersions compares RouterOS versions such as 7.15.3 or 7.16rc2.
+// Pre-release versions (rc, beta) sort before the matching release.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(aParts), len(bParts)) {
+		var aNum, bNum int
+		var aSuffix, bSuffix string
+		if i < len(aParts) {
+			aNum, aSuffix = splitVersionPart(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, bSuffix = splitVersionPart(bParts[i])
+		}
+		if aNum != bNum {
+			return aNum - bNum
+		}
+		if aSuffix != bSuffix {
+			switch {
+			case aSuffix == "":
+				return 1
+			case bSuffix == "":
+				return -1
+			}
+			return strings.Compare(aSuffix, bSuffix)
+		}
+	}
+	return 0
+}
+
+// splitVersionPart splits "16rc2" into 16 and "rc2"
+func splitVersionPart(part string) (int, string) {
+	i := 0
+	for i < len(part) && part[i] >= '0' && part[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(part[:i])
+	return n, part[i:]
+}
+
+// offlineStatus returns the RouterOS status of a router against the local package repository:
+// the available version is the pinned target if present in the repository, otherwise the newest
+// one if newer than the installed version. Packages can't downgrade a router on reboot,
+// a pinned target older than the installed version is refused.
+func offlineStatus(ctx context.Context, conn core.SshRunner, host string) (*UpdateStatus, error) {
+	resource, err := getRouterResource(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	// RouterOS 6 packages are bundled and named differently (routeros-mipsbe-6.49.10.npk)
+	if major, _ := splitVersionPart(resource.Version); major < 7 {
+		return nil, fmt.Errorf("offline upgrades need RouterOS 7 or later, %s runs %s: upgrade it from MikroTik's download servers", host, resource.Version)
+	}
+	versions, err := availableVersions(packageDir, resource.Architecture)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no RouterOS package for %s found in %s", resource.Architecture, packageDir)
+	}
+
+	_, target := updatePolicy(ctx, host)
+	if target != "" && compareVersions(target, resource.Version) < 0 {
+		return nil, fmt.Errorf("installed RouterOS %s is newer than target %s, packages can't downgrade it", resource.Version, target)
+	}
+	available := resource.Version
+	for _, v := range versions {
+		if v == target {
+			available = target
+			break
+		}
+		if compareVersions(v, available) > 0 {
+			available = v
+		}
+	}
+	slog.Debug("offline RouterOS status", "host", host, "architecture", resource.Architecture, "installed", resource.Version, "available", available)
+	return &UpdateStatus{Installed: resource.Version, Available: available}, nil
+}
+
+// uploadPackages uploads the .npk files of every installed package for the given version,
+// and verifies their size and checksum once on the router. On failure, the files already
+// uploaded are removed so that the next reboot does not install a partial set of packages.
+func uploadPackages(ctx context.Context, conn core.SshRunner, host, version string) (err error) {
+	transferer, ok := conn.(core.FileTransferer)
+	if !ok {
+		return fmt.Errorf("connection does not support file transfer")
+	}
+	resource, err := getRouterResource(ctx, conn)
+	if err != nil {
+		return err
+	}
+	packages, err := getInstalledPackages(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	// Resolve every file first, nothing is uploaded if a package is missing
+	files := make([]string, 0, len(packages))
+	for _, name := range packages {
+		file, err := findPackageFile(packageDir, name, version, resource.Architecture)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	var uploaded []string
+	defer func() {
+		if err != nil {
+			removePackages(ctx, conn, host, uploaded)
+		}
+	}()
+
+	reporter := core.GetReporter(ctx)
+	for _, file := range files {
+		remote := filepath.Base(file)
+		reporter.Progress(host, fmt.Sprintf("⏳ Uploading %s to %s", remote, host))
+		// A failed upload may leave a partial file behind
+		uploaded = append(uploaded, remote)
+		if err := transferer.Upload(ctx, file, remote); err != nil {
+			return err
+		}
+
+		wantSize, wantSum, err := core.FileChecksum(file)
+		if err != nil {
+			return fmt.Errorf("failed to checksum %s: %w", file, err)
+		}
+		size, sum, err := transferer.Checksum(ctx, remote)
+		if err != nil {
+			return err
+		}
+		if size != wantSize || sum != wantSum {
+			return fmt.Errorf("uploaded %s does not match local file (size %d, expected %d)", remote, size, wantSize)
+		}
+		slog.Info("package uploaded", "host", host, "file", remote, "size", size, "sha256", sum)
+	}
+	return nil
+}
+
+// removePackages deletes uploaded package files from a router. Failures are only logged.
+func removePackages(ctx context.Context, conn core.SshRunner, host string, files []string) {
+	for _, file := range files {
+		cmd := fmt.Sprintf("/file remove [find name=%s]", file)
+		slog.Debug("removing uploaded package", "host", host, "command", cmd)
+		if _, err := conn.RunContext(ctx, cmd); err != nil {
+			slog.Warn("failed to remove uploaded package", "host", host, "file", file, "error", err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package updates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// MockTransferRunner is a mock SshRunner able to transfer files
+type MockTransferRunner struct {
+	MockSshRunner
+	UploadFunc   func(localPath, remotePath string) error
+	ChecksumFunc func(remotePath string) (int64, string, error)
+}
+
+func (m *MockTransferRunner) Upload(ctx context.Context, localPath, remotePath string) error {
+	return m.UploadFunc(localPath, remotePath)
+}
+
+func (m *MockTransferRunner) Download(ctx context.Context, remotePath, localPath string) error {
+	return fmt.Errorf("mock Download not implemented")
+}
+
+func (m *MockTransferRunner) Checksum(ctx context.Context, remotePath string) (int64, string, error) {
+	return m.ChecksumFunc(remotePath)
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "7.15.3", b: "7.15.3", want: 0},
+		{a: "7.16", b: "7.15.3", want: 1},
+		{a: "7.9", b: "7.10", want: -1},
+		{a: "7.15", b: "7.15.1", want: -1},
+		{a: "7.16rc2", b: "7.16", want: -1},
+		{a: "7.16rc2", b: "7.16beta4", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got := compareVersions(tt.a, tt.b)
+			if (got > 0) != (tt.want > 0) || (got < 0) != (tt.want < 0) {
+				t.Errorf("compareVersions(%q, %q) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvailableVersions(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"routeros-7.15.3-arm64.npk",
+		"routeros-7.16-arm64.npk",
+		"wifi-qcom-7.16-arm64.npk",
+		"routeros-7.16-mipsbe.npk",
+		"routeros-7.14.npk",
+		"README.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		arch string
+		want []string
+	}{
+		{arch: "arm64", want: []string{"7.15.3", "7.16"}},
+		{arch: "mipsbe", want: []string{"7.16"}},
+		{arch: "x86_64", want: []string{"7.14"}},
+		{arch: "tile", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			got, err := availableVersions(dir, tt.arch)
+			if err != nil {
+				t.Fatalf("availableVersions() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("availableVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfflineUpdate(t *testing.T) {
+	resource := `                   uptime: 1d2h
+                  version: 7.15.3 (stable)
+        architecture-name: arm64
+                board-name: hAP ax3`
+	packages := ` 0   name=routeros version=7.15.3 build-time=2024-07-24 10:39:01 scheduled=""
+ 1   name=wifi-qcom version=7.15.3 build-time=2024-07-24 10:39:01 scheduled=""`
+
+	tests := []struct {
+		name         string
+		installed    string
+		files        []string
+		target       string
+		corrupt      bool
+		wantErr      string
+		wantUploads  []string
+		wantNoReboot bool
+		wantRemoved  []string
+		afterInstall string
+	}{
+		{
+			name:         "newest packages uploaded and installed",
+			files:        []string{"routeros-7.16-arm64.npk", "wifi-qcom-7.16-arm64.npk", "routeros-7.15.3-arm64.npk"},
+			wantUploads:  []string{"routeros-7.16-arm64.npk", "wifi-qcom-7.16-arm64.npk"},
+			afterInstall: "7.16",
+		},
+		{
+			name:         "pinned target selected",
+			files:        []string{"routeros-7.16-arm64.npk", "routeros-7.15.4-arm64.npk", "wifi-qcom-7.15.4-arm64.npk"},
+			target:       "7.15.4",
+			wantUploads:  []string{"routeros-7.15.4-arm64.npk", "wifi-qcom-7.15.4-arm64.npk"},
+			afterInstall: "7.15.4",
+		},
+		{
+			name:         "missing package for installed extra package",
+			files:        []string{"routeros-7.16-arm64.npk"},
+			wantErr:      "package wifi-qcom 7.16 for arm64 not found",
+			wantNoReboot: true,
+		},
+		{
+			name:         "checksum mismatch",
+			files:        []string{"routeros-7.16-arm64.npk", "wifi-qcom-7.16-arm64.npk"},
+			corrupt:      true,
+			wantErr:      "does not match local file",
+			wantUploads:  []string{"routeros-7.16-arm64.npk"},
+			wantNoReboot: true,
+			wantRemoved:  []string{"/file remove [find name=routeros-7.16-arm64.npk]"},
+		},
+		{
+			name:         "older local packages are not offered",
+			files:        []string{"routeros-7.14-arm64.npk", "wifi-qcom-7.14-arm64.npk"},
+			wantNoReboot: true,
+		},
+		{
+			name:         "pinned target older than installed version",
+			files:        []string{"routeros-7.14-arm64.npk", "wifi-qcom-7.14-arm64.npk"},
+			target:       "7.14",
+			wantErr:      "installed RouterOS 7.15.3 is newer than target 7.14",
+			wantNoReboot: true,
+		},
+		{
+			name:         "packages not installed on reboot",
+			files:        []string{"routeros-7.16-arm64.npk", "wifi-qcom-7.16-arm64.npk"},
+			wantUploads:  []string{"routeros-7.16-arm64.npk", "wifi-qcom-7.16-arm64.npk"},
+			afterInstall: "7.15.3",
+			wantErr:      "RouterOS still at 7.15.3 after installing 7.16 packages",
+		},
+		{
+			name:         "RouterOS 6 is refused",
+			installed:    "6.49.10",
+			files:        []string{"routeros-arm64-6.49.11.npk", "routeros-7.16-arm64.npk", "wifi-qcom-7.16-arm64.npk"},
+			wantErr:      "offline upgrades need RouterOS 7 or later",
+			wantNoReboot: true,
+		},
+		{
+			name:         "already running newest version",
+			files:        []string{"routeros-7.15.3-arm64.npk", "wifi-qcom-7.15.3-arm64.npk"},
+			wantNoReboot: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			originalApply, originalFactory, originalDelay := updatesApply, sshConnectionFactory, reconnectDelay
+			originalDir, originalTarget := packageDir, targetVersion
+			defer func() {
+				updatesApply, sshConnectionFactory, reconnectDelay = originalApply, originalFactory, originalDelay
+				packageDir, targetVersion = originalDir, originalTarget
+			}()
+			updatesApply, reconnectDelay = true, 1*time.Millisecond
+			packageDir, targetVersion = dir, tt.target
+
+			var executed, uploaded []string
+			installed := "7.15.3"
+			if tt.installed != "" {
+				installed = tt.installed
+			}
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockTransferRunner{
+					MockSshRunner: MockSshRunner{
+						RunFunc: func(cmd string) (string, error) {
+							executed = append(executed, cmd)
+							switch cmd {
+							case "/system/resource/print":
+								return strings.Replace(resource, "7.15.3", installed, 1), nil
+							case "/system/package/print terse":
+								return packages, nil
+							case "/system/routerboard/print":
+								return "  routerboard: no", nil
+							case "/system/reboot":
+								installed = tt.afterInstall
+							}
+							return "", nil
+						},
+					},
+					UploadFunc: func(localPath, remotePath string) error {
+						uploaded = append(uploaded, remotePath)
+						return nil
+					},
+					ChecksumFunc: func(remotePath string) (int64, string, error) {
+						size, sum, err := core.FileChecksum(filepath.Join(dir, remotePath))
+						if tt.corrupt {
+							return size - 1, "bad", err
+						}
+						return size, sum, err
+					},
+				}, nil
+			}
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+
+			err := updateHost(ctx, "router1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("updateHost() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("updateHost() unexpected error = %v", err)
+			}
+
+			if slices.Contains(executed, "/system/package/update/check-for-updates") {
+				t.Error("offline update should not contact MikroTik's download servers")
+			}
+			if !slices.Equal(uploaded, tt.wantUploads) {
+				t.Errorf("uploaded = %v, want %v", uploaded, tt.wantUploads)
+			}
+			if rebooted := slices.Contains(executed, "/system/reboot"); rebooted == tt.wantNoReboot {
+				t.Errorf("reboot executed = %v, want %v", rebooted, !tt.wantNoReboot)
+			}
+			for _, cmd := range tt.wantRemoved {
+				if !slices.Contains(executed, cmd) {
+					t.Errorf("expected command %q to be executed, got %q", cmd, executed)
+				}
+			}
+			if tt.wantErr == "" && tt.afterInstall != "" && !strings.Contains(buf.String(), `"status":"updated"`) {
+				t.Errorf("expected updated result, got:\n%s", buf.String())
+			}
+		})
+	}
+}
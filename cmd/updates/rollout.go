@@ -0,0 +1,162 @@
+package updates
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+// planWaves splits hosts into rollout waves: canary hosts first, then batches of the remaining hosts.
+// batch is either a number of hosts ("5") or a percentage of the remaining hosts ("25%").
+// An empty batch puts all remaining hosts in a single wave.
+func planWaves(hosts, canaries []string, batch string) ([][]string, error) {
+	for _, canary := range canaries {
+		if !slices.Contains(hosts, canary) {
+			return nil, fmt.Errorf("canary host %s is not part of the selected hosts", canary)
+		}
+	}
+
+	var remaining []string
+	for _, host := range hosts {
+		if !slices.Contains(canaries, host) {
+			remaining = append(remaining, host)
+		}
+	}
+
+	size := len(remaining)
+	if batch != "" {
+		var err error
+		if size, err = batchSize(batch, len(remaining)); err != nil {
+			return nil, err
+		}
+	}
+
+	var waves [][]string
+	if len(canaries) > 0 {
+		waves = append(waves, slices.Clone(canaries))
+	}
+	for chunk := range slices.Chunk(remaining, max(size, 1)) {
+		waves = append(waves, chunk)
+	}
+	return waves, nil
+}
+
+// batchSize converts a --batch-size value into a number of hosts
+func batchSize(batch string, total int) (int, error) {
+	if percent, ok := strings.CutSuffix(batch, "%"); ok {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, fmt.Errorf("invalid batch size %q (expected a percentage between 0 and 100)", batch)
+		}
+		return max(int(math.Ceil(float64(total)*p/100)), 1), nil
+	}
+	n, err := strconv.Atoi(batch)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid batch size %q (expected a positive number or a percentage)", batch)
+	}
+	return n, nil
+}
+
+// rollout applies updates wave by wave, running health checks after each wave.
+// The rollout halts at the first wave with a failed update or health check,
+// remaining hosts are reported as skipped.
+func rollout(ctx context.Context, waves [][]string, parallel int) error {
+	reporter := core.GetReporter(ctx)
+
+	for i, wave := range waves {
+		slog.Info("starting rollout wave", "wave", i+1, "waves", len(waves), "hosts", wave)
+		reporter.Progress("", fmt.Sprintf("🚀 Rollout wave %d/%d: %s", i+1, len(waves), strings.Join(wave, ", ")))
+
+		results := core.RunFleet(ctx, wave, parallel, updateAndCheckHost)
+		reporter.Summary(results)
+
+		if err := results.Err(); err != nil {
+			// Report hosts of the following waves as skipped
+			for _, next := range waves[i+1:] {
+				for _, host := range next {
+					reporter.Report(core.Result{
+						Host:    host,
+						Command: "updates",
+						Status:  core.StatusSkipped,
+						Error:   "rollout halted",
+						Message: fmt.Sprintf("⏭️  %s skipped (rollout halted)", host),
+					})
+				}
+			}
+			slog.Error("rollout halted", "wave", i+1, "error", err)
+			return fmt.Errorf("rollout halted after wave %d/%d: %w", i+1, len(waves), err)
+		}
+	}
+	return nil
+}
+
+// updateAndCheckHost updates a host and runs the health check once it is updated,
+// reporting a single result: the update result, or the failed health check
+func updateAndCheckHost(ctx context.Context, host string) error {
+	start := time.Now()
+	result, err := updateResult(ctx, host)
+	if err == nil {
+		if checkErr := healthCheck(ctx, host); checkErr != nil {
+			err = fmt.Errorf("health check failed: %w", checkErr)
+			result.Status = core.StatusFailed
+			result.Error = checkErr.Error()
+			result.Message = fmt.Sprintf("❌ %s failed health check: %v", host, checkErr)
+		}
+	}
+	result.Duration = time.Since(start)
+	core.GetReporter(ctx).Report(result)
+	return err
+}
+
+// healthCheck verifies an updated host: reachable over SSH, running the latest (or pinned target) version,
+// and passing all user-defined check commands. With --on-version-mismatch=warn, the latest version
+// is accepted in place of a pinned target it differs from, as updates installed it.
+func healthCheck(ctx context.Context, host string) error {
+	slog.Info("running health check", "host", host)
+	conn, err := sshConnectionFactory(ctx, host)
+	if err != nil {
+		return fmt.Errorf("router unreachable: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// RouterBoard firmware may legitimately lag behind until the next reboot,
+	// only RouterOS version is checked
+	osStatus, _, err := checkCurrentStatus(ctx, conn, host)
+	if err != nil {
+		return err
+	}
+	_, osStatus.Target = updatePolicy(ctx, host)
+	if osStatus.Target != "" && onVersionMismatch == "warn" && osStatus.Installed == osStatus.Available {
+		osStatus.Target = ""
+	}
+	if !osStatus.UpToDate() {
+		expected := osStatus.Available
+		if osStatus.Target != "" {
+			expected = osStatus.Target
+		}
+		return fmt.Errorf("RouterOS version %s does not match expected %s", osStatus.Installed, expected)
+	}
+
+	for _, check := range healthChecks {
+		slog.Debug("running health check command", "host", host, "command", check)
+		output, err := conn.RunContext(ctx, check)
+		if err != nil {
+			return fmt.Errorf("check command %q failed: %w", check, err)
+		}
+		if strings.Contains(output, "failure:") {
+			return fmt.Errorf("check command %q failed: %s", check, strings.TrimSpace(output))
+		}
+	}
+
+	slog.Info("health check passed", "host", host)
+	return nil
+}
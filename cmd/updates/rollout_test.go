@@ -0,0 +1,265 @@
+package updates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"jb.favre/mikrotik-fleet-autopilot/core"
+)
+
+func TestPlanWaves(t *testing.T) {
+	hosts := []string{"r1", "r2", "r3", "r4", "r5"}
+
+	tests := []struct {
+		name     string
+		canaries []string
+		batch    string
+		want     [][]string
+		wantErr  bool
+	}{
+		{
+			name: "no canary, no batch",
+			want: [][]string{{"r1", "r2", "r3", "r4", "r5"}},
+		},
+		{
+			name:     "canary only",
+			canaries: []string{"r3"},
+			want:     [][]string{{"r3"}, {"r1", "r2", "r4", "r5"}},
+		},
+		{
+			name:  "batches of 2",
+			batch: "2",
+			want:  [][]string{{"r1", "r2"}, {"r3", "r4"}, {"r5"}},
+		},
+		{
+			name:     "canary and percentage batches",
+			canaries: []string{"r1"},
+			batch:    "50%",
+			want:     [][]string{{"r1"}, {"r2", "r3"}, {"r4", "r5"}},
+		},
+		{
+			name:  "percentage rounds up",
+			batch: "30%",
+			want:  [][]string{{"r1", "r2"}, {"r3", "r4"}, {"r5"}},
+		},
+		{
+			name:     "unknown canary",
+			canaries: []string{"r9"},
+			wantErr:  true,
+		},
+		{
+			name:    "invalid batch",
+			batch:   "zero",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planWaves(hosts, tt.canaries, tt.batch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("planWaves() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planWaves() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		batch   string
+		total   int
+		want    int
+		wantErr bool
+	}{
+		{batch: "3", total: 10, want: 3},
+		{batch: "25%", total: 10, want: 3},
+		{batch: "100%", total: 10, want: 10},
+		{batch: "1%", total: 10, want: 1},
+		{batch: "0", total: 10, wantErr: true},
+		{batch: "-1", total: 10, wantErr: true},
+		{batch: "0%", total: 10, wantErr: true},
+		{batch: "150%", total: 10, wantErr: true},
+		{batch: "abc", total: 10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.batch, func(t *testing.T) {
+			got, err := batchSize(tt.batch, tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("batchSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("batchSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollout(t *testing.T) {
+	upToDate := `  status: System is already up to date
+  installed-version: 7.14.1
+  latest-version: 7.14.1`
+
+	tests := []struct {
+		name           string
+		waves          [][]string
+		unreachable    map[string]bool
+		checks         []string
+		checkOutput    string
+		wantErr        bool
+		wantUpdated    []string
+		wantSkipped    []string
+		wantErrContain string
+	}{
+		{
+			name:        "all waves succeed",
+			waves:       [][]string{{"canary"}, {"r1", "r2"}},
+			wantUpdated: []string{"canary", "r1", "r2"},
+		},
+		{
+			name:           "canary failure halts rollout",
+			waves:          [][]string{{"canary"}, {"r1", "r2"}},
+			unreachable:    map[string]bool{"canary": true},
+			wantErr:        true,
+			wantSkipped:    []string{"r1", "r2"},
+			wantErrContain: "rollout halted after wave 1/2",
+		},
+		{
+			name:           "failing user health check halts rollout",
+			waves:          [][]string{{"r1"}, {"r2"}, {"r3"}},
+			checks:         []string{"/ping 10.0.0.1 count=1"},
+			checkOutput:    "failure: no route to host",
+			wantErr:        true,
+			wantUpdated:    []string{"r1"},
+			wantSkipped:    []string{"r2", "r3"},
+			wantErrContain: "check command",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalFactory, originalApply, originalChecks := sshConnectionFactory, updatesApply, healthChecks
+			defer func() {
+				sshConnectionFactory, updatesApply, healthChecks = originalFactory, originalApply, originalChecks
+			}()
+			updatesApply = true
+			healthChecks = tt.checks
+
+			var mu sync.Mutex
+			connected := map[string]bool{}
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				if tt.unreachable[host] {
+					return nil, fmt.Errorf("connection refused")
+				}
+				mu.Lock()
+				connected[host] = true
+				mu.Unlock()
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						switch {
+						case strings.Contains(cmd, "check-for-updates"):
+							return upToDate, nil
+						case strings.Contains(cmd, "routerboard"):
+							return "  routerboard: no", nil
+						default:
+							return tt.checkOutput, nil
+						}
+					},
+				}, nil
+			}
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+
+			err := rollout(ctx, tt.waves, 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rollout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErrContain != "" && !strings.Contains(err.Error(), tt.wantErrContain) {
+				t.Errorf("rollout() error = %v, want error containing %q", err, tt.wantErrContain)
+			}
+			for _, host := range tt.wantUpdated {
+				if !connected[host] {
+					t.Errorf("expected %s to be processed", host)
+				}
+			}
+			for _, host := range tt.wantSkipped {
+				if connected[host] {
+					t.Errorf("expected %s to be skipped, but it was contacted", host)
+				}
+				if !strings.Contains(buf.String(), fmt.Sprintf(`{"host":%q,"command":"updates","status":"skipped"`, host)) {
+					t.Errorf("expected skipped result for %s, got:\n%s", host, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheckVersionMismatch(t *testing.T) {
+	// The latest version was installed although it differs from the pinned target
+	latest := `  status: System is already up to date
+  installed-version: 7.15
+  latest-version: 7.15`
+
+	tests := []struct {
+		mismatch string
+		wantErr  bool
+	}{
+		{mismatch: "refuse", wantErr: true},
+		{mismatch: "warn", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mismatch, func(t *testing.T) {
+			originalFactory, originalTarget, originalMismatch, originalChecks := sshConnectionFactory, targetVersion, onVersionMismatch, healthChecks
+			defer func() {
+				sshConnectionFactory, targetVersion, onVersionMismatch, healthChecks = originalFactory, originalTarget, originalMismatch, originalChecks
+			}()
+			targetVersion, onVersionMismatch, healthChecks = "7.14.1", tt.mismatch, nil
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						if strings.Contains(cmd, "check-for-updates") {
+							return latest, nil
+						}
+						return "  routerboard: no", nil
+					},
+				}, nil
+			}
+
+			err := healthCheck(context.Background(), "r1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("healthCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRolloutFlagsRequireApply(t *testing.T) {
+	for _, args := range [][]string{
+		{"--canary", "r1"},
+		{"--batch-size", "2"},
+		{"--health-check", "/ping 10.0.0.1 count=1"},
+		{"--reboot-timeout", "5m"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			originalApply, originalCanaries, originalBatch, originalChecks, originalTimeout := updatesApply, canaryHosts, rolloutBatch, healthChecks, rebootTimeout
+			defer func() {
+				updatesApply, canaryHosts, rolloutBatch, healthChecks, rebootTimeout = originalApply, originalCanaries, originalBatch, originalChecks, originalTimeout
+			}()
+
+			err := Command[0].Run(context.Background(), append([]string{"updates"}, args...))
+			if err == nil || !strings.Contains(err.Error(), "requires --updates-apply") {
+				t.Errorf("Run(%v) error = %v, want a --updates-apply error", args, err)
+			}
+		})
+	}
+}
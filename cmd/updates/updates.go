@@ -2,9 +2,11 @@ package updates
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"regexp"
+	"maps"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v3"
@@ -12,11 +14,34 @@ import (
 )
 
 var updatesApply bool = true
-
-// reconnectDelay is the delay between reconnection attempts after a router reboot
+var canaryHosts []string
+var rolloutBatch string
+var healthChecks []string
+var rebootTimeout = 10 * time.Minute
+var updateChannel string
+var targetVersion string
+var onVersionMismatch = "refuse"
+var packageDir string
+
+// reconnectDelay is the initial delay between reconnection attempts after a router reboot,
+// doubled after each failed attempt up to reconnectMaxDelay
 // This can be overridden in tests to speed up test execution
 var reconnectDelay = 10 * time.Second
 
+// reconnectMaxDelay caps the exponential backoff between reconnection attempts
+var reconnectMaxDelay = 1 * time.Minute
+
+// ErrRouterDidNotComeBack is returned when a router can't be reached again
+// within --reboot-timeout after an update reboot
+var ErrRouterDidNotComeBack = errors.New("router did not come back after reboot")
+
+// errConnect is returned when no connection can be opened to a router, the host is then unreachable
+var errConnect = errors.New("failed to create SSH connection")
+
+// errVersionMismatch is returned when the latest RouterOS version differs from the pinned target
+// and --on-version-mismatch is "refuse"
+var errVersionMismatch = errors.New("RouterOS version mismatch")
+
 // sshConnectionFactory is the factory function for creating SSH connections
 // This can be overridden in tests to inject mock SSH manager
 var sshConnectionFactory = core.CreateConnection
@@ -32,23 +57,86 @@ var Command = []*cli.Command{
 				Usage:       "Update router packages to the latest version available",
 				Destination: &updatesApply,
 			},
+			&cli.StringSliceFlag{
+				Name:        "canary",
+				Usage:       "Hosts to update first, as a rollout wave of their own (comma-separated or repeated, requires --updates-apply)",
+				Destination: &canaryHosts,
+			},
+			&cli.StringFlag{
+				Name:        "batch-size",
+				Value:       "",
+				Usage:       "Update remaining hosts in waves of N hosts or N% of hosts (requires --updates-apply)",
+				Destination: &rolloutBatch,
+			},
+			&cli.StringSliceFlag{
+				Name:        "health-check",
+				Usage:       "RouterOS command that must succeed on every updated host before the next rollout wave (repeatable, requires --updates-apply)",
+				Destination: &healthChecks,
+			},
+			&cli.DurationFlag{
+				Name:        "reboot-timeout",
+				Value:       10 * time.Minute,
+				Usage:       "Maximum time to wait for a router to come back after an update reboot (requires --updates-apply)",
+				Destination: &rebootTimeout,
+			},
+			&cli.StringFlag{
+				Name:        "channel",
+				Value:       "",
+				Usage:       "Set the RouterOS update channel before checking for updates: stable, long-term, testing or development",
+				Destination: &updateChannel,
+			},
+			&cli.StringFlag{
+				Name:        "target-version",
+				Value:       "",
+				Usage:       "Pin the validated RouterOS version the fleet must converge on",
+				Destination: &targetVersion,
+			},
+			&cli.StringFlag{
+				Name:        "on-version-mismatch",
+				Value:       "refuse",
+				Usage:       "What to do when the latest version differs from --target-version: refuse or warn",
+				Destination: &onVersionMismatch,
+			},
+			&cli.StringFlag{
+				Name:        "from-dir",
+				Value:       "",
+				Usage:       "Upgrade from the RouterOS .npk packages of this directory instead of MikroTik's download servers",
+				Destination: &packageDir,
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			// Rollout flags do nothing when only checking for updates
+			if !updatesApply {
+				for _, name := range []string{"canary", "batch-size", "health-check", "reboot-timeout"} {
+					if cmd.IsSet(name) {
+						return fmt.Errorf("--%s requires --updates-apply", name)
+					}
+				}
+			}
 			cfg, err := core.GetConfig(ctx)
 			if err != nil {
 				return err
 			}
+			if err := core.ValidateUpdateChannel(updateChannel); err != nil {
+				return err
+			}
+			if onVersionMismatch != "refuse" && onVersionMismatch != "warn" {
+				return fmt.Errorf("invalid --on-version-mismatch %q (expected refuse or warn)", onVersionMismatch)
+			}
 
-			// Iterate over all hosts
-			var lastErr error
-			for _, host := range cfg.Hosts {
-				if err := updates(ctx, host); err != nil {
-					slog.Debug("error checking updates", "host", host, "error", err)
-					fmt.Printf("❓ %s is unreachable\n", host)
-					// Continue with other hosts even if one fails
+			// Process all hosts, failures on one host don't stop the others
+			// Staged rollout: canary hosts and batches, with health checks between waves
+			if updatesApply && (len(canaryHosts) > 0 || rolloutBatch != "") {
+				waves, err := planWaves(cfg.Hosts, canaryHosts, rolloutBatch)
+				if err != nil {
+					return err
 				}
+				return rollout(ctx, waves, cfg.Parallel)
 			}
-			return lastErr
+
+			results := core.RunFleet(ctx, cfg.Hosts, cfg.Parallel, updateHost)
+			core.GetReporter(ctx).Summary(results)
+			return results.Err()
 		},
 	},
 }
@@ -56,6 +144,72 @@ var Command = []*cli.Command{
 type UpdateStatus struct {
 	Installed string
 	Available string
+	// Target is the pinned version, if any. It replaces Available when checking if the component is up to date.
+	Target string
+}
+
+// UpToDate reports whether the installed version is the pinned target, or the latest available one
+func (s UpdateStatus) UpToDate() bool {
+	if s.Target != "" {
+		return s.Installed == s.Target
+	}
+	return s.Installed == s.Available
+}
+
+// updatePolicy returns the update channel and target version for a host,
+// inventory settings taking precedence over command-line flags
+func updatePolicy(ctx context.Context, host string) (channel, target string) {
+	channel, target = updateChannel, targetVersion
+	if cfg, err := core.GetConfig(ctx); err == nil {
+		overrides := cfg.HostOverrides(host)
+		if overrides.Channel != "" {
+			channel = overrides.Channel
+		}
+		if overrides.TargetVersion != "" {
+			target = overrides.TargetVersion
+		}
+	}
+	return channel, target
+}
+
+// updateHost checks (and applies when requested) updates on a single host and reports its final result
+func updateHost(ctx context.Context, host string) error {
+	result, err := updateResult(ctx, host)
+	core.GetReporter(ctx).Report(result)
+	return err
+}
+
+// updateResult checks (and applies when requested) updates on a single host and returns its final result:
+// up to date, update available or updated on success; unreachable, not back after reboot, version mismatch,
+// interrupted or failed otherwise
+func updateResult(ctx context.Context, host string) (core.Result, error) {
+	start := time.Now()
+	outcome, err := updates(ctx, host)
+	if err == nil {
+		return outcome.result(host, time.Since(start)), nil
+	}
+
+	slog.Debug("error checking updates", "host", host, "error", err)
+	status, msg := core.StatusFailed, fmt.Sprintf("❌ %s: %v", host, err)
+	switch {
+	case errors.Is(err, errConnect):
+		status, msg = core.StatusUnreachable, fmt.Sprintf("❓ %s is unreachable", host)
+	case errors.Is(err, ErrRouterDidNotComeBack):
+		status, msg = core.StatusDidNotComeBack, fmt.Sprintf("💀 %s did not come back after reboot", host)
+	case errors.Is(err, errVersionMismatch):
+		status, msg = core.StatusVersionMismatch, fmt.Sprintf("🚫 %s: %v", host, err)
+	case errors.Is(err, context.Canceled):
+		status, msg = core.StatusFailed, fmt.Sprintf("⛔ %s: Update interrupted", host)
+	}
+	return core.Result{
+		Host:     host,
+		Command:  "updates",
+		Status:   status,
+		Versions: outcome.versions(),
+		Error:    err.Error(),
+		Duration: time.Since(start),
+		Message:  msg,
+	}, err
 }
 
 // ApplyUpdates is a public wrapper that applies updates to a single host
@@ -66,10 +220,57 @@ func ApplyUpdates(ctx context.Context, host string) error {
 	updatesApply = true
 	defer func() { updatesApply = originalApplyFlag }()
 
-	return updates(ctx, host)
+	start := time.Now()
+	outcome, err := updates(ctx, host)
+	if err != nil {
+		return err
+	}
+	core.GetReporter(ctx).Progress(host, outcome.result(host, time.Since(start)).Message)
+	return nil
 }
 
-func updates(ctx context.Context, host string) error {
+// updateOutcome is the state of a host once its updates are checked, and applied when requested
+type updateOutcome struct {
+	status      string
+	osStatus    UpdateStatus
+	boardStatus *UpdateStatus
+	// message replaces the versions summary when they could not be checked after the update
+	message string
+}
+
+// versions returns the component versions of the outcome as reported in results, nil when unknown
+func (o updateOutcome) versions() map[string]core.ComponentVersion {
+	if o.osStatus.Installed == "" {
+		return nil
+	}
+	versions := map[string]core.ComponentVersion{
+		"routeros": {Installed: o.osStatus.Installed, Available: o.osStatus.Available, Target: o.osStatus.Target},
+	}
+	if o.boardStatus != nil {
+		versions["routerboard"] = core.ComponentVersion{Installed: o.boardStatus.Installed, Available: o.boardStatus.Available}
+	}
+	return versions
+}
+
+// result returns the outcome as the result of a host, using formatUpdateResult as the text rendering
+func (o updateOutcome) result(host string, duration time.Duration) core.Result {
+	msg := o.message
+	if msg == "" {
+		msg = formatUpdateResult(host, o.osStatus, o.boardStatus)
+	}
+	return core.Result{
+		Host:     host,
+		Command:  "updates",
+		Status:   o.status,
+		Versions: o.versions(),
+		Duration: duration,
+		Message:  msg,
+	}
+}
+
+// updates checks the updates of a host and applies them when requested. The outcome holds
+// the versions known so far when an error is returned.
+func updates(ctx context.Context, host string) (updateOutcome, error) {
 	updatesApplyFlag := updatesApply
 	slog.Debug("subcommand apply-updates flag", "value", updatesApplyFlag)
 
@@ -78,60 +279,112 @@ func updates(ctx context.Context, host string) error {
 	conn, err := sshConnectionFactory(ctx, host)
 	if err != nil {
 		slog.Debug("failed to create SSH connection", "host", host, "error", err)
-		return fmt.Errorf("failed to create SSH connection: %w", err)
+		return updateOutcome{}, fmt.Errorf("%w: %w", errConnect, err)
 	}
 	defer func() {
 		_ = conn.Close()
 	}()
 	slog.Debug("SSH connection created", "host", host)
 
+	channel, target := updatePolicy(ctx, host)
+	if channel != "" {
+		if err := setUpdateChannel(ctx, conn, channel); err != nil {
+			return updateOutcome{}, err
+		}
+	}
+
 	// Step 1: Check current status
 	slog.Info("Checking current update status")
-	osStatus, boardStatus, err := checkCurrentStatus(conn)
+	osStatus, boardStatus, err := checkCurrentStatus(ctx, conn, host)
 	if err != nil {
-		return err
+		return updateOutcome{}, err
+	}
+	osStatus.Target = target
+	outcome := updateOutcome{
+		status:      updateResultStatus(osStatus, boardStatus),
+		osStatus:    osStatus,
+		boardStatus: boardStatus,
+	}
+	if target != "" && !osStatus.UpToDate() && osStatus.Available != target {
+		mismatch := fmt.Errorf("%w: latest version %s differs from target %s", errVersionMismatch, osStatus.Available, target)
+		if onVersionMismatch != "warn" {
+			slog.Error("refusing update", "host", host, "error", mismatch)
+			return outcome, mismatch
+		}
+		slog.Warn("latest version differs from target, updating anyway", "host", host, "error", mismatch)
+		core.GetReporter(ctx).Progress(host, fmt.Sprintf("⚠️  %s: %v", host, mismatch))
 	}
 
-	// Step 2: Display current status
-	slog.Info("Displaying current update status")
-	formatAndDisplayResult(host, osStatus, boardStatus)
-
-	// Step 3: Apply updates if requested and needed
-	if updatesApplyFlag && updatesApply {
-		osUpToDate := osStatus.Installed == osStatus.Available
-		boardUpToDate := boardStatus == nil || boardStatus.Installed == boardStatus.Available
-
-		// Apply RouterOS update if needed
-		if !osUpToDate {
-			slog.Info("Applying RouterOS updates")
-			if err := applyComponentUpdate(conn, ctx, host, "RouterOS", "/system/package/update/install", false); err != nil {
-				return err
+	// Step 2: Apply updates if requested and needed, the current status is only progress then
+	if !updatesApplyFlag || !updatesApply || outcome.status == core.StatusUpToDate {
+		return outcome, nil
+	}
+	core.GetReporter(ctx).Progress(host, formatUpdateResult(host, osStatus, boardStatus))
+
+	osUpToDate := osStatus.UpToDate()
+	boardUpToDate := boardStatus == nil || boardStatus.UpToDate()
+
+	// Apply RouterOS update if needed
+	if !osUpToDate {
+		slog.Info("Applying RouterOS updates")
+		updateCmd := "/system/package/update/install"
+		if packageDir != "" {
+			// Offline upgrade: packages are installed on reboot once uploaded
+			if err := uploadPackages(ctx, conn, host, osStatus.Available); err != nil {
+				return outcome, err
 			}
+			updateCmd = "/system/reboot"
+		}
+		updated, err := applyComponentUpdate(conn, ctx, host, "RouterOS", updateCmd, false)
+		if err != nil {
+			return outcome, err
+		}
+		outcome = updated
+		// Packages that don't match the router are silently ignored on reboot
+		if packageDir != "" && outcome.osStatus.Installed == osStatus.Installed {
+			return outcome, fmt.Errorf("RouterOS still at %s after installing %s packages", osStatus.Installed, osStatus.Available)
 		}
+	}
 
-		// Apply RouterBoard update if needed (only for physical routers)
-		if !boardUpToDate && boardStatus != nil {
-			slog.Info("Applying RouterBoard updates")
-			if err := applyComponentUpdate(conn, ctx, host, "RouterBoard", "/system/reboot", true); err != nil {
-				return err
-			}
+	// Apply RouterBoard update if needed (only for physical routers)
+	if !boardUpToDate && boardStatus != nil {
+		slog.Info("Applying RouterBoard updates")
+		updated, err := applyComponentUpdate(conn, ctx, host, "RouterBoard", "/system/reboot", true)
+		if err != nil {
+			return outcome, err
 		}
+		outcome = updated
+	} else if outcome.osStatus.Installed != "" {
+		// RouterOS only update, the RouterBoard firmware was not checked again
+		outcome.boardStatus = boardStatus
 	}
 
+	return outcome, nil
+}
+
+// setUpdateChannel selects the channel used by check-for-updates and install
+func setUpdateChannel(ctx context.Context, conn core.SshRunner, channel string) error {
+	cmd := fmt.Sprintf("/system/package/update/set channel=%s", channel)
+	slog.Info("Setting update channel", "channel", channel)
+	if _, err := conn.RunContext(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to set update channel %s: %w", channel, err)
+	}
 	return nil
 }
 
+// routerOSStatus retrieves installed and available RouterOS versions, from MikroTik's
+// download servers or, with --from-dir, from the local package repository
+func routerOSStatus(ctx context.Context, conn core.SshRunner, host string) (*UpdateStatus, error) {
+	if packageDir != "" {
+		return offlineStatus(ctx, conn, host)
+	}
+	return routerOSCheck.status(ctx, conn)
+}
+
 // checkCurrentStatus retrieves the current RouterOS and RouterBoard status
-func checkCurrentStatus(conn core.SshRunner) (UpdateStatus, *UpdateStatus, error) {
+func checkCurrentStatus(ctx context.Context, conn core.SshRunner, host string) (UpdateStatus, *UpdateStatus, error) {
 	slog.Info("Checking RouterOS update status")
-	osStatusPtr, err := getUpdateStatus(
-		conn,
-		"/system/package/update/check-for-updates",
-		"RouterOS",
-		regexp.MustCompile(`.*installed-version: (\S+)`),
-		regexp.MustCompile(`.*latest-version: (\S+)`),
-		false,
-	)
+	osStatusPtr, err := routerOSStatus(ctx, conn, host)
 	if err != nil {
 		return UpdateStatus{}, nil, err
 	}
@@ -144,14 +397,7 @@ func checkCurrentStatus(conn core.SshRunner) (UpdateStatus, *UpdateStatus, error
 	}
 
 	slog.Info("Checking RouterBoard update status")
-	boardStatus, err := getUpdateStatus(
-		conn,
-		"/system/routerboard/print",
-		"RouterBoard",
-		regexp.MustCompile(`.*current-firmware: (\S+)`),
-		regexp.MustCompile(`.*upgrade-firmware: (\S+)`),
-		true,
-	)
+	boardStatus, err := routerBoardCheck.status(ctx, conn)
 	if err != nil {
 		return UpdateStatus{}, nil, err
 	}
@@ -170,8 +416,9 @@ func checkCurrentStatus(conn core.SshRunner) (UpdateStatus, *UpdateStatus, error
 	return osStatus, boardStatus, nil
 }
 
-// applyComponentUpdate applies an update to RouterOS or RouterBoard and displays the result
-func applyComponentUpdate(conn core.SshRunner, ctx context.Context, host, component, updateCmd string, checkBoth bool) error {
+// applyComponentUpdate applies an update to RouterOS or RouterBoard and returns the updated outcome,
+// with the versions checked once the router is back
+func applyComponentUpdate(conn core.SshRunner, ctx context.Context, host, component, updateCmd string, checkBoth bool) (updateOutcome, error) {
 	slog.Info("component update needed, applying updates", "component", component)
 	slog.Debug("applying component updates", "component", component, "host", host)
 
@@ -181,63 +428,44 @@ func applyComponentUpdate(conn core.SshRunner, ctx context.Context, host, compon
 	}
 	newConn, err := applyUpdate(conn, ctx, host, updateCmd, msgPrefix+" "+host)
 	if err != nil {
-		return err
+		return updateOutcome{}, err
 	}
 	defer func() {
 		_ = newConn.Close()
 	}()
 
+	// Post-update check errors are non-fatal - the update itself succeeded
+	unchecked := updateOutcome{
+		status:  core.StatusUpdated,
+		message: fmt.Sprintf("✅ %s updated (%s), versions could not be checked after reboot", host, component),
+	}
+
 	// Check status after upgrade
-	osStatusPtr, osStatusErr := getUpdateStatus(
-		newConn,
-		"/system/package/update/check-for-updates",
-		"RouterOS",
-		regexp.MustCompile(`.*installed-version: (\S+)`),
-		regexp.MustCompile(`.*latest-version: (\S+)`),
-		false,
-	)
+	osStatusPtr, err := routerOSStatus(ctx, newConn, host)
+	if err != nil {
+		slog.Warn("failed to check RouterOS status after update", "error", err)
+		return unchecked, nil
+	}
+	osStatus := *osStatusPtr
+	_, osStatus.Target = updatePolicy(ctx, host)
 
 	if !checkBoth {
 		// RouterOS only update
-		if osStatusErr == nil {
-			osStatus := *osStatusPtr
-			formatAndDisplayResult(host, osStatus, nil)
-		} else {
-			slog.Warn("failed to check RouterOS status after update", "error", osStatusErr)
-		}
-		// Post-update check errors are non-fatal - the update itself succeeded
-		return nil
+		return updateOutcome{status: core.StatusUpdated, osStatus: osStatus}, nil
 	}
 
 	// RouterBoard update - check both OS and Board
-	boardStatus, boardStatusErr := getUpdateStatus(
-		newConn,
-		"/system/routerboard/print",
-		"RouterBoard",
-		regexp.MustCompile(`.*current-firmware: (\S+)`),
-		regexp.MustCompile(`.*upgrade-firmware: (\S+)`),
-		true,
-	)
-
-	if osStatusErr == nil && boardStatusErr == nil {
-		osStatus := *osStatusPtr
-		fmt.Println(formatUpdateResult(host, osStatus, boardStatus))
-	} else {
-		if osStatusErr != nil {
-			slog.Warn("failed to check RouterOS status after update", "error", osStatusErr)
-		}
-		if boardStatusErr != nil {
-			slog.Warn("failed to check RouterBoard status after update", "error", boardStatusErr)
-		}
+	boardStatus, err := routerBoardCheck.status(ctx, newConn)
+	if err != nil {
+		slog.Warn("failed to check RouterBoard status after update", "error", err)
+		return unchecked, nil
 	}
-
-	// Post-update check errors are non-fatal - the update itself succeeded
-	return nil
+	return updateOutcome{status: core.StatusUpdated, osStatus: osStatus, boardStatus: boardStatus}, nil
 }
 
 // formatUpdateResult formats the update result into a string
 func formatUpdateResult(host string, osStatus UpdateStatus, boardStatus *UpdateStatus) string {
-	osUpToDate := osStatus.Installed == osStatus.Available
+	osUpToDate := osStatus.UpToDate()
 
 	if boardStatus == nil {
 		// Virtualized router or RouterOS-only update
@@ -248,7 +476,7 @@ func formatUpdateResult(host string, osStatus UpdateStatus, boardStatus *UpdateS
 	}
 
 	// Physical router with RouterBoard
-	boardUpToDate := boardStatus.Installed == boardStatus.Available
+	boardUpToDate := boardStatus.UpToDate()
 	if osUpToDate && boardUpToDate {
 		return fmt.Sprintf("✅ %s is up-to-date (RouterOS: %s, RouterBoard: %s)", host, osStatus.Installed, boardStatus.Installed)
 	}
@@ -266,71 +494,184 @@ func formatUpdateResult(host string, osStatus UpdateStatus, boardStatus *UpdateS
 	return fmt.Sprintf("⚠️  %s upgrade available (RouterOS: %s → %s, RouterBoard: %s)", host, osStatus.Installed, osStatus.Available, boardUpgrade)
 }
 
-// formatAndDisplayResult formats and displays the update result
-func formatAndDisplayResult(host string, osStatus UpdateStatus, boardStatus *UpdateStatus) {
-	fmt.Println(formatUpdateResult(host, osStatus, boardStatus))
+// updateResultStatus returns the result status matching the given RouterOS and RouterBoard versions
+func updateResultStatus(osStatus UpdateStatus, boardStatus *UpdateStatus) string {
+	if !osStatus.UpToDate() {
+		return core.StatusUpdateAvailable
+	}
+	if boardStatus != nil && !boardStatus.UpToDate() {
+		return core.StatusUpdateAvailable
+	}
+	return core.StatusUpToDate
+}
+
+// statusCheck describes the command reporting the installed and available versions of a component
+type statusCheck struct {
+	command             string
+	subSystem           string
+	installedKey        string
+	availableKey        string
+	skipIfNoRouterBoard bool
+	// rest reads the versions over the REST API
+	rest func(ctx context.Context, caller core.RESTCaller) (*UpdateStatus, error)
+}
+
+var (
+	routerOSCheck = statusCheck{
+		command:      "/system/package/update/check-for-updates",
+		subSystem:    "RouterOS",
+		installedKey: "installed-version",
+		availableKey: "latest-version",
+		rest:         getRESTRouterOSStatus,
+	}
+	routerBoardCheck = statusCheck{
+		command:             "/system/routerboard/print",
+		subSystem:           "RouterBoard",
+		installedKey:        "current-firmware",
+		availableKey:        "upgrade-firmware",
+		skipIfNoRouterBoard: true,
+		rest:                getRESTRouterBoardStatus,
+	}
+)
+
+// status reads the versions from typed replies over the REST API, structured replies
+// over the RouterOS API, from the CLI output otherwise
+func (c statusCheck) status(ctx context.Context, conn core.SshRunner) (*UpdateStatus, error) {
+	if caller, ok := conn.(core.RESTCaller); ok && c.rest != nil {
+		return c.rest(ctx, caller)
+	}
+	if caller, ok := conn.(core.APICaller); ok {
+		return getAPIUpdateStatus(ctx, caller, c)
+	}
+	return getUpdateStatus(ctx, conn, c.command, c.subSystem, c.installedKey, c.availableKey, c.skipIfNoRouterBoard)
+}
+
+// getAPIUpdateStatus is getUpdateStatus over the RouterOS API
+func getAPIUpdateStatus(ctx context.Context, caller core.APICaller, c statusCheck) (*UpdateStatus, error) {
+	slog.Debug("executing API command", "command", c.command)
+	replies, err := caller.Call(ctx, c.command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run API command: %w", err)
+	}
+
+	// check-for-updates reports its progress in successive replies, the last values win
+	values := map[string]string{}
+	for _, reply := range replies {
+		maps.Copy(values, reply)
+	}
+	return updateStatusFromValues(values, c.subSystem, c.installedKey, c.availableKey, c.skipIfNoRouterBoard, "reply")
+}
+
+// getRESTRouterOSStatus checks for RouterOS updates over the REST API
+func getRESTRouterOSStatus(ctx context.Context, caller core.RESTCaller) (*UpdateStatus, error) {
+	update, err := core.CheckForUpdates(ctx, caller)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for updates: %w", err)
+	}
+	if strings.Contains(update.Status, "ERROR") {
+		return nil, fmt.Errorf("RouterOS check failed: %s", update.Status)
+	}
+	if update.InstalledVersion == "" {
+		return nil, fmt.Errorf("failed to parse installed version: RouterOS version not found in reply")
+	}
+	if update.LatestVersion == "" {
+		return nil, fmt.Errorf("failed to parse available version: RouterOS version not found in reply")
+	}
+	return &UpdateStatus{Installed: update.InstalledVersion, Available: update.LatestVersion}, nil
+}
+
+// getRESTRouterBoardStatus reads the RouterBoard firmware versions over the REST API,
+// nil when the device has no RouterBoard firmware
+func getRESTRouterBoardStatus(ctx context.Context, caller core.RESTCaller) (*UpdateStatus, error) {
+	board, err := core.GetRouterBoard(ctx, caller)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RouterBoard: %w", err)
+	}
+	if !board.Present() {
+		return nil, nil
+	}
+	if board.CurrentFirmware == "" {
+		return nil, fmt.Errorf("failed to parse installed version: RouterBoard version not found in reply")
+	}
+	if board.UpgradeFirmware == "" {
+		return nil, fmt.Errorf("failed to parse available version: RouterBoard version not found in reply")
+	}
+	return &UpdateStatus{Installed: board.CurrentFirmware, Available: board.UpgradeFirmware}, nil
 }
 
 // Generic update status fetcher for RouterOS and RouterBoard
-func getUpdateStatus(conn core.SshRunner, sshCmd, subSystem string, installedRe, availableRe *regexp.Regexp, skipIfNoRouterBoard bool) (*UpdateStatus, error) {
+func getUpdateStatus(ctx context.Context, conn core.SshRunner, sshCmd, subSystem, installedKey, availableKey string, skipIfNoRouterBoard bool) (*UpdateStatus, error) {
 	slog.Debug("executing command", "command", sshCmd)
-	result, err := conn.Run(sshCmd)
+	result, err := conn.RunContext(ctx, sshCmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run SSH command: %w", err)
 	}
-
-	// Check if the output contains an ERROR status
-	if matched, _ := regexp.MatchString(`(?m)^\s*status:\s*ERROR`, result); matched {
-		// Extract the error message from the last status line
-		statusRe := regexp.MustCompile(`(?m)^\s*status:\s*(.+?)[\r\n]*$`)
-		allMatches := statusRe.FindAllStringSubmatch(result, -1)
-		if len(allMatches) > 0 {
-			lastMatch := allMatches[len(allMatches)-1]
-			if len(lastMatch) >= 2 {
-				return nil, fmt.Errorf("%s check failed: %s", subSystem, lastMatch[1])
-			}
-		}
-		return nil, fmt.Errorf("%s check failed with ERROR status", subSystem)
+	records, err := core.ParsePrint(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s status: %w", subSystem, err)
 	}
 
-	if skipIfNoRouterBoard {
-		if matched, _ := regexp.MatchString(`(?m)^\s*routerboard:\s*no`, result); matched {
-			return nil, nil
-		}
+	// check-for-updates prints its progress in successive records, the last values win
+	values := map[string]string{}
+	for _, record := range records {
+		maps.Copy(values, record.Values)
 	}
+	return updateStatusFromValues(values, subSystem, installedKey, availableKey, skipIfNoRouterBoard, "output")
+}
 
-	installedMatches := installedRe.FindStringSubmatch(result)
-	if len(installedMatches) < 2 {
-		return nil, fmt.Errorf("failed to parse installed version: %s version not found in output", subSystem)
+// updateStatusFromValues reads the installed and available versions of a component,
+// nil when skipIfNoRouterBoard is set and the device has no RouterBoard.
+// source names where values come from in errors.
+func updateStatusFromValues(values map[string]string, subSystem, installedKey, availableKey string, skipIfNoRouterBoard bool, source string) (*UpdateStatus, error) {
+	if status := values["status"]; strings.Contains(status, "ERROR") {
+		return nil, fmt.Errorf("%s check failed: %s", subSystem, status)
 	}
-
-	availableMatches := availableRe.FindStringSubmatch(result)
-	if len(availableMatches) < 2 {
-		return nil, fmt.Errorf("failed to parse available version: %s version not found in output", subSystem)
+	if skipIfNoRouterBoard && (values["routerboard"] == "false" || values["routerboard"] == "no") {
+		return nil, nil
 	}
 
-	return &UpdateStatus{Installed: installedMatches[1], Available: availableMatches[1]}, nil
+	installed, available := values[installedKey], values[availableKey]
+	if installed == "" {
+		return nil, fmt.Errorf("failed to parse installed version: %s version not found in %s", subSystem, source)
+	}
+	if available == "" {
+		return nil, fmt.Errorf("failed to parse available version: %s version not found in %s", subSystem, source)
+	}
+	return &UpdateStatus{Installed: installed, Available: available}, nil
 }
 
-// Generic function to apply updates and wait for router to come back
+// Generic function to apply updates and wait for router to come back.
+// Reconnection is attempted with exponential backoff until rebootTimeout expires
+// (ErrRouterDidNotComeBack) or ctx is cancelled.
 func applyUpdate(conn core.SshRunner, ctx context.Context, host, updateCmd, waitMsg string) (core.SshRunner, error) {
-	_, err := conn.Run(updateCmd)
+	_, err := conn.RunContext(ctx, updateCmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run SSH command: %w", err)
 	}
+	// The router reboots, its pooled connection can't be reused
 	_ = conn.Close()
-	fmt.Printf("⏳ %s\n", waitMsg)
-
-	var newConn core.SshRunner
-	for {
-		fmt.Printf("⏳ Waiting for router %v to come back up...\n", host)
-		time.Sleep(reconnectDelay)
+	core.ResetConnection(ctx, host)
+	reporter := core.GetReporter(ctx)
+	reporter.Progress(host, fmt.Sprintf("⏳ %s", waitMsg))
+
+	deadline := time.Now().Add(rebootTimeout)
+	delay := reconnectDelay
+	for attempt := 1; ; attempt++ {
+		reporter.Progress(host, fmt.Sprintf("⏳ Waiting for router %v to come back up...", host))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for router %s: %w", host, ctx.Err())
+		case <-time.After(min(delay, time.Until(deadline))):
+		}
 
-		newConn, err = sshConnectionFactory(ctx, host)
-		if err != nil {
-			continue
+		newConn, err := sshConnectionFactory(ctx, host)
+		if err == nil {
+			return newConn, nil
+		}
+		slog.Debug("router not back yet", "host", host, "attempt", attempt, "error", err)
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w within %s: %w", ErrRouterDidNotComeBack, rebootTimeout, err)
 		}
-		break
+		delay = min(delay*2, reconnectMaxDelay)
 	}
-	return newConn, nil
 }
@@ -1,9 +1,13 @@
 package updates
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"regexp"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -39,6 +43,10 @@ func (m *MockSshRunner) Run(cmd string) (string, error) {
 	return "", nil
 }
 
+func (m *MockSshRunner) RunContext(ctx context.Context, cmd string) (string, error) {
+	return m.Run(cmd)
+}
+
 // MockSshManager is a mock implementation of SshManager for testing
 type MockSshManager struct {
 	CreateConnectionFunc func(ctx context.Context, host string) (core.SshRunner, error)
@@ -254,7 +262,7 @@ func TestUpdates(t *testing.T) {
 			ctx = context.WithValue(ctx, core.SshManagerKey, &MockSshManager{})
 
 			// Execute the function
-			err := updates(ctx, tt.host)
+			_, err := updates(ctx, tt.host)
 
 			// Verify error expectations
 			if (err != nil) != tt.wantErr {
@@ -320,8 +328,8 @@ func TestGetUpdateStatus(t *testing.T) {
 		sshError            error
 		sshCmd              string
 		subSystem           string
-		installedRe         *regexp.Regexp
-		availableRe         *regexp.Regexp
+		installedKey        string
+		availableKey        string
 		skipIfNoRouterBoard bool
 		want                *UpdateStatus
 		wantErr             bool
@@ -336,8 +344,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want: &UpdateStatus{
 				Installed: "7.14.1",
@@ -354,8 +362,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want: &UpdateStatus{
 				Installed: "7.14.0",
@@ -371,8 +379,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want:                nil,
 			wantErr:             true,
@@ -386,8 +394,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want:                nil,
 			wantErr:             true,
@@ -403,8 +411,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/routerboard/print",
 			subSystem:           "RouterBoard",
-			installedRe:         regexp.MustCompile(`.*current-firmware: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*upgrade-firmware: (\S+)`),
+			installedKey:        "current-firmware",
+			availableKey:        "upgrade-firmware",
 			skipIfNoRouterBoard: true,
 			want: &UpdateStatus{
 				Installed: "7.14.1",
@@ -422,8 +430,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/routerboard/print",
 			subSystem:           "RouterBoard",
-			installedRe:         regexp.MustCompile(`.*current-firmware: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*upgrade-firmware: (\S+)`),
+			installedKey:        "current-firmware",
+			availableKey:        "upgrade-firmware",
 			skipIfNoRouterBoard: true,
 			want: &UpdateStatus{
 				Installed: "7.14.0",
@@ -437,8 +445,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/routerboard/print",
 			subSystem:           "RouterBoard",
-			installedRe:         regexp.MustCompile(`.*current-firmware: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*upgrade-firmware: (\S+)`),
+			installedKey:        "current-firmware",
+			availableKey:        "upgrade-firmware",
 			skipIfNoRouterBoard: true,
 			want:                nil,
 			wantErr:             false,
@@ -449,8 +457,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            fmt.Errorf("connection timeout"),
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want:                nil,
 			wantErr:             true,
@@ -464,8 +472,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want:                nil,
 			wantErr:             true,
@@ -479,8 +487,8 @@ func TestGetUpdateStatus(t *testing.T) {
 			sshError:            nil,
 			sshCmd:              "/system/package/update/check-for-updates",
 			subSystem:           "RouterOS",
-			installedRe:         regexp.MustCompile(`.*installed-version: (\S+)`),
-			availableRe:         regexp.MustCompile(`.*latest-version: (\S+)`),
+			installedKey:        "installed-version",
+			availableKey:        "latest-version",
 			skipIfNoRouterBoard: false,
 			want:                nil,
 			wantErr:             true,
@@ -496,7 +504,7 @@ func TestGetUpdateStatus(t *testing.T) {
 				},
 			}
 
-			got, err := getUpdateStatus(mock, tt.sshCmd, tt.subSystem, tt.installedRe, tt.availableRe, tt.skipIfNoRouterBoard)
+			got, err := getUpdateStatus(context.Background(), mock, tt.sshCmd, tt.subSystem, tt.installedKey, tt.availableKey, tt.skipIfNoRouterBoard)
 
 			if tt.wantErr {
 				if err == nil {
@@ -533,6 +541,177 @@ func TestGetUpdateStatus(t *testing.T) {
 	}
 }
 
+// MockAPIRunner is a mock SshRunner using the RouterOS API
+type MockAPIRunner struct {
+	MockSshRunner
+	CallFunc func(command string, args ...string) ([]map[string]string, error)
+}
+
+func (m *MockAPIRunner) Call(ctx context.Context, command string, args ...string) ([]map[string]string, error) {
+	return m.CallFunc(command, args...)
+}
+
+func TestStatusCheck_API(t *testing.T) {
+	tests := []struct {
+		name        string
+		check       statusCheck
+		replies     []map[string]string
+		want        *UpdateStatus
+		errContains string
+	}{
+		{
+			name:  "RouterOS update available, last reply wins",
+			check: routerOSCheck,
+			replies: []map[string]string{
+				{"installed-version": "7.14.1", "status": "finding out latest version..."},
+				{"installed-version": "7.14.1", "latest-version": "7.15.3", "status": "New version is available"},
+			},
+			want: &UpdateStatus{Installed: "7.14.1", Available: "7.15.3"},
+		},
+		{
+			name:        "RouterOS check error",
+			check:       routerOSCheck,
+			replies:     []map[string]string{{"installed-version": "7.14.1", "status": "ERROR: could not resolve dns name"}},
+			errContains: "RouterOS check failed: ERROR: could not resolve dns name",
+		},
+		{
+			name:    "RouterBoard",
+			check:   routerBoardCheck,
+			replies: []map[string]string{{"routerboard": "true", "current-firmware": "7.14.1", "upgrade-firmware": "7.15.3"}},
+			want:    &UpdateStatus{Installed: "7.14.1", Available: "7.15.3"},
+		},
+		{
+			name:    "no RouterBoard",
+			check:   routerBoardCheck,
+			replies: []map[string]string{{"routerboard": "false"}},
+		},
+		{
+			name:        "missing latest version",
+			check:       routerOSCheck,
+			replies:     []map[string]string{{"installed-version": "7.14.1"}},
+			errContains: "failed to parse available version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockAPIRunner{
+				MockSshRunner: MockSshRunner{RunFunc: func(cmd string) (string, error) {
+					t.Errorf("CLI command %q run over the API", cmd)
+					return "", nil
+				}},
+				CallFunc: func(command string, args ...string) ([]map[string]string, error) {
+					if command != tt.check.command {
+						t.Errorf("Call() command = %q, want %q", command, tt.check.command)
+					}
+					return tt.replies, nil
+				},
+			}
+			got, err := tt.check.status(context.Background(), mock)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Fatalf("status() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("status() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("status() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// MockRESTRunner is a mock SshRunner using the REST API, replying with the JSON of a path
+type MockRESTRunner struct {
+	MockSshRunner
+	Replies map[string]string
+}
+
+func (m *MockRESTRunner) Get(ctx context.Context, path string, out any) error {
+	return m.reply(path, out)
+}
+
+func (m *MockRESTRunner) Post(ctx context.Context, path string, body, out any) error {
+	return m.reply(path, out)
+}
+
+func (m *MockRESTRunner) reply(path string, out any) error {
+	reply, ok := m.Replies[path]
+	if !ok {
+		return &core.RESTError{Path: path, Status: 404, Message: "Not Found"}
+	}
+	return json.Unmarshal([]byte(reply), out)
+}
+
+func TestStatusCheck_REST(t *testing.T) {
+	tests := []struct {
+		name        string
+		check       statusCheck
+		replies     map[string]string
+		want        *UpdateStatus
+		errContains string
+	}{
+		{
+			name:  "RouterOS update available, last reply wins",
+			check: routerOSCheck,
+			replies: map[string]string{"system/package/update/check-for-updates": `[
+				{"installed-version":"7.14.1","status":"finding out latest version..."},
+				{"installed-version":"7.14.1","latest-version":"7.15.3","status":"New version is available"}]`},
+			want: &UpdateStatus{Installed: "7.14.1", Available: "7.15.3"},
+		},
+		{
+			name:        "RouterOS check error",
+			check:       routerOSCheck,
+			replies:     map[string]string{"system/package/update/check-for-updates": `{"installed-version":"7.14.1","status":"ERROR: could not resolve dns name"}`},
+			errContains: "RouterOS check failed: ERROR: could not resolve dns name",
+		},
+		{
+			name:    "RouterBoard",
+			check:   routerBoardCheck,
+			replies: map[string]string{"system/routerboard": `{"routerboard":"true","model":"RB5009UG+S+","current-firmware":"7.14.1","upgrade-firmware":"7.15.3"}`},
+			want:    &UpdateStatus{Installed: "7.14.1", Available: "7.15.3"},
+		},
+		{
+			name:    "no RouterBoard",
+			check:   routerBoardCheck,
+			replies: map[string]string{"system/routerboard": `{"routerboard":"false"}`},
+		},
+		{
+			name:        "request rejected",
+			check:       routerBoardCheck,
+			errContains: "failed to read RouterBoard",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockRESTRunner{
+				MockSshRunner: MockSshRunner{RunFunc: func(cmd string) (string, error) {
+					t.Errorf("CLI command %q run over the REST API", cmd)
+					return "", nil
+				}},
+				Replies: tt.replies,
+			}
+			got, err := tt.check.status(context.Background(), mock)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Fatalf("status() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("status() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("status() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFormatUpdateResult(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -732,7 +911,7 @@ func TestCheckCurrentStatus(t *testing.T) {
 				},
 			}
 
-			osStatus, boardStatus, err := checkCurrentStatus(mock)
+			osStatus, boardStatus, err := checkCurrentStatus(context.Background(), mock, "test-router")
 
 			if tt.wantErr {
 				if err == nil {
@@ -880,7 +1059,293 @@ func TestApplyUpdate(t *testing.T) {
 	}
 }
 
-func TestFormatAndDisplayResult(t *testing.T) {
+func TestUpdatesVersionPinning(t *testing.T) {
+	tests := []struct {
+		name          string
+		channel       string
+		target        string
+		inventory     *core.InventoryHost
+		mismatch      string
+		installed     string
+		latest        string
+		wantErr       error
+		wantCommands  []string
+		wantNoInstall bool
+	}{
+		{
+			name:         "channel is set before checking",
+			channel:      "long-term",
+			installed:    "7.12.1",
+			latest:       "7.12.1",
+			wantCommands: []string{"/system/package/update/set channel=long-term", "/system/package/update/check-for-updates"},
+		},
+		{
+			name:         "latest matches target, update installed",
+			target:       "7.12.1",
+			installed:    "7.11.3",
+			latest:       "7.12.1",
+			wantCommands: []string{"/system/package/update/install"},
+		},
+		{
+			name:          "installed matches target, newer latest ignored",
+			target:        "7.12.1",
+			installed:     "7.12.1",
+			latest:        "7.13",
+			wantNoInstall: true,
+		},
+		{
+			name:          "latest differs from target, update refused",
+			target:        "7.12.1",
+			mismatch:      "refuse",
+			installed:     "7.11.3",
+			latest:        "7.13",
+			wantErr:       errVersionMismatch,
+			wantNoInstall: true,
+		},
+		{
+			name:         "latest differs from target, warning only",
+			target:       "7.12.1",
+			mismatch:     "warn",
+			installed:    "7.11.3",
+			latest:       "7.13",
+			wantCommands: []string{"/system/package/update/install"},
+		},
+		{
+			name:          "inventory settings override flags",
+			channel:       "stable",
+			target:        "7.13",
+			inventory:     &core.InventoryHost{Name: "router1", Channel: "long-term", TargetVersion: "7.12.1"},
+			installed:     "7.12.1",
+			latest:        "7.13",
+			wantCommands:  []string{"/system/package/update/set channel=long-term"},
+			wantNoInstall: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalApply, originalFactory, originalDelay := updatesApply, sshConnectionFactory, reconnectDelay
+			originalChannel, originalTarget, originalMismatch := updateChannel, targetVersion, onVersionMismatch
+			defer func() {
+				updatesApply, sshConnectionFactory, reconnectDelay = originalApply, originalFactory, originalDelay
+				updateChannel, targetVersion, onVersionMismatch = originalChannel, originalTarget, originalMismatch
+			}()
+			updatesApply = true
+			reconnectDelay = 1 * time.Millisecond
+			updateChannel, targetVersion, onVersionMismatch = tt.channel, tt.target, "refuse"
+			if tt.mismatch != "" {
+				onVersionMismatch = tt.mismatch
+			}
+
+			var executed []string
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						executed = append(executed, cmd)
+						switch cmd {
+						case "/system/package/update/check-for-updates":
+							return fmt.Sprintf("  installed-version: %s\n  latest-version: %s", tt.installed, tt.latest), nil
+						case "/system/routerboard/print":
+							return "  routerboard: no", nil
+						}
+						return "", nil
+					},
+				}, nil
+			}
+
+			cfg := &core.Config{Hosts: []string{"router1"}}
+			if tt.inventory != nil {
+				cfg.Inventory = &core.Inventory{Hosts: []core.InventoryHost{*tt.inventory}}
+			}
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ConfigKey, cfg)
+			ctx = context.WithValue(ctx, core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+
+			_, err := updates(ctx, "router1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("updates() error = %v, want %v", err, tt.wantErr)
+			}
+			for _, cmd := range tt.wantCommands {
+				if !slices.Contains(executed, cmd) {
+					t.Errorf("expected command %q to be executed, got %q", cmd, executed)
+				}
+			}
+			if tt.wantNoInstall && slices.Contains(executed, "/system/package/update/install") {
+				t.Errorf("update should not be installed, got %q", executed)
+			}
+		})
+	}
+}
+
+func TestApplyUpdateRouterDoesNotComeBack(t *testing.T) {
+	originalDelay, originalMaxDelay, originalTimeout := reconnectDelay, reconnectMaxDelay, rebootTimeout
+	originalFactory := sshConnectionFactory
+	defer func() {
+		reconnectDelay, reconnectMaxDelay, rebootTimeout = originalDelay, originalMaxDelay, originalTimeout
+		sshConnectionFactory = originalFactory
+	}()
+	reconnectDelay = 1 * time.Millisecond
+	reconnectMaxDelay = 4 * time.Millisecond
+
+	tests := []struct {
+		name          string
+		rebootTimeout time.Duration
+		cancel        bool
+		wantErr       error
+		wantStatus    string
+	}{
+		{
+			name:          "reboot timeout expires",
+			rebootTimeout: 30 * time.Millisecond,
+			wantErr:       ErrRouterDidNotComeBack,
+			wantStatus:    core.StatusDidNotComeBack,
+		},
+		{
+			name:          "context cancelled while waiting",
+			rebootTimeout: time.Hour,
+			cancel:        true,
+			wantErr:       context.Canceled,
+			wantStatus:    core.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rebootTimeout = tt.rebootTimeout
+
+			var buf bytes.Buffer
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf)))
+			defer cancel()
+
+			// First connection succeeds, the router never answers after reboot
+			attempts := 0
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				attempts++
+				if attempts == 1 {
+					return &MockSshRunner{
+						RunFunc: func(cmd string) (string, error) {
+							if strings.Contains(cmd, "check-for-updates") {
+								return "  installed-version: 7.13\n  latest-version: 7.14", nil
+							}
+							return "  routerboard: no", nil
+						},
+					}, nil
+				}
+				if tt.cancel && attempts == 3 {
+					cancel()
+				}
+				return nil, fmt.Errorf("connection refused")
+			}
+
+			originalApply := updatesApply
+			defer func() { updatesApply = originalApply }()
+			updatesApply = true
+
+			done := make(chan error)
+			go func() { done <- updateHost(ctx, "test-router") }()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("updateHost() error = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("updateHost() did not return")
+			}
+			if !strings.Contains(buf.String(), fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, buf.String())
+			}
+		})
+	}
+}
+
+func TestUpdateHostReportsSingleResult(t *testing.T) {
+	originalDelay, originalFactory, originalApply := reconnectDelay, sshConnectionFactory, updatesApply
+	defer func() {
+		reconnectDelay, sshConnectionFactory, updatesApply = originalDelay, originalFactory, originalApply
+	}()
+	reconnectDelay = 1 * time.Millisecond
+	updatesApply = true
+
+	tests := []struct {
+		name       string
+		sshError   error
+		checkOut   string
+		wantErr    bool
+		wantStatus string
+	}{
+		{
+			name:       "update applied",
+			checkOut:   "  installed-version: 7.13\n  latest-version: 7.14",
+			wantStatus: core.StatusUpdated,
+		},
+		{
+			name:       "already up to date",
+			checkOut:   "  installed-version: 7.14\n  latest-version: 7.14",
+			wantStatus: core.StatusUpToDate,
+		},
+		{
+			name:       "connection refused",
+			sshError:   fmt.Errorf("connection refused"),
+			wantErr:    true,
+			wantStatus: core.StatusUnreachable,
+		},
+		{
+			name:       "check output not parsable",
+			checkOut:   "  status: ERROR: could not resolve dns name",
+			wantErr:    true,
+			wantStatus: core.StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installed := false
+			sshConnectionFactory = func(ctx context.Context, host string) (core.SshRunner, error) {
+				if tt.sshError != nil {
+					return nil, tt.sshError
+				}
+				return &MockSshRunner{
+					RunFunc: func(cmd string) (string, error) {
+						switch cmd {
+						case "/system/package/update/check-for-updates":
+							if installed {
+								return "  installed-version: 7.14\n  latest-version: 7.14", nil
+							}
+							return tt.checkOut, nil
+						case "/system/package/update/install":
+							installed = true
+							return "", nil
+						}
+						return "  routerboard: no", nil
+					},
+				}, nil
+			}
+
+			var buf bytes.Buffer
+			ctx := context.WithValue(context.Background(), core.ReporterKey, core.NewReporter(core.OutputNDJSON, &buf))
+			err := updateHost(ctx, "router1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var results []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if strings.Contains(line, `"status"`) {
+					results = append(results, line)
+				}
+			}
+			if len(results) != 1 {
+				t.Fatalf("expected a single result, got %d:\n%s", len(results), buf.String())
+			}
+			if !strings.Contains(results[0], fmt.Sprintf(`"status":%q`, tt.wantStatus)) {
+				t.Errorf("result status should be %q, got %s", tt.wantStatus, results[0])
+			}
+		})
+	}
+}
+
+func TestUpdateOutcomeResult(t *testing.T) {
 	tests := []struct {
 		name        string
 		host        string
@@ -936,10 +1401,13 @@ func TestFormatAndDisplayResult(t *testing.T) {
 				t.Errorf("formatUpdateResult() = %q, want %q", expected, tt.wantOutput)
 			}
 
-			// Call formatAndDisplayResult to ensure it doesn't panic
-			// Note: We can't easily capture stdout in a unit test without redirecting it,
-			// but calling it ensures the function executes and code coverage is counted
-			formatAndDisplayResult(tt.host, tt.osStatus, tt.boardStatus)
+			// Report through a text reporter and check the rendered line
+			var buf bytes.Buffer
+			outcome := updateOutcome{status: updateResultStatus(tt.osStatus, tt.boardStatus), osStatus: tt.osStatus, boardStatus: tt.boardStatus}
+			core.NewReporter(core.OutputText, &buf).Report(outcome.result(tt.host, 0))
+			if buf.String() != tt.wantOutput+"\n" {
+				t.Errorf("outcome.result() output = %q, want %q", buf.String(), tt.wantOutput+"\n")
+			}
 		})
 	}
 }
@@ -1052,7 +1520,7 @@ func TestApplyComponentUpdate(t *testing.T) {
 
 			ctx := context.WithValue(context.Background(), core.SshManagerKey, &MockSshManager{})
 
-			err := applyComponentUpdate(initialMock, ctx, "test-router", tt.component, tt.updateCmd, tt.checkBoth)
+			outcome, err := applyComponentUpdate(initialMock, ctx, "test-router", tt.component, tt.updateCmd, tt.checkBoth)
 
 			if tt.wantErr {
 				if err == nil {
@@ -1066,6 +1534,10 @@ func TestApplyComponentUpdate(t *testing.T) {
 				return
 			}
 
+			if outcome.status != core.StatusUpdated {
+				t.Errorf("applyComponentUpdate() status = %q, want %q", outcome.status, core.StatusUpdated)
+			}
+
 			if !runCalled {
 				t.Errorf("Update command was not executed")
 			}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// HostCertInfo stores the pinned TLS certificate of a router REST API,
+// captured during enrollment like the SSH host key
+type HostCertInfo struct {
+	Host        string    `json:"host"`
+	CapturedAt  time.Time `json:"capturedAt"`
+	Subject     string    `json:"subject"`
+	NotAfter    time.Time `json:"notAfter"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+// HostCertFilePath returns the path to the pinned certificate file of a host,
+// next to its host key file
+func HostCertFilePath(host string) string {
+	hostInfo := ParseHost(host)
+	return fmt.Sprintf("%s.certpin", hostInfo.ShortName)
+}
+
+// HostCertExists checks if a pinned certificate file exists for the given host
+func HostCertExists(host string) bool {
+	_, err := os.Stat(HostCertFilePath(host))
+	return err == nil
+}
+
+// GetCertFingerprint returns the SHA256 fingerprint of a certificate
+func GetCertFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return fmt.Sprintf("SHA256:%s", base64.StdEncoding.EncodeToString(hash[:]))
+}
+
+// CaptureHostCert pins the certificate of a host to disk
+func CaptureHostCert(host string, cert *x509.Certificate) error {
+	path := HostCertFilePath(host)
+	info := HostCertInfo{
+		Host:        host,
+		CapturedAt:  time.Now().UTC(),
+		Subject:     cert.Subject.String(),
+		NotAfter:    cert.NotAfter.UTC(),
+		Fingerprint: GetCertFingerprint(cert),
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal certificate info: %w", err)
+	}
+
+	slog.Debug("saving certificate pin", "path", path, "subject", info.Subject, "fingerprint", info.Fingerprint)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write certificate pin file: %w", err)
+	}
+
+	slog.Info("certificate pin saved", "host", host, "file", path)
+	return nil
+}
+
+// LoadHostCertInfo returns the pinned certificate of a host from disk
+func LoadHostCertInfo(host string) (*HostCertInfo, error) {
+	data, err := os.ReadFile(HostCertFilePath(host))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate pin file: %w", err)
+	}
+
+	var info HostCertInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal certificate info: %w", err)
+	}
+	return &info, nil
+}
+
+// VerifyHostCert compares a remote certificate with the pinned one
+func VerifyHostCert(host string, cert *x509.Certificate) error {
+	info, err := LoadHostCertInfo(host)
+	if err != nil {
+		return fmt.Errorf("failed to load pinned certificate: %w", err)
+	}
+
+	remoteFp := GetCertFingerprint(cert)
+	if info.Fingerprint != remoteFp {
+		return fmt.Errorf("certificate mismatch: pinned=%s remote=%s", info.Fingerprint, remoteFp)
+	}
+	return nil
+}
+
+// DeleteHostCert removes a pinned certificate file
+func DeleteHostCert(host string) error {
+	path := HostCertFilePath(host)
+
+	if !HostCertExists(host) {
+		return fmt.Errorf("certificate pin file does not exist: %s", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete certificate pin file: %w", err)
+	}
+
+	slog.Info("certificate pin deleted", "host", host, "file", path)
+	return nil
+}
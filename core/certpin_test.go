@@ -0,0 +1,90 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// generateTestCert generates a self-signed certificate for testing
+func generateTestCert(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestHostCertFilePath(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "router1", expected: "router1.certpin"},
+		{host: "router1.home.local", expected: "router1.certpin"},
+		{host: "192.168.1.1", expected: "192.168.1.1.certpin"},
+		{host: "router1:2222", expected: "router1.certpin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if result := HostCertFilePath(tt.host); result != tt.expected {
+				t.Errorf("HostCertFilePath(%q) = %q, want %q", tt.host, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCaptureAndVerifyHostCert(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cert := generateTestCert(t, "router1")
+
+	if HostCertExists("router1") {
+		t.Fatal("HostCertExists() = true before capture")
+	}
+	if err := CaptureHostCert("router1", cert); err != nil {
+		t.Fatalf("CaptureHostCert() error = %v", err)
+	}
+	info, err := LoadHostCertInfo("router1")
+	if err != nil {
+		t.Fatalf("LoadHostCertInfo() error = %v", err)
+	}
+	if info.Subject != "CN=router1" || info.Fingerprint != GetCertFingerprint(cert) || !strings.HasPrefix(info.Fingerprint, "SHA256:") {
+		t.Errorf("LoadHostCertInfo() = %+v", info)
+	}
+
+	if err := VerifyHostCert("router1", cert); err != nil {
+		t.Errorf("VerifyHostCert() with pinned certificate error = %v", err)
+	}
+	if err := VerifyHostCert("router1", generateTestCert(t, "router1")); err == nil || !strings.Contains(err.Error(), "certificate mismatch") {
+		t.Errorf("VerifyHostCert() with another certificate error = %v, want a mismatch", err)
+	}
+
+	if err := DeleteHostCert("router1"); err != nil {
+		t.Fatalf("DeleteHostCert() error = %v", err)
+	}
+	if err := DeleteHostCert("router1"); err == nil {
+		t.Error("DeleteHostCert() of a missing pin error = nil")
+	}
+}
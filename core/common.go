@@ -20,6 +20,10 @@ const (
 	SshManagerKey ContextKey = "ssh_manager"
 	// EnrollmentModeKey is the context key for storing enrollment mode
 	EnrollmentModeKey ContextKey = "enrollment_mode"
+	// ReporterKey is the context key for storing Reporter
+	ReporterKey ContextKey = "reporter"
+	// LocalModeKey is the context key marking commands that work on local files only
+	LocalModeKey ContextKey = "local_mode"
 )
 
 // GetConfig extracts *config.Config from context
@@ -46,6 +50,12 @@ func IsEnrollmentMode(ctx context.Context) bool {
 	return ok && mode
 }
 
+// IsLocalMode checks if the command works on local files only, without routers
+func IsLocalMode(ctx context.Context) bool {
+	mode, ok := ctx.Value(LocalModeKey).(bool)
+	return ok && mode
+}
+
 // SetupLogging sets slog default logger to the given level
 func SetupLogging(level slog.Level) {
 	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
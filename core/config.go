@@ -1,8 +1,18 @@
 package core
 
+import "time"
+
 type Config struct {
 	Hosts            []string
 	User             string
 	Debug            bool
 	SkipHostKeyCheck bool
+	Parallel         int
+	CommandTimeout   time.Duration
+	Transport        string
+	Output           string
+	InventoryFile    string
+	Groups           []string
+	Tags             []string
+	Inventory        *Inventory
 }
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is a single line operation of a diff
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines computes a line diff between a and b based on their longest common subsequence.
+// Hirschberg's algorithm keeps memory linear in the number of lines.
+func diffLines(a, b []string) []diffOp {
+	// Lines are compared as integers
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := lineDiff{
+		a:   a,
+		b:   b,
+		x:   intern(a),
+		y:   intern(b),
+		fwd: make([]int, len(b)+1),
+		bwd: make([]int, len(b)+1),
+		ops: make([]diffOp, 0, max(len(a), len(b))),
+	}
+	d.diff(0, len(a), 0, len(b))
+	return d.ops
+}
+
+// lineDiff holds the state of a Hirschberg diff: the lines, their ids and two LCS length rows
+type lineDiff struct {
+	a, b     []string
+	x, y     []int
+	fwd, bwd []int
+	ops      []diffOp
+}
+
+// diff appends the operations turning a[aLo:aHi] into b[bLo:bHi]
+func (d *lineDiff) diff(aLo, aHi, bLo, bHi int) {
+	// Common prefix and suffix are kept as is
+	for aLo < aHi && bLo < bHi && d.x[aLo] == d.y[bLo] {
+		d.ops = append(d.ops, diffOp{' ', d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffixEnd := aHi
+	for aLo < aHi && bLo < bHi && d.x[aHi-1] == d.y[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		d.emit('+', d.b[bLo:bHi])
+	case bLo == bHi:
+		d.emit('-', d.a[aLo:aHi])
+	case aHi-aLo == 1:
+		// A single line is either kept somewhere in b, or replaced
+		j := bLo
+		for j < bHi && d.y[j] != d.x[aLo] {
+			j++
+		}
+		if j == bHi {
+			d.emit('-', d.a[aLo:aHi])
+			d.emit('+', d.b[bLo:bHi])
+			break
+		}
+		d.emit('+', d.b[bLo:j])
+		d.emit(' ', d.a[aLo:aHi])
+		d.emit('+', d.b[j+1:bHi])
+	default:
+		// Split a in halves, and b where the LCS lengths of both halves add up to the most
+		mid := (aLo + aHi) / 2
+		d.forward(aLo, mid, bLo, bHi)
+		d.backward(mid, aHi, bLo, bHi)
+		split, best := bLo, -1
+		for j := 0; j <= bHi-bLo; j++ {
+			if n := d.fwd[j] + d.bwd[j]; n > best {
+				split, best = bLo+j, n
+			}
+		}
+		d.diff(aLo, mid, bLo, split)
+		d.diff(mid, aHi, split, bHi)
+	}
+	d.emit(' ', d.a[aHi:suffixEnd])
+}
+
+// forward sets fwd[j] to the LCS length of a[aLo:aHi] and b[bLo:bLo+j]
+func (d *lineDiff) forward(aLo, aHi, bLo, bHi int) {
+	row := d.fwd[:bHi-bLo+1]
+	clear(row)
+	for i := aLo; i < aHi; i++ {
+		diag := 0
+		for j := 1; j < len(row); j++ {
+			above := row[j]
+			if d.x[i] == d.y[bLo+j-1] {
+				row[j] = diag + 1
+			} else {
+				row[j] = max(above, row[j-1])
+			}
+			diag = above
+		}
+	}
+}
+
+// backward sets bwd[j] to the LCS length of a[aLo:aHi] and b[bLo+j:bHi]
+func (d *lineDiff) backward(aLo, aHi, bLo, bHi int) {
+	row := d.bwd[:bHi-bLo+1]
+	clear(row)
+	for i := aHi - 1; i >= aLo; i-- {
+		diag := 0
+		for j := len(row) - 2; j >= 0; j-- {
+			below := row[j]
+			if d.x[i] == d.y[bLo+j] {
+				row[j] = diag + 1
+			} else {
+				row[j] = max(below, row[j+1])
+			}
+			diag = below
+		}
+	}
+}
+
+// emit appends an operation of the given kind for each line
+func (d *lineDiff) emit(kind byte, lines []string) {
+	for _, line := range lines {
+		d.ops = append(d.ops, diffOp{kind, line})
+	}
+}
+
+// UnifiedDiff returns a unified diff between a and b with the given number of context lines.
+// An empty string is returned when both sides are identical.
+func UnifiedDiff(aName, bName string, a, b []string, context int) string {
+	ops := diffLines(a, b)
+
+	// Find ranges of ops to print: changes plus surrounding context
+	type hunk struct{ start, end int }
+	var hunks []hunk
+	for idx, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		start, end := max(idx-context, 0), min(idx+context+1, len(ops))
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	// Line numbers (1-based) on each side at the start of every op
+	aLine, bLine := make([]int, len(ops)), make([]int, len(ops))
+	ai, bi := 1, 1
+	for idx, op := range ops {
+		aLine[idx], bLine[idx] = ai, bi
+		if op.kind != '+' {
+			ai++
+		}
+		if op.kind != '-' {
+			bi++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	for _, h := range hunks {
+		aCount, bCount := 0, 0
+		for _, op := range ops[h.start:h.end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		aStart, bStart := aLine[h.start], bLine[h.start]
+		// Unified diff convention: empty ranges start at the line before
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, op := range ops[h.start:h.end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
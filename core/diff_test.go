@@ -0,0 +1,138 @@
+package core
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       []string
+		b       []string
+		context int
+		want    string
+	}{
+		{
+			name: "identical",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "b", "c"},
+			want: "",
+		},
+		{
+			name:    "single line changed",
+			a:       []string{"a", "b", "c"},
+			b:       []string{"a", "x", "c"},
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name:    "line added at end",
+			a:       []string{"a", "b"},
+			b:       []string{"a", "b", "c"},
+			context: 0,
+			want:    "--- old\n+++ new\n@@ -2,0 +3,1 @@\n+c\n",
+		},
+		{
+			name:    "line removed at start",
+			a:       []string{"a", "b", "c"},
+			b:       []string{"b", "c"},
+			context: 0,
+			want:    "--- old\n+++ new\n@@ -1,1 +0,0 @@\n-a\n",
+		},
+		{
+			name:    "separate hunks",
+			a:       []string{"1", "2", "3", "4", "5", "6", "7", "8"},
+			b:       []string{"1", "x", "3", "4", "5", "6", "y", "8"},
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n@@ -6,3 +6,3 @@\n 6\n-7\n+y\n 8\n",
+		},
+		{
+			name:    "empty old side",
+			a:       nil,
+			b:       []string{"a"},
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("old", "new", tt.a, tt.b, tt.context)
+			if got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	// lcsLength is the quadratic reference the diff must agree with
+	lcsLength := func(a, b []string) int {
+		prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+		for i := range a {
+			for j := range b {
+				if a[i] == b[j] {
+					cur[j+1] = prev[j] + 1
+				} else {
+					cur[j+1] = max(prev[j+1], cur[j])
+				}
+			}
+			prev, cur = cur, prev
+		}
+		return prev[len(b)]
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	lines := func() []string {
+		out := make([]string, rng.IntN(30))
+		for i := range out {
+			out[i] = strconv.Itoa(rng.IntN(6))
+		}
+		return out
+	}
+	for range 500 {
+		a, b := lines(), lines()
+		var kept, gotA, gotB []string
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind == ' ' {
+				kept = append(kept, op.line)
+			}
+		}
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("diffLines(%q, %q) does not rebuild both sides: %q, %q", a, b, gotA, gotB)
+		}
+		if want := lcsLength(a, b); len(kept) != want {
+			t.Fatalf("diffLines(%q, %q) keeps %d lines, want %d", a, b, len(kept), want)
+		}
+	}
+}
+
+func TestDiffLinesLargeExports(t *testing.T) {
+	a := make([]string, 5000)
+	for i := range a {
+		a[i] = "add name=item" + strconv.Itoa(i)
+	}
+	b := slices.Clone(a)
+	b[100], b[4000] = "add name=changed", "add name=changed"
+	b = append(b[:2000], b[2100:]...)
+
+	ops := diffLines(a, b)
+	changes := 0
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changes++
+		}
+	}
+	if changes != 104 {
+		t.Errorf("diffLines() found %d changed lines, want 104", changes)
+	}
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptedExt is appended to the name of encrypted files
+const EncryptedExt = ".enc"
+
+// encryptedMagic starts every encrypted file, followed by the scheme byte
+var encryptedMagic = []byte("mfa-enc1")
+
+// Encryption schemes
+const (
+	// schemePassphrase: scrypt salt, secretbox nonce and secretbox sealed data
+	schemePassphrase byte = 'p'
+	// schemeX25519: anonymous sealed box to the recipient public key
+	schemeX25519 byte = 'x'
+)
+
+// scrypt parameters used to derive the key from a passphrase
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptSaltLen = 16
+)
+
+// FileEncrypter encrypts whole files, with a passphrase or to an X25519 recipient
+type FileEncrypter struct {
+	Passphrase string
+	Recipient  *[32]byte
+}
+
+// Enabled reports whether a passphrase or a recipient is configured
+func (e FileEncrypter) Enabled() bool {
+	return e.Passphrase != "" || e.Recipient != nil
+}
+
+// Validate checks exactly one of passphrase and recipient is configured
+func (e FileEncrypter) Validate() error {
+	if e.Passphrase != "" && e.Recipient != nil {
+		return fmt.Errorf("encrypt with either a passphrase or a recipient, not both")
+	}
+	return nil
+}
+
+// Encrypt returns the encrypted file content
+func (e FileEncrypter) Encrypt(data []byte) ([]byte, error) {
+	out := bytes.Clone(encryptedMagic)
+	switch {
+	case e.Recipient != nil:
+		out = append(out, schemeX25519)
+		return box.SealAnonymous(out, data, e.Recipient, rand.Reader)
+	case e.Passphrase != "":
+		salt := make([]byte, scryptSaltLen)
+		var nonce [24]byte
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return nil, err
+		}
+		key, err := passphraseKey(e.Passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, schemePassphrase)
+		out = append(out, salt...)
+		out = append(out, nonce[:]...)
+		return secretbox.Seal(out, data, &nonce, key), nil
+	}
+	return nil, fmt.Errorf("no passphrase or recipient to encrypt with")
+}
+
+// FileDecrypter decrypts files written by a FileEncrypter, with the passphrase
+// or the recipient key pair
+type FileDecrypter struct {
+	Passphrase string
+	PublicKey  *[32]byte
+	PrivateKey *[32]byte
+}
+
+// Decrypt returns the decrypted file content
+func (d FileDecrypter) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("not an encrypted file")
+	}
+	scheme, payload := data[len(encryptedMagic)], data[len(encryptedMagic)+1:]
+	switch scheme {
+	case schemeX25519:
+		if d.PrivateKey == nil {
+			return nil, fmt.Errorf("file encrypted to a recipient, an identity is required")
+		}
+		plain, ok := box.OpenAnonymous(nil, payload, d.PublicKey, d.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("file not encrypted for this identity")
+		}
+		return plain, nil
+	case schemePassphrase:
+		if d.Passphrase == "" {
+			return nil, fmt.Errorf("file encrypted with a passphrase, a passphrase is required")
+		}
+		if len(payload) < scryptSaltLen+24 {
+			return nil, fmt.Errorf("truncated encrypted file")
+		}
+		salt, nonce, sealed := payload[:scryptSaltLen], (*[24]byte)(payload[scryptSaltLen:scryptSaltLen+24]), payload[scryptSaltLen+24:]
+		key, err := passphraseKey(d.Passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+		plain, ok := secretbox.Open(nil, sealed, nonce, key)
+		if !ok {
+			return nil, fmt.Errorf("wrong passphrase or corrupted file")
+		}
+		return plain, nil
+	}
+	return nil, fmt.Errorf("unknown encryption scheme %q", scheme)
+}
+
+// IsEncrypted reports whether data was written by a FileEncrypter
+func IsEncrypted(data []byte) bool {
+	return len(data) > len(encryptedMagic) && bytes.HasPrefix(data, encryptedMagic)
+}
+
+// passphraseKey derives a secretbox key from a passphrase
+func passphraseKey(passphrase string, salt []byte) (*[32]byte, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from passphrase: %w", err)
+	}
+	return (*[32]byte)(key), nil
+}
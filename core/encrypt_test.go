@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestFileEncryptionRoundTrip(t *testing.T) {
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, otherPrivate, _ := box.GenerateKey(rand.Reader)
+	plain := []byte(sensitiveExport)
+
+	tests := []struct {
+		name      string
+		encrypter FileEncrypter
+		decrypter FileDecrypter
+		wrong     FileDecrypter
+	}{
+		{
+			name:      "passphrase",
+			encrypter: FileEncrypter{Passphrase: "correct horse"},
+			decrypter: FileDecrypter{Passphrase: "correct horse"},
+			wrong:     FileDecrypter{Passphrase: "battery staple"},
+		},
+		{
+			name:      "recipient",
+			encrypter: FileEncrypter{Recipient: public},
+			decrypter: FileDecrypter{PublicKey: public, PrivateKey: private},
+			wrong:     FileDecrypter{PublicKey: otherPublic, PrivateKey: otherPrivate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := tt.encrypter.Encrypt(plain)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if !IsEncrypted(encrypted) {
+				t.Error("IsEncrypted() = false for encrypted data")
+			}
+			if bytes.Contains(encrypted, []byte("p4ss")) {
+				t.Error("encrypted data contains a secret in clear text")
+			}
+
+			got, err := tt.decrypter.Decrypt(encrypted)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("Decrypt() = %q, want %q", got, plain)
+			}
+			if _, err := tt.wrong.Decrypt(encrypted); err == nil {
+				t.Error("Decrypt() with the wrong secret should fail")
+			}
+			if _, err := (FileDecrypter{}).Decrypt(encrypted); err == nil {
+				t.Error("Decrypt() without secret should fail")
+			}
+		})
+	}
+}
+
+func TestFileEncrypterValidate(t *testing.T) {
+	public, _, _ := box.GenerateKey(rand.Reader)
+	if err := (FileEncrypter{Passphrase: "x", Recipient: public}).Validate(); err == nil {
+		t.Error("Validate() with passphrase and recipient should fail")
+	}
+	if _, err := (FileDecrypter{Passphrase: "x"}).Decrypt([]byte(sensitiveExport)); err == nil {
+		t.Error("Decrypt() of a plain file should fail")
+	}
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// HostFunc is the per-host operation executed by RunFleet
+type HostFunc func(ctx context.Context, host string) error
+
+// HostResult holds the outcome of a HostFunc for a single host
+type HostResult struct {
+	Host     string
+	Err      error
+	Duration time.Duration
+}
+
+// FleetError is returned by FleetResults.Err when at least one host failed
+type FleetError struct {
+	Failed int
+	Total  int
+	Last   error
+	Errors []error
+}
+
+func (e *FleetError) Error() string {
+	if e.Failed == e.Total {
+		return fmt.Sprintf("all %d hosts failed: %v", e.Total, e.Last)
+	}
+	return fmt.Sprintf("%d of %d hosts failed: %v", e.Failed, e.Total, e.Last)
+}
+
+// Unwrap returns the errors of all failed hosts, so errors.Is matches any of them
+func (e *FleetError) Unwrap() []error {
+	return e.Errors
+}
+
+// FleetResults is the ordered list of results returned by RunFleet
+// (same order as the hosts given as input)
+type FleetResults []HostResult
+
+// Failed returns the number of hosts whose HostFunc returned an error
+func (r FleetResults) Failed() int {
+	failed := 0
+	for _, res := range r {
+		if res.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Err returns a *FleetError summarizing failures, or nil if every host succeeded
+func (r FleetResults) Err() error {
+	var errs []error
+	for _, res := range r {
+		if res.Err != nil {
+			errs = append(errs, res.Err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &FleetError{Failed: len(errs), Total: len(r), Last: errs[len(errs)-1], Errors: errs}
+}
+
+// RunFleet executes fn for every host using a pool of at most parallel workers.
+// Each host gets its own cancellable context derived from ctx. Once ctx is
+// cancelled, hosts that have not started yet are reported with ctx.Err().
+// Results are returned in the same order as hosts, whatever the completion order.
+func RunFleet(ctx context.Context, hosts []string, parallel int, fn HostFunc) FleetResults {
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel > len(hosts) {
+		parallel = len(hosts)
+	}
+	slog.Debug("running fleet operation", "hosts", len(hosts), "parallel", parallel)
+
+	results := make(FleetResults, len(hosts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for range parallel {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = runHost(ctx, hosts[i], fn)
+			}
+		}()
+	}
+
+	for i, host := range hosts {
+		// Stop scheduling new hosts once the parent context is done
+		if err := ctx.Err(); err != nil {
+			results[i] = HostResult{Host: host, Err: err}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// runHost executes fn for a single host with its own cancellable context
+func runHost(ctx context.Context, host string, fn HostFunc) HostResult {
+	hostCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(hostCtx, host)
+	duration := time.Since(start)
+	if err != nil {
+		slog.Debug("fleet host failed", "host", host, "duration", duration, "error", err)
+	} else {
+		slog.Debug("fleet host succeeded", "host", host, "duration", duration)
+	}
+	return HostResult{Host: host, Err: err, Duration: duration}
+}
+
+// PrintSummary writes a summary table of fleet results to w
+func PrintSummary(w io.Writer, results FleetResults) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "HOST\tSTATUS\tDURATION\tERROR")
+	for _, res := range results {
+		status := "ok"
+		errMsg := ""
+		if res.Err != nil {
+			status = "failed"
+			if errors.Is(res.Err, context.Canceled) || errors.Is(res.Err, context.DeadlineExceeded) {
+				status = "cancelled"
+			}
+			errMsg = res.Err.Error()
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Host, status, res.Duration.Round(time.Millisecond), errMsg)
+	}
+	_, _ = fmt.Fprintf(tw, "\n%d hosts, %d succeeded, %d failed\n", len(results), len(results)-results.Failed(), results.Failed())
+	_ = tw.Flush()
+}
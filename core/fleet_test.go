@@ -0,0 +1,213 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunFleet(t *testing.T) {
+	tests := []struct {
+		name       string
+		hosts      []string
+		parallel   int
+		failHosts  map[string]bool
+		wantFailed int
+	}{
+		{
+			name:     "sequential execution",
+			hosts:    []string{"router1", "router2", "router3"},
+			parallel: 1,
+		},
+		{
+			name:     "parallel execution",
+			hosts:    []string{"router1", "router2", "router3", "router4"},
+			parallel: 2,
+		},
+		{
+			name:     "parallel greater than host count",
+			hosts:    []string{"router1", "router2"},
+			parallel: 10,
+		},
+		{
+			name:     "zero parallel falls back to sequential",
+			hosts:    []string{"router1", "router2"},
+			parallel: 0,
+		},
+		{
+			name:       "some hosts fail",
+			hosts:      []string{"router1", "router2", "router3"},
+			parallel:   3,
+			failHosts:  map[string]bool{"router2": true},
+			wantFailed: 1,
+		},
+		{
+			name:     "no hosts",
+			hosts:    []string{},
+			parallel: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := RunFleet(context.Background(), tt.hosts, tt.parallel, func(ctx context.Context, host string) error {
+				if tt.failHosts[host] {
+					return fmt.Errorf("failed on %s", host)
+				}
+				return nil
+			})
+
+			if len(results) != len(tt.hosts) {
+				t.Fatalf("RunFleet() returned %d results, want %d", len(results), len(tt.hosts))
+			}
+			for i, res := range results {
+				if res.Host != tt.hosts[i] {
+					t.Errorf("results[%d].Host = %s, want %s", i, res.Host, tt.hosts[i])
+				}
+				if (res.Err != nil) != tt.failHosts[res.Host] {
+					t.Errorf("results[%d].Err = %v, want failure %v", i, res.Err, tt.failHosts[res.Host])
+				}
+			}
+			if results.Failed() != tt.wantFailed {
+				t.Errorf("Failed() = %d, want %d", results.Failed(), tt.wantFailed)
+			}
+			if (results.Err() != nil) != (tt.wantFailed > 0) {
+				t.Errorf("Err() = %v, want failure %v", results.Err(), tt.wantFailed > 0)
+			}
+		})
+	}
+}
+
+func TestRunFleetConcurrencyLimit(t *testing.T) {
+	hosts := []string{"r1", "r2", "r3", "r4", "r5", "r6"}
+	var running, maxRunning int32
+
+	RunFleet(context.Background(), hosts, 2, func(ctx context.Context, host string) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("observed %d concurrent hosts, want at most 2", maxRunning)
+	}
+	if maxRunning < 2 {
+		t.Errorf("observed %d concurrent hosts, want hosts to run in parallel", maxRunning)
+	}
+}
+
+func TestRunFleetOrderedResults(t *testing.T) {
+	hosts := []string{"slow", "medium", "fast"}
+	delays := map[string]time.Duration{
+		"slow":   30 * time.Millisecond,
+		"medium": 15 * time.Millisecond,
+		"fast":   0,
+	}
+
+	results := RunFleet(context.Background(), hosts, 3, func(ctx context.Context, host string) error {
+		time.Sleep(delays[host])
+		return nil
+	})
+
+	for i, res := range results {
+		if res.Host != hosts[i] {
+			t.Errorf("results[%d].Host = %s, want %s", i, res.Host, hosts[i])
+		}
+	}
+}
+
+func TestRunFleetCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hosts := []string{"router1", "router2", "router3"}
+
+	var mu sync.Mutex
+	var started []string
+	results := RunFleet(ctx, hosts, 1, func(ctx context.Context, host string) error {
+		mu.Lock()
+		started = append(started, host)
+		mu.Unlock()
+		// Cancel the whole run from within the first host
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if len(started) != 1 {
+		t.Errorf("expected only the first host to start, got %v", started)
+	}
+	for i, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("results[%d].Err = %v, want context.Canceled", i, res.Err)
+		}
+	}
+}
+
+func TestFleetError(t *testing.T) {
+	tests := []struct {
+		name        string
+		results     FleetResults
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:    "all succeeded",
+			results: FleetResults{{Host: "r1"}, {Host: "r2"}},
+			wantErr: false,
+		},
+		{
+			name:        "partial failure",
+			results:     FleetResults{{Host: "r1"}, {Host: "r2", Err: fmt.Errorf("boom")}},
+			wantErr:     true,
+			errContains: "1 of 2 hosts failed: boom",
+		},
+		{
+			name:        "all failed",
+			results:     FleetResults{{Host: "r1", Err: fmt.Errorf("first")}, {Host: "r2", Err: fmt.Errorf("second")}},
+			wantErr:     true,
+			errContains: "all 2 hosts failed: second",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.results.Err()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Err() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("Err() = %v, want error containing %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	results := FleetResults{
+		{Host: "router1", Duration: 1500 * time.Millisecond},
+		{Host: "router2", Err: fmt.Errorf("connection refused")},
+		{Host: "router3", Err: context.Canceled},
+	}
+
+	var buf bytes.Buffer
+	PrintSummary(&buf, results)
+	output := buf.String()
+
+	for _, want := range []string{"HOST", "router1", "ok", "1.5s", "router2", "failed", "connection refused", "router3", "cancelled", "3 hosts, 1 succeeded, 2 failed"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("PrintSummary() output missing %q:\n%s", want, output)
+		}
+	}
+}
@@ -23,11 +23,42 @@ type HostInfo struct {
 	//   Hostname: as-is (router1 → router1)
 
 	// SSH config details (optional, from ssh_config)
-	IdentityFile             string
+	IdentityFile             string   // First of IdentityFiles
+	IdentityFiles            []string // Tried in order
 	IdentitiesOnly           string
 	ForwardAgent             string
 	HostkeyAlgorithms        string
 	PubkeyAcceptedAlgorithms string
+	Ciphers                  string
+	KexAlgorithms            string
+	MACs                     string
+	ProxyJump                string // Comma separated [user@]host[:port] jump hosts
+	ProxyCommand             string // Command whose stdin/stdout carry the connection
+}
+
+// sshTokens returns the values of the ssh_config %h, %p, %r, %n, %u and %d tokens.
+// defaultUser is the remote user when none is configured.
+func (h *HostInfo) sshTokens(defaultUser string) map[byte]string {
+	remoteUser := h.User
+	if remoteUser == "" {
+		remoteUser = defaultUser
+	}
+	return map[byte]string{
+		'h': h.Hostname,
+		'p': h.Port,
+		'r': remoteUser,
+		'n': h.Original,
+		'u': localUsername(),
+		'd': homeDir(),
+	}
+}
+
+// identityFiles returns the IdentityFiles to try, or the single IdentityFile when only it is set
+func (h *HostInfo) identityFiles() []string {
+	if len(h.IdentityFiles) == 0 && h.IdentityFile != "" {
+		return []string{h.IdentityFile}
+	}
+	return h.IdentityFiles
 }
 
 // ParseHost analyzes a host string and returns initial HostInfo
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory describes a fleet of routers, loaded from a YAML file:
+//
+//	defaults:
+//	  user: admin
+//	  channel: long-term
+//	hosts:
+//	  - name: router1
+//	    address: 192.168.1.1
+//	    port: "2222"
+//	    target-version: 7.15.3
+//	  - name: switch1
+//	    transport: api-ssl
+//	    tags: [core]
+//	  - name: ap-kitchen
+//	    tags: [ap]
+//	    output-dir: ./aps
+//	groups:
+//	  site-paris: [router1, ap-kitchen]
+type Inventory struct {
+	Defaults InventoryHost       `yaml:"defaults"`
+	Hosts    []InventoryHost     `yaml:"hosts"`
+	Groups   map[string][]string `yaml:"groups"`
+}
+
+// InventoryHost holds per-host settings overriding command-line and ssh_config values
+type InventoryHost struct {
+	Name             string   `yaml:"name"`
+	Address          string   `yaml:"address"`
+	User             string   `yaml:"user"`
+	Port             string   `yaml:"port"`
+	OutputDir        string   `yaml:"output-dir"`
+	PreEnrollScript  string   `yaml:"pre-enroll-script"`
+	PostEnrollScript string   `yaml:"post-enroll-script"`
+	Channel          string   `yaml:"channel"`
+	TargetVersion    string   `yaml:"target-version"`
+	Transport        string   `yaml:"transport"`
+	APIPort          string   `yaml:"api-port"`
+	Tags             []string `yaml:"tags"`
+}
+
+// UpdateChannels lists the RouterOS update channels accepted by /system/package/update/set
+var UpdateChannels = []string{"stable", "long-term", "testing", "development"}
+
+// ValidateUpdateChannel checks channel is a known RouterOS update channel (empty is allowed)
+func ValidateUpdateChannel(channel string) error {
+	if channel != "" && !slices.Contains(UpdateChannels, channel) {
+		return fmt.Errorf("invalid update channel %q (expected one of %s)", channel, strings.Join(UpdateChannels, ", "))
+	}
+	return nil
+}
+
+// LoadInventory reads and validates an inventory file
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+
+	var inv Inventory
+	if err := yaml.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory file %s: %w", path, err)
+	}
+
+	if err := inv.validate(); err != nil {
+		return nil, fmt.Errorf("invalid inventory file %s: %w", path, err)
+	}
+
+	slog.Debug("inventory loaded", "file", path, "hosts", len(inv.Hosts), "groups", len(inv.Groups))
+	return &inv, nil
+}
+
+// validate checks host names are set and unique, update channels are known,
+// and groups only reference known hosts
+func (inv *Inventory) validate() error {
+	if err := ValidateUpdateChannel(inv.Defaults.Channel); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	if err := ValidateTransport(inv.Defaults.Transport); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	seen := map[string]bool{}
+	for i, h := range inv.Hosts {
+		if h.Name == "" {
+			return fmt.Errorf("host #%d has no name", i+1)
+		}
+		if seen[h.Name] {
+			return fmt.Errorf("duplicate host %q", h.Name)
+		}
+		if err := ValidateUpdateChannel(h.Channel); err != nil {
+			return fmt.Errorf("host %q: %w", h.Name, err)
+		}
+		if err := ValidateTransport(h.Transport); err != nil {
+			return fmt.Errorf("host %q: %w", h.Name, err)
+		}
+		seen[h.Name] = true
+	}
+	for group, members := range inv.Groups {
+		for _, member := range members {
+			if !seen[member] {
+				return fmt.Errorf("group %q references unknown host %q", group, member)
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the settings for a host merged with inventory defaults.
+// The second return value is false if the host is not part of the inventory.
+func (inv *Inventory) Lookup(name string) (InventoryHost, bool) {
+	if inv == nil {
+		return InventoryHost{}, false
+	}
+	for _, h := range inv.Hosts {
+		if h.Name != name {
+			continue
+		}
+		merged := inv.Defaults
+		merged.Name = h.Name
+		merged.Tags = h.Tags
+		if h.Address != "" {
+			merged.Address = h.Address
+		}
+		if h.User != "" {
+			merged.User = h.User
+		}
+		if h.Port != "" {
+			merged.Port = h.Port
+		}
+		if h.OutputDir != "" {
+			merged.OutputDir = h.OutputDir
+		}
+		if h.PreEnrollScript != "" {
+			merged.PreEnrollScript = h.PreEnrollScript
+		}
+		if h.PostEnrollScript != "" {
+			merged.PostEnrollScript = h.PostEnrollScript
+		}
+		if h.Channel != "" {
+			merged.Channel = h.Channel
+		}
+		if h.TargetVersion != "" {
+			merged.TargetVersion = h.TargetVersion
+		}
+		if h.Transport != "" {
+			merged.Transport = h.Transport
+		}
+		if h.APIPort != "" {
+			merged.APIPort = h.APIPort
+		}
+		return merged, true
+	}
+	return InventoryHost{}, false
+}
+
+// Select returns the names of hosts matching the given groups and tags, in inventory order.
+// A host matches if it belongs to any of the groups (when groups are given)
+// and has any of the tags (when tags are given).
+func (inv *Inventory) Select(groups, tags []string) ([]string, error) {
+	for _, group := range groups {
+		if _, ok := inv.Groups[group]; !ok {
+			return nil, fmt.Errorf("unknown group %q", group)
+		}
+	}
+
+	var selected []string
+	for _, h := range inv.Hosts {
+		if len(groups) > 0 && !slices.ContainsFunc(groups, func(g string) bool {
+			return slices.Contains(inv.Groups[g], h.Name)
+		}) {
+			continue
+		}
+		if len(tags) > 0 && !slices.ContainsFunc(tags, func(t string) bool {
+			return slices.Contains(h.Tags, t)
+		}) {
+			continue
+		}
+		selected = append(selected, h.Name)
+	}
+	return selected, nil
+}
+
+// HostOverrides returns the inventory settings for a host, or zero values
+// when no inventory is loaded or the host is not part of it
+func (c *Config) HostOverrides(host string) InventoryHost {
+	h, _ := c.Inventory.Lookup(host)
+	return h
+}
+
+// HostTransport returns the transport of a host: the inventory one if any,
+// the --transport one otherwise, SSH by default
+func (c *Config) HostTransport(host string) string {
+	if transport := c.HostOverrides(host).Transport; transport != "" {
+		return transport
+	}
+	if c.Transport != "" {
+		return c.Transport
+	}
+	return TransportSSH
+}
@@ -0,0 +1,283 @@
+package core
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadInventory(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		wantHosts   int
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:      "valid inventory",
+			file:      "valid.yaml",
+			wantHosts: 4,
+		},
+		{
+			name:        "missing file",
+			file:        "does-not-exist.yaml",
+			wantErr:     true,
+			errContains: "failed to read inventory file",
+		},
+		{
+			name:        "invalid yaml",
+			file:        "invalid.yaml",
+			wantErr:     true,
+			errContains: "failed to parse inventory file",
+		},
+		{
+			name:        "duplicate host",
+			file:        "duplicate_host.yaml",
+			wantErr:     true,
+			errContains: `duplicate host "router1"`,
+		},
+		{
+			name:        "group references unknown host",
+			file:        "unknown_group_member.yaml",
+			wantErr:     true,
+			errContains: `unknown host "router9"`,
+		},
+		{
+			name:        "host without name",
+			file:        "missing_name.yaml",
+			wantErr:     true,
+			errContains: "host #1 has no name",
+		},
+		{
+			name:        "unknown update channel",
+			file:        "invalid_channel.yaml",
+			wantErr:     true,
+			errContains: `host "router1": invalid update channel "beta"`,
+		},
+		{
+			name:        "unknown transport",
+			file:        "invalid_transport.yaml",
+			wantErr:     true,
+			errContains: `host "router1": invalid transport "telnet"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := LoadInventory(filepath.Join("testdata", "inventory", tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadInventory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("LoadInventory() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if len(inv.Hosts) != tt.wantHosts {
+				t.Errorf("LoadInventory() hosts = %d, want %d", len(inv.Hosts), tt.wantHosts)
+			}
+		})
+	}
+}
+
+func TestInventorySelect(t *testing.T) {
+	inv, err := LoadInventory(filepath.Join("testdata", "inventory", "valid.yaml"))
+	if err != nil {
+		t.Fatalf("LoadInventory() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		groups  []string
+		tags    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "no selector returns all hosts in inventory order",
+			want: []string{"router1", "router2", "ap-kitchen", "ap-office"},
+		},
+		{
+			name:   "single group",
+			groups: []string{"site-paris"},
+			want:   []string{"router1", "ap-kitchen"},
+		},
+		{
+			name:   "multiple groups",
+			groups: []string{"site-paris", "site-lyon"},
+			want:   []string{"router1", "router2", "ap-kitchen", "ap-office"},
+		},
+		{
+			name: "single tag",
+			tags: []string{"ap"},
+			want: []string{"ap-kitchen", "ap-office"},
+		},
+		{
+			name:   "group and tag",
+			groups: []string{"site-lyon"},
+			tags:   []string{"core"},
+			want:   []string{"router2"},
+		},
+		{
+			name: "no matching host",
+			tags: []string{"unknown-tag"},
+			want: nil,
+		},
+		{
+			name:    "unknown group",
+			groups:  []string{"site-berlin"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inv.Select(tt.groups, tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInventoryLookup(t *testing.T) {
+	inv, err := LoadInventory(filepath.Join("testdata", "inventory", "valid.yaml"))
+	if err != nil {
+		t.Fatalf("LoadInventory() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		host   string
+		want   InventoryHost
+		wantOk bool
+	}{
+		{
+			name: "host inherits defaults",
+			host: "router1",
+			want: InventoryHost{
+				Name:      "router1",
+				Address:   "192.168.1.1",
+				User:      "admin",
+				Port:      "2222",
+				OutputDir: "./exports",
+				Channel:   "stable",
+				Tags:      []string{"core"},
+			},
+			wantOk: true,
+		},
+		{
+			name: "host overrides defaults",
+			host: "ap-kitchen",
+			want: InventoryHost{
+				Name:            "ap-kitchen",
+				User:            "admin",
+				OutputDir:       "./aps",
+				PreEnrollScript: "./ap-pre.rsc",
+				Channel:         "stable",
+				Tags:            []string{"ap"},
+			},
+			wantOk: true,
+		},
+		{
+			name: "host overrides update channel and target version",
+			host: "router2",
+			want: InventoryHost{
+				Name:          "router2",
+				Address:       "192.168.1.2",
+				User:          "ops",
+				OutputDir:     "./exports",
+				Channel:       "long-term",
+				TargetVersion: "7.12.1",
+				Tags:          []string{"core", "edge"},
+			},
+			wantOk: true,
+		},
+		{
+			name:   "unknown host",
+			host:   "router9",
+			wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := inv.Lookup(tt.host)
+			if ok != tt.wantOk {
+				t.Fatalf("Lookup() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigHostOverrides(t *testing.T) {
+	// No inventory loaded
+	cfg := &Config{}
+	if got := cfg.HostOverrides("router1"); !reflect.DeepEqual(got, InventoryHost{}) {
+		t.Errorf("HostOverrides() without inventory = %+v, want zero value", got)
+	}
+
+	inv, err := LoadInventory(filepath.Join("testdata", "inventory", "valid.yaml"))
+	if err != nil {
+		t.Fatalf("LoadInventory() error = %v", err)
+	}
+	cfg.Inventory = inv
+	if got := cfg.HostOverrides("router2"); got.User != "ops" || got.Address != "192.168.1.2" {
+		t.Errorf("HostOverrides() = %+v, want user ops and address 192.168.1.2", got)
+	}
+}
+
+func TestConfigHostTransport(t *testing.T) {
+	inv := &Inventory{Hosts: []InventoryHost{
+		{Name: "router1", Transport: TransportAPISSL},
+		{Name: "router2"},
+	}}
+	tests := []struct {
+		name      string
+		transport string
+		host      string
+		want      string
+	}{
+		{"default", "", "router2", TransportSSH},
+		{"command line", TransportAPI, "router2", TransportAPI},
+		{"inventory wins", TransportAPI, "router1", TransportAPISSL},
+		{"host not in inventory", "", "router9", TransportSSH},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Transport: tt.transport, Inventory: inv}
+			if got := cfg.HostTransport(tt.host); got != tt.want {
+				t.Errorf("HostTransport(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyInventoryOverrides(t *testing.T) {
+	hostInfo := ParseHost("router1")
+	hostInfo.User = "from-ssh-config"
+
+	applyInventoryOverrides(hostInfo, InventoryHost{Name: "router1", Address: "10.0.0.1", Port: "2222"})
+
+	if hostInfo.Hostname != "10.0.0.1" {
+		t.Errorf("Hostname = %s, want 10.0.0.1", hostInfo.Hostname)
+	}
+	if hostInfo.Port != "2222" {
+		t.Errorf("Port = %s, want 2222", hostInfo.Port)
+	}
+	if hostInfo.User != "from-ssh-config" {
+		t.Errorf("User = %s, want ssh_config value to be kept", hostInfo.User)
+	}
+	if hostInfo.ShortName != "router1" {
+		t.Errorf("ShortName = %s, want router1", hostInfo.ShortName)
+	}
+}
@@ -0,0 +1,544 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrintRecord is an item of the output of a RouterOS print command
+type PrintRecord struct {
+	// Index is the item number, -1 when the output has none (system resource, as-value)
+	Index int
+	// Flags are the flag letters of the item (X disabled, D dynamic, R running...)
+	Flags string
+	// Comment is the ;;; comment of the item
+	Comment string
+	// Keys lists the attribute names in their order of appearance
+	Keys []string
+	// Values maps attribute names to their unquoted values
+	Values map[string]string
+}
+
+var (
+	// printKeyValueRe matches the "name: value" lines of print on a menu without items
+	printKeyValueRe = regexp.MustCompile(`^\s*([a-z][a-z0-9.-]*):(?:\s+(.*))?$`)
+	// printItemRe matches the first line of an item in print detail and terse outputs
+	printItemRe = regexp.MustCompile(`^\s*(\d+)(?:\s+(.*))?$`)
+	// printHeaderRe matches the column header line of a table print
+	printHeaderRe = regexp.MustCompile(`^\s*(#\s+)?[A-Z][A-Z0-9-]*(\s+[A-Z][A-Z0-9-]*)*$`)
+	// printLegendRe matches the flag legend lines ("Flags: X - disabled, R - running")
+	printLegendRe = regexp.MustCompile(`^\s*(Flags:\s*)?([A-Za-z*] - [a-zA-Z-]+(,\s*|;\s*|\s*$))+$`)
+	// printAttributeRe matches the start of a name=value attribute
+	printAttributeRe = regexp.MustCompile(`^[a-zA-Z.][a-zA-Z0-9._-]*=`)
+	// printFlagsRe matches the flag letters following the item number
+	printFlagsRe = regexp.MustCompile(`^[A-Za-z*]+$`)
+)
+
+// RunPrint runs a print command and parses its output
+func RunPrint(ctx context.Context, conn SshRunner, cmd string) ([]PrintRecord, error) {
+	output, err := conn.RunContext(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	records, err := ParsePrint(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output of %q: %w", cmd, err)
+	}
+	return records, nil
+}
+
+// ParsePrint parses the output of print, print detail, print terse or print as-value,
+// of RouterOS 6 and 7. Menus without items (system resource) print a single record,
+// except commands reporting their progress (check-for-updates), whose successive
+// states are records in order.
+func ParsePrint(output string) ([]PrintRecord, error) {
+	output = strings.ReplaceAll(output, "\r", "")
+	var lines []string
+	for line := range strings.SplitSeq(output, "\n") {
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+
+	// Flag legends and the column list of RouterOS 7 only describe the output
+	content := lines[:0]
+	legend := true
+	for _, line := range lines {
+		switch {
+		case legend && (strings.HasPrefix(strings.TrimSpace(line), "Columns:") || printLegendRe.MatchString(line)):
+			continue
+		case strings.TrimSpace(line) == "":
+			content = append(content, "")
+		default:
+			legend = false
+			content = append(content, line)
+		}
+	}
+
+	first := ""
+	for _, line := range content {
+		if line != "" {
+			first = line
+			break
+		}
+	}
+	switch {
+	case first == "":
+		return nil, nil
+	case printKeyValueRe.MatchString(first):
+		return parsePrintKeyValues(content)
+	case printHeaderRe.MatchString(first):
+		return parsePrintTable(content)
+	case !strings.HasPrefix(first, " ") && strings.Contains(first, ";") && printAttributeRe.MatchString(first):
+		return parsePrintAsValue(content), nil
+	case printItemRe.MatchString(first) || printAttributeRe.MatchString(strings.TrimSpace(first)):
+		return parsePrintItems(content)
+	}
+	return nil, fmt.Errorf("unrecognized print output: %s", strings.TrimSpace(first))
+}
+
+// add sets an attribute, keeping the order of appearance
+func (r *PrintRecord) add(key, value string) {
+	if r.Values == nil {
+		r.Values = map[string]string{}
+	}
+	if _, ok := r.Values[key]; !ok {
+		r.Keys = append(r.Keys, key)
+	}
+	r.Values[key] = value
+}
+
+// parsePrintKeyValues parses "name: value" lines. A blank line or a repeated name starts a new record,
+// indented lines without name continue the previous value.
+func parsePrintKeyValues(lines []string) ([]PrintRecord, error) {
+	var records []PrintRecord
+	var current *PrintRecord
+	last := ""
+	for _, line := range lines {
+		if line == "" {
+			current = nil
+			continue
+		}
+		match := printKeyValueRe.FindStringSubmatch(line)
+		if match == nil {
+			if current == nil || last == "" {
+				return nil, fmt.Errorf("unexpected line %q", strings.TrimSpace(line))
+			}
+			current.Values[last] = strings.TrimSpace(current.Values[last] + " " + strings.TrimSpace(line))
+			continue
+		}
+		key, value := match[1], strings.TrimSpace(match[2])
+		if current != nil {
+			if _, repeated := current.Values[key]; repeated {
+				current = nil
+			}
+		}
+		if current == nil {
+			records = append(records, PrintRecord{Index: -1})
+			current = &records[len(records)-1]
+		}
+		current.add(key, value)
+		last = key
+	}
+	return records, nil
+}
+
+// parsePrintItems parses print detail and print terse outputs: items start with their number
+// and flags, followed by a ;;; comment or name=value attributes, possibly on the next lines
+func parsePrintItems(lines []string) ([]PrintRecord, error) {
+	var records []PrintRecord
+	var current *PrintRecord
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		text := strings.TrimSpace(line)
+		if match := printItemRe.FindStringSubmatch(line); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			records = append(records, PrintRecord{Index: index})
+			current = &records[len(records)-1]
+			text = match[2]
+			for {
+				word, rest, _ := strings.Cut(text, " ")
+				if word == "" || !printFlagsRe.MatchString(word) {
+					break
+				}
+				current.Flags += word
+				text = strings.TrimSpace(rest)
+			}
+		} else if current == nil || !strings.HasPrefix(line, " ") {
+			// Menus without items print their attributes without number (terse)
+			records = append(records, PrintRecord{Index: -1})
+			current = &records[len(records)-1]
+		}
+		if comment, ok := strings.CutPrefix(text, ";;;"); ok {
+			current.Comment = strings.TrimSpace(comment)
+			continue
+		}
+		if err := parsePrintAttributes(current, text); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// parsePrintAttributes reads name=value attributes. Values are quoted in detail outputs;
+// unquoted values of terse outputs extend to the next attribute (build-time=2024-07-24 12:15:48).
+func parsePrintAttributes(record *PrintRecord, text string) error {
+	last := ""
+	for text = strings.TrimSpace(text); text != ""; text = strings.TrimSpace(text) {
+		name := printAttributeRe.FindString(text)
+		if name == "" {
+			word, rest, _ := strings.Cut(text, " ")
+			if last == "" {
+				return fmt.Errorf("unexpected text %q", text)
+			}
+			record.Values[last] += " " + word
+			text = rest
+			continue
+		}
+		key := strings.TrimSuffix(name, "=")
+		text = text[len(name):]
+		var value string
+		if strings.HasPrefix(text, `"`) {
+			var err error
+			value, text, err = unquotePrintValue(text)
+			if err != nil {
+				return fmt.Errorf("attribute %s: %w", key, err)
+			}
+		} else {
+			value, text, _ = strings.Cut(text, " ")
+		}
+		record.add(key, value)
+		last = key
+	}
+	if comment, ok := record.Values["comment"]; ok && record.Comment == "" {
+		record.Comment = comment
+	}
+	return nil
+}
+
+// unquotePrintValue reads a quoted value at the start of text and returns it with the text left
+func unquotePrintValue(text string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"':
+			return b.String(), text[i+1:], nil
+		case '\\':
+			if i+1 >= len(text) {
+				return "", "", fmt.Errorf("unterminated escape in %s", text)
+			}
+			i++
+			switch e := text[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '_':
+				b.WriteByte(' ')
+			default:
+				if i+1 < len(text) && isHexDigit(e) && isHexDigit(text[i+1]) {
+					n, _ := strconv.ParseUint(text[i:i+2], 16, 8)
+					b.WriteByte(byte(n))
+					i++
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted value %s", text)
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('A' <= c && c <= 'F')
+}
+
+// parsePrintAsValue parses print as-value outputs: name=value pairs separated by ";",
+// a record ends when a name repeats
+func parsePrintAsValue(lines []string) []PrintRecord {
+	var records []PrintRecord
+	var current *PrintRecord
+	for pair := range strings.SplitSeq(strings.Join(lines, ""), ";") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			continue
+		}
+		if current != nil {
+			if _, repeated := current.Values[key]; repeated {
+				current = nil
+			}
+		}
+		if current == nil {
+			records = append(records, PrintRecord{Index: -1})
+			current = &records[len(records)-1]
+		}
+		current.add(key, value)
+	}
+	return records
+}
+
+// printColumn is a column of a table print, spanning from its header to the next one
+type printColumn struct {
+	name  string
+	start int
+	end   int
+}
+
+// parsePrintTable parses the table of print. Values are matched to the column whose span they
+// overlap most, numbers being right-aligned. Items start with their number and flags, comments
+// are on their own line before the values.
+func parsePrintTable(lines []string) ([]PrintRecord, error) {
+	var header string
+	var columns []printColumn
+	numbered := false
+	var records []PrintRecord
+	var current *PrintRecord
+	comment := ""
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if columns == nil {
+			header = line
+			for _, word := range printWords(line) {
+				if word.text == "#" {
+					numbered = true
+					continue
+				}
+				columns = append(columns, printColumn{name: strings.ToLower(word.text), start: word.start})
+			}
+			for i := range columns {
+				columns[i].end = math.MaxInt
+				if i+1 < len(columns) {
+					columns[i].end = columns[i+1].start
+				}
+			}
+			continue
+		}
+
+		words := printWords(line)
+		if len(words) > 0 && numbered && words[0].start < columns[0].start {
+			if index, err := strconv.Atoi(words[0].text); err == nil {
+				records = append(records, PrintRecord{Index: index, Comment: comment})
+				current = &records[len(records)-1]
+				comment = ""
+				words = words[1:]
+				for len(words) > 0 && words[0].start < columns[0].start && printFlagsRe.MatchString(words[0].text) {
+					current.Flags += words[0].text
+					words = words[1:]
+				}
+			}
+		}
+		if len(words) > 0 && words[0].text == ";;;" {
+			text := strings.TrimSpace(line[words[0].start+3:])
+			if current != nil && len(current.Keys) == 0 {
+				// RouterOS 6 prints the comment after the number, values on the next line
+				current.Comment = text
+			} else {
+				comment = text
+			}
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if !numbered && (current == nil || len(current.Keys) > 0) {
+			records = append(records, PrintRecord{Index: -1, Comment: comment})
+			current = &records[len(records)-1]
+			comment = ""
+		}
+		if current == nil {
+			return nil, fmt.Errorf("values before the first item under header %q", strings.TrimSpace(header))
+		}
+
+		for _, word := range words {
+			column := columns[0]
+			best := -1
+			for _, c := range columns {
+				overlap := min(word.end, c.end) - max(word.start, c.start)
+				if overlap > best {
+					column, best = c, overlap
+				}
+			}
+			if value, ok := current.Values[column.name]; ok && value != "" {
+				current.Values[column.name] = value + " " + word.text
+			} else {
+				current.add(column.name, word.text)
+			}
+		}
+	}
+	return records, nil
+}
+
+// printWord is a word of a table line and its position
+type printWord struct {
+	text  string
+	start int
+	end   int
+}
+
+// printWords splits a line into words separated by spaces, with their positions
+func printWords(line string) []printWord {
+	var words []printWord
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && line[i] != ' ' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, printWord{text: line[start:i], start: start, end: i})
+			start = -1
+		}
+	}
+	return words
+}
+
+// Get returns the value of an attribute, empty when missing
+func (r PrintRecord) Get(key string) string {
+	return r.Values[key]
+}
+
+// Lookup returns the value of an attribute and whether it is present
+func (r PrintRecord) Lookup(key string) (string, bool) {
+	value, ok := r.Values[key]
+	return value, ok
+}
+
+// HasFlag reports whether the item has a flag letter
+func (r PrintRecord) HasFlag(flag rune) bool {
+	return strings.ContainsRune(r.Flags, flag)
+}
+
+// Disabled reports whether the item is disabled, by its X flag or disabled attribute
+func (r PrintRecord) Disabled() bool {
+	if r.HasFlag('X') {
+		return true
+	}
+	disabled, err := r.Bool("disabled")
+	return err == nil && disabled
+}
+
+// value returns the value of an attribute, or an error when missing
+func (r PrintRecord) value(key string) (string, error) {
+	value, ok := r.Values[key]
+	if !ok {
+		return "", fmt.Errorf("attribute %s not found", key)
+	}
+	return value, nil
+}
+
+// Bool returns a yes/no or true/false attribute
+func (r PrintRecord) Bool(key string) (bool, error) {
+	value, err := r.value(key)
+	if err != nil {
+		return false, err
+	}
+	switch value {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("attribute %s: %q is not a boolean", key, value)
+}
+
+// Int returns an integer attribute
+func (r PrintRecord) Int(key string) (int64, error) {
+	value, err := r.value(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("attribute %s: %q is not an integer", key, value)
+	}
+	return n, nil
+}
+
+// byteUnits are the size units RouterOS prints
+var byteUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// Bytes returns a size attribute such as 224.5MiB, in bytes
+func (r PrintRecord) Bytes(key string) (int64, error) {
+	value, err := r.value(key)
+	if err != nil {
+		return 0, err
+	}
+	number := strings.TrimRight(value, "BKMGTi ")
+	unit := strings.TrimSpace(value[len(number):])
+	multiplier, ok := byteUnits[unit]
+	f, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("attribute %s: %q is not a size", key, value)
+	}
+	return int64(math.Round(f * multiplier)), nil
+}
+
+var (
+	// durationClockRe matches the hh:mm:ss part ending durations of RouterOS 6 (1d02:03:04)
+	durationClockRe = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})(?:\.(\d+))?$`)
+	// durationUnitRe matches a number and its unit (1w2d3h4m5s100ms)
+	durationUnitRe = regexp.MustCompile(`^(\d+)(ms|us|w|d|h|m|s)`)
+)
+
+var durationUnits = map[string]time.Duration{
+	"w":  7 * 24 * time.Hour,
+	"d":  24 * time.Hour,
+	"h":  time.Hour,
+	"m":  time.Minute,
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+}
+
+// Duration returns a duration attribute such as 1w2d3h4m5s or 1d02:03:04
+func (r PrintRecord) Duration(key string) (time.Duration, error) {
+	value, err := r.value(key)
+	if err != nil {
+		return 0, err
+	}
+	var total time.Duration
+	for text := value; text != ""; {
+		if match := durationClockRe.FindStringSubmatch(text); match != nil {
+			hours, _ := strconv.Atoi(match[1])
+			minutes, _ := strconv.Atoi(match[2])
+			seconds, _ := strconv.Atoi(match[3])
+			total += time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+			if match[4] != "" {
+				fraction, _ := strconv.ParseFloat("0."+match[4], 64)
+				total += time.Duration(fraction * float64(time.Second))
+			}
+			break
+		}
+		match := durationUnitRe.FindStringSubmatch(text)
+		if match == nil {
+			return 0, fmt.Errorf("attribute %s: %q is not a duration", key, value)
+		}
+		n, _ := strconv.Atoi(match[1])
+		total += time.Duration(n) * durationUnits[match[2]]
+		text = text[len(match[0]):]
+	}
+	if value == "" {
+		return 0, fmt.Errorf("attribute %s: empty duration", key)
+	}
+	return total, nil
+}
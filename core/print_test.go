@@ -0,0 +1,249 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePrint_Fixtures(t *testing.T) {
+	// record is the expected part of a parsed record: values not listed are not checked
+	type record struct {
+		index   int
+		flags   string
+		comment string
+		values  map[string]string
+	}
+	tests := []struct {
+		file    string
+		records []record
+	}{
+		{
+			file: "ros6/system_resource.txt",
+			records: []record{{index: -1, values: map[string]string{
+				"uptime":            "2w3d04:05:06",
+				"version":           "6.49.10 (long-term)",
+				"build-time":        "Sep/06/2023 09:51:37",
+				"architecture-name": "mmips",
+				"board-name":        "hEX",
+			}}},
+		},
+		{
+			file: "ros6/routerboard.txt",
+			records: []record{{index: -1, values: map[string]string{
+				"routerboard":      "yes",
+				"model":            "RouterBOARD 750G r3",
+				"current-firmware": "6.49.8",
+				"upgrade-firmware": "6.49.10",
+			}}},
+		},
+		{
+			file: "ros6/check_for_updates.txt",
+			records: []record{
+				{index: -1, values: map[string]string{"installed-version": "6.49.8", "status": "finding out latest version..."}},
+				{index: -1, values: map[string]string{"latest-version": "6.49.10", "status": "New version is available"}},
+			},
+		},
+		{
+			file: "ros6/interface_print.txt",
+			records: []record{
+				{index: 0, flags: "R", values: map[string]string{"name": "ether1", "type": "ether", "actual-mtu": "1500", "l2mtu": "1596", "max-l2mtu": "2026", "mac-address": "48:8F:5A:00:00:01"}},
+				{index: 1, flags: "RS", comment: "uplink to core", values: map[string]string{"name": "ether2", "mac-address": "48:8F:5A:00:00:02"}},
+				{index: 2, flags: "X", values: map[string]string{"name": "ether3", "actual-mtu": "1500"}},
+				{index: 3, flags: "R", values: map[string]string{"name": "bridge1", "type": "bridge", "l2mtu": "1596", "mac-address": "48:8F:5A:00:00:02"}},
+			},
+		},
+		{
+			file: "ros6/interface_print_detail.txt",
+			records: []record{
+				{index: 0, flags: "R", values: map[string]string{"name": "ether1", "mtu": "1500", "last-link-up-time": "sep/10/2023 08:12:45", "link-downs": "0"}},
+				{index: 1, flags: "RS", comment: "uplink to core", values: map[string]string{"name": "ether2", "link-downs": "2"}},
+				{index: 2, flags: "X", values: map[string]string{"name": "ether3", "mac-address": "48:8F:5A:00:00:03"}},
+			},
+		},
+		{
+			file: "ros6/package_print_terse.txt",
+			records: []record{
+				{index: 0, values: map[string]string{"name": "routeros-mmips", "version": "6.49.10", "build-time": "sep/06/2023 09:51:37", "scheduled": ""}},
+				{index: 1, values: map[string]string{"name": "system"}},
+				{index: 2, flags: "X", values: map[string]string{"name": "wireless"}},
+			},
+		},
+		{
+			file: "ros6/ip_address_print_as_value.txt",
+			records: []record{
+				{index: -1, values: map[string]string{".id": "*1", "address": "192.168.88.1/24", "interface": "bridge1"}},
+				{index: -1, values: map[string]string{".id": "*2", "address": "10.0.0.2/30", "network": "10.0.0.0"}},
+			},
+		},
+		{
+			file: "ros7/system_resource.txt",
+			records: []record{{index: -1, values: map[string]string{
+				"uptime":       "1w2d3h4m5s",
+				"version":      "7.15.3 (stable)",
+				"build-time":   "2024-07-24 12:15:48",
+				"free-memory":  "870.2MiB",
+				"board-name":   "RB5009UG+S+",
+				"total-memory": "1024.0MiB",
+			}}},
+		},
+		{
+			file: "ros7/check_for_updates_error.txt",
+			records: []record{
+				{index: -1, values: map[string]string{"channel": "stable", "status": "ERROR: could not resolve dns name (timeout)"}},
+			},
+		},
+		{
+			file: "ros7/interface_print.txt",
+			records: []record{
+				{index: 0, flags: "R", values: map[string]string{"name": "ether1", "type": "ether", "actual-mtu": "1500", "max-l2mtu": "9796"}},
+				{index: 1, flags: "RS", comment: "uplink to core", values: map[string]string{"name": "ether2", "mac-address": "78:9A:18:00:00:02"}},
+				{index: 2, values: map[string]string{"name": "sfp-sfpplus1", "type": "ether", "l2mtu": "1514"}},
+				{index: 3, flags: "R", values: map[string]string{"name": "bridge1", "type": "bridge", "mac-address": "78:9A:18:00:00:02"}},
+			},
+		},
+		{
+			file: "ros7/ip_address_print_detail.txt",
+			records: []record{
+				{index: 0, comment: "defconf", values: map[string]string{"address": "192.168.88.1/24", "interface": "bridge1"}},
+				{index: 1, flags: "D", values: map[string]string{"address": "10.0.0.2/30", "actual-interface": "ether1"}},
+				{index: 2, flags: "X", comment: `lab "old" range`, values: map[string]string{"address": "172.16.0.1/24", "actual-interface": "ether3"}},
+			},
+		},
+		{
+			file: "ros7/package_print_terse.txt",
+			records: []record{
+				{index: 0, values: map[string]string{"name": "routeros", "version": "7.15.3", "build-time": "2024-07-24 12:15:48"}},
+				{index: 1, values: map[string]string{"name": "container"}},
+				{index: 2, flags: "X", values: map[string]string{"name": "wifi-qcom"}},
+			},
+		},
+		{
+			file: "ros7/ip_route_print_as_value.txt",
+			records: []record{
+				{index: -1, values: map[string]string{".id": "*80000001", "dst-address": "0.0.0.0/0", "gateway": "10.0.0.1"}},
+				{index: -1, values: map[string]string{".id": "*80000002", "gateway": "bridge1", "distance": "0"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			output, err := os.ReadFile(filepath.Join("testdata", "print", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			records, err := ParsePrint(string(output))
+			if err != nil {
+				t.Fatalf("ParsePrint() error = %v", err)
+			}
+			if len(records) != len(tt.records) {
+				t.Fatalf("ParsePrint() = %d records, want %d: %+v", len(records), len(tt.records), records)
+			}
+			for i, want := range tt.records {
+				got := records[i]
+				if got.Index != want.index || got.Flags != want.flags || got.Comment != want.comment {
+					t.Errorf("record %d = index %d flags %q comment %q, want %d %q %q", i, got.Index, got.Flags, got.Comment, want.index, want.flags, want.comment)
+				}
+				for key, value := range want.values {
+					if got.Values[key] != value {
+						t.Errorf("record %d %s = %q, want %q", i, key, got.Values[key], value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParsePrint(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		want        int
+		errContains string
+	}{
+		{name: "empty output", output: "", want: 0},
+		{name: "CRLF line endings", output: "  uptime: 1d\r\n  version: 7.15.3\r\n", want: 1},
+		{name: "terse menu without items", output: "name=router1\n", want: 1},
+		{name: "router error", output: "bad command name prnt (line 1 column 18)", errContains: "unrecognized print output"},
+		{name: "unterminated quote", output: ` 0 name="ether1`, errContains: "unterminated quoted value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ParsePrint(tt.output)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Fatalf("ParsePrint() error = %v, want error containing %q", err, tt.errContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePrint() error = %v", err)
+			}
+			if len(records) != tt.want {
+				t.Errorf("ParsePrint() = %d records, want %d", len(records), tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintRecord_TypedValues(t *testing.T) {
+	record := PrintRecord{Flags: "R", Values: map[string]string{
+		"running":     "true",
+		"disabled":    "no",
+		"cpu-count":   "4",
+		"free-memory": "224.5MiB",
+		"hdd":         "16.0MiB",
+		"size":        "1024",
+		"uptime":      "1w2d3h4m5s",
+		"uptime6":     "2w3d04:05:06",
+		"interval":    "500ms",
+		"comment":     "never",
+	}}
+
+	if v, err := record.Bool("running"); err != nil || !v {
+		t.Errorf("Bool(running) = %v, %v", v, err)
+	}
+	if v, err := record.Bool("disabled"); err != nil || v {
+		t.Errorf("Bool(disabled) = %v, %v", v, err)
+	}
+	if _, err := record.Bool("cpu-count"); err == nil {
+		t.Error("Bool(cpu-count) error = nil, want not a boolean")
+	}
+	if v, err := record.Int("cpu-count"); err != nil || v != 4 {
+		t.Errorf("Int(cpu-count) = %v, %v", v, err)
+	}
+	if _, err := record.Int("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Int(missing) error = %v, want not found", err)
+	}
+
+	sizes := map[string]int64{"free-memory": 235405312, "hdd": 16 << 20, "size": 1024}
+	for key, want := range sizes {
+		if v, err := record.Bytes(key); err != nil || v != want {
+			t.Errorf("Bytes(%s) = %v, %v, want %d", key, v, err, want)
+		}
+	}
+
+	durations := map[string]time.Duration{
+		"uptime":   9*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second,
+		"uptime6":  17*24*time.Hour + 4*time.Hour + 5*time.Minute + 6*time.Second,
+		"interval": 500 * time.Millisecond,
+	}
+	for key, want := range durations {
+		if v, err := record.Duration(key); err != nil || v != want {
+			t.Errorf("Duration(%s) = %v, %v, want %v", key, v, err, want)
+		}
+	}
+	if _, err := record.Duration("comment"); err == nil {
+		t.Error("Duration(comment) error = nil, want not a duration")
+	}
+
+	if !record.HasFlag('R') || record.Disabled() {
+		t.Errorf("HasFlag(R) = %v, Disabled() = %v", record.HasFlag('R'), record.Disabled())
+	}
+	if !(PrintRecord{Flags: "X"}).Disabled() {
+		t.Error("Disabled() of an X flagged item = false")
+	}
+}
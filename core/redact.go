@@ -0,0 +1,277 @@
+package core
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+// SecretParameters lists the RouterOS parameters holding secrets in show-sensitive exports
+var SecretParameters = []string{
+	"authentication-key",
+	"authentication-password",
+	"encryption-password",
+	"ipsec-secret",
+	"management-protection-key",
+	"passphrase",
+	"password",
+	"pre-shared-key",
+	"preshared-key",
+	"private-key",
+	"secret",
+	"static-key-0",
+	"static-key-1",
+	"static-key-2",
+	"static-key-3",
+	"static-sta-private-key",
+	"tcp-md5-key",
+	"wpa-pre-shared-key",
+	"wpa2-pre-shared-key",
+}
+
+// SecretMenuParameters lists the parameters holding secrets only in some menus, by menu path:
+// SNMP communities are named after their secret
+var SecretMenuParameters = map[string]string{
+	"/snmp community": "name",
+}
+
+// RedactedValue replaces secret values when no recipient is configured
+const RedactedValue = `"REDACTED"`
+
+// encryptedPrefix marks secret values encrypted to a recipient: "ENC[x25519,<base64 sealed box>]"
+const encryptedPrefix = "ENC[x25519,"
+
+// secretParamRe matches a secret parameter with its value, quoted (with escapes) or not
+var secretParamRe = regexp.MustCompile(`(^|\s)(` + strings.Join(SecretParameters, "|") + `)=("(?:[^"\\]|\\.)*"|\S+)`)
+
+// encryptedValueRe matches encrypted secret values
+var encryptedValueRe = regexp.MustCompile(`"` + regexp.QuoteMeta(encryptedPrefix) + `([A-Za-z0-9+/=]+)\]"`)
+
+// Redactor replaces secret values of an export, with RedactedValue or with values
+// encrypted to an X25519 recipient
+type Redactor struct {
+	Recipient *[32]byte
+}
+
+// Redact returns the export with every secret value replaced, and the number of replaced values
+func (r Redactor) Redact(export string) (string, int, error) {
+	var b strings.Builder
+	count, last := 0, 0
+	for _, secret := range findSecrets(export) {
+		value := export[secret.start:secret.end]
+		// Empty secrets carry no information
+		if value == `""` {
+			continue
+		}
+		count++
+		b.WriteString(export[last:secret.start])
+		last = secret.end
+		if r.Recipient == nil {
+			b.WriteString(RedactedValue)
+			continue
+		}
+		sealed, err := box.SealAnonymous(nil, []byte(unquoteValue(value)), r.Recipient, rand.Reader)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to encrypt secret: %w", err)
+		}
+		b.WriteString(`"` + encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + `]"`)
+	}
+	b.WriteString(export[last:])
+	return b.String(), count, nil
+}
+
+// secretValue is the location of a secret value in an export, quotes included
+type secretValue struct {
+	start, end int
+}
+
+// findSecrets returns the secret values of an export in order: the values of SecretParameters,
+// and of SecretMenuParameters in commands of their menu
+func findSecrets(export string) []secretValue {
+	var secrets []secretValue
+	for _, match := range secretParamRe.FindAllStringSubmatchIndex(export, -1) {
+		secrets = append(secrets, secretValue{start: match[6], end: match[7]})
+	}
+	secrets = append(secrets, menuSecrets(export)...)
+	slices.SortFunc(secrets, func(a, b secretValue) int {
+		return a.start - b.start
+	})
+	return secrets
+}
+
+// menuSecrets returns the values of SecretMenuParameters in the commands of their menu.
+// Commands are found with the rsc parser, values are then located in the text of their command.
+// An export the parser can't read only has its SecretParameters redacted.
+func menuSecrets(export string) []secretValue {
+	script, err := rsc.Parse(export)
+	if err != nil {
+		return nil
+	}
+
+	// Offsets of the lines, and of the end of every top-level statement
+	lines := []int{0}
+	for i, c := range export {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	offset := func(pos rsc.Position) int {
+		return lines[pos.Line-1] + pos.Column - 1
+	}
+	ends := map[rsc.Position]int{}
+	for i, statement := range script.Statements {
+		ends[statement.Pos()] = len(export)
+		if i+1 < len(script.Statements) {
+			ends[statement.Pos()] = offset(script.Statements[i+1].Pos())
+		}
+	}
+
+	var secrets []secretValue
+	for _, statement := range rsc.Resolve(script) {
+		cmd, ok := statement.(*rsc.Command)
+		if !ok || !cmd.Absolute {
+			continue
+		}
+		param, ok := SecretMenuParameters["/"+strings.Join(cmd.Path, " ")]
+		if !ok {
+			continue
+		}
+		start, end := offset(cmd.Pos()), ends[cmd.Pos()]
+		for _, arg := range cmd.Args {
+			if arg.Name != param || arg.Value == nil {
+				continue
+			}
+			// The argument as written, preceded by a space
+			text := " " + arg.String()
+			i := strings.Index(export[start:end], text)
+			if i < 0 {
+				continue
+			}
+			secrets = append(secrets, secretValue{start: start + i + len(" "+param+"="), end: start + i + len(text)})
+			start += i + len(text)
+		}
+	}
+	return secrets
+}
+
+// RedactCommand returns a command with the values of its secret parameters replaced by
+// RedactedValue, so that it can be logged or returned in errors
+func RedactCommand(cmd string) string {
+	// Placeholders can't fail
+	redacted, _, _ := Redactor{}.Redact(cmd)
+	return redacted
+}
+
+// IsRedacted reports whether an export holds secrets replaced by a Redactor
+func IsRedacted(export string) bool {
+	for _, secret := range findSecrets(export) {
+		if value := export[secret.start:secret.end]; value == RedactedValue || encryptedValueRe.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RevealSecrets decrypts the secret values encrypted by a Redactor, using the recipient key pair
+func RevealSecrets(export string, publicKey, privateKey *[32]byte) (string, error) {
+	var openErr error
+	revealed := encryptedValueRe.ReplaceAllStringFunc(export, func(match string) string {
+		sealed, err := base64.StdEncoding.DecodeString(encryptedValueRe.FindStringSubmatch(match)[1])
+		if err != nil {
+			openErr = err
+			return match
+		}
+		value, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+		if !ok {
+			openErr = fmt.Errorf("secret not encrypted for this key")
+			return match
+		}
+		return `"` + string(value) + `"`
+	})
+	if openErr != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", openErr)
+	}
+	return revealed, nil
+}
+
+// unquoteValue removes the surrounding quotes of a value, escapes are kept as-is
+// so that the value can be quoted again unchanged
+func unquoteValue(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// ParseRecipient reads an X25519 public key, either from a PEM file (as written by
+// "openssl pkey -pubout") or as a base64 encoded raw key
+func ParseRecipient(recipient string) (*[32]byte, error) {
+	raw, err := parseX25519Key(recipient, "PUBLIC KEY", func(der []byte) (any, error) {
+		return x509.ParsePKIXPublicKey(der)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return raw, nil
+}
+
+// ParseIdentity reads an X25519 private key, either from a PEM file (as written by
+// "openssl genpkey -algorithm x25519") or as a base64 encoded raw key.
+// It returns the public and private keys.
+func ParseIdentity(identity string) (*[32]byte, *[32]byte, error) {
+	raw, err := parseX25519Key(identity, "PRIVATE KEY", func(der []byte) (any, error) {
+		return x509.ParsePKCS8PrivateKey(der)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	private, err := ecdh.X25519().NewPrivateKey(raw[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	public := [32]byte(private.PublicKey().Bytes())
+	return &public, raw, nil
+}
+
+// parseX25519Key returns the raw bytes of an X25519 key read from a PEM file or a base64 string
+func parseX25519Key(key, pemType string, parse func(der []byte) (any, error)) (*[32]byte, error) {
+	data, err := os.ReadFile(key)
+	if err != nil {
+		// Not a file, expect a base64 encoded raw key
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("expected a PEM file or a base64 encoded 32 bytes key")
+		}
+		return (*[32]byte)(raw), nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return nil, fmt.Errorf("%s: no %s PEM block found", key, pemType)
+	}
+	parsed, err := parse(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	var raw []byte
+	switch k := parsed.(type) {
+	case *ecdh.PublicKey:
+		raw = k.Bytes()
+	case *ecdh.PrivateKey:
+		raw = k.Bytes()
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("%s: not an X25519 key", key)
+	}
+	return (*[32]byte)(raw), nil
+}
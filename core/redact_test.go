@@ -0,0 +1,171 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+const sensitiveExport = `/interface wifi security
+add authentication-types=wpa2-psk name=home passphrase="my secret phrase" wpa2-pre-shared-key=Sup3rS3cret
+/ppp secret
+add name=alice password=p4ss service=pppoe
+add name=bob password="" service=pppoe
+/user
+add name=backup group=read comment="user-password=kept"
+`
+
+func TestRedactorPlaceholder(t *testing.T) {
+	got, count, err := Redactor{}.Redact(sensitiveExport)
+	if err != nil {
+		t.Fatalf("Redact() error = %v", err)
+	}
+	want := `/interface wifi security
+add authentication-types=wpa2-psk name=home passphrase="REDACTED" wpa2-pre-shared-key="REDACTED"
+/ppp secret
+add name=alice password="REDACTED" service=pppoe
+add name=bob password="" service=pppoe
+/user
+add name=backup group=read comment="user-password=kept"
+`
+	if got != want {
+		t.Errorf("Redact() =\n%s\nwant\n%s", got, want)
+	}
+	if count != 3 {
+		t.Errorf("Redact() count = %d, want 3", count)
+	}
+	if !IsRedacted(got) || IsRedacted(sensitiveExport) {
+		t.Errorf("IsRedacted() should only report the redacted export")
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	got := RedactCommand(`/system/backup/save name=router1 password="pa\$\"ss"`)
+	if want := `/system/backup/save name=router1 password="REDACTED"`; got != want {
+		t.Errorf("RedactCommand() = %q, want %q", got, want)
+	}
+	if cmd := "/system/backup/save name=router1 dont-encrypt=yes"; RedactCommand(cmd) != cmd {
+		t.Errorf("RedactCommand() should keep commands without secrets")
+	}
+}
+
+func TestRedactMenus(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+		want   string
+	}{
+		{
+			name:   "snmp community",
+			export: "/snmp community\nadd addresses=10.0.0.0/8 name=s3cr3t\nset [ find default=yes ] name=\"pub lic\"\n",
+			want:   "/snmp community\nadd addresses=10.0.0.0/8 name=\"REDACTED\"\nset [ find default=yes ] name=\"REDACTED\"\n",
+		},
+		{
+			name:   "snmp community terse",
+			export: "/snmp community add name=s3cr3t authentication-password=p4ss\n/interface bridge add name=bridge1\n",
+			want:   "/snmp community add name=\"REDACTED\" authentication-password=\"REDACTED\"\n/interface bridge add name=bridge1\n",
+		},
+		{
+			name:   "l2tp server",
+			export: "/interface l2tp-server server\nset enabled=yes ipsec-secret=hunter2 use-ipsec=yes\n",
+			want:   "/interface l2tp-server server\nset enabled=yes ipsec-secret=\"REDACTED\" use-ipsec=yes\n",
+		},
+		{
+			name:   "bgp connection",
+			export: "/routing bgp connection\nadd as=65001 name=peer1 tcp-md5-key=\"md5 key\"\n",
+			want:   "/routing bgp connection\nadd as=65001 name=peer1 tcp-md5-key=\"REDACTED\"\n",
+		},
+		{
+			name:   "ospf interface template",
+			export: "/routing ospf interface-template\nadd area=backbone auth=md5 authentication-key=k3y interfaces=ether1\n",
+			want:   "/routing ospf interface-template\nadd area=backbone auth=md5 authentication-key=\"REDACTED\" interfaces=ether1\n",
+		},
+		{
+			name:   "wireless security profile",
+			export: "/interface wireless security-profiles\nadd management-protection-key=mpk name=guests static-key-0=wep0\n",
+			want:   "/interface wireless security-profiles\nadd management-protection-key=\"REDACTED\" name=guests static-key-0=\"REDACTED\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Redactor{}.Redact(tt.export)
+			if err != nil {
+				t.Fatalf("Redact() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Redact() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if !IsRedacted(got) {
+				t.Errorf("IsRedacted() should report the redacted export")
+			}
+		})
+	}
+}
+
+func TestRedactorEncryptionRoundTrip(t *testing.T) {
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, count, err := Redactor{Recipient: public}.Redact(sensitiveExport)
+	if err != nil {
+		t.Fatalf("Redact() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Redact() count = %d, want 3", count)
+	}
+	if !IsRedacted(redacted) {
+		t.Error("IsRedacted() should report secrets encrypted to a recipient")
+	}
+	for _, secret := range []string{"my secret phrase", "Sup3rS3cret", "p4ss"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("redacted export still contains %q", secret)
+		}
+	}
+
+	revealed, err := RevealSecrets(redacted, public, private)
+	if err != nil {
+		t.Fatalf("RevealSecrets() error = %v", err)
+	}
+	// Unquoted values come back quoted
+	want := strings.NewReplacer("=Sup3rS3cret", `="Sup3rS3cret"`, "=p4ss", `="p4ss"`).Replace(sensitiveExport)
+	if revealed != want {
+		t.Errorf("RevealSecrets() =\n%s\nwant\n%s", revealed, want)
+	}
+
+	otherPublic, otherPrivate, _ := box.GenerateKey(rand.Reader)
+	if _, err := RevealSecrets(redacted, otherPublic, otherPrivate); err == nil {
+		t.Error("RevealSecrets() with another key should fail")
+	}
+}
+
+func TestParseRecipientAndIdentity(t *testing.T) {
+	recipient, err := ParseRecipient(filepath.Join("testdata", "keys", "recipient.pem"))
+	if err != nil {
+		t.Fatalf("ParseRecipient() error = %v", err)
+	}
+	public, _, err := ParseIdentity(filepath.Join("testdata", "keys", "identity.pem"))
+	if err != nil {
+		t.Fatalf("ParseIdentity() error = %v", err)
+	}
+	if *recipient != *public {
+		t.Error("identity public key does not match recipient")
+	}
+
+	fromBase64, err := ParseRecipient(base64.StdEncoding.EncodeToString(recipient[:]))
+	if err != nil || *fromBase64 != *recipient {
+		t.Errorf("ParseRecipient() from base64 = %v, %v", fromBase64, err)
+	}
+
+	for _, invalid := range []string{"not-a-key", filepath.Join("testdata", "keys", "identity.pem")} {
+		if _, err := ParseRecipient(invalid); err == nil {
+			t.Errorf("ParseRecipient(%q) should fail", invalid)
+		}
+	}
+}
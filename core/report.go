@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"jb.favre/mikrotik-fleet-autopilot/rsc"
+)
+
+// OutputFormat selects how per-host results are rendered
+type OutputFormat string
+
+const (
+	// OutputText renders human-readable lines (default)
+	OutputText OutputFormat = "text"
+	// OutputJSON renders a single JSON array once all hosts are processed
+	OutputJSON OutputFormat = "json"
+	// OutputNDJSON renders one JSON object per line as soon as a host is processed
+	OutputNDJSON OutputFormat = "ndjson"
+)
+
+// Result statuses shared by all subcommands
+const (
+	StatusOK              = "ok"
+	StatusFailed          = "failed"
+	StatusUnreachable     = "unreachable"
+	StatusUpToDate        = "up-to-date"
+	StatusUpdateAvailable = "update-available"
+	StatusUpdated         = "updated"
+	StatusInSync          = "in-sync"
+	StatusDrift           = "drift"
+	StatusApplied         = "applied"
+	StatusRolledBack      = "rolled-back"
+	StatusSkipped         = "skipped"
+	StatusDidNotComeBack  = "did-not-come-back"
+	StatusVersionMismatch = "version-mismatch"
+)
+
+// ParseOutputFormat validates an --output flag value
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch OutputFormat(format) {
+	case "", OutputText:
+		return OutputText, nil
+	case OutputJSON, OutputNDJSON:
+		return OutputFormat(format), nil
+	}
+	return "", fmt.Errorf("invalid output format %q (expected text, json or ndjson)", format)
+}
+
+// ComponentVersion holds installed, available and pinned target versions of a router component
+type ComponentVersion struct {
+	Installed string `json:"installed"`
+	Available string `json:"available"`
+	Target    string `json:"target,omitempty"`
+}
+
+// Result is the per-host outcome of a subcommand, emitted through a Reporter
+type Result struct {
+	Host        string                      `json:"host"`
+	Command     string                      `json:"command"`
+	Status      string                      `json:"status"`
+	Versions    map[string]ComponentVersion `json:"versions,omitempty"`
+	File        string                      `json:"file,omitempty"`
+	Fingerprint string                      `json:"fingerprint,omitempty"`
+	Diff        string                      `json:"diff,omitempty"`
+	Changes     []rsc.Change                `json:"changes,omitempty"`
+	Error       string                      `json:"error,omitempty"`
+	Duration    time.Duration               `json:"-"`
+
+	// Message is the human-readable rendering used by the text reporter
+	Message string `json:"-"`
+}
+
+// MarshalJSON renders Duration as milliseconds
+func (r Result) MarshalJSON() ([]byte, error) {
+	type alias Result
+	return json.Marshal(struct {
+		alias
+		DurationMs int64 `json:"durationMs"`
+	}{alias(r), r.Duration.Milliseconds()})
+}
+
+// Reporter emits per-host results and progress messages in a given output format.
+// Implementations are safe for concurrent use.
+type Reporter interface {
+	// Report emits the final result for a host
+	Report(res Result)
+	// Progress emits an intermediate, human-oriented message for a host
+	Progress(host, msg string)
+	// Summary emits the fleet summary once all hosts are processed
+	Summary(results FleetResults)
+	// Close flushes any buffered output
+	Close() error
+}
+
+// NewReporter creates a Reporter writing to w in the given format
+func NewReporter(format OutputFormat, w io.Writer) Reporter {
+	switch format {
+	case OutputJSON:
+		return &jsonReporter{w: w}
+	case OutputNDJSON:
+		return &ndjsonReporter{w: w}
+	default:
+		return &textReporter{w: w}
+	}
+}
+
+// GetReporter extracts the Reporter from context, falling back to a text reporter on stdout
+func GetReporter(ctx context.Context) Reporter {
+	reporter, ok := ctx.Value(ReporterKey).(Reporter)
+	if !ok {
+		return NewReporter(OutputText, os.Stdout)
+	}
+	return reporter
+}
+
+// textReporter renders results as emoji-prefixed lines, as the CLI always did
+type textReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *textReporter) Report(res Result) {
+	msg := res.Message
+	if msg == "" {
+		if res.Error != "" {
+			msg = fmt.Sprintf("❌ %s: %s failed", res.Host, res.Command)
+		} else {
+			msg = fmt.Sprintf("✅ %s: %s %s", res.Host, res.Command, res.Status)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintln(r.w, msg)
+}
+
+func (r *textReporter) Progress(host, msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintln(r.w, msg)
+}
+
+func (r *textReporter) Summary(results FleetResults) {
+	if len(results) < 2 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	PrintSummary(r.w, results)
+}
+
+func (r *textReporter) Close() error {
+	return nil
+}
+
+// jsonReporter buffers results and writes them as a single JSON array on Close
+type jsonReporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	results []Result
+}
+
+func (r *jsonReporter) Report(res Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, res)
+}
+
+func (r *jsonReporter) Progress(host, msg string) {
+	slog.Info("progress", "host", host, "message", msg)
+}
+
+func (r *jsonReporter) Summary(results FleetResults) {}
+
+func (r *jsonReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	results := r.results
+	if results == nil {
+		results = []Result{}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+	if _, err := fmt.Fprintln(r.w, string(data)); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
+
+// ndjsonReporter writes one JSON object per line as results come in
+type ndjsonReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *ndjsonReporter) Report(res Result) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		slog.Error("failed to marshal result", "host", res.Host, "error", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = fmt.Fprintln(r.w, string(data))
+}
+
+func (r *ndjsonReporter) Progress(host, msg string) {
+	slog.Info("progress", "host", host, "message", msg)
+}
+
+func (r *ndjsonReporter) Summary(results FleetResults) {}
+
+func (r *ndjsonReporter) Close() error {
+	return nil
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		want    OutputFormat
+		wantErr bool
+	}{
+		{name: "empty defaults to text", format: "", want: OutputText},
+		{name: "text", format: "text", want: OutputText},
+		{name: "json", format: "json", want: OutputJSON},
+		{name: "ndjson", format: "ndjson", want: OutputNDJSON},
+		{name: "invalid format", format: "yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOutputFormat(tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOutputFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOutputFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextReporter(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{
+			name:   "message is rendered as-is",
+			result: Result{Host: "router1", Command: "export", Status: StatusOK, Message: "✅ router1: Configuration exported to router1.rsc"},
+			want:   "✅ router1: Configuration exported to router1.rsc\n",
+		},
+		{
+			name:   "fallback rendering on success",
+			result: Result{Host: "router1", Command: "export", Status: StatusOK},
+			want:   "✅ router1: export ok\n",
+		},
+		{
+			name:   "fallback rendering on error",
+			result: Result{Host: "router1", Command: "export", Status: StatusFailed, Error: "boom"},
+			want:   "❌ router1: export failed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			reporter := NewReporter(OutputText, &buf)
+			reporter.Report(tt.result)
+			if buf.String() != tt.want {
+				t.Errorf("Report() output = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewReporter(OutputJSON, &buf)
+
+	reporter.Progress("router1", "⏳ waiting")
+	reporter.Report(Result{
+		Host:     "router1",
+		Command:  "updates",
+		Status:   StatusUpdateAvailable,
+		Versions: map[string]ComponentVersion{"routeros": {Installed: "7.11", Available: "7.12"}},
+		Duration: 1500 * time.Millisecond,
+		Message:  "⚠️  router1 upgrade available",
+	})
+	reporter.Report(Result{Host: "router2", Command: "updates", Status: StatusUnreachable, Error: "timeout"})
+
+	if buf.Len() != 0 {
+		t.Fatalf("JSON reporter should buffer output until Close, got %q", buf.String())
+	}
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a JSON array: %v\n%s", err, buf.String())
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(got))
+	}
+	if got[0]["host"] != "router1" || got[0]["status"] != StatusUpdateAvailable {
+		t.Errorf("unexpected first result: %v", got[0])
+	}
+	if got[0]["durationMs"] != float64(1500) {
+		t.Errorf("durationMs = %v, want 1500", got[0]["durationMs"])
+	}
+	if _, ok := got[0]["message"]; ok {
+		t.Errorf("message should not be part of JSON output: %v", got[0])
+	}
+	versions, ok := got[0]["versions"].(map[string]any)
+	if !ok || versions["routeros"] == nil {
+		t.Errorf("versions missing from JSON output: %v", got[0])
+	}
+	if got[1]["error"] != "timeout" {
+		t.Errorf("error = %v, want timeout", got[1]["error"])
+	}
+}
+
+func TestJSONReporterNoResults(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewReporter(OutputJSON, &buf)
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("expected empty JSON array, got %q", buf.String())
+	}
+}
+
+func TestNDJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewReporter(OutputNDJSON, &buf)
+
+	reporter.Report(Result{Host: "router1", Command: "export", Status: StatusOK, File: "router1.rsc"})
+	reporter.Progress("router2", "⏳ waiting")
+	reporter.Summary(FleetResults{{Host: "router1"}, {Host: "router2"}})
+	reporter.Report(Result{Host: "router2", Command: "export", Status: StatusFailed, Error: "boom"})
+	if err := reporter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		var res map[string]any
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Errorf("line %d is not valid JSON: %v", i, err)
+		}
+	}
+	if !strings.Contains(lines[0], `"file":"router1.rsc"`) {
+		t.Errorf("first line missing file: %s", lines[0])
+	}
+}
+
+func TestGetReporter(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := NewReporter(OutputNDJSON, &buf)
+
+	ctx := context.WithValue(context.Background(), ReporterKey, reporter)
+	if GetReporter(ctx) != reporter {
+		t.Error("GetReporter() should return the reporter stored in context")
+	}
+
+	if _, ok := GetReporter(context.Background()).(*textReporter); !ok {
+		t.Error("GetReporter() should fall back to a text reporter")
+	}
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RetentionPolicy selects which archives to keep, the same way as most backup tools:
+// the Last most recent ones, plus the most recent one of each of the last Daily days,
+// Weekly ISO weeks and Monthly months having an archive. A zero policy keeps everything.
+type RetentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// IsZero reports whether the policy keeps everything
+func (p RetentionPolicy) IsZero() bool {
+	return p == RetentionPolicy{}
+}
+
+// Validate checks no count is negative
+func (p RetentionPolicy) Validate() error {
+	if p.Last < 0 || p.Daily < 0 || p.Weekly < 0 || p.Monthly < 0 {
+		return fmt.Errorf("retention counts must be positive")
+	}
+	return nil
+}
+
+// Keep returns, for each of the given archive times, whether the archive is kept
+func (p RetentionPolicy) Keep(times []time.Time) []bool {
+	keep := make([]bool, len(times))
+	if p.IsZero() {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	// Walk archives from the most recent one
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return times[b].Compare(times[a])
+	})
+
+	buckets := []struct {
+		count int
+		key   func(time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for n, i := range order {
+		if n < p.Last {
+			keep[i] = true
+		}
+	}
+	for _, bucket := range buckets {
+		seen := map[string]bool{}
+		for _, i := range order {
+			if len(seen) >= bucket.count {
+				break
+			}
+			key := bucket.key(times[i])
+			if !seen[key] {
+				seen[key] = true
+				keep[i] = true
+			}
+		}
+	}
+	return keep
+}
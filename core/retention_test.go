@@ -0,0 +1,76 @@
+package core
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	day := func(d, h int) time.Time {
+		return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC)
+	}
+	// 2024-03-01 is a Friday, 2024-03-04 a Monday
+	times := []time.Time{
+		day(1, 10),
+		day(1, 20),
+		day(3, 10),
+		day(4, 10),
+		day(4, 18),
+		day(5, 10),
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []bool
+	}{
+		{
+			name:   "zero policy keeps everything",
+			policy: RetentionPolicy{},
+			want:   []bool{true, true, true, true, true, true},
+		},
+		{
+			name:   "keep last",
+			policy: RetentionPolicy{Last: 2},
+			want:   []bool{false, false, false, false, true, true},
+		},
+		{
+			name:   "keep daily",
+			policy: RetentionPolicy{Daily: 3},
+			want:   []bool{false, false, true, false, true, true},
+		},
+		{
+			name:   "keep weekly",
+			policy: RetentionPolicy{Weekly: 2},
+			want:   []bool{false, false, true, false, false, true},
+		},
+		{
+			name:   "keep monthly",
+			policy: RetentionPolicy{Monthly: 1},
+			want:   []bool{false, false, false, false, false, true},
+		},
+		{
+			name:   "policies are combined",
+			policy: RetentionPolicy{Last: 1, Daily: 1, Weekly: 2},
+			want:   []bool{false, false, true, false, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Keep(times); !slices.Equal(got, tt.want) {
+				t.Errorf("Keep() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	if err := (RetentionPolicy{Last: 3, Daily: 7}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := (RetentionPolicy{Weekly: -1}).Validate(); err == nil {
+		t.Error("Validate() with negative count should fail")
+	}
+}
@@ -0,0 +1,473 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transports to reach routers: SSH, the RouterOS API in clear text or over TLS,
+// or the REST API of RouterOS 7 over HTTPS
+const (
+	TransportSSH    = "ssh"
+	TransportAPI    = "api"
+	TransportAPISSL = "api-ssl"
+	TransportREST   = "rest"
+)
+
+// Transports lists the accepted --transport and inventory transport values
+var Transports = []string{TransportSSH, TransportAPI, TransportAPISSL, TransportREST}
+
+// ValidateTransport checks transport is a known transport (empty is allowed)
+func ValidateTransport(transport string) error {
+	if transport != "" && !slices.Contains(Transports, transport) {
+		return fmt.Errorf("invalid transport %q (expected one of %s)", transport, strings.Join(Transports, ", "))
+	}
+	return nil
+}
+
+// Default RouterOS API ports
+const (
+	apiPort    = "8728"
+	apiSSLPort = "8729"
+)
+
+// APICaller is implemented by connections using the RouterOS API: commands return
+// structured replies instead of CLI text
+type APICaller interface {
+	// Call runs an API command such as /system/resource/print, args are API words
+	// (=name=value attributes, ?name=value queries). It returns the attributes of each reply.
+	Call(ctx context.Context, command string, args ...string) ([]map[string]string, error)
+}
+
+// APIError is returned when the router rejects an API command (!trap reply)
+type APIError struct {
+	Command  string
+	Category string
+	Message  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("RouterOS API command %s failed: %s", e.Command, e.Message)
+}
+
+// apiAttribute is a reply attribute, replies keep the order of their attributes
+type apiAttribute struct {
+	Key   string
+	Value string
+}
+
+// apiConnection is a RouterOS API session. Commands are sent one at a time.
+type apiConnection struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	closed bool
+}
+
+// dialAPI connects and logs in to the RouterOS API of a host.
+// The API authenticates with the password only, ssh_config and inventory settings
+// resolve the address and user. api-ssl certificates are pinned like REST ones (see dialREST).
+func dialAPI(ctx context.Context, host, username, password, transport string) (*apiConnection, error) {
+	hostInfo := readSshConfig(host, username)
+	overrides := InventoryHost{}
+	cfg, cfgErr := GetConfig(ctx)
+	if cfgErr == nil {
+		overrides = cfg.HostOverrides(host)
+		applyInventoryOverrides(hostInfo, overrides)
+	}
+	if hostInfo.User != "" {
+		username = hostInfo.User
+	}
+	if password == "" {
+		return nil, fmt.Errorf("the RouterOS API needs a password")
+	}
+
+	port := overrides.APIPort
+	if port == "" {
+		port = apiPort
+		if transport == TransportAPISSL {
+			port = apiSSLPort
+		}
+	}
+	address := net.JoinHostPort(hostInfo.Hostname, port)
+	slog.Debug("connecting to RouterOS API", "address", address, "transport", transport, "user", username)
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if transport == TransportAPISSL {
+		// Pinned like the REST certificate, routers mostly serve self-signed certificates
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: pinnedTLSConfig(ctx, host, address)}).DialContext(ctx, "tcp", address)
+	} else {
+		slog.Warn("RouterOS API without TLS, the password is sent in clear text", "address", address)
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", address, err)
+	}
+
+	api := &apiConnection{conn: conn, reader: bufio.NewReader(conn)}
+	if err := api.login(ctx, username, password); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	slog.Debug("RouterOS API connection established", "address", address)
+	return api, nil
+}
+
+// login authenticates, with the legacy challenge-response of RouterOS before 6.43 when asked to
+func (c *apiConnection) login(ctx context.Context, username, password string) error {
+	_, done, err := c.call(ctx, "/login", "=name="+username, "=password="+password)
+	if err != nil {
+		return fmt.Errorf("RouterOS API login failed: %w", err)
+	}
+	challenge := apiValue(done, "ret")
+	if challenge == "" {
+		return nil
+	}
+
+	raw, err := hex.DecodeString(challenge)
+	if err != nil {
+		return fmt.Errorf("RouterOS API login failed: invalid challenge: %w", err)
+	}
+	sum := md5.Sum(slices.Concat([]byte{0}, []byte(password), raw))
+	if _, _, err := c.call(ctx, "/login", "=name="+username, "=response=00"+hex.EncodeToString(sum[:])); err != nil {
+		return fmt.Errorf("RouterOS API login failed: %w", err)
+	}
+	return nil
+}
+
+// Call runs an API command and returns the attributes of its replies
+func (c *apiConnection) Call(ctx context.Context, command string, args ...string) ([]map[string]string, error) {
+	replies, _, err := c.call(ctx, command, args...)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]map[string]string, 0, len(replies))
+	for _, reply := range replies {
+		attributes := make(map[string]string, len(reply))
+		for _, attribute := range reply {
+			attributes[attribute.Key] = attribute.Value
+		}
+		results = append(results, attributes)
+	}
+	return results, nil
+}
+
+// call sends a command and reads its !re replies until !done, whose attributes are returned too.
+// The connection is closed when the exchange is interrupted, its state is unknown afterwards.
+func (c *apiConnection) call(ctx context.Context, command string, args ...string) ([][]apiAttribute, []apiAttribute, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, nil, fmt.Errorf("%w: RouterOS API connection already closed", errSession)
+	}
+	ctx, cancel := withCommandTimeout(ctx)
+	defer cancel()
+
+	// Deadlines unblock reads and writes once ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+	start := time.Now()
+
+	fail := func(err error) ([][]apiAttribute, []apiAttribute, error) {
+		c.closed = true
+		_ = c.conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				return nil, nil, &CommandTimeoutError{Command: command, Elapsed: time.Since(start)}
+			}
+			return nil, nil, fmt.Errorf("command %q interrupted: %w", command, ctxErr)
+		}
+		return nil, nil, err
+	}
+
+	slog.Debug("RouterOS API command", "command", command)
+	if err := writeAPISentence(c.conn, append([]string{command}, args...)); err != nil {
+		// Nothing reached the router, the command can be sent again on a new connection
+		return fail(fmt.Errorf("%w: %v", errSession, err))
+	}
+
+	var replies [][]apiAttribute
+	var trap *APIError
+	for {
+		sentence, err := readAPISentence(c.reader)
+		if err != nil {
+			return fail(fmt.Errorf("failed to read RouterOS API reply: %w", err))
+		}
+		if len(sentence) == 0 {
+			continue
+		}
+		attributes := parseAPIAttributes(sentence[1:])
+		switch sentence[0] {
+		case "!re":
+			replies = append(replies, attributes)
+		case "!trap":
+			// The command still ends with !done
+			trap = &APIError{Command: command, Category: apiValue(attributes, "category"), Message: apiValue(attributes, "message")}
+		case "!fatal":
+			message := strings.Join(sentence[1:], " ")
+			return fail(fmt.Errorf("RouterOS API connection closed by router: %s", message))
+		case "!done":
+			if trap != nil {
+				slog.Warn("RouterOS API command failed", "command", command, "error", trap.Message)
+				return nil, nil, trap
+			}
+			return replies, attributes, nil
+		default:
+			slog.Debug("ignoring unexpected RouterOS API reply", "reply", sentence[0])
+		}
+	}
+}
+
+// Close ends the API session
+func (c *apiConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// IsAlreadyClosedError checks if the error is due to closing an already closed connection
+func (c *apiConnection) IsAlreadyClosedError(err error) bool {
+	return isAlreadyClosedError(err)
+}
+
+// connected reports whether the session can still be used, checked with a command when check is set
+func (c *apiConnection) connected(check bool) bool {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed || !check {
+		return !closed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keepaliveTimeout)
+	defer cancel()
+	_, _, err := c.call(ctx, "/system/identity/print")
+	return err == nil
+}
+
+// Run runs a CLI command translated to the API, without deadline
+func (c *apiConnection) Run(cmd string) (string, error) {
+	return c.RunContext(context.Background(), cmd)
+}
+
+// RunContext runs a CLI command translated to the API and returns its replies as CLI text
+func (c *apiConnection) RunContext(ctx context.Context, cmd string) (string, error) {
+	result, err := c.Exec(ctx, cmd)
+	return result.Stdout, err
+}
+
+// Exec runs a simple CLI command ("/menu/path command name=value", print flags terse or detail)
+// over the API. Replies are printed as "name: value" lines, or one "n name=value ..."
+// line per item for terse prints, so CLI output parsers keep working.
+// Rejected commands are *RemoteCommandError holding the router message.
+func (c *apiConnection) Exec(ctx context.Context, cmd string) (CommandResult, error) {
+	start := time.Now()
+	command, args, terse, err := cliToAPI(cmd)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	replies, _, err := c.call(ctx, command, args...)
+	result := CommandResult{Duration: time.Since(start)}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		result.Stderr = apiErr.Message
+		result.ExitCode = 1
+		return result, &RemoteCommandError{Command: RedactCommand(cmd), Result: result}
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Stdout = formatAPIReplies(replies, terse)
+	return result, nil
+}
+
+// cliToAPI translates a CLI command into an API command and its attribute words.
+// Scripting ([find], variables, several commands) has no API equivalent.
+func cliToAPI(cmd string) (string, []string, bool, error) {
+	if strings.ContainsAny(cmd, "[];${}") || strings.HasPrefix(strings.TrimSpace(cmd), ":") {
+		return "", nil, false, fmt.Errorf("command %q is not supported over the RouterOS API, use the SSH transport", RedactCommand(cmd))
+	}
+	fields, err := splitSshConfigArgs(cmd)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("invalid command %q: %w", RedactCommand(cmd), err)
+	}
+
+	var path, args []string
+	terse := false
+	for _, field := range fields {
+		switch {
+		case strings.Contains(field, "="):
+			args = append(args, "="+field)
+		case len(args) > 0 || (len(path) > 0 && path[len(path)-1] == "print"):
+			// Print flags: terse changes the output format, others have no API meaning
+			if field == "terse" {
+				terse = true
+			} else if field != "detail" && field != "without-paging" {
+				return "", nil, false, fmt.Errorf("command %q: flag %q is not supported over the RouterOS API", RedactCommand(cmd), field)
+			}
+		default:
+			path = append(path, strings.Split(strings.Trim(field, "/"), "/")...)
+		}
+	}
+	if len(path) == 0 {
+		return "", nil, false, fmt.Errorf("empty command")
+	}
+	if path[0] == "export" {
+		return "", nil, false, fmt.Errorf("export is not available over the RouterOS API, use the SSH transport")
+	}
+	return "/" + strings.Join(path, "/"), args, terse, nil
+}
+
+// formatAPIReplies prints replies the way the CLI does
+func formatAPIReplies(replies [][]apiAttribute, terse bool) string {
+	var b strings.Builder
+	for i, reply := range replies {
+		if terse {
+			fmt.Fprintf(&b, "%2d", i)
+			for _, attribute := range reply {
+				if attribute.Key != ".id" {
+					fmt.Fprintf(&b, " %s=%s", attribute.Key, attribute.Value)
+				}
+			}
+			b.WriteString("\n")
+			continue
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for _, attribute := range reply {
+			if attribute.Key != ".id" {
+				fmt.Fprintf(&b, "%s: %s\n", attribute.Key, attribute.Value)
+			}
+		}
+	}
+	return b.String()
+}
+
+// parseAPIAttributes reads =name=value words, other words (.tag) are skipped
+func parseAPIAttributes(words []string) []apiAttribute {
+	var attributes []apiAttribute
+	for _, word := range words {
+		if !strings.HasPrefix(word, "=") {
+			continue
+		}
+		key, value, _ := strings.Cut(word[1:], "=")
+		attributes = append(attributes, apiAttribute{Key: key, Value: value})
+	}
+	return attributes
+}
+
+// apiValue returns the value of an attribute, empty when missing
+func apiValue(attributes []apiAttribute, key string) string {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+// writeAPISentence sends words followed by the empty word ending the sentence
+func writeAPISentence(w io.Writer, words []string) error {
+	var buf []byte
+	for _, word := range words {
+		buf = appendAPILength(buf, len(word))
+		buf = append(buf, word...)
+	}
+	buf = append(buf, 0)
+	_, err := w.Write(buf)
+	return err
+}
+
+// maxAPIWordLength bounds the words read from the API: lengths go up to 4 GiB on the wire,
+// RouterOS replies are far smaller
+const maxAPIWordLength = 16 << 20
+
+// readAPISentence reads words until the empty word ending the sentence
+func readAPISentence(r *bufio.Reader) ([]string, error) {
+	var words []string
+	for {
+		length, err := readAPILength(r)
+		if err != nil {
+			return nil, err
+		}
+		if length == 0 {
+			return words, nil
+		}
+		if length > maxAPIWordLength {
+			return nil, fmt.Errorf("RouterOS API word of %d bytes exceeds the %d bytes limit", length, maxAPIWordLength)
+		}
+		word := make([]byte, length)
+		if _, err := io.ReadFull(r, word); err != nil {
+			return nil, err
+		}
+		words = append(words, string(word))
+	}
+}
+
+// appendAPILength encodes a word length on 1 to 5 bytes, the high bits of the first byte
+// telling how many follow
+func appendAPILength(buf []byte, length int) []byte {
+	switch {
+	case length < 0x80:
+		return append(buf, byte(length))
+	case length < 0x4000:
+		return append(buf, byte(length>>8)|0x80, byte(length))
+	case length < 0x200000:
+		return append(buf, byte(length>>16)|0xC0, byte(length>>8), byte(length))
+	case length < 0x10000000:
+		return append(buf, byte(length>>24)|0xE0, byte(length>>16), byte(length>>8), byte(length))
+	}
+	return append(buf, 0xF0, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+}
+
+// readAPILength decodes a word length
+func readAPILength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var extra int
+	var length int
+	switch {
+	case first&0x80 == 0:
+		return int(first), nil
+	case first&0xC0 == 0x80:
+		extra, length = 1, int(first&0x3F)
+	case first&0xE0 == 0xC0:
+		extra, length = 2, int(first&0x1F)
+	case first&0xF0 == 0xE0:
+		extra, length = 3, int(first&0x0F)
+	case first == 0xF0:
+		extra = 4
+	default:
+		return 0, fmt.Errorf("invalid RouterOS API word length prefix 0x%02x", first)
+	}
+	for range extra {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
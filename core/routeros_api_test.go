@@ -0,0 +1,359 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestAPIServer is an in-process RouterOS API accepting admin/secret.
+// With legacy set, it uses the challenge-response login of RouterOS before 6.43.
+// /system/resource/print and check-for-updates reply with fixed values, /delay never replies
+// and other commands are rejected.
+func startTestAPIServer(t *testing.T, legacy bool) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveTestAPI(t, listener, legacy)
+	return listener.Addr().String()
+}
+
+// startTestAPISSLServer is startTestAPIServer over TLS, with a self-signed certificate
+func startTestAPISSLServer(t *testing.T) (string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "router-api"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveTestAPI(t, listener, false)
+	return listener.Addr().String(), cert
+}
+
+// serveTestAPI serves the test API on a listener, closed at the end of the test
+func serveTestAPI(t *testing.T, listener net.Listener, legacy bool) {
+	t.Helper()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	challenge := []byte("0123456789abcdef")
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				reader := bufio.NewReader(conn)
+				loggedIn := false
+				for {
+					sentence, err := readAPISentence(reader)
+					if err != nil {
+						return
+					}
+					attributes := parseAPIAttributes(sentence[1:])
+					var replies [][]string
+					switch {
+					case sentence[0] == "/login":
+						response := apiValue(attributes, "response")
+						sum := md5.Sum(append(append([]byte{0}, "secret"...), challenge...))
+						switch {
+						case legacy && response == "":
+							replies = [][]string{{"!done", "=ret=" + hex.EncodeToString(challenge)}}
+						case legacy && apiValue(attributes, "name") == "admin" && response == "00"+hex.EncodeToString(sum[:]),
+							!legacy && apiValue(attributes, "name") == "admin" && apiValue(attributes, "password") == "secret":
+							loggedIn = true
+							replies = [][]string{{"!done"}}
+						default:
+							replies = [][]string{{"!trap", "=message=invalid user name or password (6)"}, {"!done"}}
+						}
+					case !loggedIn:
+						replies = [][]string{{"!fatal", "not logged in"}}
+					case sentence[0] == "/system/resource/print":
+						replies = [][]string{{"!re", "=.id=*0", "=version=7.15.3", "=architecture-name=arm64"}, {"!done"}}
+					case sentence[0] == "/system/package/update/check-for-updates":
+						replies = [][]string{
+							{"!re", "=channel=stable", "=installed-version=7.15.3", "=status=finding out latest version..."},
+							{"!re", "=channel=stable", "=installed-version=7.15.3", "=latest-version=7.16", "=status=New version is available"},
+							{"!done"},
+						}
+					case sentence[0] == "/delay":
+						continue
+					default:
+						replies = [][]string{{"!trap", "=message=no such command"}, {"!done"}}
+					}
+					for _, reply := range replies {
+						if err := writeAPISentence(conn, reply); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+}
+
+// apiTestContext returns a context with an inventory host reaching the test API server
+func apiTestContext(t *testing.T, address string, commandTimeout time.Duration) context.Context {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	originalSystem := systemSshConfig
+	t.Cleanup(func() { systemSshConfig = originalSystem })
+	systemSshConfig = filepath.Join(t.TempDir(), "none")
+
+	host, port, _ := net.SplitHostPort(address)
+	cfg := &Config{
+		CommandTimeout: commandTimeout,
+		Inventory: &Inventory{Hosts: []InventoryHost{
+			{Name: "router-api", Address: host, APIPort: port, Transport: TransportAPI},
+		}},
+	}
+	ctx := context.WithValue(context.Background(), ConfigKey, cfg)
+	return context.WithValue(ctx, SshManagerKey, NewSshManager("admin", "secret", ""))
+}
+
+func TestAPILength(t *testing.T) {
+	for _, length := range []int{0, 1, 0x7F, 0x80, 0x3FFF, 0x4000, 0x1FFFFF, 0x200000, 0xFFFFFFF, 0x10000000} {
+		encoded := appendAPILength(nil, length)
+		decoded, err := readAPILength(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil {
+			t.Fatalf("readAPILength(%x) error = %v", encoded, err)
+		}
+		if decoded != length {
+			t.Errorf("length %#x encoded as %x decoded as %#x", length, encoded, decoded)
+		}
+	}
+	if got := appendAPILength(nil, 0x80); !bytes.Equal(got, []byte{0x80, 0x80}) {
+		t.Errorf("appendAPILength(0x80) = %x, want 8080", got)
+	}
+	if _, err := readAPILength(bufio.NewReader(bytes.NewReader([]byte{0xF8}))); err == nil {
+		t.Error("readAPILength(0xF8) error = nil, want invalid prefix error")
+	}
+
+	// A word announced with 256 MiB is refused before anything is allocated
+	huge := appendAPILength(nil, 256<<20)
+	if _, err := readAPISentence(bufio.NewReader(bytes.NewReader(huge))); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("readAPISentence() error = %v, want a word size error", err)
+	}
+}
+
+func TestCliToAPI(t *testing.T) {
+	tests := []struct {
+		cmd       string
+		command   string
+		args      []string
+		terse     bool
+		errString string
+	}{
+		{cmd: "/system/resource/print", command: "/system/resource/print"},
+		{cmd: "/system identity print", command: "/system/identity/print"},
+		{cmd: "/system/package/print terse", command: "/system/package/print", terse: true},
+		{cmd: `/system identity set name="core router"`, command: "/system/identity/set", args: []string{"=name=core router"}},
+		{cmd: "/system/package/update/set channel=long-term", command: "/system/package/update/set", args: []string{"=channel=long-term"}},
+		{cmd: "/export terse", errString: "export is not available"},
+		{cmd: "/system scheduler remove [find name=rollback]", errString: "not supported over the RouterOS API"},
+		{cmd: ":delay 5s", errString: "not supported over the RouterOS API"},
+		{cmd: "/ip address print where interface=ether1", errString: `flag "where"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			command, args, terse, err := cliToAPI(tt.cmd)
+			if tt.errString != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errString) {
+					t.Fatalf("cliToAPI() error = %v, want %q", err, tt.errString)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cliToAPI() error = %v", err)
+			}
+			if command != tt.command || !reflect.DeepEqual(args, tt.args) || terse != tt.terse {
+				t.Errorf("cliToAPI() = %q %q %v, want %q %q %v", command, args, terse, tt.command, tt.args, tt.terse)
+			}
+		})
+	}
+}
+
+func TestFormatAPIReplies(t *testing.T) {
+	replies := [][]apiAttribute{
+		{{".id", "*1"}, {"name", "routeros"}, {"version", "7.15.3"}},
+		{{".id", "*2"}, {"name", "wifi-qcom"}, {"version", "7.15.3"}},
+	}
+	wantTerse := " 0 name=routeros version=7.15.3\n 1 name=wifi-qcom version=7.15.3\n"
+	if got := formatAPIReplies(replies, true); got != wantTerse {
+		t.Errorf("formatAPIReplies(terse) = %q, want %q", got, wantTerse)
+	}
+	wantDetail := "name: routeros\nversion: 7.15.3\n\nname: wifi-qcom\nversion: 7.15.3\n"
+	if got := formatAPIReplies(replies, false); got != wantDetail {
+		t.Errorf("formatAPIReplies() = %q, want %q", got, wantDetail)
+	}
+}
+
+func TestDialAPI(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		t.Run(map[bool]string{false: "login", true: "legacy login"}[legacy], func(t *testing.T) {
+			ctx := apiTestContext(t, startTestAPIServer(t, legacy), 0)
+
+			conn, err := dialAPI(ctx, "router-api", "admin", "secret", TransportAPI)
+			if err != nil {
+				t.Fatalf("dialAPI() error = %v", err)
+			}
+			defer func() { _ = conn.Close() }()
+
+			replies, err := conn.Call(ctx, "/system/resource/print")
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			want := []map[string]string{{".id": "*0", "version": "7.15.3", "architecture-name": "arm64"}}
+			if !reflect.DeepEqual(replies, want) {
+				t.Errorf("Call() = %v, want %v", replies, want)
+			}
+		})
+	}
+
+	t.Run("wrong password", func(t *testing.T) {
+		ctx := apiTestContext(t, startTestAPIServer(t, false), 0)
+		_, err := dialAPI(ctx, "router-api", "admin", "wrong", TransportAPI)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !strings.Contains(err.Error(), "invalid user name or password") {
+			t.Errorf("dialAPI() error = %v, want an APIError about the password", err)
+		}
+	})
+}
+
+func TestDialAPISSL_CertificatePinning(t *testing.T) {
+	address, cert := startTestAPISSLServer(t)
+	ctx := apiTestContext(t, address, 0)
+	t.Chdir(t.TempDir())
+
+	// Outside enrollment, an unknown certificate is refused
+	if _, err := dialAPI(ctx, "router-api", "admin", "secret", TransportAPISSL); err == nil || !strings.Contains(err.Error(), "no pinned certificate") {
+		t.Fatalf("dialAPI() before enrollment error = %v, want a pinning error", err)
+	}
+
+	// Enrollment pins it, later connections check it
+	enrollCtx := context.WithValue(ctx, EnrollmentModeKey, true)
+	conn, err := dialAPI(enrollCtx, "router-api", "admin", "secret", TransportAPISSL)
+	if err != nil {
+		t.Fatalf("dialAPI() during enrollment error = %v", err)
+	}
+	_ = conn.Close()
+	info, err := LoadHostCertInfo("router-api")
+	if err != nil {
+		t.Fatalf("LoadHostCertInfo() error = %v", err)
+	}
+	if want := GetCertFingerprint(cert); info.Fingerprint != want {
+		t.Errorf("pinned fingerprint = %s, want %s", info.Fingerprint, want)
+	}
+	conn, err = dialAPI(ctx, "router-api", "admin", "secret", TransportAPISSL)
+	if err != nil {
+		t.Fatalf("dialAPI() with pinned certificate error = %v", err)
+	}
+	_ = conn.Close()
+
+	// Another certificate is refused
+	if err := CaptureHostCert("router-api", generateTestCert(t, "router-api")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialAPI(ctx, "router-api", "admin", "secret", TransportAPISSL); err == nil || !strings.Contains(err.Error(), "certificate mismatch") {
+		t.Errorf("dialAPI() with another certificate error = %v, want a mismatch error", err)
+	}
+}
+
+func TestCreateConnection_API(t *testing.T) {
+	ctx := apiTestContext(t, startTestAPIServer(t, false), 200*time.Millisecond)
+
+	conn, err := CreateConnection(ctx, "router-api")
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	caller, ok := conn.(APICaller)
+	if !ok {
+		t.Fatal("API connection doesn't return structured replies")
+	}
+	if _, ok := conn.(FileTransferer); ok {
+		t.Error("API connection claims to support SFTP transfers")
+	}
+
+	replies, err := caller.Call(ctx, "/system/package/update/check-for-updates")
+	if err != nil || len(replies) != 2 || replies[1]["latest-version"] != "7.16" {
+		t.Errorf("Call() = %v, %v, want 2 replies with latest-version 7.16", replies, err)
+	}
+
+	// CLI commands are translated, and their replies printed as the CLI does
+	output, err := conn.RunContext(ctx, "/system/resource/print")
+	if err != nil || output != "version: 7.15.3\narchitecture-name: arm64\n" {
+		t.Errorf("RunContext() = %q, %v", output, err)
+	}
+	_, err = conn.RunContext(ctx, "/interface/bridge/add name=bridge1")
+	var remoteErr *RemoteCommandError
+	if !errors.As(err, &remoteErr) || remoteErr.Message() != "no such command" {
+		t.Errorf("RunContext() error = %v, want a RemoteCommandError with the router message", err)
+	}
+
+	// A timed out command leaves the session in an unknown state, the next command reconnects
+	_, err = conn.RunContext(ctx, "/delay")
+	var timeout *CommandTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("RunContext() error = %v, want a CommandTimeoutError", err)
+	}
+	if _, err := conn.RunContext(ctx, "/system/resource/print"); err != nil {
+		t.Errorf("RunContext() after timeout error = %v", err)
+	}
+}
+
+func TestCreateConnection_RedialAfterCallerContext(t *testing.T) {
+	ctx := apiTestContext(t, startTestAPIServer(t, false), time.Second)
+
+	// The context of a step is cancelled once it is done, as RunFleet does
+	stepCtx, cancel := context.WithCancel(ctx)
+	conn, err := CreateConnection(stepCtx, "router-api")
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	cancel()
+
+	// The connection lost afterwards (router reboot) is dialed again all the same
+	ResetConnection(ctx, "router-api")
+	if _, err := conn.RunContext(ctx, "/system/resource/print"); err != nil {
+		t.Errorf("RunContext() after reset error = %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default RouterOS REST API port (www-ssl service)
+const restPort = "443"
+
+// RESTCaller is implemented by connections using the REST API of RouterOS 7:
+// menus and commands exchange JSON objects, whose values are all strings
+type RESTCaller interface {
+	// Get reads a menu such as system/identity into out
+	Get(ctx context.Context, path string, out any) error
+	// Post runs a command such as system/identity/set with the attributes of body,
+	// its reply is decoded into out unless nil
+	Post(ctx context.Context, path string, body, out any) error
+}
+
+// RESTError is returned when the router rejects a REST request
+type RESTError struct {
+	Path    string `json:"-"`
+	Status  int    `json:"error"`
+	Message string `json:"message"`
+	Detail  string `json:"detail"`
+}
+
+func (e *RESTError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("RouterOS REST request %s failed: %d %s: %s", e.Path, e.Status, e.Message, e.Detail)
+	}
+	return fmt.Sprintf("RouterOS REST request %s failed: %d %s", e.Path, e.Status, e.Message)
+}
+
+// restConnection is a client of the REST API of a router. Requests are independent,
+// the HTTP client keeps the TLS session open between them.
+type restConnection struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// dialREST connects to the REST API of a host and checks the credentials.
+// The certificate is pinned during enrollment (HostCertFilePath) and verified afterwards,
+// routers mostly serve self-signed certificates. ssh_config and inventory settings
+// resolve the address and user, like dialAPI.
+func dialREST(ctx context.Context, host, username, password string) (*restConnection, error) {
+	hostInfo := readSshConfig(host, username)
+	overrides := InventoryHost{}
+	if cfg, err := GetConfig(ctx); err == nil {
+		overrides = cfg.HostOverrides(host)
+		applyInventoryOverrides(hostInfo, overrides)
+	}
+	if hostInfo.User != "" {
+		username = hostInfo.User
+	}
+	if password == "" {
+		return nil, fmt.Errorf("the RouterOS REST API needs a password")
+	}
+
+	port := overrides.APIPort
+	if port == "" {
+		port = restPort
+	}
+	address := net.JoinHostPort(hostInfo.Hostname, port)
+	slog.Debug("connecting to RouterOS REST API", "address", address, "user", username)
+
+	tlsConfig := pinnedTLSConfig(ctx, host, address)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn := &restConnection{
+		baseURL:  "https://" + address + "/rest/",
+		username: username,
+		password: password,
+		client: &http.Client{Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+		}},
+	}
+
+	if _, err := GetIdentity(ctx, conn); err != nil {
+		conn.client.CloseIdleConnections()
+		return nil, err
+	}
+	slog.Debug("RouterOS REST connection established", "address", address)
+	return conn, nil
+}
+
+// pinnedTLSConfig returns the TLS configuration of the REST and api-ssl transports:
+// the chain is not checked against CAs, the certificate of the host is pinned instead
+func pinnedTLSConfig(ctx context.Context, host, address string) *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("no certificate presented by %s", address)
+			}
+			return checkHostCert(ctx, host, state.PeerCertificates[0])
+		},
+	}
+}
+
+// checkHostCert verifies the certificate of a host against its pin, the way SSH host keys are
+// verified: pinned on first use during enrollment, mandatory afterwards
+func checkHostCert(ctx context.Context, host string, cert *x509.Certificate) error {
+	cfg, err := GetConfig(ctx)
+	if err == nil && cfg.SkipHostKeyCheck {
+		slog.Warn("⚠️  TLS CERTIFICATE VERIFICATION DISABLED - INSECURE!")
+
+		// Even when skipping verification, still pin the certificate during enrollment
+		if !HostCertExists(host) && IsEnrollmentMode(ctx) {
+			if err := CaptureHostCert(host, cert); err != nil {
+				slog.Error("failed to pin certificate while SkipHostKeyCheck is enabled",
+					"host", host,
+					"fingerprint", GetCertFingerprint(cert),
+					"error", err)
+			}
+		}
+		return nil
+	}
+
+	if HostCertExists(host) {
+		if err := VerifyHostCert(host, cert); err != nil {
+			slog.Error("certificate verification failed", "host", host, "fingerprint", GetCertFingerprint(cert), "error", err)
+			return fmt.Errorf("certificate verification failed: %w", err)
+		}
+		slog.Debug("certificate verified successfully", "host", host)
+		return nil
+	}
+
+	if IsEnrollmentMode(ctx) {
+		slog.Info("pinning certificate for first time",
+			"host", host,
+			"subject", cert.Subject.String(),
+			"fingerprint", GetCertFingerprint(cert))
+		if err := CaptureHostCert(host, cert); err != nil {
+			return fmt.Errorf("failed to pin certificate: %w", err)
+		}
+		return nil
+	}
+
+	slog.Error("no pinned certificate found", "host", host)
+	return fmt.Errorf("no pinned certificate found for %s - run 'enroll' command first to pin the certificate", host)
+}
+
+// Get reads a menu such as system/identity into out
+func (c *restConnection) Get(ctx context.Context, path string, out any) error {
+	return c.request(ctx, http.MethodGet, path, nil, out)
+}
+
+// Post runs a command such as system/identity/set, its reply is decoded into out unless nil
+func (c *restConnection) Post(ctx context.Context, path string, body, out any) error {
+	if body == nil {
+		body = map[string]string{}
+	}
+	return c.request(ctx, http.MethodPost, path, body, out)
+}
+
+// request sends a request bounded by the command timeout and decodes its JSON reply.
+// Rejected requests are *RESTError.
+func (c *restConnection) request(ctx context.Context, method, path string, body, out any) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return fmt.Errorf("%w: RouterOS REST connection already closed", errSession)
+	}
+	ctx, cancel := withCommandTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	// fail reports ctx errors the way SSH commands do
+	fail := func(err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				return &CommandTimeoutError{Command: path, Elapsed: time.Since(start)}
+			}
+			return fmt.Errorf("request %q interrupted: %w", path, ctxErr)
+		}
+		return fmt.Errorf("RouterOS REST request %s failed: %w", path, err)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode RouterOS REST request %s: %w", path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return fmt.Errorf("invalid RouterOS REST request %s: %w", path, err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	slog.Debug("RouterOS REST request", "method", method, "path", path)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fail(err)
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		restErr := &RESTError{}
+		_ = json.Unmarshal(data, restErr)
+		restErr.Path, restErr.Status = path, resp.StatusCode
+		if restErr.Message == "" {
+			restErr.Message = http.StatusText(resp.StatusCode)
+		}
+		slog.Warn("RouterOS REST request failed", "path", path, "status", resp.StatusCode, "error", restErr.Detail)
+		return restErr
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode RouterOS REST reply of %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Close releases the idle connections of the client
+func (c *restConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// IsAlreadyClosedError checks if the error is due to closing an already closed connection
+func (c *restConnection) IsAlreadyClosedError(err error) bool {
+	return isAlreadyClosedError(err)
+}
+
+// connected reports whether the client can still be used, checked with a request when check is set
+func (c *restConnection) connected(check bool) bool {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed || !check {
+		return !closed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keepaliveTimeout)
+	defer cancel()
+	_, err := GetIdentity(ctx, c)
+	return err == nil
+}
+
+// Run runs a CLI command through the REST API, without deadline
+func (c *restConnection) Run(cmd string) (string, error) {
+	return c.RunContext(context.Background(), cmd)
+}
+
+// RunContext runs a CLI command through the REST API and returns its output
+func (c *restConnection) RunContext(ctx context.Context, cmd string) (string, error) {
+	result, err := c.Exec(ctx, cmd)
+	return result.Stdout, err
+}
+
+// Exec runs a CLI command as a script (/execute), which returns the output the CLI prints.
+// Rejected scripts are *RemoteCommandError holding the router message.
+func (c *restConnection) Exec(ctx context.Context, cmd string) (CommandResult, error) {
+	start := time.Now()
+	var reply struct {
+		Ret string `json:"ret"`
+	}
+	err := c.Post(ctx, "execute", map[string]string{"script": cmd, "as-string": ""}, &reply)
+	result := CommandResult{Duration: time.Since(start)}
+	var restErr *RESTError
+	if errors.As(err, &restErr) && restErr.Status == http.StatusBadRequest {
+		result.Stderr = restErr.Detail
+		if result.Stderr == "" {
+			result.Stderr = restErr.Message
+		}
+		result.ExitCode = 1
+		return result, &RemoteCommandError{Command: RedactCommand(cmd), Result: result}
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Stdout = reply.Ret
+	return result, nil
+}
+
+// PackageUpdate is the system/package/update menu
+type PackageUpdate struct {
+	Channel          string `json:"channel"`
+	InstalledVersion string `json:"installed-version"`
+	LatestVersion    string `json:"latest-version"`
+	Status           string `json:"status"`
+}
+
+// RouterBoard is the system/routerboard menu, routerboard is false on CHR and x86
+type RouterBoard struct {
+	RouterBoard     string `json:"routerboard"`
+	Model           string `json:"model"`
+	CurrentFirmware string `json:"current-firmware"`
+	UpgradeFirmware string `json:"upgrade-firmware"`
+}
+
+// Present reports whether the device has a RouterBoard firmware
+func (r RouterBoard) Present() bool {
+	return r.RouterBoard == "true" || r.RouterBoard == "yes"
+}
+
+// Identity is the system/identity menu
+type Identity struct {
+	Name string `json:"name"`
+}
+
+// GetPackageUpdate reads the update channel and the versions known from the last check
+func GetPackageUpdate(ctx context.Context, c RESTCaller) (*PackageUpdate, error) {
+	var update PackageUpdate
+	if err := c.Get(ctx, "system/package/update", &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// CheckForUpdates asks the update server for the latest version of the channel
+func CheckForUpdates(ctx context.Context, c RESTCaller) (*PackageUpdate, error) {
+	var raw json.RawMessage
+	if err := c.Post(ctx, "system/package/update/check-for-updates", nil, &raw); err != nil {
+		return nil, err
+	}
+
+	// The check reports its progress in successive replies, the last values win
+	var replies []map[string]string
+	if err := json.Unmarshal(raw, &replies); err != nil {
+		var reply map[string]string
+		if err := json.Unmarshal(raw, &reply); err != nil {
+			return nil, fmt.Errorf("failed to decode RouterOS REST reply of check-for-updates: %w", err)
+		}
+		replies = append(replies, reply)
+	}
+	values := map[string]string{}
+	for _, reply := range replies {
+		maps.Copy(values, reply)
+	}
+	return &PackageUpdate{
+		Channel:          values["channel"],
+		InstalledVersion: values["installed-version"],
+		LatestVersion:    values["latest-version"],
+		Status:           values["status"],
+	}, nil
+}
+
+// GetRouterBoard reads the model and firmware versions of the device
+func GetRouterBoard(ctx context.Context, c RESTCaller) (*RouterBoard, error) {
+	var board RouterBoard
+	if err := c.Get(ctx, "system/routerboard", &board); err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// GetIdentity reads the system identity (hostname) of the router
+func GetIdentity(ctx context.Context, c RESTCaller) (*Identity, error) {
+	var identity Identity
+	if err := c.Get(ctx, "system/identity", &identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// SetIdentity sets the system identity (hostname) of the router
+func SetIdentity(ctx context.Context, c RESTCaller, name string) error {
+	return c.Post(ctx, "system/identity/set", Identity{Name: name}, nil)
+}
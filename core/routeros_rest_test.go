@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestRESTServer is an HTTPS stand-in of the RouterOS 7 REST API accepting admin/secret.
+// Scripts sent to /execute print their own text, except ":delay" which never replies
+// and ":error <msg>" which is rejected with msg.
+func startTestRESTServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	identity := "MikroTik"
+
+	reply := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/system/identity", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		reply(w, http.StatusOK, map[string]string{"name": identity})
+	})
+	mux.HandleFunc("POST /rest/system/identity/set", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["name"] == "" {
+			reply(w, http.StatusBadRequest, map[string]any{"error": 400, "message": "Bad Request", "detail": "missing name"})
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		identity = body["name"]
+		reply(w, http.StatusOK, []any{})
+	})
+	mux.HandleFunc("GET /rest/system/routerboard", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]string{"routerboard": "true", "model": "RB5009UG+S+", "current-firmware": "7.15.3", "upgrade-firmware": "7.16"})
+	})
+	mux.HandleFunc("GET /rest/system/package/update", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]string{"channel": "stable", "installed-version": "7.15.3"})
+	})
+	mux.HandleFunc("POST /rest/system/package/update/check-for-updates", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, []map[string]string{
+			{"channel": "stable", "installed-version": "7.15.3", "status": "finding out latest version..."},
+			{"channel": "stable", "installed-version": "7.15.3", "latest-version": "7.16", "status": "New version is available"},
+		})
+	})
+	mux.HandleFunc("POST /rest/execute", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		script := body["script"]
+		switch {
+		case strings.HasPrefix(script, ":delay"):
+			<-r.Context().Done()
+		case strings.HasPrefix(script, ":error "):
+			reply(w, http.StatusBadRequest, map[string]any{"error": 400, "message": "Bad Request", "detail": strings.TrimPrefix(script, ":error ")})
+		default:
+			reply(w, http.StatusOK, map[string]string{"ret": "output of " + script})
+		}
+	})
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			reply(w, http.StatusUnauthorized, map[string]any{"error": 401, "message": "Unauthorized"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// restTestContext returns a context with an inventory host reaching the test REST server,
+// run from a temporary directory holding the certificate pins
+func restTestContext(t *testing.T, server *httptest.Server, enrollment bool, commandTimeout time.Duration) context.Context {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	originalSystem := systemSshConfig
+	t.Cleanup(func() { systemSshConfig = originalSystem })
+	systemSshConfig = filepath.Join(t.TempDir(), "none")
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(serverURL.Host)
+	cfg := &Config{
+		CommandTimeout: commandTimeout,
+		Inventory: &Inventory{Hosts: []InventoryHost{
+			{Name: "router-rest", Address: host, APIPort: port, Transport: TransportREST},
+		}},
+	}
+	ctx := context.WithValue(context.Background(), ConfigKey, cfg)
+	ctx = context.WithValue(ctx, EnrollmentModeKey, enrollment)
+	return context.WithValue(ctx, SshManagerKey, NewSshManager("admin", "secret", ""))
+}
+
+func TestDialREST_CertificatePinning(t *testing.T) {
+	server := startTestRESTServer(t)
+	ctx := restTestContext(t, server, false, 0)
+
+	// Outside enrollment, an unknown certificate is refused
+	if _, err := dialREST(ctx, "router-rest", "admin", "secret"); err == nil || !strings.Contains(err.Error(), "no pinned certificate") {
+		t.Fatalf("dialREST() before enrollment error = %v, want a pinning error", err)
+	}
+
+	// Enrollment pins it next to the host key
+	enrollCtx := context.WithValue(ctx, EnrollmentModeKey, true)
+	conn, err := dialREST(enrollCtx, "router-rest", "admin", "secret")
+	if err != nil {
+		t.Fatalf("dialREST() during enrollment error = %v", err)
+	}
+	_ = conn.Close()
+	info, err := LoadHostCertInfo("router-rest")
+	if err != nil {
+		t.Fatalf("LoadHostCertInfo() error = %v", err)
+	}
+	if want := GetCertFingerprint(server.Certificate()); info.Fingerprint != want {
+		t.Errorf("pinned fingerprint = %s, want %s", info.Fingerprint, want)
+	}
+
+	conn, err = dialREST(ctx, "router-rest", "admin", "secret")
+	if err != nil {
+		t.Fatalf("dialREST() with pinned certificate error = %v", err)
+	}
+	_ = conn.Close()
+
+	_, err = dialREST(ctx, "router-rest", "admin", "wrong")
+	var restErr *RESTError
+	if !errors.As(err, &restErr) || restErr.Status != http.StatusUnauthorized {
+		t.Errorf("dialREST() with wrong password error = %v, want a 401 RESTError", err)
+	}
+
+	// Another certificate is refused
+	if err := CaptureHostCert("router-rest", generateTestCert(t, "router-rest")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialREST(ctx, "router-rest", "admin", "secret"); err == nil || !strings.Contains(err.Error(), "certificate mismatch") {
+		t.Errorf("dialREST() with another certificate error = %v, want a mismatch error", err)
+	}
+}
+
+func TestRESTHelpers(t *testing.T) {
+	ctx := restTestContext(t, startTestRESTServer(t), true, 0)
+	conn, err := dialREST(ctx, "router-rest", "admin", "secret")
+	if err != nil {
+		t.Fatalf("dialREST() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if err := SetIdentity(ctx, conn, "core-router"); err != nil {
+		t.Fatalf("SetIdentity() error = %v", err)
+	}
+	identity, err := GetIdentity(ctx, conn)
+	if err != nil || identity.Name != "core-router" {
+		t.Errorf("GetIdentity() = %+v, %v, want core-router", identity, err)
+	}
+
+	board, err := GetRouterBoard(ctx, conn)
+	want := &RouterBoard{RouterBoard: "true", Model: "RB5009UG+S+", CurrentFirmware: "7.15.3", UpgradeFirmware: "7.16"}
+	if err != nil || !reflect.DeepEqual(board, want) || !board.Present() {
+		t.Errorf("GetRouterBoard() = %+v, %v, want %+v", board, err, want)
+	}
+
+	update, err := CheckForUpdates(ctx, conn)
+	wantUpdate := &PackageUpdate{Channel: "stable", InstalledVersion: "7.15.3", LatestVersion: "7.16", Status: "New version is available"}
+	if err != nil || !reflect.DeepEqual(update, wantUpdate) {
+		t.Errorf("CheckForUpdates() = %+v, %v, want %+v", update, err, wantUpdate)
+	}
+
+	current, err := GetPackageUpdate(ctx, conn)
+	if err != nil || current.Channel != "stable" || current.InstalledVersion != "7.15.3" {
+		t.Errorf("GetPackageUpdate() = %+v, %v, want stable 7.15.3", current, err)
+	}
+
+	err = conn.Post(ctx, "system/reboot", nil, nil)
+	var restErr *RESTError
+	if !errors.As(err, &restErr) || restErr.Status != http.StatusNotFound {
+		t.Errorf("Post() to an unknown path error = %v, want a 404 RESTError", err)
+	}
+}
+
+func TestCreateConnection_REST(t *testing.T) {
+	ctx := restTestContext(t, startTestRESTServer(t), true, 200*time.Millisecond)
+
+	conn, err := CreateConnection(ctx, "router-rest")
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, ok := conn.(RESTCaller); !ok {
+		t.Fatal("REST connection doesn't return typed replies")
+	}
+	if _, ok := conn.(FileTransferer); ok {
+		t.Error("REST connection claims to support SFTP transfers")
+	}
+
+	// CLI commands run as scripts
+	output, err := conn.RunContext(ctx, "/system/resource/print")
+	if err != nil || output != "output of /system/resource/print" {
+		t.Errorf("RunContext() = %q, %v", output, err)
+	}
+	_, err = conn.RunContext(ctx, ":error expected end of command")
+	var remoteErr *RemoteCommandError
+	if !errors.As(err, &remoteErr) || remoteErr.Message() != "expected end of command" {
+		t.Errorf("RunContext() error = %v, want a RemoteCommandError with the router message", err)
+	}
+
+	_, err = conn.RunContext(ctx, ":delay 1h")
+	var timeout *CommandTimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("RunContext() error = %v, want a CommandTimeoutError", err)
+	}
+	if _, err := conn.RunContext(ctx, "/system/resource/print"); err != nil {
+		t.Errorf("RunContext() after timeout error = %v", err)
+	}
+}
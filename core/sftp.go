@@ -0,0 +1,161 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/pkg/sftp"
+)
+
+// FileTransferer is implemented by connections able to transfer files to and from the router (SFTP)
+// Transfers are interrupted once ctx is done.
+type FileTransferer interface {
+	Upload(ctx context.Context, localPath, remotePath string) error
+	Download(ctx context.Context, remotePath, localPath string) error
+	Checksum(ctx context.Context, remotePath string) (size int64, sha256sum string, err error)
+}
+
+// Upload copies a local file to the router over SFTP, on the existing SSH connection
+func (c *sshConnection) Upload(ctx context.Context, localPath, remotePath string) error {
+	return c.withSFTP(ctx, func(client *sftp.Client) error {
+		return uploadFile(client, localPath, remotePath)
+	})
+}
+
+// Download copies a file stored on the router to a local file over SFTP, on the existing SSH connection
+func (c *sshConnection) Download(ctx context.Context, remotePath, localPath string) error {
+	return c.withSFTP(ctx, func(client *sftp.Client) error {
+		return downloadFile(client, remotePath, localPath)
+	})
+}
+
+// Checksum returns the size and SHA-256 checksum of a file stored on the router
+func (c *sshConnection) Checksum(ctx context.Context, remotePath string) (size int64, sum string, err error) {
+	err = c.withSFTP(ctx, func(client *sftp.Client) error {
+		size, sum, err = remoteChecksum(client, remotePath)
+		return err
+	})
+	return size, sum, err
+}
+
+// withSFTP runs fn on a new SFTP session of the SSH connection (see withSFTPClient)
+func (c *sshConnection) withSFTP(ctx context.Context, fn func(client *sftp.Client) error) error {
+	if c.client == nil {
+		return fmt.Errorf("SSH connection not established")
+	}
+	client, err := sftp.NewClient(c.client)
+	if err != nil {
+		return fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	return withSFTPClient(ctx, client, fn)
+}
+
+// withSFTPClient runs fn on an SFTP client, closed once fn returns or as soon as ctx is done:
+// a transfer stuck on a dead connection fails instead of hanging
+func withSFTPClient(ctx context.Context, client *sftp.Client, fn func(client *sftp.Client) error) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = client.Close()
+	})
+	defer func() {
+		stop()
+		_ = client.Close()
+	}()
+	if err := fn(client); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("file transfer interrupted: %w", context.Cause(ctx))
+		}
+		return err
+	}
+	return nil
+}
+
+func uploadFile(client *sftp.Client, localPath, remotePath string) error {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dst, err := client.Create(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", remotePath, err)
+	}
+	written, err := io.Copy(dst, src)
+	if err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+	slog.Debug("file uploaded", "local", localPath, "remote", remotePath, "bytes", written)
+	return nil
+}
+
+func downloadFile(client *sftp.Client, remotePath, localPath string) error {
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file %s: %w", remotePath, err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dst, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	written, err := io.Copy(dst, src)
+	if err != nil {
+		_ = dst.Close()
+		_ = os.Remove(localPath)
+		return fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+	slog.Debug("file downloaded", "remote", remotePath, "local", localPath, "bytes", written)
+	return nil
+}
+
+func remoteChecksum(client *sftp.Client, remotePath string) (int64, string, error) {
+	f, err := client.Open(remotePath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open remote file %s: %w", remotePath, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read remote file %s: %w", remotePath, err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FileChecksum returns the size and SHA-256 checksum of a local file
+func FileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
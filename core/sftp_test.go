@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// newInMemorySftpClient returns an SFTP client connected to an in-memory SFTP server
+func newInMemorySftpClient(t *testing.T) *sftp.Client {
+	t.Helper()
+	// Closing either end of the pipe ends both the client and the server, like an SSH channel
+	serverConn, clientConn := net.Pipe()
+
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go func() {
+		_ = server.Serve()
+	}()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("failed to create SFTP client: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client
+}
+
+func TestFileTransfer(t *testing.T) {
+	client := newInMemorySftpClient(t)
+
+	local := filepath.Join(t.TempDir(), "routeros-7.15.3-arm64.npk")
+	if err := os.WriteFile(local, []byte("npk package content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uploadFile(client, local, "/routeros-7.15.3-arm64.npk"); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	wantSize, wantSum, err := FileChecksum(local)
+	if err != nil {
+		t.Fatalf("FileChecksum() error = %v", err)
+	}
+	size, sum, err := remoteChecksum(client, "/routeros-7.15.3-arm64.npk")
+	if err != nil {
+		t.Fatalf("remoteChecksum() error = %v", err)
+	}
+	if size != wantSize || sum != wantSum {
+		t.Errorf("remoteChecksum() = %d %s, want %d %s", size, sum, wantSize, wantSum)
+	}
+
+	downloaded := filepath.Join(t.TempDir(), "downloaded.npk")
+	if err := downloadFile(client, "/routeros-7.15.3-arm64.npk", downloaded); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if content, err := os.ReadFile(downloaded); err != nil || string(content) != "npk package content" {
+		t.Errorf("downloaded content = %q (error %v), want %q", content, err, "npk package content")
+	}
+
+	if _, _, err := remoteChecksum(client, "/missing.npk"); err == nil {
+		t.Error("remoteChecksum() on missing file should fail")
+	}
+	if err := uploadFile(client, filepath.Join(t.TempDir(), "missing.npk"), "/missing.npk"); err == nil {
+		t.Error("uploadFile() with missing local file should fail")
+	}
+}
+
+func TestWithSFTPClientInterrupted(t *testing.T) {
+	client := newInMemorySftpClient(t)
+
+	// A transfer still running when ctx is done fails once the client is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	err := withSFTPClient(ctx, client, func(client *sftp.Client) error {
+		cancel()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := client.Stat("/"); err != nil {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("withSFTPClient() error = %v, want context.Canceled", err)
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -12,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/kevinburke/ssh_config"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -21,15 +21,83 @@ type SshRunner interface {
 	Close() error
 	IsAlreadyClosedError(err error) bool
 	Run(cmd string) (string, error)
+	// RunContext runs a command until ctx is done or the configured command timeout expires
+	RunContext(ctx context.Context, cmd string) (string, error)
 }
 
+// CommandTimeoutError is returned when a command runs past its deadline.
+// Command has its secrets redacted.
+type CommandTimeoutError struct {
+	Command string
+	Elapsed time.Duration
+}
+
+func (e *CommandTimeoutError) Error() string {
+	return fmt.Sprintf("command %q timed out after %s", e.Command, e.Elapsed.Round(time.Second))
+}
+
+// Unwrap makes errors.Is(err, context.DeadlineExceeded) hold for timeouts
+func (e *CommandTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// CommandResult is the outcome of a remote command
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
+
+// RemoteCommandError is returned when a remote command exits with a non-zero status
+// or without any status. Result holds what the router printed, Command has its secrets redacted.
+type RemoteCommandError struct {
+	Command string
+	Result  CommandResult
+}
+
+func (e *RemoteCommandError) Error() string {
+	status := fmt.Sprintf("exit status %d", e.Result.ExitCode)
+	if e.Result.ExitCode < 0 {
+		status = "no exit status"
+	}
+	if message := e.Message(); message != "" {
+		return fmt.Sprintf("failed to run command: %s: %s", status, message)
+	}
+	return fmt.Sprintf("failed to run command: %s", status)
+}
+
+// Message returns the error text printed by the router, stderr or else stdout
+func (e *RemoteCommandError) Message() string {
+	if message := strings.TrimSpace(e.Result.Stderr); message != "" {
+		return message
+	}
+	return strings.TrimSpace(e.Result.Stdout)
+}
+
+// withCommandTimeout bounds ctx with the configured command timeout, unless disabled
+func withCommandTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg, err := GetConfig(ctx); err == nil && cfg.CommandTimeout > 0 {
+		return context.WithTimeout(ctx, cfg.CommandTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// errSession is returned when a session can't be opened, the command was not sent
+var errSession = errors.New("failed to create session")
+
 type sshConnection struct {
 	client       *ssh.Client
 	clientConfig *ssh.ClientConfig
+	// jumps are the ProxyJump host connections the client goes through
+	jumps []*ssh.Client
+	// done is closed once the SSH transport is gone (router rebooted, network error)
+	done chan struct{}
 }
 
 func (c *sshConnection) Close() error {
 	err := c.client.Close()
+	closeClients(c.jumps)
 	if err != nil && !c.IsAlreadyClosedError(err) {
 		slog.Warn("failed to close SSH connection", "error", err)
 		return err
@@ -40,6 +108,10 @@ func (c *sshConnection) Close() error {
 
 // IsAlreadyClosedError checks if the error is due to closing an already closed connection
 func (c *sshConnection) IsAlreadyClosedError(err error) bool {
+	return isAlreadyClosedError(err)
+}
+
+func isAlreadyClosedError(err error) bool {
 	if err == nil {
 		return false
 	}
@@ -49,18 +121,34 @@ func (c *sshConnection) IsAlreadyClosedError(err error) bool {
 }
 
 func (c *sshConnection) Run(cmd string) (string, error) {
+	return c.RunContext(context.Background(), cmd)
+}
+
+// RunContext runs a command and returns its standard output
+func (c *sshConnection) RunContext(ctx context.Context, cmd string) (string, error) {
+	result, err := c.Exec(ctx, cmd)
+	return result.Stdout, err
+}
+
+// Exec runs a command and returns its output and exit status, the session is killed
+// and closed once ctx is done. A non-zero exit status is a *RemoteCommandError.
+func (c *sshConnection) Exec(ctx context.Context, cmd string) (CommandResult, error) {
 	// Check if connection is established
 	if c.client == nil {
 		slog.Warn("SSH connection not established")
-		return "", fmt.Errorf("SSH connection not established")
+		return CommandResult{}, fmt.Errorf("SSH connection not established")
 	}
+	ctx, cancel := withCommandTimeout(ctx)
+	defer cancel()
+	// Commands may hold secrets (backup passwords...), never log or return them as is
+	logged := RedactCommand(cmd)
 
 	// Each ClientConn can support multiple interactive sessions,
 	// represented by a Session.
 	session, err := c.client.NewSession()
 	if err != nil {
 		slog.Warn("failed to create session", "error", err)
-		return "", fmt.Errorf("failed to create session: %v", err)
+		return CommandResult{}, fmt.Errorf("%w: %v", errSession, err)
 	}
 	defer func() {
 		_ = session.Close() // Explicitly ignore close error on session as connection may already be closed
@@ -68,13 +156,76 @@ func (c *sshConnection) Run(cmd string) (string, error) {
 
 	// Once a Session is created, you can execute a single command on
 	// the remote side using the Run method.
-	var b bytes.Buffer
-	session.Stdout = &b
-	if err := session.Run(cmd); err != nil {
-		slog.Warn("failed to run command", "command", cmd, "error", err)
-		return "", fmt.Errorf("failed to run command: %v", err)
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+
+	select {
+	case err := <-done:
+		result := CommandResult{Stdout: stdout.String(), Stderr: stderr.String(), Duration: time.Since(start)}
+		var exitErr *ssh.ExitError
+		var missingErr *ssh.ExitMissingError
+		switch {
+		case err == nil:
+			if result.Stderr != "" {
+				slog.Debug("command wrote to stderr", "command", logged, "stderr", result.Stderr)
+			}
+			return result, nil
+		case errors.As(err, &exitErr):
+			result.ExitCode = exitErr.ExitStatus()
+		case errors.As(err, &missingErr):
+			result.ExitCode = -1
+		default:
+			slog.Warn("failed to run command", "command", logged, "error", err)
+			return result, fmt.Errorf("failed to run command: %v", err)
+		}
+		remoteErr := &RemoteCommandError{Command: logged, Result: result}
+		slog.Warn("command failed", "command", logged, "exitCode", result.ExitCode, "error", remoteErr.Message())
+		return result, remoteErr
+	case <-ctx.Done():
+		// RouterOS may ignore the signal, closing the session stops the command anyway
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err := &CommandTimeoutError{Command: logged, Elapsed: time.Since(start)}
+			slog.Warn("command timed out", "command", logged, "error", err)
+			return CommandResult{Duration: time.Since(start)}, err
+		}
+		slog.Warn("command interrupted", "command", logged, "error", ctx.Err())
+		return CommandResult{Duration: time.Since(start)}, fmt.Errorf("command %q interrupted: %w", logged, ctx.Err())
+	}
+}
+
+// alive reports whether the connection still answers, a keepalive request is sent
+// unless the transport is already known to be gone
+func (c *sshConnection) alive() bool {
+	if c.client == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	replied := make(chan error, 1)
+	go func() {
+		// Servers reply to unknown global requests, a failure reply proves the connection works
+		_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+	select {
+	case err := <-replied:
+		return err == nil
+	case <-c.done:
+		return false
+	case <-time.After(keepaliveTimeout):
+		return false
 	}
-	return b.String(), nil
 }
 
 // newSsh creates a new SSH connection (internal function, use SshManager.CreateConnection instead)
@@ -87,53 +238,26 @@ func newSsh(ctx context.Context, host, username, password, passphrase string) (*
 		clientConfig: nil,
 	}
 
-	hostInfo := readSshConfig(host)
+	hostInfo := readSshConfig(host, username)
+	if cfg, err := GetConfig(ctx); err == nil {
+		applyInventoryOverrides(hostInfo, cfg.HostOverrides(host))
+	}
 	slog.Debug("SSH host configuration",
 		"original", hostInfo.Original,
 		"type", hostInfo.Type,
 		"hostname", hostInfo.Hostname,
 		"port", hostInfo.Port,
 		"user", hostInfo.User,
-		"identityFile", hostInfo.IdentityFile)
-
-	var sshSigner ssh.Signer
-	var authMethod []ssh.AuthMethod
-	// Try to load SSH key if passphrase is provided
-	if passphrase != "" {
-		slog.Debug("attempting to unlock private key with passphrase")
-		var err error
-		sshSigner, err = parseSshPrivateKey(hostInfo.IdentityFile, passphrase)
-		if err != nil {
-			slog.Warn("failed to parse SSH private key with provided passphrase", "error", err)
-			return nil, err
-		}
-		slog.Debug("successfully parsed SSH private key", "file", hostInfo.IdentityFile, "keyType", sshSigner.PublicKey().Type())
-	}
+		"identityFiles", hostInfo.IdentityFiles,
+		"proxyJump", hostInfo.ProxyJump,
+		"proxyCommand", hostInfo.ProxyCommand)
 
-	// Build authentication methods
-	if sshSigner != nil && password != "" {
-		slog.Debug("using both SSH key and password authentication")
-		// Both key and password available
-		authMethod = []ssh.AuthMethod{
-			ssh.PublicKeys(sshSigner),
-			ssh.Password(password),
-		}
-	} else if sshSigner != nil {
-		slog.Debug("using SSH key authentication")
-		// Only key available
-		authMethod = []ssh.AuthMethod{
-			ssh.PublicKeys(sshSigner),
-		}
-	} else if password != "" {
-		slog.Debug("using password authentication")
-		// Only password available
-		authMethod = []ssh.AuthMethod{
-			ssh.Password(password),
-		}
-	} else {
-		slog.Debug("no authentication method provided (need password or SSH key with passphrase)")
-		return nil, fmt.Errorf("no authentication method provided (need password or SSH key with passphrase)")
+	auth, err := buildSshAuth(hostInfo, password, passphrase)
+	if err != nil {
+		return nil, err
 	}
+	// Agent keys are only needed during the handshake
+	defer auth.Close()
 
 	// Determine which username to use: ssh_config takes precedence over command-line
 	finalUsername := username
@@ -148,7 +272,7 @@ func newSsh(ctx context.Context, host, username, password, passphrase string) (*
 	// Build ssh client config
 	config := &ssh.ClientConfig{
 		User: finalUsername,
-		Auth: authMethod,
+		Auth: auth.methods,
 		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			// Check if user wants to skip host key verification (INSECURE)
 			cfg, err := GetConfig(ctx)
@@ -208,85 +332,137 @@ func newSsh(ctx context.Context, host, username, password, passphrase string) (*
 		},
 		Timeout: 10 * time.Second,
 	}
+	// Legacy algorithms (RouterOS 6) are only enabled for hosts configured so in ssh_config
+	if err := applySshAlgorithms(config, hostInfo); err != nil {
+		slog.Error("invalid SSH algorithms configuration", "host", host, "error", err)
+		return nil, err
+	}
 	conn.clientConfig = config
 
 	// Establish the SSH connection
 	address := net.JoinHostPort(hostInfo.Hostname, hostInfo.Port)
 	slog.Debug("establishing SSH connection", "address", address)
-	client, err := ssh.Dial("tcp", address, config)
+	client, jumps, err := dialSsh(ctx, hostInfo, config, passphrase, 0)
 	if err != nil {
 		slog.Error("failed to dial", "address", address, "error", err)
 		return nil, fmt.Errorf("failed to dial %s: %v", address, err.Error())
 	}
 	conn.client = client
+	conn.jumps = jumps
+	conn.done = make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(conn.done)
+	}()
 
 	slog.Debug("SSH connection established")
 	return conn, nil
 }
 
-func readSshConfig(host string) *HostInfo {
+// readSshConfig returns the connection details of a host, enriched with ssh_config.
+// user is the remote user when ssh_config sets none (Match user and %r token).
+func readSshConfig(host, user string) *HostInfo {
 	// Step 1: Parse user input into HostInfo (the reference)
 	hostInfo := ParseHost(host)
+	alias := hostInfo.Hostname
 
-	// Step 2: Try to read from user's ssh_config for ALL host types (including IPs)
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		// Could not determine home directory - use defaults
-		return hostInfo
-	}
-	sshConfigFile, err := os.Open(filepath.Join(homeDir, ".ssh", "config"))
-	if err != nil {
-		slog.Debug("SSH config file doesn't exist or can't be read - using defaults")
-		return hostInfo
-	}
-	defer func() { _ = sshConfigFile.Close() }()
-
-	sshConfig, err := ssh_config.Decode(sshConfigFile)
-	if err != nil || sshConfig == nil {
-		slog.Debug("Failed to decode SSH config - using defaults")
-		return hostInfo
-	}
+	// Step 2: Evaluate user's and system ssh_config for ALL host types (including IPs)
+	values, identityFiles := resolveSshConfig(alias, user)
 
 	// Step 3: Merge ssh_config values into HostInfo (enrich, not override)
-	if hostname, _ := sshConfig.Get(host, "Hostname"); hostname != "" {
-		hostInfo.Hostname = strings.ReplaceAll(hostname, "%h", host)
+	if hostname := values["hostname"]; hostname != "" {
+		hostInfo.Hostname = expandSshTokens(hostname, map[byte]string{'h': alias})
 	}
 
-	if user, _ := sshConfig.Get(host, "User"); user != "" {
-		hostInfo.User = user
+	if configuredUser := values["user"]; configuredUser != "" {
+		hostInfo.User = configuredUser
 	}
 
-	if port, _ := sshConfig.Get(host, "Port"); port != "" && port != "0" {
-		hostInfo.Port = port
+	// A port given with the host wins over ssh_config, as on the ssh command line
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if port := values["port"]; port != "" && port != "0" {
+			hostInfo.Port = port
+		}
 	}
 
-	hostInfo.IdentityFile, _ = sshConfig.Get(host, "IdentityFile")
-	hostInfo.IdentitiesOnly, _ = sshConfig.Get(host, "IdentitiesOnly")
-	hostInfo.ForwardAgent, _ = sshConfig.Get(host, "ForwardAgent")
-	hostInfo.HostkeyAlgorithms, _ = sshConfig.Get(host, "HostkeyAlgorithms")
-	hostInfo.PubkeyAcceptedAlgorithms, _ = sshConfig.Get(host, "PubkeyAcceptedAlgorithms")
+	// IdentityFiles are tried in order, IdentityFile is the first one
+	tokens := hostInfo.sshTokens(user)
+	for _, file := range identityFiles {
+		hostInfo.IdentityFiles = append(hostInfo.IdentityFiles, expandSshTokens(file, tokens))
+	}
+	if len(hostInfo.IdentityFiles) > 0 {
+		hostInfo.IdentityFile = hostInfo.IdentityFiles[0]
+	}
+	hostInfo.IdentitiesOnly = values["identitiesonly"]
+	hostInfo.ForwardAgent = values["forwardagent"]
+	hostInfo.HostkeyAlgorithms = values["hostkeyalgorithms"]
+	hostInfo.PubkeyAcceptedAlgorithms = values["pubkeyacceptedalgorithms"]
+	hostInfo.Ciphers = values["ciphers"]
+	hostInfo.KexAlgorithms = values["kexalgorithms"]
+	hostInfo.MACs = values["macs"]
+	if proxyJump := values["proxyjump"]; !strings.EqualFold(proxyJump, "none") {
+		hostInfo.ProxyJump = proxyJump
+	}
+	if proxyCommand := values["proxycommand"]; !strings.EqualFold(proxyCommand, "none") {
+		hostInfo.ProxyCommand = proxyCommand
+	}
 
 	slog.Debug("ssh_config found",
 		"host", host,
 		"hostname", hostInfo.Hostname,
 		"port", hostInfo.Port,
 		"user", hostInfo.User,
-		"identityfile", hostInfo.IdentityFile)
+		"identityfiles", hostInfo.IdentityFiles,
+		"proxyjump", hostInfo.ProxyJump,
+		"proxycommand", hostInfo.ProxyCommand)
 	return hostInfo
 }
 
-func parseSshPrivateKey(identityFile, passphrase string) (ssh.Signer, error) {
-	// Get current user's detail
+// applyInventoryOverrides merges per-host inventory settings into HostInfo.
+// Inventory values take precedence over ssh_config ones.
+func applyInventoryOverrides(hostInfo *HostInfo, overrides InventoryHost) {
+	if overrides.Address != "" {
+		hostInfo.Hostname = overrides.Address
+	}
+	if overrides.Port != "" {
+		hostInfo.Port = overrides.Port
+	}
+	if overrides.User != "" {
+		hostInfo.User = overrides.User
+	}
+	if overrides.Name != "" {
+		slog.Debug("inventory overrides applied",
+			"host", hostInfo.Original,
+			"hostname", hostInfo.Hostname,
+			"port", hostInfo.Port,
+			"user", hostInfo.User)
+	}
+}
+
+// expandHome expands a leading ~/ with the current user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	return filepath.Join(homeDir(), path[2:])
+}
+
+// homeDir returns the home directory of the current user, from $HOME when set
+func homeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
 	user, err := user.Current()
 	if err != nil {
 		slog.Warn("unable to get current user", "error", err)
-		return nil, err
-	}
-	userHomeDir := user.HomeDir
-	// Expand ~/ IdentityFile with full user's home path
-	if strings.HasPrefix(identityFile, "~/") {
-		identityFile = filepath.Join(userHomeDir, identityFile[2:])
+		return ""
 	}
+	return user.HomeDir
+}
+
+// parseSshPrivateKey loads a private key, unencrypted when passphrase is empty
+func parseSshPrivateKey(identityFile, passphrase string) (ssh.Signer, error) {
+	identityFile = expandHome(identityFile)
 
 	// If Identity File found, parse private key and add ssh.PublicKeys(signer) to AuthMethod
 	// Parse private key and build ssh.signer
@@ -299,8 +475,18 @@ func parseSshPrivateKey(identityFile, passphrase string) (ssh.Signer, error) {
 	slog.Debug("SSH private key read successfully", "file", identityFile)
 
 	var signer ssh.Signer
-	slog.Debug("unlocking private key with provided passphrase")
-	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if passphrase == "" {
+		signer, err = ssh.ParsePrivateKey(key)
+	} else {
+		slog.Debug("unlocking private key with provided passphrase")
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+		if err != nil {
+			// The passphrase may be meant for another IdentityFile, try the key unencrypted
+			if unencrypted, plainErr := ssh.ParsePrivateKey(key); plainErr == nil {
+				signer, err = unencrypted, nil
+			}
+		}
+	}
 	if err != nil {
 		slog.Warn("unable to parse private key", "error", err)
 		return nil, err
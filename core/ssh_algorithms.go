@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// resolveAlgorithms applies an ssh_config algorithm list to the defaults, with the OpenSSH syntax:
+// "a,b" replaces the defaults, "+a,b" appends to them, "-a,b" removes from them (wildcards allowed)
+// and "^a,b" moves to their head. Legacy algorithms, disabled by default, can be enabled this way.
+// An empty spec returns nil, meaning the defaults of the SSH library.
+func resolveAlgorithms(spec string, defaults, known []string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	op := spec[0]
+	if strings.ContainsRune("+-^", rune(op)) {
+		spec = spec[1:]
+	} else {
+		op = 0
+	}
+	names := strings.Split(spec, ",")
+
+	if op == '-' {
+		return slices.DeleteFunc(slices.Clone(defaults), func(algo string) bool {
+			return slices.ContainsFunc(names, func(pattern string) bool {
+				matched, _ := path.Match(strings.TrimSpace(pattern), algo)
+				return matched
+			})
+		}), nil
+	}
+
+	var listed []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unsupported algorithm %q", name)
+		}
+		if !slices.Contains(listed, name) {
+			listed = append(listed, name)
+		}
+	}
+	rest := slices.DeleteFunc(slices.Clone(defaults), func(algo string) bool {
+		return slices.Contains(listed, algo)
+	})
+	switch op {
+	case '+':
+		return append(rest, listed...), nil
+	case '^':
+		return append(listed, rest...), nil
+	}
+	return listed, nil
+}
+
+// applySshAlgorithms sets the ciphers, key exchanges, MACs and host key algorithms
+// of the client configuration from ssh_config
+func applySshAlgorithms(config *ssh.ClientConfig, hostInfo *HostInfo) error {
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	settings := []struct {
+		option     string
+		spec       string
+		defaults   []string
+		insecure   []string
+		algorithms *[]string
+	}{
+		{"Ciphers", hostInfo.Ciphers, supported.Ciphers, insecure.Ciphers, &config.Ciphers},
+		{"KexAlgorithms", hostInfo.KexAlgorithms, supported.KeyExchanges, insecure.KeyExchanges, &config.KeyExchanges},
+		{"MACs", hostInfo.MACs, supported.MACs, insecure.MACs, &config.MACs},
+		{"HostkeyAlgorithms", hostInfo.HostkeyAlgorithms, supported.HostKeys, insecure.HostKeys, &config.HostKeyAlgorithms},
+	}
+	for _, s := range settings {
+		algorithms, err := resolveAlgorithms(s.spec, s.defaults, slices.Concat(s.defaults, s.insecure))
+		if err != nil {
+			return fmt.Errorf("invalid %s in ssh_config: %w", s.option, err)
+		}
+		if algorithms != nil {
+			slog.Debug("SSH algorithms from ssh_config", "option", s.option, "algorithms", algorithms)
+			*s.algorithms = algorithms
+		}
+	}
+	return nil
+}
+
+// restrictSigners limits the signature algorithms of the signers to the ssh_config
+// PubkeyAcceptedAlgorithms. Signers left without any accepted algorithm are dropped.
+func restrictSigners(signers []ssh.Signer, spec string) ([]ssh.Signer, error) {
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	accepted, err := resolveAlgorithms(spec, supported.PublicKeyAuths, slices.Concat(supported.PublicKeyAuths, insecure.PublicKeyAuths))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PubkeyAcceptedAlgorithms in ssh_config: %w", err)
+	}
+	if accepted == nil {
+		return signers, nil
+	}
+
+	var restricted []ssh.Signer
+	for _, signer := range signers {
+		algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+		if !ok {
+			restricted = append(restricted, signer)
+			continue
+		}
+		// Keep the accepted algorithms this key type can sign with
+		var usable []string
+		for _, algo := range accepted {
+			if _, err := ssh.NewSignerWithAlgorithms(algorithmSigner, []string{algo}); err == nil {
+				usable = append(usable, algo)
+			}
+		}
+		if len(usable) == 0 {
+			slog.Debug("SSH key skipped, no accepted algorithm", "keyType", signer.PublicKey().Type())
+			continue
+		}
+		multi, err := ssh.NewSignerWithAlgorithms(algorithmSigner, usable)
+		if err != nil {
+			return nil, err
+		}
+		restricted = append(restricted, multi)
+	}
+	return restricted, nil
+}
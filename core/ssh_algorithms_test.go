@@ -0,0 +1,136 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestResolveAlgorithms(t *testing.T) {
+	defaults := []string{"a", "b", "c"}
+	known := []string{"a", "b", "c", "legacy-1", "legacy-2"}
+
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "c,legacy-1", want: []string{"c", "legacy-1"}},
+		{spec: "+legacy-1,legacy-2", want: []string{"a", "b", "c", "legacy-1", "legacy-2"}},
+		{spec: "+a", want: []string{"b", "c", "a"}},
+		{spec: "^legacy-2,c", want: []string{"legacy-2", "c", "a", "b"}},
+		{spec: "-b", want: []string{"a", "c"}},
+		{spec: "-*", want: []string{}},
+		{spec: "a, b", want: []string{"a", "b"}},
+		{spec: "+unknown", wantErr: true},
+		{spec: "unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := resolveAlgorithms(tt.spec, defaults, known)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAlgorithms() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolveAlgorithms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplySshAlgorithms(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ssh_config", "legacy_config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+
+	// Modern routers keep the library defaults
+	config := &ssh.ClientConfig{}
+	if err := applySshAlgorithms(config, readSshConfig("new-router", "")); err != nil {
+		t.Fatalf("applySshAlgorithms() error = %v", err)
+	}
+	if config.Ciphers != nil || config.KeyExchanges != nil || config.MACs != nil || config.HostKeyAlgorithms != nil {
+		t.Errorf("applySshAlgorithms() changed defaults: %+v", config.Config)
+	}
+
+	config = &ssh.ClientConfig{}
+	hostInfo := readSshConfig("old-router", "")
+	if err := applySshAlgorithms(config, hostInfo); err != nil {
+		t.Fatalf("applySshAlgorithms() error = %v", err)
+	}
+	for option, want := range map[string]struct {
+		got  []string
+		algo string
+	}{
+		"KexAlgorithms":     {config.KeyExchanges, "diffie-hellman-group1-sha1"},
+		"Ciphers":           {config.Ciphers, "aes128-cbc"},
+		"HostkeyAlgorithms": {config.HostKeyAlgorithms, ssh.KeyAlgoRSA},
+	} {
+		if !slices.Contains(want.got, want.algo) {
+			t.Errorf("%s = %v, want it to contain %s", option, want.got, want.algo)
+		}
+	}
+	if !slices.Contains(config.KeyExchanges, ssh.KeyExchangeCurve25519) {
+		t.Errorf("KexAlgorithms = %v, should keep the defaults", config.KeyExchanges)
+	}
+	if !slices.Equal(config.MACs, []string{ssh.HMACSHA1}) {
+		t.Errorf("MACs = %v, want [%s]", config.MACs, ssh.HMACSHA1)
+	}
+
+	if err := applySshAlgorithms(&ssh.ClientConfig{}, &HostInfo{Ciphers: "+rot13"}); err == nil {
+		t.Error("applySshAlgorithms() with an unknown cipher should fail")
+	}
+}
+
+func TestRestrictSigners(t *testing.T) {
+	signer, err := parseSshPrivateKey(filepath.Join("testdata", "ssh_keys", "test_key"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spec     string
+		wantKeys int
+		wantAlgo []string
+	}{
+		{spec: "", wantKeys: 1},
+		{spec: "+ssh-rsa", wantKeys: 1, wantAlgo: []string{ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSA}},
+		{spec: "ssh-rsa", wantKeys: 1, wantAlgo: []string{ssh.KeyAlgoRSA}},
+		{spec: "ssh-ed25519", wantKeys: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := restrictSigners([]ssh.Signer{signer}, tt.spec)
+			if err != nil {
+				t.Fatalf("restrictSigners() error = %v", err)
+			}
+			if len(got) != tt.wantKeys {
+				t.Fatalf("restrictSigners() = %d keys, want %d", len(got), tt.wantKeys)
+			}
+			if tt.wantAlgo == nil {
+				return
+			}
+			multi, ok := got[0].(ssh.MultiAlgorithmSigner)
+			if !ok {
+				t.Fatal("restricted signer is not a MultiAlgorithmSigner")
+			}
+			if !slices.Equal(multi.Algorithms(), tt.wantAlgo) {
+				t.Errorf("Algorithms() = %v, want %v", multi.Algorithms(), tt.wantAlgo)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshAuth holds the authentication methods of a connection, and the SSH agent
+// connection its keys sign with until the handshake is done
+type sshAuth struct {
+	methods   []ssh.AuthMethod
+	signers   []ssh.Signer
+	agentConn net.Conn
+}
+
+// Close releases the SSH agent connection, once the SSH handshake is done
+func (a *sshAuth) Close() {
+	if a.agentConn != nil {
+		_ = a.agentConn.Close()
+	}
+}
+
+// buildSshAuth returns the authentication methods, tried in this order:
+//  1. public keys: the SSH agent keys (SSH_AUTH_SOCK), then the IdentityFile keys in order
+//  2. password
+//
+// With "IdentitiesOnly yes", only the IdentityFile keys are used, from the agent or from the files.
+// Key signature algorithms are limited to PubkeyAcceptedAlgorithms.
+func buildSshAuth(hostInfo *HostInfo, password, passphrase string) (*sshAuth, error) {
+	auth := &sshAuth{}
+	identitiesOnly := strings.EqualFold(hostInfo.IdentitiesOnly, "yes")
+
+	fileSigners, err := loadIdentityFiles(hostInfo, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	agentSigners, agentConn := sshAgentSigners()
+	auth.agentConn = agentConn
+	if identitiesOnly {
+		var identities []ssh.Signer
+		for i, file := range hostInfo.identityFiles() {
+			identities = append(identities, filterSigners(agentSigners, identityPublicKey(file, fileSigners[i]))...)
+		}
+		agentSigners = identities
+		slog.Debug("IdentitiesOnly set, agent keys limited to IdentityFiles", "files", hostInfo.identityFiles(), "keys", len(agentSigners))
+	}
+	auth.signers = append(auth.signers, agentSigners...)
+	for _, fileSigner := range fileSigners {
+		if fileSigner != nil && len(filterSigners(auth.signers, fileSigner.PublicKey())) == 0 {
+			auth.signers = append(auth.signers, fileSigner)
+		}
+	}
+	if auth.signers, err = restrictSigners(auth.signers, hostInfo.PubkeyAcceptedAlgorithms); err != nil {
+		auth.Close()
+		return nil, err
+	}
+
+	if len(auth.signers) > 0 {
+		// A single method for all keys: the SSH client tries each method only once
+		slog.Debug("using SSH key authentication", "keys", len(auth.signers), "agent", len(agentSigners))
+		auth.methods = append(auth.methods, ssh.PublicKeys(auth.signers...))
+	}
+	if password != "" {
+		slog.Debug("using password authentication")
+		auth.methods = append(auth.methods, ssh.Password(password))
+	}
+	if len(auth.methods) == 0 {
+		auth.Close()
+		slog.Debug("no authentication method provided (need password, SSH key or SSH agent)")
+		return nil, fmt.Errorf("no authentication method provided (need password, SSH key or SSH agent)")
+	}
+	return auth, nil
+}
+
+// loadIdentityFiles loads the IdentityFile keys, unencrypted or with the passphrase.
+// The returned slice has one entry per IdentityFile, nil for keys that can't be loaded.
+// Unusable keys are skipped, unless a passphrase was given and no key could be loaded with it.
+func loadIdentityFiles(hostInfo *HostInfo, passphrase string) ([]ssh.Signer, error) {
+	files := hostInfo.identityFiles()
+	if len(files) == 0 && passphrase != "" {
+		// A passphrase without key is a configuration error
+		files = []string{""}
+	}
+	signers := make([]ssh.Signer, len(files))
+	var firstErr error
+	loaded := 0
+	for i, file := range files {
+		signer, err := parseSshPrivateKey(file, passphrase)
+		if err != nil {
+			slog.Debug("SSH private key not usable", "file", file, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		signers[i] = signer
+		loaded++
+	}
+	if loaded == 0 && passphrase != "" && firstErr != nil {
+		slog.Warn("failed to parse SSH private key with provided passphrase", "error", firstErr)
+		return nil, firstErr
+	}
+	return signers, nil
+}
+
+// sshAgentSigners returns the keys held by the SSH agent and the agent connection,
+// or nothing when no agent is available
+func sshAgentSigners() ([]ssh.Signer, net.Conn) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		slog.Debug("SSH agent not reachable", "socket", socket, "error", err)
+		return nil, nil
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		slog.Debug("failed to list SSH agent keys", "socket", socket, "error", err)
+		_ = conn.Close()
+		return nil, nil
+	}
+	slog.Debug("SSH agent keys found", "socket", socket, "keys", len(signers))
+	return signers, conn
+}
+
+// identityPublicKey returns the public key of the IdentityFile: from its loaded signer,
+// or from the ".pub" file next to it (encrypted keys kept in the agent)
+func identityPublicKey(identityFile string, signer ssh.Signer) ssh.PublicKey {
+	if signer != nil {
+		return signer.PublicKey()
+	}
+	if identityFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(expandHome(identityFile) + ".pub")
+	if err != nil {
+		slog.Debug("IdentityFile public key not readable", "file", identityFile, "error", err)
+		return nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		slog.Debug("invalid IdentityFile public key", "file", identityFile, "error", err)
+		return nil
+	}
+	return key
+}
+
+// filterSigners returns the signers of the given public key
+func filterSigners(signers []ssh.Signer, key ssh.PublicKey) []ssh.Signer {
+	if key == nil {
+		return nil
+	}
+	var matching []ssh.Signer
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), key.Marshal()) {
+			matching = append(matching, signer)
+		}
+	}
+	return matching
+}
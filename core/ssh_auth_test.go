@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startTestAgent serves an in-memory SSH agent holding the given keys on SSH_AUTH_SOCK
+func startTestAgent(t *testing.T, keys ...any) {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
+
+func TestBuildSshAuth(t *testing.T) {
+	testdataDir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKey := filepath.Join(testdataDir, "ssh_keys", "test_key")
+	encryptedKey := filepath.Join(testdataDir, "ssh_keys", "encrypted_key")
+
+	fileSigner, err := parseSshPrivateKey(testKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedSigner, err := parseSshPrivateKey(encryptedKey, "testpassphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, agentOnlyKey, _ := ed25519.GenerateKey(rand.Reader)
+	agentOnlySigner, _ := ssh.NewSignerFromKey(agentOnlyKey)
+	encryptedRaw, err := os.ReadFile(encryptedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPrivate, err := ssh.ParseRawPrivateKeyWithPassphrase(encryptedRaw, []byte("testpassphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		agentKeys      []any
+		identityFile   string
+		identitiesOnly string
+		password       string
+		passphrase     string
+		wantSigners    []ssh.Signer
+		wantMethods    int
+		wantErr        bool
+	}{
+		{
+			name:         "unencrypted identity file",
+			identityFile: testKey,
+			wantSigners:  []ssh.Signer{fileSigner},
+			wantMethods:  1,
+		},
+		{
+			name:         "agent keys before identity file, then password",
+			agentKeys:    []any{agentOnlyKey},
+			identityFile: testKey,
+			password:     "secret",
+			wantSigners:  []ssh.Signer{agentOnlySigner, fileSigner},
+			wantMethods:  2,
+		},
+		{
+			name:         "encrypted identity file without passphrase is skipped",
+			agentKeys:    []any{agentOnlyKey},
+			identityFile: encryptedKey,
+			wantSigners:  []ssh.Signer{agentOnlySigner},
+			wantMethods:  1,
+		},
+		{
+			name:         "encrypted identity file with passphrase",
+			identityFile: encryptedKey,
+			passphrase:   "testpassphrase",
+			wantSigners:  []ssh.Signer{encryptedSigner},
+			wantMethods:  1,
+		},
+		{
+			name:           "IdentitiesOnly keeps the agent copy of the identity file key",
+			agentKeys:      []any{agentOnlyKey, encryptedPrivate},
+			identityFile:   encryptedKey,
+			identitiesOnly: "yes",
+			wantSigners:    []ssh.Signer{encryptedSigner},
+			wantMethods:    1,
+		},
+		{
+			name:           "IdentitiesOnly without identity file ignores the agent",
+			agentKeys:      []any{agentOnlyKey},
+			identitiesOnly: "yes",
+			wantErr:        true,
+		},
+		{
+			name:         "wrong passphrase is an error",
+			identityFile: encryptedKey,
+			passphrase:   "wrongpassphrase",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SSH_AUTH_SOCK", "")
+			if tt.agentKeys != nil {
+				startTestAgent(t, tt.agentKeys...)
+			}
+			hostInfo := &HostInfo{IdentityFile: tt.identityFile, IdentitiesOnly: tt.identitiesOnly}
+
+			auth, err := buildSshAuth(hostInfo, tt.password, tt.passphrase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildSshAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer auth.Close()
+
+			if len(auth.methods) != tt.wantMethods {
+				t.Errorf("buildSshAuth() methods = %d, want %d", len(auth.methods), tt.wantMethods)
+			}
+			if len(auth.signers) != len(tt.wantSigners) {
+				t.Fatalf("buildSshAuth() signers = %d, want %d", len(auth.signers), len(tt.wantSigners))
+			}
+			for i, want := range tt.wantSigners {
+				if !bytes.Equal(auth.signers[i].PublicKey().Marshal(), want.PublicKey().Marshal()) {
+					t.Errorf("signer %d = %s, want %s", i, ssh.FingerprintSHA256(auth.signers[i].PublicKey()), ssh.FingerprintSHA256(want.PublicKey()))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// userSshConfig and systemSshConfig are the ssh_config files read in order,
+// the first value found for an option wins. Overridden in tests.
+var (
+	userSshConfig   = "~/.ssh/config"
+	systemSshConfig = "/etc/ssh/ssh_config"
+)
+
+// maxIncludeDepth limits nested Include directives, as OpenSSH does
+const maxIncludeDepth = 16
+
+// sshConfigResolver evaluates ssh_config files for a host with OpenSSH semantics:
+// Host and Match blocks, Include directives, first obtained value wins except for
+// IdentityFile which accumulates
+type sshConfigResolver struct {
+	alias         string
+	user          string
+	values        map[string]string
+	identityFiles []string
+}
+
+// resolveSshConfig returns the ssh_config options of a host alias, keyed by lowercase option name,
+// and the IdentityFiles in order. user is the remote user when ssh_config sets none.
+func resolveSshConfig(alias, user string) (map[string]string, []string) {
+	r := &sshConfigResolver{alias: alias, user: user, values: map[string]string{}}
+	for _, file := range []string{expandHome(userSshConfig), systemSshConfig} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Debug("ssh_config file doesn't exist or can't be read", "file", file)
+			continue
+		}
+		if err := r.parse(data, file == systemSshConfig, 0); err != nil {
+			slog.Warn("failed to read ssh_config, ignoring the rest of the file", "file", file, "error", err)
+		}
+	}
+	return r.values, r.identityFiles
+}
+
+// parse applies the options of a ssh_config file content
+func (r *sshConfigResolver) parse(data []byte, system bool, depth int) error {
+	active := true
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		keyword, rest := splitSshConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+		args, err := splitSshConfigArgs(rest)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("line %d: missing argument for %s", lineNumber, keyword)
+		}
+
+		switch keyword {
+		case "host":
+			active = matchHostPatterns(args, r.alias)
+		case "match":
+			if active, err = r.match(args); err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		case "include":
+			if active {
+				if err := r.include(args, system, depth); err != nil {
+					return fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+			}
+		case "identityfile":
+			if active && !strings.EqualFold(args[0], "none") {
+				r.identityFiles = append(r.identityFiles, args[0])
+			}
+		default:
+			if _, found := r.values[keyword]; active && !found {
+				// Commands are kept whole, other options take their first argument
+				if keyword == "proxycommand" || keyword == "localcommand" {
+					r.values[keyword] = rest
+				} else {
+					r.values[keyword] = args[0]
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// include reads the files matching the Include globs, relative to ~/.ssh or /etc/ssh
+func (r *sshConfigResolver) include(globs []string, system bool, depth int) error {
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("too many nested Include directives")
+	}
+	for _, glob := range globs {
+		glob = expandHome(glob)
+		if !filepath.IsAbs(glob) {
+			base := filepath.Dir(expandHome(userSshConfig))
+			if system {
+				base = filepath.Dir(systemSshConfig)
+			}
+			glob = filepath.Join(base, glob)
+		}
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return fmt.Errorf("invalid Include %q: %w", glob, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			slog.Debug("ssh_config Include", "file", file)
+			if err := r.parse(data, system, depth+1); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// match evaluates the criteria of a Match block, all of them must match
+func (r *sshConfigResolver) match(args []string) (bool, error) {
+	matched := true
+	for i := 0; i < len(args); i++ {
+		criterion, negate := strings.CutPrefix(strings.ToLower(args[i]), "!")
+		var result bool
+		switch criterion {
+		case "all":
+			result = true
+		case "canonical", "final":
+			// Hostnames are not canonicalized, the configuration is read once as the final pass
+			result = true
+		case "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(args) {
+				return false, fmt.Errorf("missing argument for Match %s", criterion)
+			}
+			i++
+			result = r.matchCriterion(criterion, args[i])
+		default:
+			return false, fmt.Errorf("unsupported Match criterion %q", criterion)
+		}
+		if result == negate {
+			matched = false
+		}
+	}
+	return matched, nil
+}
+
+// matchCriterion evaluates a Match criterion taking an argument
+func (r *sshConfigResolver) matchCriterion(criterion, arg string) bool {
+	switch criterion {
+	case "host":
+		hostname := r.alias
+		if configured, ok := r.values["hostname"]; ok {
+			hostname = expandSshTokens(configured, map[byte]string{'h': r.alias})
+		}
+		return matchPatternList(arg, hostname)
+	case "originalhost":
+		return matchPatternList(arg, r.alias)
+	case "user":
+		remoteUser := r.user
+		if configured, ok := r.values["user"]; ok {
+			remoteUser = configured
+		}
+		return matchPatternList(arg, remoteUser)
+	case "localuser":
+		return matchPatternList(arg, localUsername())
+	case "exec":
+		command := expandSshTokens(arg, map[byte]string{'h': r.alias, 'n': r.alias, 'r': r.user, 'u': localUsername()})
+		err := exec.Command("/bin/sh", "-c", command).Run()
+		slog.Debug("ssh_config Match exec", "command", command, "matched", err == nil)
+		return err == nil
+	}
+	return false
+}
+
+// splitSshConfigLine returns the lowercase keyword of a line and its raw arguments
+func splitSshConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), ""
+	}
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+	return strings.ToLower(line[:end]), rest
+}
+
+// splitSshConfigArgs splits arguments on whitespace, double quotes group words
+func splitSshConfigArgs(rest string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inQuotes, inArg := false, false
+	for _, c := range rest {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inArg = true
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// matchHostPatterns reports whether the host matches Host patterns:
+// at least one pattern matches and no negated pattern does
+func matchHostPatterns(patterns []string, host string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if wildcardMatch(negated, host) {
+				return false
+			}
+		} else if wildcardMatch(pattern, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPatternList matches a comma separated pattern list, as used by Match criteria
+func matchPatternList(list, value string) bool {
+	return matchHostPatterns(strings.Split(list, ","), value)
+}
+
+// wildcardMatch matches ssh_config patterns: * matches any sequence, ? any character,
+// case insensitively
+func wildcardMatch(pattern, value string) bool {
+	pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(value); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if value == "" {
+				return false
+			}
+		default:
+			if value == "" || pattern[0] != value[0] {
+				return false
+			}
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return value == ""
+}
+
+// expandSshTokens replaces ssh_config %x tokens with their values, %% being a literal %.
+// Unknown tokens are kept as-is.
+func expandSshTokens(s string, tokens map[byte]string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if s[i] == '%' {
+			b.WriteByte('%')
+		} else if value, ok := tokens[s[i]]; ok {
+			b.WriteString(value)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// localUsername returns the name of the current user
+func localUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// useSshConfigFixture installs a ssh_config fixture directory as ~/.ssh of a temporary home,
+// and its system_config file as the system ssh_config
+func useSshConfigFixture(t *testing.T, fixture string) string {
+	t.Helper()
+	home := t.TempDir()
+	if err := os.CopyFS(filepath.Join(home, ".ssh"), os.DirFS(filepath.Join("testdata", "ssh_config", fixture))); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+	originalSystem := systemSshConfig
+	t.Cleanup(func() { systemSshConfig = originalSystem })
+	systemSshConfig = filepath.Join(home, ".ssh", "system_config")
+	return home
+}
+
+func TestReadSshConfig_OpenSSHSemantics(t *testing.T) {
+	useSshConfigFixture(t, "openssh")
+
+	tests := []struct {
+		host              string
+		user              string
+		wantHostname      string
+		wantPort          string
+		wantUser          string
+		wantIdentityFiles []string
+		wantProxyJump     string
+		wantProxyCommand  string
+	}{
+		{
+			host:              "site-paris",
+			user:              "admin",
+			wantHostname:      "site-paris.routers.example.com",
+			wantPort:          "2222",
+			wantUser:          "system-user",
+			wantIdentityFiles: []string{"~/.ssh/system-user@site-paris.routers.example.com", "~/.ssh/id_ed25519"},
+			wantProxyJump:     "bastion-paris",
+		},
+		{
+			host:              "site-lyon",
+			user:              "operator",
+			wantHostname:      "site-lyon",
+			wantPort:          "2222",
+			wantUser:          "system-user",
+			wantIdentityFiles: []string{"~/.ssh/operator_key", "~/.ssh/system-user@site-lyon", "~/.ssh/id_ed25519"},
+			wantProxyJump:     "bastion.example.com",
+		},
+		{
+			host:              "legacy:2200",
+			user:              "admin",
+			wantHostname:      "legacy",
+			wantPort:          "2200",
+			wantUser:          "system-user",
+			wantIdentityFiles: []string{"~/.ssh/id_ed25519"},
+			wantProxyCommand:  "ssh -W %h:%p gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			info := readSshConfig(tt.host, tt.user)
+			if info.Hostname != tt.wantHostname {
+				t.Errorf("Hostname = %q, want %q", info.Hostname, tt.wantHostname)
+			}
+			if info.Port != tt.wantPort {
+				t.Errorf("Port = %q, want %q", info.Port, tt.wantPort)
+			}
+			if info.User != tt.wantUser {
+				t.Errorf("User = %q, want %q", info.User, tt.wantUser)
+			}
+			if !slices.Equal(info.IdentityFiles, tt.wantIdentityFiles) {
+				t.Errorf("IdentityFiles = %v, want %v", info.IdentityFiles, tt.wantIdentityFiles)
+			}
+			if info.IdentityFile != tt.wantIdentityFiles[0] {
+				t.Errorf("IdentityFile = %q, want %q", info.IdentityFile, tt.wantIdentityFiles[0])
+			}
+			if info.ProxyJump != tt.wantProxyJump {
+				t.Errorf("ProxyJump = %q, want %q", info.ProxyJump, tt.wantProxyJump)
+			}
+			if info.ProxyCommand != tt.wantProxyCommand {
+				t.Errorf("ProxyCommand = %q, want %q", info.ProxyCommand, tt.wantProxyCommand)
+			}
+			if info.IdentitiesOnly != "yes" {
+				t.Errorf("IdentitiesOnly = %q, want yes from the system ssh_config", info.IdentitiesOnly)
+			}
+		})
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"router*", "router1", true},
+		{"router*", "Router1", true},
+		{"router?", "router12", false},
+		{"*.example.com", "r1.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"10.0.0.*", "10.0.0.254", true},
+		{"*", "", true},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+
+	if !matchHostPatterns([]string{"site-*", "!site-lyon"}, "site-paris") || matchHostPatterns([]string{"site-*", "!site-lyon"}, "site-lyon") {
+		t.Error("matchHostPatterns() should honor negated patterns")
+	}
+}
+
+func TestExpandSshTokens(t *testing.T) {
+	tokens := map[byte]string{'h': "10.0.0.1", 'p': "22", 'r': "admin", 'n': "router1"}
+	got := expandSshTokens("%r@%h:%p (%n) 100%% %x", tokens)
+	if want := "admin@10.0.0.1:22 (router1) 100% %x"; got != want {
+		t.Errorf("expandSshTokens() = %q, want %q", got, want)
+	}
+}
+
+func TestSshConfigParseErrors(t *testing.T) {
+	for _, config := range []string{
+		"Match localnetwork 10.0.0.0/8\n  User x\n",
+		"Host router1\n  ProxyCommand \"unterminated\n",
+		"Host\n",
+	} {
+		r := &sshConfigResolver{alias: "router1", values: map[string]string{}}
+		if err := r.parse([]byte(config), false, 0); err == nil {
+			t.Errorf("parse(%q) should fail", config)
+		}
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 )
 
 // SshManager encapsulates SSH credentials and provides SSH connections
-// without exposing credentials to callers
+// without exposing credentials to callers.
+// Connections are pooled per host for the whole run, so that the steps of a command
+// share one SSH handshake per host. Close releases them at exit.
 type SshManager struct {
 	user       string
 	password   string
 	passphrase string
+
+	mu   sync.Mutex
+	pool map[string]*pooledConnection
 }
 
 // NewSshManager creates a new SSH manager with the provided credentials
@@ -21,11 +27,14 @@ func NewSshManager(user, password, passphrase string) *SshManager {
 		user:       user,
 		password:   password,
 		passphrase: passphrase,
+		pool:       map[string]*pooledConnection{},
 	}
 }
 
-// CreateConnection retrieves the SshManager from context and creates a new SSH connection
+// CreateConnection retrieves the SshManager from context and returns an SSH connection
 // to the specified host (automatically appending :22 port if not present).
+// The connection is shared with the other callers for the same host: closing it only
+// releases it, and a connection lost meanwhile (router reboot) is dialed again.
 // This is the standard way to create SSH connections in subcommands.
 func CreateConnection(ctx context.Context, host string) (SshRunner, error) {
 	manager, err := GetSshManager(ctx)
@@ -33,15 +42,74 @@ func CreateConnection(ctx context.Context, host string) (SshRunner, error) {
 		return nil, fmt.Errorf("failed to get SSH manager from context: %w", err)
 	}
 
-	// Call the internal newSsh function with context
-	slog.Debug("creating SSH connection", "host", host, "user", manager.user)
-	conn, err := newSsh(ctx, host, manager.user, manager.password, manager.passphrase)
-	if err != nil {
-		slog.Error("failed to create SSH connection", "host", host, "error", err)
+	transport := TransportSSH
+	if cfg, err := GetConfig(ctx); err == nil {
+		transport = cfg.HostTransport(host)
+	}
+	pooled := manager.pooled(ctx, host, transport)
+	if _, err := pooled.get(true); err != nil {
+		slog.Error("failed to create connection", "host", host, "transport", transport, "error", err)
+		switch transport {
+		case TransportREST:
+			return nil, fmt.Errorf("failed to create RouterOS REST connection to %s: %w", host, err)
+		case TransportAPI, TransportAPISSL:
+			return nil, fmt.Errorf("failed to create RouterOS API connection to %s: %w", host, err)
+		}
 		return nil, fmt.Errorf("failed to create SSH connection to %s: %w", host, err)
 	}
+	shared := &sharedConnection{pooled: pooled}
+	switch transport {
+	case TransportREST:
+		return &sharedRESTConnection{shared}, nil
+	case TransportAPI, TransportAPISSL:
+		return &sharedAPIConnection{shared}, nil
+	}
+	return &sharedSshConnection{shared}, nil
+}
 
-	return conn, nil
+// ResetConnection closes the pooled connection to a host, when it is known to go away
+// (reboot command), so that the next CreateConnection dials again.
+// It does nothing without SshManager in context.
+func ResetConnection(ctx context.Context, host string) {
+	manager, err := GetSshManager(ctx)
+	if err != nil || manager == nil {
+		return
+	}
+	manager.mu.Lock()
+	pooled, ok := manager.pool[host]
+	manager.mu.Unlock()
+	if ok {
+		pooled.reset()
+	}
+}
+
+// pooled returns the pool entry of a host, created on first use with the given transport
+// and dialing with ctx, without its cancellation
+func (m *SshManager) pooled(ctx context.Context, host, transport string) *pooledConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pool == nil {
+		m.pool = map[string]*pooledConnection{}
+	}
+	pooled, ok := m.pool[host]
+	if !ok {
+		pooled = &pooledConnection{host: host, transport: transport, manager: m, ctx: context.WithoutCancel(ctx)}
+		m.pool[host] = pooled
+	}
+	return pooled
+}
+
+// Close closes all the pooled connections, connections handed out before fail afterwards
+// until they are created again
+func (m *SshManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for host, pooled := range m.pool {
+		slog.Debug("closing pooled SSH connection", "host", host)
+		pooled.close()
+	}
+	m.pool = map[string]*pooledConnection{}
+	return nil
 }
 
 // GetUser returns the username (non-sensitive information)
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// keepaliveTimeout bounds the check of a pooled connection before handing it out
+var keepaliveTimeout = 5 * time.Second
+
+// pooledTransport is a connection to a router over SSH, the RouterOS API or the REST API
+type pooledTransport interface {
+	Exec(ctx context.Context, cmd string) (CommandResult, error)
+	Close() error
+	connected(check bool) bool
+}
+
+// pooledConnection holds the connection of a host shared by all the steps of a run
+type pooledConnection struct {
+	host      string
+	transport string
+	manager   *SshManager
+
+	// ctx dials the connection: the context of the first caller without its cancellation,
+	// since callers' contexts end with their step while the connection is dialed again later
+	ctx context.Context
+
+	mu     sync.Mutex
+	conn   pooledTransport
+	closed bool
+}
+
+// get returns the connection of the host, dialing it when missing or lost.
+// check sends a keepalive first, to detect connections lost without notice.
+func (p *pooledConnection) get(check bool) (pooledTransport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		if p.conn.connected(check) {
+			slog.Debug("reusing connection", "host", p.host)
+			return p.conn, nil
+		}
+		slog.Debug("connection lost, connecting again", "host", p.host)
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+	if p.closed {
+		return nil, fmt.Errorf("SSH connection to %s closed", p.host)
+	}
+
+	m := p.manager
+	slog.Debug("creating connection", "host", p.host, "transport", p.transport, "user", m.user)
+	if p.transport == TransportREST {
+		conn, err := dialREST(p.ctx, p.host, m.user, m.password)
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+		return conn, nil
+	}
+	if p.transport == TransportAPI || p.transport == TransportAPISSL {
+		conn, err := dialAPI(p.ctx, p.host, m.user, m.password, p.transport)
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+		return conn, nil
+	}
+	conn, err := newSsh(p.ctx, p.host, m.user, m.password, m.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+// reset closes the connection, the next get dials again
+func (p *pooledConnection) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+// close closes the connection for good, shared connections fail afterwards
+func (p *pooledConnection) close() {
+	p.reset()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+}
+
+// connected reports whether the connection can still be used, with a keepalive when check is set
+func (c *sshConnection) connected(check bool) bool {
+	if check {
+		return c.alive()
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+		return c.client != nil
+	}
+}
+
+// sharedConnection is the SshRunner handed out by CreateConnection over a pooled connection
+type sharedConnection struct {
+	pooled *pooledConnection
+	mu     sync.Mutex
+	closed bool
+}
+
+// sharedSshConnection is a shared SSH connection, able to transfer files
+type sharedSshConnection struct {
+	*sharedConnection
+}
+
+// sharedAPIConnection is a shared RouterOS API connection, returning structured replies
+type sharedAPIConnection struct {
+	*sharedConnection
+}
+
+// sharedRESTConnection is a shared REST API connection, exchanging JSON objects
+type sharedRESTConnection struct {
+	*sharedConnection
+}
+
+// Run runs the command on the pooled connection, without deadline
+func (s *sharedConnection) Run(cmd string) (string, error) {
+	return s.RunContext(context.Background(), cmd)
+}
+
+// RunContext runs the command on the pooled connection and returns its standard output
+func (s *sharedConnection) RunContext(ctx context.Context, cmd string) (string, error) {
+	result, err := s.Exec(ctx, cmd)
+	return result.Stdout, err
+}
+
+// Exec runs the command on the pooled connection. When the connection was lost
+// before the command could be sent, it is dialed again and the command retried once.
+func (s *sharedConnection) Exec(ctx context.Context, cmd string) (CommandResult, error) {
+	conn, err := s.connection()
+	if err != nil {
+		return CommandResult{}, err
+	}
+	result, err := conn.Exec(ctx, cmd)
+	if !errors.Is(err, errSession) {
+		return result, err
+	}
+	if conn, err = s.reconnect(); err != nil {
+		return CommandResult{}, err
+	}
+	return conn.Exec(ctx, cmd)
+}
+
+// Call runs an API command on the pooled connection, retried once like Exec
+func (s *sharedAPIConnection) Call(ctx context.Context, command string, args ...string) ([]map[string]string, error) {
+	conn, err := s.connection()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := conn.(*apiConnection).Call(ctx, command, args...)
+	if !errors.Is(err, errSession) {
+		return replies, err
+	}
+	if conn, err = s.reconnect(); err != nil {
+		return nil, err
+	}
+	return conn.(*apiConnection).Call(ctx, command, args...)
+}
+
+// Get reads a REST menu on the pooled connection
+func (s *sharedRESTConnection) Get(ctx context.Context, path string, out any) error {
+	conn, err := s.connection()
+	if err != nil {
+		return err
+	}
+	return conn.(*restConnection).Get(ctx, path, out)
+}
+
+// Post runs a REST command on the pooled connection
+func (s *sharedRESTConnection) Post(ctx context.Context, path string, body, out any) error {
+	conn, err := s.connection()
+	if err != nil {
+		return err
+	}
+	return conn.(*restConnection).Post(ctx, path, body, out)
+}
+
+// Upload copies a local file to the router over SFTP, on the pooled connection
+func (s *sharedSshConnection) Upload(ctx context.Context, localPath, remotePath string) error {
+	conn, err := s.connection()
+	if err != nil {
+		return err
+	}
+	return conn.(*sshConnection).Upload(ctx, localPath, remotePath)
+}
+
+// Download copies a file stored on the router to a local file over SFTP, on the pooled connection
+func (s *sharedSshConnection) Download(ctx context.Context, remotePath, localPath string) error {
+	conn, err := s.connection()
+	if err != nil {
+		return err
+	}
+	return conn.(*sshConnection).Download(ctx, remotePath, localPath)
+}
+
+// Checksum returns the size and SHA-256 checksum of a file stored on the router
+func (s *sharedSshConnection) Checksum(ctx context.Context, remotePath string) (int64, string, error) {
+	conn, err := s.connection()
+	if err != nil {
+		return 0, "", err
+	}
+	return conn.(*sshConnection).Checksum(ctx, remotePath)
+}
+
+// reconnect dials the pooled connection again, after it was lost before a command was sent
+func (s *sharedConnection) reconnect() (pooledTransport, error) {
+	slog.Debug("connection lost before running command, connecting again", "host", s.pooled.host)
+	s.pooled.reset()
+	conn, err := s.pooled.get(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconnect to %s: %w", s.pooled.host, err)
+	}
+	return conn, nil
+}
+
+// connection returns the pooled connection, dialed again if it was lost
+func (s *sharedConnection) connection() (pooledTransport, error) {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("SSH connection already closed")
+	}
+	conn, err := s.pooled.get(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconnect to %s: %w", s.pooled.host, err)
+	}
+	return conn, nil
+}
+
+// Close releases the connection, which stays open in the pool for the next steps
+func (s *sharedConnection) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// IsAlreadyClosedError checks if the error is due to closing an already closed connection
+func (s *sharedConnection) IsAlreadyClosedError(err error) bool {
+	return isAlreadyClosedError(err)
+}
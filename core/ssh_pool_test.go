@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startPoolTestRouter starts a router accepting admin/secret and counting handshakes,
+// with enrollment mode capturing its host key
+func startPoolTestRouter(t *testing.T) (context.Context, string, *atomic.Int32) {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	originalSystem := systemSshConfig
+	t.Cleanup(func() { systemSshConfig = originalSystem })
+	systemSshConfig = filepath.Join(t.TempDir(), "none")
+
+	var handshakes atomic.Int32
+	router := startTestSshServer(t, &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "admin" && string(password) == "secret" {
+				handshakes.Add(1)
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+	}, "router output")
+
+	ctx := context.WithValue(context.Background(), ConfigKey, &Config{})
+	ctx = context.WithValue(ctx, EnrollmentModeKey, true)
+	ctx = context.WithValue(ctx, SshManagerKey, NewSshManager("admin", "secret", ""))
+	return ctx, router.Address, &handshakes
+}
+
+func TestCreateConnection_Pooled(t *testing.T) {
+	ctx, host, handshakes := startPoolTestRouter(t)
+	manager, _ := GetSshManager(ctx)
+
+	first, err := CreateConnection(ctx, host)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	second, err := CreateConnection(ctx, host)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	for _, conn := range []SshRunner{first, second} {
+		if output, err := conn.Run("/system identity print"); err != nil || output != "router output" {
+			t.Fatalf("Run() = %q, %v, want router output", output, err)
+		}
+	}
+	if handshakes.Load() != 1 {
+		t.Errorf("handshakes = %d, want 1 shared connection", handshakes.Load())
+	}
+	if _, ok := first.(FileTransferer); !ok {
+		t.Error("shared connection doesn't support SFTP transfers")
+	}
+
+	// Closing a shared connection only releases it
+	_ = first.Close()
+	if _, err := first.Run("/system identity print"); err == nil || !first.IsAlreadyClosedError(err) {
+		t.Errorf("Run() after Close() error = %v, want an already closed error", err)
+	}
+	if _, err := second.Run("/system identity print"); err != nil {
+		t.Errorf("Run() on the other connection error = %v", err)
+	}
+
+	// A connection lost (router reboot) is dialed again transparently
+	_ = manager.pool[host].conn.(*sshConnection).client.Close()
+	if output, err := second.Run("/system identity print"); err != nil || output != "router output" {
+		t.Fatalf("Run() after connection loss = %q, %v, want router output", output, err)
+	}
+	if handshakes.Load() != 2 {
+		t.Errorf("handshakes = %d, want 2 after reconnect", handshakes.Load())
+	}
+
+	// Reset forces the next CreateConnection to dial again
+	ResetConnection(ctx, host)
+	third, err := CreateConnection(ctx, host)
+	if err != nil {
+		t.Fatalf("CreateConnection() after reset error = %v", err)
+	}
+	if handshakes.Load() != 3 {
+		t.Errorf("handshakes = %d, want 3 after reset", handshakes.Load())
+	}
+
+	// Closing the manager closes everything for good
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := third.Run("/system identity print"); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("Run() after manager Close() error = %v, want a closed error", err)
+	}
+}
+
+func TestResetConnection_NoManager(t *testing.T) {
+	// Does nothing without SSH manager, as in subcommand tests
+	ResetConnection(context.Background(), "router1")
+}
+
+func TestRunContext_Deadline(t *testing.T) {
+	ctx, host, _ := startPoolTestRouter(t)
+	ctx = context.WithValue(ctx, ConfigKey, &Config{CommandTimeout: 200 * time.Millisecond})
+	conn, err := CreateConnection(ctx, host)
+	if err != nil {
+		t.Fatalf("CreateConnection() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The configured command timeout stops hung commands
+	_, err = conn.RunContext(ctx, ":delay 1h")
+	var timeout *CommandTimeoutError
+	if !errors.As(err, &timeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunContext() error = %v, want a CommandTimeoutError", err)
+	}
+	if timeout.Command != ":delay 1h" {
+		t.Errorf("CommandTimeoutError.Command = %q, want :delay 1h", timeout.Command)
+	}
+
+	// Secrets of timed out commands are not printed
+	_, err = conn.RunContext(ctx, `:delay 1h; /system/backup/save password="s3cret"`)
+	if err == nil || strings.Contains(err.Error(), "s3cret") || !strings.Contains(err.Error(), "REDACTED") {
+		t.Errorf("RunContext() error = %v, want the password redacted", err)
+	}
+
+	// Cancellation stops the command without being reported as a timeout
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = conn.RunContext(cancelCtx, ":delay 1h")
+	if !errors.Is(err, context.Canceled) || errors.As(err, &timeout) {
+		t.Fatalf("RunContext() after cancel error = %v, want context.Canceled", err)
+	}
+
+	// The connection is still usable afterwards
+	if output, err := conn.RunContext(ctx, "/system identity print"); err != nil || output != "router output" {
+		t.Errorf("RunContext() = %q, %v, want router output", output, err)
+	}
+}
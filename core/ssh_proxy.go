@@ -0,0 +1,229 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// maxJumpDepth limits chained ProxyJump configurations
+const maxJumpDepth = 8
+
+// knownHostsFiles are the OpenSSH known hosts files used to verify jump hosts,
+// routers are verified with their enrolled host key instead. Overridden in tests.
+var knownHostsFiles = []string{"~/.ssh/known_hosts", "/etc/ssh/ssh_known_hosts"}
+
+// dialSsh opens the SSH connection to a host: directly, through its ProxyCommand,
+// or through its ProxyJump hosts. It returns the client and the jump host clients
+// to close along with it.
+func dialSsh(ctx context.Context, hostInfo *HostInfo, config *ssh.ClientConfig, passphrase string, depth int) (*ssh.Client, []*ssh.Client, error) {
+	address := net.JoinHostPort(hostInfo.Hostname, hostInfo.Port)
+	switch {
+	case hostInfo.ProxyCommand != "":
+		command := expandSshTokens(hostInfo.ProxyCommand, hostInfo.sshTokens(config.User))
+		slog.Debug("connecting through ProxyCommand", "address", address, "command", command)
+		conn, err := startProxyCommand(command)
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := newClientOverConn(conn, address, config)
+		return client, nil, err
+
+	case hostInfo.ProxyJump != "":
+		if depth >= maxJumpDepth {
+			return nil, nil, fmt.Errorf("too many chained ProxyJump hosts")
+		}
+		jumps, err := dialJumpHosts(ctx, hostInfo.ProxyJump, passphrase, depth)
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.Debug("connecting through ProxyJump", "address", address, "jumps", hostInfo.ProxyJump)
+		conn, err := jumps[len(jumps)-1].Dial("tcp", address)
+		if err != nil {
+			closeClients(jumps)
+			return nil, nil, fmt.Errorf("jump host failed to reach %s: %w", address, err)
+		}
+		client, err := newClientOverConn(conn, address, config)
+		if err != nil {
+			closeClients(jumps)
+			return nil, nil, err
+		}
+		return client, jumps, nil
+	}
+
+	client, err := ssh.Dial("tcp", address, config)
+	return client, nil, err
+}
+
+// dialJumpHosts connects to the comma separated ProxyJump hosts, each one through the previous one.
+// The first host is dialed with its own ssh_config, including its ProxyCommand or ProxyJump.
+func dialJumpHosts(ctx context.Context, proxyJump, passphrase string, depth int) ([]*ssh.Client, error) {
+	var jumps []*ssh.Client
+	for i, spec := range strings.Split(proxyJump, ",") {
+		jumpInfo, config, auth, err := jumpHostConfig(ctx, strings.TrimSpace(spec), passphrase)
+		if err != nil {
+			closeClients(jumps)
+			return nil, err
+		}
+		address := net.JoinHostPort(jumpInfo.Hostname, jumpInfo.Port)
+		slog.Debug("connecting to jump host", "host", spec, "address", address, "user", config.User)
+
+		var client *ssh.Client
+		if i == 0 {
+			var nested []*ssh.Client
+			client, nested, err = dialSsh(ctx, jumpInfo, config, passphrase, depth+1)
+			jumps = append(jumps, nested...)
+		} else {
+			var conn net.Conn
+			if conn, err = jumps[len(jumps)-1].Dial("tcp", address); err == nil {
+				client, err = newClientOverConn(conn, address, config)
+			}
+		}
+		auth.Close()
+		if err != nil {
+			closeClients(jumps)
+			return nil, fmt.Errorf("failed to connect to jump host %s: %w", spec, err)
+		}
+		jumps = append(jumps, client)
+	}
+	return jumps, nil
+}
+
+// jumpHostConfig returns the connection details and client configuration of a [user@]host[:port]
+// jump host. Jump hosts are regular SSH servers: the router password is never sent to them,
+// and their host key is checked against the OpenSSH known hosts files.
+func jumpHostConfig(ctx context.Context, spec, passphrase string) (*HostInfo, *ssh.ClientConfig, *sshAuth, error) {
+	spec = strings.TrimPrefix(spec, "ssh://")
+	jumpUser, host, hasUser := strings.Cut(spec, "@")
+	if !hasUser {
+		host, jumpUser = jumpUser, ""
+	}
+
+	jumpInfo := readSshConfig(host, localUsername())
+	if jumpUser == "" {
+		jumpUser = jumpInfo.User
+	}
+	if jumpUser == "" {
+		jumpUser = localUsername()
+	}
+	if len(jumpInfo.identityFiles()) == 0 {
+		// The passphrase is meant for IdentityFiles, the jump host may still use the agent
+		passphrase = ""
+	}
+
+	auth, err := buildSshAuth(jumpInfo, "", passphrase)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("jump host %s: %w", spec, err)
+	}
+	hostKeyCallback, err := jumpHostKeyCallback(ctx)
+	if err != nil {
+		auth.Close()
+		return nil, nil, nil, fmt.Errorf("jump host %s: %w", spec, err)
+	}
+	config := &ssh.ClientConfig{
+		User:            jumpUser,
+		Auth:            auth.methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}
+	if err := applySshAlgorithms(config, jumpInfo); err != nil {
+		auth.Close()
+		return nil, nil, nil, fmt.Errorf("jump host %s: %w", spec, err)
+	}
+	return jumpInfo, config, auth, nil
+}
+
+// jumpHostKeyCallback verifies jump host keys with the OpenSSH known hosts files
+func jumpHostKeyCallback(ctx context.Context) (ssh.HostKeyCallback, error) {
+	if cfg, err := GetConfig(ctx); err == nil && cfg.SkipHostKeyCheck {
+		slog.Warn("⚠️  HOST KEY VERIFICATION DISABLED - INSECURE!")
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	var files []string
+	for _, file := range knownHostsFiles {
+		file = expandHome(file)
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no known_hosts file to verify the host key, connect once with ssh first")
+	}
+	return knownhosts.New(files...)
+}
+
+// newClientOverConn runs the SSH handshake over an established connection
+func newClientOverConn(conn net.Conn, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// closeClients closes jump host clients, the last one first
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		_ = clients[i].Close()
+	}
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a ProxyCommand
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// startProxyCommand runs a ProxyCommand with the shell, its stderr goes to ours
+func startProxyCommand(command string) (*commandConn, error) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ProxyCommand: %w", err)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *commandConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *commandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close stops the ProxyCommand
+func (c *commandConn) Close() error {
+	_ = c.stdin.Close()
+	if c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	_ = c.cmd.Wait()
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr                { return proxyCommandAddr(c.cmd.String()) }
+func (c *commandConn) RemoteAddr() net.Addr               { return proxyCommandAddr(c.cmd.String()) }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// proxyCommandAddr is the address of a ProxyCommand connection
+type proxyCommandAddr string
+
+func (a proxyCommandAddr) Network() string { return "proxycommand" }
+func (a proxyCommandAddr) String() string  { return string(a) }
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSshServer is an in-process SSH server answering exec requests with a fixed
+// output and forwarding direct-tcpip channels (jump host).
+// ":delay" commands hang until the client closes the session, ":error" commands
+// fail with their arguments on stderr and exit status 1.
+type testSshServer struct {
+	Address   string
+	HostKey   ssh.PublicKey
+	Forwarded atomic.Int32
+}
+
+func startTestSshServer(t *testing.T, config *ssh.ServerConfig, output string) *testSshServer {
+	t.Helper()
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	server := &testSshServer{Address: listener.Addr().String(), HostKey: hostKey.PublicKey()}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config, output)
+		}
+	}()
+	return server
+}
+
+func (s *testSshServer) serve(conn net.Conn, config *ssh.ServerConfig, output string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			var target struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+				_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+			if err != nil {
+				_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, requests, _ := newChannel.Accept()
+			s.Forwarded.Add(1)
+			go ssh.DiscardRequests(requests)
+			go func() {
+				_, _ = io.Copy(channel, upstream)
+				_ = channel.Close()
+			}()
+			go func() {
+				_, _ = io.Copy(upstream, channel)
+				_ = upstream.Close()
+			}()
+		case "session":
+			channel, requests, _ := newChannel.Accept()
+			go func() {
+				for req := range requests {
+					if req.Type != "exec" {
+						_ = req.Reply(false, nil)
+						continue
+					}
+					_ = req.Reply(true, nil)
+					var exec struct{ Command string }
+					if ssh.Unmarshal(req.Payload, &exec) == nil && strings.HasPrefix(exec.Command, ":delay") {
+						// Closed once the client closes the session
+						continue
+					}
+					if message, ok := strings.CutPrefix(exec.Command, ":error "); ok {
+						_, _ = channel.Stderr().Write([]byte(message + "\n"))
+						_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+						_ = channel.Close()
+						continue
+					}
+					_, _ = channel.Write([]byte(output))
+					_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					_ = channel.Close()
+				}
+				_ = channel.Close()
+			}()
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+		}
+	}
+}
+
+func TestNewSsh_ProxyJump(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	// Absolute path: the test runs from a temporary directory holding the enrolled host key
+	keyFile, err := filepath.Abs(filepath.Join("testdata", "ssh_keys", "test_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	originalSystem, originalKnownHosts := systemSshConfig, knownHostsFiles
+	defer func() { systemSshConfig, knownHostsFiles = originalSystem, originalKnownHosts }()
+	systemSshConfig = filepath.Join(home, "none")
+	knownHostsFiles = []string{"~/.ssh/known_hosts"}
+
+	jumpSigner, err := parseSshPrivateKey(keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bastion only accepts the key, the router only the password
+	bastion := startTestSshServer(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "jump" && string(key.Marshal()) == string(jumpSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+	}, "")
+	router := startTestSshServer(t, &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "admin" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+	}, "router output")
+
+	bastionHost, bastionPort, _ := net.SplitHostPort(bastion.Address)
+	routerHost, routerPort, _ := net.SplitHostPort(router.Address)
+	config := fmt.Sprintf(`Host bastion
+    HostName %s
+    Port %s
+    User jump
+    IdentityFile %s
+
+Host router-behind
+    HostName %s
+    Port %s
+    ProxyJump bastion
+`, bastionHost, bastionPort, keyFile, routerHost, routerPort)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), ConfigKey, &Config{})
+
+	// The bastion host key is checked against known_hosts
+	if _, err := newSsh(ctx, "router-behind", "admin", "secret", ""); err == nil || !strings.Contains(err.Error(), "known_hosts") {
+		t.Fatalf("newSsh() without known_hosts error = %v, want a known_hosts error", err)
+	}
+	knownHosts := knownhosts.Line([]string{knownhosts.Normalize(bastion.Address)}, bastion.HostKey) + "\n"
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(knownHosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The router host key is checked against its enrolled key
+	if err := CaptureHostKey("router-behind", router.HostKey); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := newSsh(ctx, "router-behind", "admin", "secret", "")
+	if err != nil {
+		t.Fatalf("newSsh() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if len(conn.jumps) != 1 {
+		t.Errorf("jump connections = %d, want 1", len(conn.jumps))
+	}
+	output, err := conn.Run("/system identity print")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if output != "router output" {
+		t.Errorf("Run() = %q, want router output", output)
+	}
+	if bastion.Forwarded.Load() != 1 {
+		t.Errorf("bastion forwarded %d connections, want 1", bastion.Forwarded.Load())
+	}
+}
+
+func TestProxyCommandConn(t *testing.T) {
+	conn, err := startProxyCommand("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("Read() = %q, want ping", buf)
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -207,6 +207,8 @@ func TestSshConnection_Run_NilClient(t *testing.T) {
 
 func TestNewSsh_NoAuthenticationMethods(t *testing.T) {
 	// Test that newSsh returns error when no authentication is provided
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
 	ctx := context.Background()
 	_, err := newSsh(ctx, "test-host:22", "admin", "", "")
 
@@ -214,7 +216,7 @@ func TestNewSsh_NoAuthenticationMethods(t *testing.T) {
 		t.Error("newSsh() expected error for no authentication, got nil")
 	}
 
-	expectedErr := "no authentication method provided (need password or SSH key with passphrase)"
+	expectedErr := "no authentication method provided (need password, SSH key or SSH agent)"
 	if err != nil && err.Error() != expectedErr {
 		t.Errorf("newSsh() error = %q, want %q", err.Error(), expectedErr)
 	}
@@ -285,7 +287,7 @@ func TestReadSshConfig_NoConfigFile(t *testing.T) {
 		t.Fatalf("Failed to set HOME: %v", err)
 	}
 
-	config := readSshConfig("test-host")
+	config := readSshConfig("test-host", "")
 
 	if config == nil {
 		t.Fatal("readSshConfig() returned nil")
@@ -431,7 +433,7 @@ func TestReadSshConfig_WithFixtures(t *testing.T) {
 			}
 
 			// Test readSshConfig
-			config := readSshConfig(tt.host)
+			config := readSshConfig(tt.host, "")
 
 			if config == nil {
 				t.Fatal("readSshConfig() returned nil")
@@ -454,10 +456,7 @@ func TestReadSshConfig_WithFixtures(t *testing.T) {
 }
 
 func TestParseSshPrivateKey_Unencrypted(t *testing.T) {
-	// Test parsing unencrypted key
-	// Note: The current implementation uses ssh.ParsePrivateKeyWithPassphrase
-	// which fails for unencrypted keys when given an empty passphrase
-	// This test documents the current behavior
+	// Test parsing unencrypted key, loaded without passphrase
 	testdataDir, err := filepath.Abs("testdata")
 	if err != nil {
 		t.Fatalf("Failed to get testdata path: %v", err)
@@ -465,16 +464,15 @@ func TestParseSshPrivateKey_Unencrypted(t *testing.T) {
 
 	keyPath := filepath.Join(testdataDir, "ssh_keys", "test_key")
 
-	// With empty passphrase, unencrypted keys fail to parse
-	signer, _ := parseSshPrivateKey(keyPath, "")
-
-	// Current implementation returns nil for unencrypted keys with empty passphrase
-	if signer != nil {
-		t.Error("parseSshPrivateKey() unexpectedly succeeded for unencrypted key with empty passphrase")
+	signer, err := parseSshPrivateKey(keyPath, "")
+	if err != nil || signer == nil {
+		t.Errorf("parseSshPrivateKey() failed for unencrypted key with empty passphrase: %v", err)
 	}
 
-	// Note: To support unencrypted keys, parseSshPrivateKey would need to try
-	// ssh.ParsePrivateKey() first before ssh.ParsePrivateKeyWithPassphrase()
+	// Encrypted keys still need their passphrase
+	if signer, _ := parseSshPrivateKey(filepath.Join(testdataDir, "ssh_keys", "encrypted_key"), ""); signer != nil {
+		t.Error("parseSshPrivateKey() unexpectedly succeeded for encrypted key with empty passphrase")
+	}
 }
 
 func TestParseSshPrivateKey_Encrypted(t *testing.T) {
@@ -622,3 +620,59 @@ func TestSshConnection_Close_WithMockClient(t *testing.T) {
 		})
 	}
 }
+
+func TestSshConnection_Exec(t *testing.T) {
+	ctx, host, _ := startPoolTestRouter(t)
+	manager, _ := GetSshManager(ctx)
+	conn, err := newSsh(ctx, host, manager.user, manager.password, manager.passphrase)
+	if err != nil {
+		t.Fatalf("newSsh() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	result, err := conn.Exec(ctx, "/system identity print")
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if result.Stdout != "router output" || result.Stderr != "" || result.ExitCode != 0 || result.Duration <= 0 {
+		t.Errorf("Exec() = %+v, want router output with exit code 0", result)
+	}
+
+	// stderr and exit status of failed commands are kept
+	result, err = conn.Exec(ctx, ":error bad command name foo (line 1 column 1)")
+	var remoteErr *RemoteCommandError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("Exec() error = %v, want a RemoteCommandError", err)
+	}
+	if result.ExitCode != 1 || remoteErr.Result.ExitCode != 1 {
+		t.Errorf("exit code = %d, want 1", result.ExitCode)
+	}
+	if remoteErr.Message() != "bad command name foo (line 1 column 1)" {
+		t.Errorf("Message() = %q, want the stderr text", remoteErr.Message())
+	}
+	want := "failed to run command: exit status 1: bad command name foo (line 1 column 1)"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestRemoteCommandError_Message(t *testing.T) {
+	tests := []struct {
+		name   string
+		result CommandResult
+		want   string
+	}{
+		{"stderr first", CommandResult{Stdout: "out", Stderr: "err\n", ExitCode: 1}, "failed to run command: exit status 1: err"},
+		{"stdout when stderr is empty", CommandResult{Stdout: "failure: bad\r\n", ExitCode: 2}, "failed to run command: exit status 2: failure: bad"},
+		{"no output", CommandResult{ExitCode: 1}, "failed to run command: exit status 1"},
+		{"no exit status", CommandResult{ExitCode: -1}, "failed to run command: no exit status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &RemoteCommandError{Command: "/test", Result: tt.result}
+			if got := err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,9 +4,14 @@ go 1.25.4
 
 require github.com/urfave/cli/v3 v3.6.1
 
-require github.com/kevinburke/ssh_config v1.4.0
+require (
+	github.com/pkg/sftp v1.13.11
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/kr/fs v0.1.0 // indirect
 
 require (
-	golang.org/x/crypto v0.46.0
-	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/crypto v0.54.0
+	golang.org/x/sys v0.47.0 // indirect
 )
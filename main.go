@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v3"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/backup"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/decrypt"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/diff"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/drift"
 	"jb.favre/mikrotik-fleet-autopilot/cmd/enroll"
 	"jb.favre/mikrotik-fleet-autopilot/cmd/export"
+	"jb.favre/mikrotik-fleet-autopilot/cmd/push"
 	"jb.favre/mikrotik-fleet-autopilot/cmd/updates"
 	"jb.favre/mikrotik-fleet-autopilot/core"
 )
@@ -22,11 +32,120 @@ func main() {
 
 	cmd := buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
 
-	if err := cmd.Run(context.WithValue(context.Background(), core.ConfigKey, &globalConfig), os.Args); err != nil {
+	// Ctrl-C and SIGTERM cancel the context, commands in progress stop and report it
+	ctx, stop := signal.NotifyContext(context.WithValue(context.Background(), core.ConfigKey, &globalConfig), os.Interrupt, syscall.SIGTERM)
+	err := cmd.Run(ctx, os.Args)
+	stop()
+	if err != nil {
 		slog.Error("command failed", "error", err)
+		os.Exit(exitCode(err))
 	}
 }
 
+// Exit codes: routers that did not come back after an update reboot
+// need attention before anything else is retried
+const (
+	exitFailure        = 1
+	exitDidNotComeBack = 3
+)
+
+// exitCode maps a command error to the process exit code
+func exitCode(err error) int {
+	if errors.Is(err, updates.ErrRouterDidNotComeBack) {
+		return exitDidNotComeBack
+	}
+	return exitFailure
+}
+
+// hostsKey is the context key of the --host flag, read once the subcommand parsed its arguments
+type hostsKey struct{}
+
+// commands are the subcommands, selecting their routers before they run
+var commands = withRouters(slices.Concat(export.Command, updates.Command, enroll.Command, drift.Command, diff.Command, push.Command, backup.Command, decrypt.Command))
+
+// withRouters selects the routers of each command once its arguments are parsed, global flags
+// may follow the subcommand. Commands working on local files only mark the context in their
+// own Before (core.LocalModeKey), decrypt always and diff of two files, and need no routers.
+func withRouters(commands []*cli.Command) []*cli.Command {
+	for _, command := range commands {
+		before := command.Before
+		command.Before = func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			if before != nil {
+				var err error
+				if ctx, err = before(ctx, cmd); err != nil {
+					return ctx, err
+				}
+			}
+			if core.IsLocalMode(ctx) {
+				return ctx, nil
+			}
+			cfg, err := core.GetConfig(ctx)
+			if err != nil {
+				return ctx, err
+			}
+			var hosts string
+			if flag, ok := ctx.Value(hostsKey{}).(*string); ok {
+				hosts = *flag
+			}
+			return ctx, selectRouters(cfg, hosts)
+		}
+	}
+	return commands
+}
+
+// selectRouters sets the routers to process: the --host list, the routers of the inventory
+// selected by group and tag, or the routers discovered from router*.rsc files
+func selectRouters(globalConfig *core.Config, hosts string) error {
+	// Load inventory if provided
+	if globalConfig.InventoryFile != "" {
+		inventory, err := core.LoadInventory(globalConfig.InventoryFile)
+		if err != nil {
+			return err
+		}
+		globalConfig.Inventory = inventory
+	} else if len(globalConfig.Groups) > 0 || len(globalConfig.Tags) > 0 {
+		return fmt.Errorf("--group and --tag require --inventory")
+	}
+
+	// Setup hosts
+	if hosts != "" {
+		// Split comma-separated hosts
+		globalConfig.Hosts = core.ParseHosts(hosts)
+	} else if globalConfig.Inventory != nil {
+		// Select routers from inventory
+		selected, err := globalConfig.Inventory.Select(globalConfig.Groups, globalConfig.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to select routers from inventory: %w", err)
+		}
+		globalConfig.Hosts = selected
+		slog.Info("selected routers from inventory", "count", len(selected), "routers", selected)
+	} else {
+		// Auto-discover routers
+		routers, err := core.DiscoverHosts()
+		if err != nil {
+			return fmt.Errorf("failed to discover routers: %w", err)
+		}
+		globalConfig.Hosts = routers
+		slog.Info("auto-discovered routers", "count", len(routers), "routers", routers)
+	}
+
+	if len(globalConfig.Hosts) == 0 {
+		slog.Error("no routers specified or discovered")
+		return fmt.Errorf("no routers specified or discovered")
+	}
+
+	if err := core.ValidateTransport(globalConfig.Transport); err != nil {
+		return err
+	}
+	if globalConfig.CommandTimeout < 0 {
+		return fmt.Errorf("--command-timeout must not be negative, got %s", globalConfig.CommandTimeout)
+	}
+	if globalConfig.Parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1, got %d", globalConfig.Parallel)
+	}
+	return nil
+}
+
 // buildCommand creates and configures the CLI command structure.
 // This function is extracted to make the CLI testable.
 func buildCommand(globalConfig *core.Config, hosts, sshPassword, sshPassphrase *string) *cli.Command {
@@ -46,6 +165,28 @@ func buildCommand(globalConfig *core.Config, hosts, sshPassword, sshPassphrase *
 				Usage:       "MikroTik router hostname or IP address (comma-separated for multiple routers). If not provided, will auto-discover from router*.rsc files in current directory",
 				Destination: hosts,
 			},
+			&cli.StringFlag{
+				Name:        "inventory",
+				Aliases:     []string{"i"},
+				Category:    "inventory",
+				Value:       "",
+				Usage:       "Path to a YAML fleet inventory file (hosts, groups, tags and per-host overrides)",
+				Destination: &globalConfig.InventoryFile,
+			},
+			&cli.StringSliceFlag{
+				Name:        "group",
+				Aliases:     []string{"g"},
+				Category:    "inventory",
+				Usage:       "Only process routers from these inventory groups (comma-separated or repeated)",
+				Destination: &globalConfig.Groups,
+			},
+			&cli.StringSliceFlag{
+				Name:        "tag",
+				Aliases:     []string{"t"},
+				Category:    "inventory",
+				Usage:       "Only process routers with these inventory tags (comma-separated or repeated)",
+				Destination: &globalConfig.Tags,
+			},
 			&cli.StringFlag{
 				Name:        "ssh-user",
 				Aliases:     []string{"u"},
@@ -77,6 +218,35 @@ func buildCommand(globalConfig *core.Config, hosts, sshPassword, sshPassphrase *
 				Usage:       "⚠️  INSECURE: Skip host key verification (for testing only)",
 				Destination: &globalConfig.SkipHostKeyCheck,
 			},
+			&cli.StringFlag{
+				Name:        "transport",
+				Category:    "ssh",
+				Value:       core.TransportSSH,
+				Usage:       "Transport to reach routers: ssh, api (RouterOS API, port 8728), api-ssl (port 8729) or rest (REST API of RouterOS 7, port 443), inventory transport overrides it",
+				Destination: &globalConfig.Transport,
+			},
+			&cli.DurationFlag{
+				Name:        "command-timeout",
+				Category:    "ssh",
+				Value:       5 * time.Minute,
+				Usage:       "Maximum duration of a single router command (0 to disable)",
+				Destination: &globalConfig.CommandTimeout,
+			},
+			&cli.IntFlag{
+				Name:        "parallel",
+				Aliases:     []string{"j"},
+				Value:       1,
+				Usage:       "Number of routers to process concurrently",
+				Destination: &globalConfig.Parallel,
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Aliases:     []string{"o"},
+				Category:    "log",
+				Value:       "text",
+				Usage:       "Output format for per-router results: text, json or ndjson",
+				Destination: &globalConfig.Output,
+			},
 			&cli.BoolFlag{
 				Name:        "debug",
 				Aliases:     []string{"d"},
@@ -85,7 +255,7 @@ func buildCommand(globalConfig *core.Config, hosts, sshPassword, sshPassphrase *
 				Destination: &globalConfig.Debug,
 			},
 		},
-		Commands: append(append(export.Command, updates.Command...), enroll.Command...),
+		Commands: commands,
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			// Set log level
 			core.SetupLogging(slog.LevelWarn)
@@ -94,38 +264,33 @@ func buildCommand(globalConfig *core.Config, hosts, sshPassword, sshPassphrase *
 			}
 			slog.Info("Starting global")
 
-			// Check if a subcommand was provided
-			// If not, the help will be shown automatically by urfave/cli
-			if cmd.Args().Len() > 0 {
-				slog.Debug("cmd args", "args", cmd.Args())
-				// Setup hosts
-				if *hosts != "" {
-					// Split comma-separated hosts
-					globalConfig.Hosts = core.ParseHosts(*hosts)
-				} else {
-					// Auto-discover routers
-					routers, err := core.DiscoverHosts()
-					if err != nil {
-						return ctx, fmt.Errorf("failed to discover routers: %w", err)
-					}
-					globalConfig.Hosts = routers
-					slog.Info("auto-discovered routers", "count", len(routers), "routers", routers)
-				}
-
-				if len(globalConfig.Hosts) == 0 {
-					slog.Error("no routers specified or discovered")
-					return ctx, fmt.Errorf("no routers specified or discovered")
-				}
+			// Create reporter for per-host results
+			outputFormat, err := core.ParseOutputFormat(globalConfig.Output)
+			if err != nil {
+				return ctx, err
 			}
+			reporter := core.NewReporter(outputFormat, os.Stdout)
+
 			// Create SSH manager with credentials (credentials stay encapsulated)
 			sshManager := core.NewSshManager(globalConfig.User, *sshPassword, *sshPassphrase)
 
 			// Make global config (without credentials) and SSH manager available in context
 			ctx = context.WithValue(ctx, core.ConfigKey, globalConfig)
 			ctx = context.WithValue(ctx, core.SshManagerKey, sshManager)
+			ctx = context.WithValue(ctx, core.ReporterKey, reporter)
+			// Routers are selected by the subcommand, see withRouters
+			ctx = context.WithValue(ctx, hostsKey{}, hosts)
 			slog.Debug("global config available in context", "config", *globalConfig)
 			slog.Info("starting subcommand", "subcommand", cmd.Args().Get(0))
 			return ctx, nil
 		},
+		After: func(ctx context.Context, cmd *cli.Command) error {
+			// Close the SSH connections pooled during the run
+			if sshManager, err := core.GetSshManager(ctx); err == nil && sshManager != nil {
+				_ = sshManager.Close()
+			}
+			// Flush buffered results (JSON array output)
+			return core.GetReporter(ctx).Close()
+		},
 	}
 }
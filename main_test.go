@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
+	"jb.favre/mikrotik-fleet-autopilot/cmd/updates"
 	"jb.favre/mikrotik-fleet-autopilot/core"
 )
 
@@ -46,11 +49,18 @@ func TestBuildCommandFlags(t *testing.T) {
 	cmd := buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
 
 	expectedFlags := map[string]bool{
-		"host":           false,
-		"ssh-user":       false,
-		"ssh-password":   false,
-		"ssh-passphrase": false,
-		"debug":          false,
+		"host":            false,
+		"ssh-user":        false,
+		"ssh-password":    false,
+		"ssh-passphrase":  false,
+		"parallel":        false,
+		"inventory":       false,
+		"group":           false,
+		"tag":             false,
+		"output":          false,
+		"debug":           false,
+		"command-timeout": false,
+		"transport":       false,
 	}
 
 	// Check all expected flags exist
@@ -70,8 +80,8 @@ func TestBuildCommandFlags(t *testing.T) {
 	}
 
 	// Test that we have the right number of flags
-	if len(cmd.Flags) != 6 {
-		t.Errorf("Expected 6 flags, got %d", len(cmd.Flags))
+	if len(cmd.Flags) != 13 {
+		t.Errorf("Expected 13 flags, got %d", len(cmd.Flags))
 	}
 }
 
@@ -251,6 +261,97 @@ func TestAutoDiscoveryWithBeforeHook(t *testing.T) {
 	}
 }
 
+func TestInventorySelectionWithBeforeHook(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantHosts   []string
+		errContains string
+	}{
+		{
+			name:      "all inventory hosts",
+			args:      []string{"--inventory", "inventory.yaml"},
+			wantHosts: []string{"router1", "router2", "ap1"},
+		},
+		{
+			name:      "select by group",
+			args:      []string{"--inventory", "inventory.yaml", "--group", "site-paris"},
+			wantHosts: []string{"router1", "ap1"},
+		},
+		{
+			name:      "select by tag",
+			args:      []string{"--inventory", "inventory.yaml", "--tag", "core"},
+			wantHosts: []string{"router1", "router2"},
+		},
+		{
+			name:      "--host takes precedence over inventory selection",
+			args:      []string{"--inventory", "inventory.yaml", "--host", "router2"},
+			wantHosts: []string{"router2"},
+		},
+		{
+			name:        "tag without inventory",
+			args:        []string{"--tag", "core"},
+			errContains: "--group and --tag require --inventory",
+		},
+		{
+			name:        "unknown group",
+			args:        []string{"--inventory", "inventory.yaml", "--group", "site-berlin"},
+			errContains: "unknown group",
+		},
+	}
+
+	inventory := `hosts:
+  - name: router1
+    address: 127.0.0.1
+    port: "1"
+    tags: [core]
+  - name: router2
+    address: 127.0.0.1
+    port: "1"
+    tags: [core]
+  - name: ap1
+    address: 127.0.0.1
+    port: "1"
+    tags: [ap]
+groups:
+  site-paris: [router1, ap1]
+`
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			origDir, _ := os.Getwd()
+			defer func() { _ = os.Chdir(origDir) }()
+			if err := os.Chdir(tmpDir); err != nil {
+				t.Fatalf("Failed to change to temp dir: %v", err)
+			}
+			if err := os.WriteFile("inventory.yaml", []byte(inventory), 0644); err != nil {
+				t.Fatalf("Failed to create inventory file: %v", err)
+			}
+
+			var globalConfig core.Config
+			var hosts, sshPassword, sshPassphrase string
+			sshPassword = "testpass"
+			cmd := buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
+
+			args := append([]string{"mikrotik-fleet-autopilot"}, tt.args...)
+			args = append(args, "export")
+			err := cmd.Run(context.Background(), args)
+
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("Expected error containing %q, got %v", tt.errContains, err)
+				}
+				return
+			}
+			// Export itself fails (nothing listens on port 1), only host selection matters here
+			if !reflect.DeepEqual(globalConfig.Hosts, tt.wantHosts) {
+				t.Errorf("Expected hosts %v, got %v", tt.wantHosts, globalConfig.Hosts)
+			}
+		})
+	}
+}
+
 func TestEmptyHostsWithNoFiles(t *testing.T) {
 	tmpDir := t.TempDir()
 	origDir, _ := os.Getwd()
@@ -406,7 +507,7 @@ func TestBuildCommandAllSubcommands(t *testing.T) {
 
 	cmd := buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
 
-	expectedCommands := []string{"export", "updates", "enroll"}
+	expectedCommands := []string{"export", "updates", "enroll", "drift", "diff", "push", "backup", "decrypt"}
 
 	if len(cmd.Commands) < len(expectedCommands) {
 		t.Errorf("Expected at least %d subcommands, got %d", len(expectedCommands), len(cmd.Commands))
@@ -509,3 +610,102 @@ func TestBuildCommandDebugFlag(t *testing.T) {
 		t.Error("Debug flag should be false")
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "generic failure",
+			err:  fmt.Errorf("connection refused"),
+			want: exitFailure,
+		},
+		{
+			name: "router did not come back",
+			err:  fmt.Errorf("wrapped: %w", updates.ErrRouterDidNotComeBack),
+			want: exitDidNotComeBack,
+		},
+		{
+			name: "did not come back on any host of the fleet",
+			err: core.FleetResults{
+				{Host: "r1", Err: fmt.Errorf("wait: %w", updates.ErrRouterDidNotComeBack)},
+				{Host: "r2", Err: fmt.Errorf("connection refused")},
+			}.Err(),
+			want: exitDidNotComeBack,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalCommandWithoutRouters(t *testing.T) {
+	tmpDir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+
+	encrypted, err := core.FileEncrypter{Passphrase: "secret"}.Encrypt([]byte("/system identity\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("router1.rsc.enc", encrypted, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No router*.rsc file to discover: decrypt must not need any router
+	var globalConfig core.Config
+	var hosts, sshPassword, sshPassphrase string
+	cmd := buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
+	if err := cmd.Run(context.Background(), []string{"mikrotik-fleet-autopilot", "decrypt", "--passphrase", "secret", "router1.rsc.enc"}); err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if len(globalConfig.Hosts) != 0 {
+		t.Errorf("Expected no hosts, got %v", globalConfig.Hosts)
+	}
+	if _, err := os.Stat("router1.rsc"); err != nil {
+		t.Errorf("decrypted file missing: %v", err)
+	}
+}
+
+func TestDiffRoutersAfterArguments(t *testing.T) {
+	tmpDir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to change to temp dir: %v", err)
+	}
+	for _, name := range []string{"a.rsc", "b.rsc"} {
+		if err := os.WriteFile(name, []byte("/system identity\nset name=router\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Global flags following the subcommand are not files: two files need no router
+	var globalConfig core.Config
+	var hosts, sshPassword, sshPassphrase string
+	cmd := buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
+	if err := cmd.Run(context.Background(), []string{"mikrotik-fleet-autopilot", "diff", "--inventory", "missing.yml", "a.rsc", "b.rsc"}); err != nil {
+		t.Fatalf("diff of two files failed: %v", err)
+	}
+	if len(globalConfig.Hosts) != 0 {
+		t.Errorf("Expected no hosts, got %v", globalConfig.Hosts)
+	}
+
+	// A single file is compared with the routers, selected with the flags following the subcommand
+	globalConfig = core.Config{}
+	cmd = buildCommand(&globalConfig, &hosts, &sshPassword, &sshPassphrase)
+	err := cmd.Run(context.Background(), []string{"mikrotik-fleet-autopilot", "diff", "--inventory", "missing.yml", "a.rsc"})
+	if err == nil || !strings.Contains(err.Error(), "missing.yml") {
+		t.Errorf("Expected the inventory to be loaded, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Package rsc parses RouterOS scripts (exports, enroll scripts, stored .rsc files)
+// into an abstract syntax tree and prints them back.
+//
+// Parsing a script and printing it gives a normalized script, with line continuations
+// joined, menu paths separated by spaces and blocks indented. Parsing the printed script
+// gives the same tree.
+package rsc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Position is the line and column (1-based, in bytes) where a node starts
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Pos returns the position, so that nodes embedding Position implement Statement
+func (p Position) Pos() Position {
+	return p
+}
+
+// Statement is a top-level or block statement: *Comment, *Menu, *Command or *Block
+type Statement interface {
+	Pos() Position
+	// String prints the statement on a single line, comments within blocks are dropped
+	String() string
+}
+
+// Value is an argument value: *Word, *String, *Variable, *Expression, *Subcommand,
+// *Block or *Concat
+type Value interface {
+	String() string
+}
+
+// Script is a parsed RouterOS script
+type Script struct {
+	Statements []Statement
+}
+
+// Comment is a "# ..." line, Text excludes the #
+type Comment struct {
+	Position
+	Text string
+}
+
+// Menu is a line holding only a menu path, changing the menu of the following commands
+type Menu struct {
+	Position
+	Path []string
+}
+
+// Command is a command and its arguments. Path is the menu of the command,
+// absolute when Absolute is set (/ip address add), relative to the current menu
+// otherwise (add). Global commands (:put, :if) have no path.
+type Command struct {
+	Position
+	Absolute bool
+	Path     []string
+	Name     string
+	Args     []Arg
+}
+
+// Arg is a command argument: name=value, or a positional value (detail, where, [ find ])
+type Arg struct {
+	Name string
+	// Value is nil for "name=" without value
+	Value Value
+}
+
+// Block is a { ... } block, as statement or as value (do={ ... })
+type Block struct {
+	Position
+	Statements []Statement
+}
+
+// Word is an unquoted value
+type Word struct {
+	Text string
+}
+
+// String is a quoted value, Raw holds the text between quotes with its escape sequences
+type String struct {
+	Raw string
+}
+
+// Variable is a $name reference
+type Variable struct {
+	Name string
+}
+
+// Expression is a ( ... ) expression, kept as written
+type Expression struct {
+	Raw string
+}
+
+// Subcommand is a [ ... ] command whose result is the value, such as find expressions
+type Subcommand struct {
+	Statements []Statement
+}
+
+// Concat is a value made of adjacent parts ("prefix".$name, address~"10.0")
+type Concat struct {
+	Parts []Value
+}
+
+// Global reports whether the command is a global command (:put, :if, :local)
+func (c *Command) Global() bool {
+	return strings.HasPrefix(c.Name, ":")
+}
+
+// Arg returns the value of a named argument
+func (c *Command) Arg(name string) (Value, bool) {
+	for _, arg := range c.Args {
+		if arg.Name == name {
+			return arg.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Unquote returns the value of the string with its escape sequences replaced
+func (s *String) Unquote() string {
+	var b strings.Builder
+	raw := s.Raw
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 >= len(raw) {
+			b.WriteByte(raw[i])
+			continue
+		}
+		i++
+		switch c := raw[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case '_':
+			b.WriteByte(' ')
+		default:
+			if i+1 < len(raw) && isHexDigit(c) && isHexDigit(raw[i+1]) {
+				n, _ := strconv.ParseUint(raw[i:i+2], 16, 8)
+				b.WriteByte(byte(n))
+				i++
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('A' <= c && c <= 'F')
+}
+
+// Text returns the value of an argument as RouterOS reads it: words as written,
+// strings unquoted, other values printed
+func Text(v Value) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case *Word:
+		return v.Text
+	case *String:
+		return v.Unquote()
+	}
+	return v.String()
+}
+
+// Resolve returns the statements of a script to run one at a time: relative commands
+// following a menu line get its path, comments and menu lines are dropped. Blocks and
+// global commands are returned as they are.
+func Resolve(s *Script) []Statement {
+	var statements []Statement
+	var menu []string
+	for _, statement := range s.Statements {
+		switch st := statement.(type) {
+		case *Comment:
+			continue
+		case *Menu:
+			// Changing menu does nothing on its own, the following commands get its path
+			menu = st.Path
+			continue
+		case *Command:
+			if menu != nil && !st.Absolute && !st.Global() && !strings.HasPrefix(st.Name, "$") {
+				resolved := *st
+				resolved.Absolute = true
+				resolved.Path = append(append([]string{}, menu...), st.Path...)
+				statement = &resolved
+			}
+		}
+		statements = append(statements, statement)
+	}
+	return statements
+}
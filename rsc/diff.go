@@ -0,0 +1,339 @@
+package rsc
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Change kinds
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// naturalKeys are the properties identifying an added item, by order of preference.
+// push matches items on them too, see ItemKeys.
+var naturalKeys = []string{"name", "address", "interface", "comment"}
+
+// Change is the difference of an item between two configurations
+type Change struct {
+	// Menu is the menu path of the item (/ip address)
+	Menu string `json:"menu"`
+	// Key identifies the item within its menu (name=bridge1), empty for the settings
+	// of a menu without items (/ip dns set)
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	// Properties holds all the properties of added and removed items,
+	// the modified ones of changed items
+	Properties []PropertyChange `json:"properties,omitempty"`
+}
+
+// PropertyChange is the old and new value of a property, empty when it is not set
+type PropertyChange struct {
+	Name string `json:"name"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// item is a configured item: the properties of an add command, or of the set
+// commands applying to the same item
+type item struct {
+	properties map[string]string
+	order      []string
+}
+
+// menu holds the items of a menu path, in order of appearance
+type menu struct {
+	items map[string]*item
+	order []string
+}
+
+// configuration holds the menus of a script, in order of appearance
+type configuration struct {
+	menus map[string]*menu
+	order []string
+}
+
+// Diff compares two configurations, typically exports, menu by menu. Items are matched
+// by their natural key (name, address, interface or comment), so that neither the order of items
+// nor the order of their properties matter. Only add and set commands are compared:
+// global commands and scripts are not configuration items.
+func Diff(from, to *Script) []Change {
+	oldConfig, newConfig := items(from), items(to)
+
+	var changes []Change
+	paths := slices.Clone(oldConfig.order)
+	for _, path := range newConfig.order {
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range paths {
+		oldMenu, newMenu := oldConfig.menu(path), newConfig.menu(path)
+		keys := slices.Clone(oldMenu.order)
+		for _, key := range newMenu.order {
+			if _, ok := oldMenu.items[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			oldItem, newItem := oldMenu.items[key], newMenu.items[key]
+			switch {
+			case newItem == nil:
+				changes = append(changes, Change{Menu: path, Key: key, Kind: ChangeRemoved, Properties: compareProperties(oldItem, &item{})})
+			case oldItem == nil:
+				changes = append(changes, Change{Menu: path, Key: key, Kind: ChangeAdded, Properties: compareProperties(&item{}, newItem)})
+			default:
+				if properties := compareProperties(oldItem, newItem); len(properties) > 0 {
+					changes = append(changes, Change{Menu: path, Key: key, Kind: ChangeChanged, Properties: properties})
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// compareProperties returns the properties that differ between two items, in order of appearance
+func compareProperties(from, to *item) []PropertyChange {
+	names := slices.Clone(from.order)
+	for _, name := range to.order {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	var properties []PropertyChange
+	for _, name := range names {
+		oldValue, inOld := from.properties[name]
+		newValue, inNew := to.properties[name]
+		if inOld != inNew || oldValue != newValue {
+			properties = append(properties, PropertyChange{Name: name, Old: oldValue, New: newValue})
+		}
+	}
+	return properties
+}
+
+// command is an add or set command of a menu, selector holds the item selected by set
+type command struct {
+	add        bool
+	selector   string
+	properties map[string]string
+	order      []string
+}
+
+// items collects the configured items of a script
+func items(s *Script) *configuration {
+	commands := map[string][]command{}
+	var paths []string
+	for _, statement := range Resolve(s) {
+		cmd, ok := statement.(*Command)
+		if !ok || !cmd.Absolute || (cmd.Name != "add" && cmd.Name != "set") {
+			continue
+		}
+		path := "/" + strings.Join(cmd.Path, " ")
+		if _, ok := commands[path]; !ok {
+			paths = append(paths, path)
+		}
+
+		commands[path] = append(commands[path], newCommand(cmd))
+	}
+
+	config := &configuration{menus: map[string]*menu{}}
+	for _, path := range paths {
+		m := config.menu(path)
+		keys := addKeys(commands[path])
+		for i, c := range commands[path] {
+			if !c.add {
+				// set applies to the item it selects, or to the menu settings
+				m.set(c.selector, c.properties, c.order)
+				continue
+			}
+			key := keys[i]
+			for n := 2; m.items[key] != nil; n++ {
+				key = fmt.Sprintf("%s #%d", keys[i], n)
+			}
+			m.set(key, c.properties, c.order)
+		}
+	}
+	return config
+}
+
+// newCommand returns the properties and selector of an add or set command
+func newCommand(cmd *Command) command {
+	c := command{add: cmd.Name == "add", properties: map[string]string{}}
+	var selector []string
+	for _, arg := range cmd.Args {
+		if arg.Name == "" {
+			selector = append(selector, selectorText(arg.Value))
+			continue
+		}
+		if _, ok := c.properties[arg.Name]; !ok {
+			c.order = append(c.order, arg.Name)
+		}
+		c.properties[arg.Name] = Text(arg.Value)
+	}
+	c.selector = strings.Join(selector, " ")
+	return c
+}
+
+// menu returns the menu of a path, created when missing
+func (c *configuration) menu(path string) *menu {
+	m, ok := c.menus[path]
+	if !ok {
+		m = &menu{items: map[string]*item{}}
+		c.menus[path] = m
+		c.order = append(c.order, path)
+	}
+	return m
+}
+
+// set merges properties into the item of a key, created when missing
+func (m *menu) set(key string, properties map[string]string, order []string) {
+	it, ok := m.items[key]
+	if !ok {
+		it = &item{properties: map[string]string{}}
+		m.items[key] = it
+		m.order = append(m.order, key)
+	}
+	for _, name := range order {
+		if _, ok := it.properties[name]; !ok {
+			it.order = append(it.order, name)
+		}
+		it.properties[name] = properties[name]
+	}
+}
+
+// ItemKeys returns the property identifying each item added by the commands of a menu, by command
+// index: its first natural key (name, address, interface or comment) whose value is unique among
+// the added items, empty when there is none or for other commands. Diff matches items the same way.
+func ItemKeys(commands []*Command) []string {
+	converted := make([]command, len(commands))
+	for i, cmd := range commands {
+		converted[i] = newCommand(cmd)
+	}
+	return keyNames(converted)
+}
+
+// keyNames returns the natural key identifying each item added by the commands of a menu,
+// by command index (see ItemKeys)
+func keyNames(commands []command) []string {
+	counts := map[string]int{}
+	for _, c := range commands {
+		for _, name := range naturalKeys {
+			if value, ok := c.properties[name]; ok && c.add {
+				counts[name+"="+quoteValue(value)]++
+			}
+		}
+	}
+
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		if !c.add {
+			continue
+		}
+		for _, name := range naturalKeys {
+			if value, ok := c.properties[name]; ok && counts[name+"="+quoteValue(value)] == 1 {
+				names[i] = name
+				break
+			}
+		}
+	}
+	return names
+}
+
+// addKeys returns the keys of the items added by the commands of a menu, by command index.
+// The key of an item is its first natural key whose value is unique in the menu
+// (bridge ports all commented defconf are told apart by interface), all its properties otherwise.
+func addKeys(commands []command) map[int]string {
+	keys := map[int]string{}
+	for i, name := range keyNames(commands) {
+		c := commands[i]
+		if !c.add {
+			continue
+		}
+		if name != "" {
+			keys[i] = name + "=" + quoteValue(c.properties[name])
+		} else {
+			var fields []string
+			for _, name := range c.order {
+				fields = append(fields, name+"="+quoteValue(c.properties[name]))
+			}
+			keys[i] = strings.Join(fields, " ")
+		}
+	}
+	return keys
+}
+
+// selectorText returns the item selected by a positional set argument:
+// the conditions of [ find ... ], the value as written otherwise
+func selectorText(v Value) string {
+	sub, ok := v.(*Subcommand)
+	if !ok || len(sub.Statements) != 1 {
+		return Text(v)
+	}
+	find, ok := sub.Statements[0].(*Command)
+	if !ok || find.Name != "find" || find.Absolute || len(find.Path) > 0 {
+		return Text(v)
+	}
+	var conditions []string
+	for _, arg := range find.Args {
+		conditions = append(conditions, arg.String())
+	}
+	return strings.Join(conditions, " ")
+}
+
+// quoteValue quotes values that would not read as a single word
+func quoteValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"\\;") || strconv.Quote(value) != `"`+value+`"` {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// FormatChanges prints changes menu by menu: added items with +, removed items with -,
+// changed items with ~ followed by their modified properties
+func FormatChanges(changes []Change) string {
+	var b strings.Builder
+	path := ""
+	for _, change := range changes {
+		if change.Menu != path {
+			path = change.Menu
+			b.WriteString(path + "\n")
+		}
+		key := change.Key
+		if key == "" {
+			key = "(settings)"
+		}
+		switch change.Kind {
+		case ChangeAdded, ChangeRemoved:
+			sign, value := "+", func(p PropertyChange) string { return p.New }
+			if change.Kind == ChangeRemoved {
+				sign, value = "-", func(p PropertyChange) string { return p.Old }
+			}
+			fields := []string{key}
+			for _, property := range change.Properties {
+				field := property.Name + "=" + quoteValue(value(property))
+				if !strings.Contains(" "+change.Key+" ", " "+field+" ") {
+					fields = append(fields, field)
+				}
+			}
+			fmt.Fprintf(&b, "  %s %s\n", sign, strings.Join(fields, " "))
+		default:
+			fmt.Fprintf(&b, "  ~ %s\n", key)
+			for _, property := range change.Properties {
+				fmt.Fprintf(&b, "      %s: %s -> %s\n", property.Name, displayValue(property.Old), displayValue(property.New))
+			}
+		}
+	}
+	return b.String()
+}
+
+// displayValue prints a property value of a changed item
+func displayValue(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return quoteValue(value)
+}
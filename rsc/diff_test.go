@@ -0,0 +1,160 @@
+package rsc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want []Change
+	}{
+		{
+			name: "same configuration in another order",
+			old:  "/interface bridge\nadd name=bridge1 auto-mac=no\nadd name=bridge2\n/ip dns\nset servers=1.1.1.1 allow-remote-requests=yes\n",
+			new:  "/ip dns set allow-remote-requests=yes servers=1.1.1.1\n/interface bridge add name=bridge2\n/interface bridge add auto-mac=no name=bridge1\n",
+		},
+		{
+			name: "added, removed and changed items",
+			old:  "/ip address add address=10.0.0.1/24 interface=ether1\n/ip address add address=10.0.1.1/24 interface=ether2\n/ip dns set servers=1.1.1.1\n",
+			new:  "/ip address add address=10.0.0.1/24 interface=bridge1 comment=lan\n/ip address add address=10.0.2.1/24 interface=ether2\n/ip dns set servers=1.1.1.1\n",
+			want: []Change{
+				{Menu: "/ip address", Key: "address=10.0.0.1/24", Kind: ChangeChanged, Properties: []PropertyChange{
+					{Name: "interface", Old: "ether1", New: "bridge1"},
+					{Name: "comment", New: "lan"},
+				}},
+				{Menu: "/ip address", Key: "address=10.0.1.1/24", Kind: ChangeRemoved, Properties: []PropertyChange{
+					{Name: "address", Old: "10.0.1.1/24"},
+					{Name: "interface", Old: "ether2"},
+				}},
+				{Menu: "/ip address", Key: "address=10.0.2.1/24", Kind: ChangeAdded, Properties: []PropertyChange{
+					{Name: "address", New: "10.0.2.1/24"},
+					{Name: "interface", New: "ether2"},
+				}},
+			},
+		},
+		{
+			name: "menu settings and selected items",
+			old:  "/ip dns set servers=1.1.1.1\n/interface ethernet set [ find default-name=ether1 ] comment=wan\n",
+			new:  "/ip dns set servers=9.9.9.9\n/interface ethernet set [ find default-name=ether1 ] comment=\"wan uplink\"\n/system clock set time-zone-name=UTC\n",
+			want: []Change{
+				{Menu: "/ip dns", Kind: ChangeChanged, Properties: []PropertyChange{{Name: "servers", Old: "1.1.1.1", New: "9.9.9.9"}}},
+				{Menu: "/interface ethernet", Key: "default-name=ether1", Kind: ChangeChanged, Properties: []PropertyChange{{Name: "comment", Old: "wan", New: "wan uplink"}}},
+				{Menu: "/system clock", Kind: ChangeAdded, Properties: []PropertyChange{{Name: "time-zone-name", New: "UTC"}}},
+			},
+		},
+		{
+			name: "items told apart by a unique natural key",
+			old:  "/interface bridge port\nadd bridge=bridge1 comment=defconf interface=ether2\nadd bridge=bridge1 comment=defconf interface=ether3\n",
+			new:  "/interface bridge port\nadd bridge=bridge1 comment=defconf interface=ether3 pvid=10\nadd bridge=bridge1 comment=defconf interface=ether2\n",
+			want: []Change{
+				{Menu: "/interface bridge port", Key: "interface=ether3", Kind: ChangeChanged, Properties: []PropertyChange{{Name: "pvid", New: "10"}}},
+			},
+		},
+		{
+			name: "items without natural key",
+			old:  "/ip firewall filter\nadd action=accept chain=input\nadd action=drop chain=input\n",
+			new:  "/ip firewall filter\nadd action=drop chain=input\nadd action=drop chain=forward\n",
+			want: []Change{
+				{Menu: "/ip firewall filter", Key: "action=accept chain=input", Kind: ChangeRemoved, Properties: []PropertyChange{
+					{Name: "action", Old: "accept"},
+					{Name: "chain", Old: "input"},
+				}},
+				{Menu: "/ip firewall filter", Key: "action=drop chain=forward", Kind: ChangeAdded, Properties: []PropertyChange{
+					{Name: "action", New: "drop"},
+					{Name: "chain", New: "forward"},
+				}},
+			},
+		},
+		{
+			name: "natural key no longer unique",
+			old:  "/system script add name=a source=x\n",
+			new:  "/system script add name=a source=x\n/system script add name=a source=y\n",
+			want: []Change{
+				{Menu: "/system script", Key: "name=a", Kind: ChangeRemoved, Properties: []PropertyChange{{Name: "name", Old: "a"}, {Name: "source", Old: "x"}}},
+				{Menu: "/system script", Key: "name=a source=x", Kind: ChangeAdded, Properties: []PropertyChange{{Name: "name", New: "a"}, {Name: "source", New: "x"}}},
+				{Menu: "/system script", Key: "name=a source=y", Kind: ChangeAdded, Properties: []PropertyChange{{Name: "name", New: "a"}, {Name: "source", New: "y"}}},
+			},
+		},
+		{
+			name: "identical items",
+			old:  "/ip firewall filter add action=drop chain=input\n",
+			new:  "/ip firewall filter add action=drop chain=input\n/ip firewall filter add action=drop chain=input\n",
+			want: []Change{
+				{Menu: "/ip firewall filter", Key: "action=drop chain=input #2", Kind: ChangeAdded, Properties: []PropertyChange{{Name: "action", New: "drop"}, {Name: "chain", New: "input"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, err := Parse(tt.old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			updated, err := Parse(tt.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Diff(old, updated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff_ExportFormats(t *testing.T) {
+	// The terse and non-terse exports of the same configuration compare equal,
+	// once the lines absent from the terse export are left out
+	src, err := os.ReadFile(filepath.Join("testdata", "ros6_export.rsc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := Parse(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var terse []string
+	for _, statement := range Resolve(old) {
+		if _, ok := statement.(*Command); ok {
+			terse = append(terse, statement.String())
+		}
+	}
+	terseScript, err := Parse(strings.Join(terse, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Diff(old, terseScript); len(changes) != 0 {
+		t.Errorf("Diff() = %+v, want no changes", changes)
+	}
+}
+
+func TestFormatChanges(t *testing.T) {
+	changes := []Change{
+		{Menu: "/interface bridge", Key: "name=bridge2", Kind: ChangeAdded, Properties: []PropertyChange{
+			{Name: "name", New: "bridge2"},
+			{Name: "comment", New: "guest network"},
+		}},
+		{Menu: "/interface bridge", Key: "name=bridge1", Kind: ChangeChanged, Properties: []PropertyChange{
+			{Name: "vlan-filtering", Old: "no", New: "yes"},
+			{Name: "pvid", Old: "10"},
+		}},
+		{Menu: "/ip dns", Kind: ChangeRemoved, Properties: []PropertyChange{{Name: "servers", Old: "1.1.1.1"}}},
+	}
+	want := `/interface bridge
+  + name=bridge2 comment="guest network"
+  ~ name=bridge1
+      vlan-filtering: no -> yes
+      pvid: 10 -> (unset)
+/ip dns
+  - (settings) servers=1.1.1.1
+`
+	if got := FormatChanges(changes); got != want {
+		t.Errorf("FormatChanges() =\n%s\nwant\n%s", got, want)
+	}
+}
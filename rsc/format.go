@@ -0,0 +1,184 @@
+package rsc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// indent is the indentation of block statements printed by Format
+const indent = "    "
+
+// Format prints a script with one statement per line and blocks indented
+func Format(s *Script) string {
+	var b strings.Builder
+	formatStatements(&b, s.Statements, "")
+	return b.String()
+}
+
+func formatStatements(b *strings.Builder, statements []Statement, prefix string) {
+	for _, statement := range statements {
+		b.WriteString(prefix)
+		switch st := statement.(type) {
+		case *Command:
+			b.WriteString(st.head())
+			for _, arg := range st.Args {
+				b.WriteByte(' ')
+				if arg.Name != "" {
+					b.WriteString(arg.Name + "=")
+				}
+				formatValue(b, arg.Value, prefix)
+			}
+		case *Block:
+			formatValue(b, st, prefix)
+		default:
+			b.WriteString(statement.String())
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// formatValue prints a value, blocks on several lines
+func formatValue(b *strings.Builder, v Value, prefix string) {
+	switch v := v.(type) {
+	case nil:
+	case *Block:
+		if len(v.Statements) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		formatStatements(b, v.Statements, prefix+indent)
+		b.WriteString(prefix + "}")
+	case *Concat:
+		for _, part := range v.Parts {
+			formatValue(b, part, prefix)
+		}
+	default:
+		b.WriteString(v.String())
+	}
+}
+
+// joinStatements prints statements on a single line, without comments
+func joinStatements(statements []Statement) string {
+	var parts []string
+	for _, statement := range statements {
+		if _, ok := statement.(*Comment); !ok {
+			parts = append(parts, statement.String())
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (c *Comment) String() string {
+	return "#" + c.Text
+}
+
+func (m *Menu) String() string {
+	return "/" + escapeTrailingBackslash(strings.Join(m.Path, " "))
+}
+
+// head prints the path and name of the command
+func (c *Command) head() string {
+	words := append(append([]string{}, c.Path...), c.Name)
+	if c.Absolute {
+		return "/" + escapeTrailingBackslash(strings.Join(words, " "))
+	}
+	return escapeTrailingBackslash(strings.Join(words, " "))
+}
+
+func (c *Command) String() string {
+	var b strings.Builder
+	b.WriteString(c.head())
+	for _, arg := range c.Args {
+		b.WriteString(" " + arg.String())
+	}
+	return b.String()
+}
+
+func (a Arg) String() string {
+	value := ""
+	if a.Value != nil {
+		value = a.Value.String()
+	}
+	if a.Name == "" {
+		return value
+	}
+	return a.Name + "=" + value
+}
+
+func (b *Block) String() string {
+	if inner := joinStatements(b.Statements); inner != "" {
+		return "{ " + inner + " }"
+	}
+	return "{}"
+}
+
+func (w *Word) String() string {
+	return escapeTrailingBackslash(w.Text)
+}
+
+// escapeTrailingBackslash escapes a backslash ending a word, which would otherwise be read
+// back as a line continuation when followed by the end of the line. Only a word at the end
+// of a script can end with a single backslash, others escape the next character.
+func escapeTrailingBackslash(text string) string {
+	trailing := len(text) - len(strings.TrimRight(text, `\`))
+	if trailing%2 == 1 {
+		return text + `\`
+	}
+	return text
+}
+
+func (s *String) String() string {
+	return `"` + s.Raw + `"`
+}
+
+// Quote returns a value as a RouterOS string, the reverse of String.Unquote: quotes, backslashes,
+// "$" (variable substitution) and "?" are escaped, control characters use escape sequences
+func Quote(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', '$', '?':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\%02X`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func (v *Variable) String() string {
+	return "$" + v.Name
+}
+
+func (e *Expression) String() string {
+	return "(" + e.Raw + ")"
+}
+
+func (s *Subcommand) String() string {
+	if inner := joinStatements(s.Statements); inner != "" {
+		return "[ " + inner + " ]"
+	}
+	return "[]"
+}
+
+func (c *Concat) String() string {
+	var b strings.Builder
+	for _, part := range c.Parts {
+		b.WriteString(part.String())
+	}
+	return b.String()
+}
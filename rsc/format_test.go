@@ -0,0 +1,165 @@
+package rsc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	src := "/ip/address/add address=10.0.0.1/24 comment=\\\n    lan\n" +
+		":if ($a = 1) do={ :put \"one\"; # never\n} else={}\n" +
+		"{ :local x [/system identity get name]; :put $x }\n"
+	want := `/ip address add address=10.0.0.1/24 comment=lan
+:if ($a = 1) do={
+    :put "one"
+    # never
+} else={}
+{
+    :local x [ /system identity get name ]
+    :put $x
+}
+`
+	script, err := Parse(src)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := Format(script); got != want {
+		t.Errorf("Format() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormat_Stable(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{name: "trailing backslash at end of script", src: `:put a\`, want: ":put a\\\\\n"},
+		{name: "escaped backslash", src: `:put a\\`, want: ":put a\\\\\n"},
+		{name: "trailing backslash of a menu", src: `/ip\`, want: "/ip\\\\\n"},
+		{name: "stray carriage return", src: ":put a\rb\r\n/ip address\r\nadd address=10.0.0.1/24\r", want: ":put a b\n/ip address\nadd address=10.0.0.1/24\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			printed := Format(script)
+			if printed != tt.want {
+				t.Errorf("Format() = %q, want %q", printed, tt.want)
+			}
+			reparsed, err := Parse(printed)
+			if err != nil {
+				t.Fatalf("Parse(Format()) error = %v", err)
+			}
+			if again := Format(reparsed); again != printed {
+				t.Errorf("Format(Parse(Format())) = %q, want %q", again, printed)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{value: "s3cret", want: `"s3cret"`},
+		{value: `pa$s"w\o?rd`, want: `"pa\$s\"w\\o\?rd"`},
+		{value: "a\tb\n\x01", want: `"a\tb\n\01"`},
+		{value: "", want: `""`},
+	}
+	for _, tt := range tests {
+		got := Quote(tt.value)
+		if got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+		script, err := Parse(":put " + got)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", got, err)
+		}
+		args := script.Statements[0].(*Command).Args
+		if len(args) != 1 {
+			t.Fatalf("Parse(%s) gives %d arguments, want 1", got, len(args))
+		}
+		if unquoted := args[0].Value.(*String).Unquote(); unquoted != tt.value {
+			t.Errorf("Unquote(Quote(%q)) = %q", tt.value, unquoted)
+		}
+	}
+}
+
+func TestFormat_RoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.rsc"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			script, err := Parse(string(src))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			printed := Format(script)
+			reparsed, err := Parse(printed)
+			if err != nil {
+				t.Fatalf("Parse(Format()) error = %v\n%s", err, printed)
+			}
+			if again := Format(reparsed); again != printed {
+				t.Errorf("Format(Parse(Format())) =\n%s\nwant\n%s", again, printed)
+			}
+			if !reflect.DeepEqual(withoutPositions(reparsed.Statements), withoutPositions(script.Statements)) {
+				t.Errorf("Parse(Format()) gives another tree:\n%s", printed)
+			}
+		})
+	}
+}
+
+// withoutPositions returns the statements with their positions cleared, positions
+// change when continued lines are joined
+func withoutPositions(statements []Statement) []Statement {
+	var cleared []Statement
+	for _, statement := range statements {
+		switch st := statement.(type) {
+		case *Comment:
+			c := *st
+			c.Position = Position{}
+			statement = &c
+		case *Menu:
+			m := *st
+			m.Position = Position{}
+			statement = &m
+		case *Command:
+			c := *st
+			c.Position = Position{}
+			c.Args = nil
+			for _, arg := range st.Args {
+				c.Args = append(c.Args, Arg{Name: arg.Name, Value: valueWithoutPositions(arg.Value)})
+			}
+			statement = &c
+		case *Block:
+			statement = valueWithoutPositions(st).(*Block)
+		}
+		cleared = append(cleared, statement)
+	}
+	return cleared
+}
+
+func valueWithoutPositions(v Value) Value {
+	switch v := v.(type) {
+	case *Block:
+		return &Block{Statements: withoutPositions(v.Statements)}
+	case *Subcommand:
+		return &Subcommand{Statements: withoutPositions(v.Statements)}
+	case *Concat:
+		var parts []Value
+		for _, part := range v.Parts {
+			parts = append(parts, valueWithoutPositions(part))
+		}
+		return &Concat{Parts: parts}
+	}
+	return v
+}
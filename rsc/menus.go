@@ -0,0 +1,311 @@
+package rsc
+
+import "strings"
+
+// menuPaths are the RouterOS menus the parser knows, so that a line holding only words
+// can be told apart: a menu line (/ip dhcp-client), a command with positional arguments
+// (/ip dhcp-client renew 0), or a menu named like a command (/tool mac-server ping).
+// Parent menus are known too.
+var menuPaths = []string{
+	"caps-man aaa",
+	"caps-man access-list",
+	"caps-man channel",
+	"caps-man configuration",
+	"caps-man datapath",
+	"caps-man interface",
+	"caps-man manager interface",
+	"caps-man provisioning",
+	"caps-man rates",
+	"caps-man security",
+	"certificate crl",
+	"certificate scep-server",
+	"certificate settings",
+	"container config",
+	"container envs",
+	"container mounts",
+	"disk settings",
+	"file",
+	"interface 6to4",
+	"interface bonding",
+	"interface bridge filter",
+	"interface bridge host",
+	"interface bridge mdb",
+	"interface bridge msti",
+	"interface bridge nat",
+	"interface bridge port",
+	"interface bridge port-controller",
+	"interface bridge port-extender",
+	"interface bridge settings",
+	"interface bridge vlan",
+	"interface detect-internet",
+	"interface eoip",
+	"interface eoipv6",
+	"interface ethernet poe",
+	"interface ethernet switch egress-vlan-tag",
+	"interface ethernet switch egress-vlan-translation",
+	"interface ethernet switch host",
+	"interface ethernet switch ingress-vlan-translation",
+	"interface ethernet switch port",
+	"interface ethernet switch port-isolation",
+	"interface ethernet switch qos",
+	"interface ethernet switch rule",
+	"interface ethernet switch vlan",
+	"interface gre",
+	"interface gre6",
+	"interface ipip",
+	"interface ipipv6",
+	"interface l2tp-client",
+	"interface l2tp-ether",
+	"interface l2tp-server server",
+	"interface list member",
+	"interface lte apn",
+	"interface lte settings",
+	"interface macvlan",
+	"interface mesh port",
+	"interface ovpn-client",
+	"interface ovpn-server server",
+	"interface pppoe-client",
+	"interface pppoe-server server",
+	"interface pptp-client",
+	"interface pptp-server server",
+	"interface sstp-client",
+	"interface sstp-server server",
+	"interface veth",
+	"interface vlan",
+	"interface vpls bgp-vpls",
+	"interface vrrp",
+	"interface vxlan vteps",
+	"interface wifi aaa",
+	"interface wifi access-list",
+	"interface wifi cap",
+	"interface wifi capsman",
+	"interface wifi channel",
+	"interface wifi configuration",
+	"interface wifi datapath",
+	"interface wifi interworking",
+	"interface wifi provisioning",
+	"interface wifi security",
+	"interface wifi steering",
+	"interface wifiwave2 aaa",
+	"interface wifiwave2 access-list",
+	"interface wifiwave2 cap",
+	"interface wifiwave2 capsman",
+	"interface wifiwave2 channel",
+	"interface wifiwave2 configuration",
+	"interface wifiwave2 datapath",
+	"interface wifiwave2 interworking",
+	"interface wifiwave2 provisioning",
+	"interface wifiwave2 security",
+	"interface wifiwave2 steering",
+	"interface wireguard peers",
+	"interface wireless access-list",
+	"interface wireless align",
+	"interface wireless cap",
+	"interface wireless channels",
+	"interface wireless connect-list",
+	"interface wireless interworking-profiles",
+	"interface wireless manual-tx-power-table",
+	"interface wireless nstreme",
+	"interface wireless security-profiles",
+	"interface wireless sniffer",
+	"interface wireless snooper",
+	"iot lora servers",
+	"ip accounting web-access",
+	"ip address",
+	"ip arp",
+	"ip cloud advanced",
+	"ip dhcp-client option",
+	"ip dhcp-relay",
+	"ip dhcp-server alert",
+	"ip dhcp-server config",
+	"ip dhcp-server lease",
+	"ip dhcp-server matcher",
+	"ip dhcp-server network",
+	"ip dhcp-server option sets",
+	"ip dhcp-server vendor-class-id",
+	"ip dns adlist",
+	"ip dns cache",
+	"ip dns forwarders",
+	"ip dns static",
+	"ip firewall address-list",
+	"ip firewall calea",
+	"ip firewall connection tracking",
+	"ip firewall filter",
+	"ip firewall layer7-protocol",
+	"ip firewall mangle",
+	"ip firewall nat",
+	"ip firewall raw",
+	"ip firewall service-port",
+	"ip hotspot ip-binding",
+	"ip hotspot profile",
+	"ip hotspot service-port",
+	"ip hotspot user profile",
+	"ip hotspot walled-garden ip",
+	"ip ipsec identity",
+	"ip ipsec mode-config",
+	"ip ipsec peer",
+	"ip ipsec policy group",
+	"ip ipsec profile",
+	"ip ipsec proposal",
+	"ip ipsec settings",
+	"ip kid-control device",
+	"ip media",
+	"ip nat-pmp interfaces",
+	"ip neighbor discovery-settings",
+	"ip packing",
+	"ip pool",
+	"ip proxy access",
+	"ip proxy cache",
+	"ip proxy direct",
+	"ip route rule",
+	"ip service",
+	"ip settings",
+	"ip smb shares",
+	"ip smb users",
+	"ip socks access",
+	"ip ssh",
+	"ip tftp settings",
+	"ip traffic-flow ipfix",
+	"ip traffic-flow target",
+	"ip upnp interfaces",
+	"ip vrf",
+	"ipv6 address",
+	"ipv6 dhcp-client option",
+	"ipv6 dhcp-relay",
+	"ipv6 dhcp-server binding",
+	"ipv6 dhcp-server option sets",
+	"ipv6 firewall address-list",
+	"ipv6 firewall filter",
+	"ipv6 firewall mangle",
+	"ipv6 firewall nat",
+	"ipv6 firewall raw",
+	"ipv6 nd prefix default",
+	"ipv6 pool",
+	"ipv6 route",
+	"ipv6 settings",
+	"lcd",
+	"log",
+	"mpls interface",
+	"mpls ldp accept-filter",
+	"mpls ldp advertise-filter",
+	"mpls ldp interface",
+	"mpls ldp neighbor",
+	"mpls settings",
+	"partitions",
+	"port remote-access",
+	"ppp aaa",
+	"ppp l2tp-secret",
+	"ppp profile",
+	"ppp secret",
+	"queue interface",
+	"queue simple",
+	"queue tree",
+	"queue type",
+	"radius incoming",
+	"routing bfd configuration",
+	"routing bgp connection",
+	"routing bgp instance",
+	"routing bgp template",
+	"routing bgp vpn",
+	"routing filter community-ext-list",
+	"routing filter community-large-list",
+	"routing filter community-list",
+	"routing filter num-list",
+	"routing filter rule",
+	"routing filter select-rule",
+	"routing id",
+	"routing igmp-proxy interface",
+	"routing isis instance",
+	"routing isis interface-template",
+	"routing ospf area range",
+	"routing ospf instance",
+	"routing ospf interface-template",
+	"routing ospf static-neighbor",
+	"routing pimsm instance",
+	"routing pimsm interface-template",
+	"routing rip instance",
+	"routing rip interface-template",
+	"routing rpki",
+	"routing rule",
+	"routing settings",
+	"routing table",
+	"snmp community",
+	"special-login",
+	"system clock manual",
+	"system console",
+	"system gps",
+	"system hardware",
+	"system health settings",
+	"system identity",
+	"system leds settings",
+	"system logging action",
+	"system note",
+	"system ntp client servers",
+	"system ntp server",
+	"system package update",
+	"system resource irq rps",
+	"system routerboard mode-button",
+	"system routerboard reset-button",
+	"system routerboard settings",
+	"system routerboard usb",
+	"system routerboard wps-button",
+	"system scheduler",
+	"system script environment",
+	"system ups",
+	"system upgrade mirror",
+	"system watchdog",
+	"tool bandwidth-server",
+	"tool e-mail",
+	"tool graphing interface",
+	"tool graphing queue",
+	"tool graphing resource",
+	"tool mac-server mac-winbox",
+	"tool mac-server ping",
+	"tool netwatch",
+	"tool romon port",
+	"tool sms",
+	"tool sniffer",
+	"tool traffic-generator",
+	"tool traffic-monitor",
+	"user aaa",
+	"user group",
+	"user settings",
+	"user ssh-keys",
+	"user-manager advanced",
+	"user-manager attribute",
+	"user-manager database",
+	"user-manager limitation",
+	"user-manager profile",
+	"user-manager profile-limitation",
+	"user-manager router",
+	"user-manager settings",
+	"user-manager user group",
+	"user-manager user-profile",
+	"zerotier interface",
+}
+
+// menus holds the known menus and their parents, by space-separated path
+var menus = func() map[string]bool {
+	known := map[string]bool{}
+	for _, path := range menuPaths {
+		words := strings.Fields(path)
+		for i := range words {
+			known[strings.Join(words[:i+1], " ")] = true
+		}
+	}
+	return known
+}()
+
+// menuPrefix returns how many leading words name a known menu, within the menu base
+func menuPrefix(base, words []string) int {
+	path := strings.Join(base, " ")
+	n := 0
+	for i, word := range words {
+		path = strings.TrimPrefix(path+" "+word, " ")
+		if !menus[path] {
+			break
+		}
+		n = i + 1
+	}
+	return n
+}
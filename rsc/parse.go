@@ -0,0 +1,427 @@
+package rsc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is a syntax error, positioned like RouterOS reports them
+type ParseError struct {
+	Position
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s (line %d column %d)", e.Message, e.Line, e.Column)
+}
+
+// verbs are the commands that end a menu path, unless the path is a known menu named like
+// a command (/tool mac-server ping). Paths without verb are classified by the known menus,
+// see (*parser).command.
+var verbs = map[string]bool{
+	"add":                 true,
+	"cancel":              true,
+	"check-for-updates":   true,
+	"comment":             true,
+	"disable":             true,
+	"download":            true,
+	"edit":                true,
+	"enable":              true,
+	"export":              true,
+	"fetch":               true,
+	"find":                true,
+	"flush":               true,
+	"get":                 true,
+	"import":              true,
+	"install":             true,
+	"make-static":         true,
+	"monitor":             true,
+	"monitor-traffic":     true,
+	"move":                true,
+	"ping":                true,
+	"print":               true,
+	"reboot":              true,
+	"remove":              true,
+	"reset":               true,
+	"reset-configuration": true,
+	"reset-counters":      true,
+	"reset-counters-all":  true,
+	"run":                 true,
+	"set":                 true,
+	"shutdown":            true,
+	"uninstall":           true,
+	"unset":               true,
+	"upgrade":             true,
+}
+
+// Parse parses a RouterOS script. CRLF line endings and "\" line continuations are accepted,
+// a stray carriage return is a blank.
+func Parse(src string) (*Script, error) {
+	p := &parser{src: strings.ReplaceAll(src, "\r\n", "\n"), line: 1, column: 1}
+	statements, err := p.statements(0)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{Statements: statements}, nil
+}
+
+// parser reads a script byte by byte, tracking the position
+type parser struct {
+	src    string
+	offset int
+	line   int
+	column int
+	// menu is the path of the last menu line, relative commands are looked up within it
+	menu []string
+}
+
+func (p *parser) position() Position {
+	return Position{Line: p.line, Column: p.column}
+}
+
+func (p *parser) errorf(pos Position, format string, args ...any) error {
+	return &ParseError{Position: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// peek returns the next byte, 0 at the end
+func (p *parser) peek() byte {
+	if p.offset >= len(p.src) {
+		return 0
+	}
+	return p.src[p.offset]
+}
+
+// continuation reports whether a "\" line continuation starts at the next byte
+func (p *parser) continuation() bool {
+	return strings.HasPrefix(p.src[p.offset:], "\\\n")
+}
+
+func (p *parser) next() byte {
+	c := p.src[p.offset]
+	p.offset++
+	if c == '\n' {
+		p.line++
+		p.column = 1
+	} else {
+		p.column++
+	}
+	return c
+}
+
+// skipSpace skips blanks and line continuations, not line ends
+func (p *parser) skipSpace() {
+	for {
+		switch {
+		case p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r':
+			p.next()
+		case p.continuation():
+			p.next()
+			p.next()
+		default:
+			return
+		}
+	}
+}
+
+// statements parses statements until end (']' or '}'), or the end of the script when end is 0
+func (p *parser) statements(end byte) ([]Statement, error) {
+	var statements []Statement
+	for {
+		p.skipSpace()
+		pos := p.position()
+		switch c := p.peek(); {
+		case c == 0:
+			if end != 0 {
+				return nil, p.errorf(pos, "missing %q", end)
+			}
+			return statements, nil
+		case c == end:
+			p.next()
+			return statements, nil
+		case c == ']' || c == '}':
+			return nil, p.errorf(pos, "unexpected %q", c)
+		case c == '\n' || c == ';':
+			p.next()
+		case c == '#':
+			p.next()
+			start := p.offset
+			for p.peek() != 0 && p.peek() != '\n' {
+				p.next()
+			}
+			statements = append(statements, &Comment{Position: pos, Text: p.src[start:p.offset]})
+		case c == '{':
+			p.next()
+			inner, err := p.statements('}')
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, &Block{Position: pos, Statements: inner})
+		default:
+			statement, err := p.command()
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, statement)
+		}
+	}
+}
+
+// command parses a command up to the end of the statement. Leading words form the menu path
+// and the command name: a verb ends the path, otherwise the word following the longest known
+// menu is the command and the next words are its arguments (/certificate sign ca-template).
+// An absolute path without arguments is a menu line when it is a known menu, or when it can't
+// be told from a command: no known menu, or a single unknown word after it (a newer submenu).
+// Other paths without known menu have their last word as command (/tool fetch url=...).
+func (p *parser) command() (Statement, error) {
+	pos := p.position()
+	var args []Arg
+	for {
+		p.skipSpace()
+		c := p.peek()
+		if c == 0 || c == '\n' || c == ';' || c == ']' || c == '}' {
+			break
+		}
+		arg, err := p.arg()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	// Leading words are menu path segments and the command name
+	tail := args[1:]
+	if len(tail) == 0 {
+		tail = nil
+	}
+	if v, ok := args[0].Value.(*Variable); ok && args[0].Name == "" {
+		return &Command{Position: pos, Name: "$" + v.Name, Args: tail}, nil
+	}
+	first, _ := args[0].Value.(*Word)
+	if args[0].Name == "" && first != nil && strings.HasPrefix(first.Text, ":") {
+		return &Command{Position: pos, Name: first.Text, Args: tail}, nil
+	}
+	absolute := args[0].Name == "" && first != nil && strings.HasPrefix(first.Text, "/")
+	base := p.menu
+	if absolute {
+		base = nil
+	}
+	var words []string
+	verb := false
+	n := 0
+	for ; n < len(args); n++ {
+		word, ok := args[n].Value.(*Word)
+		// Only the first word holds /-separated segments, later ones are values (10.0.0.0/8)
+		if args[n].Name != "" || !ok || (n > 0 && strings.Contains(word.Text, "/")) {
+			break
+		}
+		words = append(words, strings.FieldsFunc(word.Text, func(r rune) bool { return r == '/' })...)
+		if len(words) > 0 && verbs[words[len(words)-1]] && menuPrefix(base, words) < len(words) {
+			verb = true
+			n++
+			break
+		}
+	}
+	rest := args[n:]
+
+	if len(words) == 0 {
+		if absolute {
+			p.menu = nil
+			return &Menu{Position: pos, Path: []string{}}, nil
+		}
+		return nil, p.errorf(pos, "expected command name")
+	}
+	name := len(words) - 1
+	if !verb {
+		known := menuPrefix(base, words)
+		// Relative commands of a known menu start with their name (sign ca-template in /certificate)
+		withinMenu := known > 0 || (len(base) > 0 && menus[strings.Join(base, " ")])
+		switch {
+		case absolute && len(rest) == 0 && (known == 0 || known >= len(words)-1):
+			p.menu = words
+			return &Menu{Position: pos, Path: words}, nil
+		case withinMenu && known < len(words):
+			// Words following the command are positional arguments
+			name = known
+			var positional []Arg
+			for _, word := range words[known+1:] {
+				positional = append(positional, Arg{Value: &Word{Text: word}})
+			}
+			rest = append(positional, rest...)
+		}
+	}
+	if len(rest) == 0 {
+		rest = nil
+	}
+	command := &Command{Position: pos, Absolute: absolute, Name: words[name], Args: rest}
+	if name > 0 {
+		command.Path = words[:name]
+	}
+	return command, nil
+}
+
+// arg parses name=value or a positional value
+func (p *parser) arg() (Arg, error) {
+	name := ""
+	rest := p.src[p.offset:]
+	i := 0
+	for i < len(rest) && isNameByte(rest[i]) {
+		i++
+	}
+	if i > 0 && i < len(rest) && rest[i] == '=' && !strings.HasPrefix(rest[i:], "==") {
+		name = rest[:i]
+		for range i + 1 {
+			p.next()
+		}
+	}
+	value, err := p.value()
+	if err != nil {
+		return Arg{}, err
+	}
+	return Arg{Name: name, Value: value}, nil
+}
+
+func isNameByte(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.'
+}
+
+// value parses adjacent value parts, up to a blank or the end of the statement.
+// It returns nil for an empty value.
+func (p *parser) value() (Value, error) {
+	var parts []Value
+loop:
+	for {
+		pos := p.position()
+		switch c := p.peek(); c {
+		case 0, ' ', '\t', '\r', '\n', ';', ']', '}':
+			if len(parts) == 0 {
+				return nil, nil
+			}
+			break loop
+		case '"':
+			s, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		case '[':
+			p.next()
+			inner, err := p.statements(']')
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, &Subcommand{Statements: inner})
+		case '{':
+			p.next()
+			inner, err := p.statements('}')
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, &Block{Position: pos, Statements: inner})
+		case '(':
+			raw, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, &Expression{Raw: raw})
+		case '$':
+			p.next()
+			start := p.offset
+			for isNameByte(p.peek()) && p.peek() != '.' {
+				p.next()
+			}
+			if p.offset == start {
+				parts = append(parts, &Word{Text: "$"})
+			} else {
+				parts = append(parts, &Variable{Name: p.src[start:p.offset]})
+			}
+		default:
+			if p.continuation() {
+				p.skipSpace()
+				continue
+			}
+			var b strings.Builder
+			for {
+				c := p.peek()
+				if c == 0 || strings.IndexByte(" \t\r\n;]}\"[{($", c) >= 0 || p.continuation() {
+					break
+				}
+				if c == '\\' && p.offset+1 < len(p.src) {
+					b.WriteByte(p.next())
+				}
+				b.WriteByte(p.next())
+			}
+			parts = append(parts, &Word{Text: b.String()})
+		}
+		if p.continuation() {
+			// A continuation ends the value like a blank
+			break loop
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return &Concat{Parts: parts}, nil
+}
+
+// quoted parses a quoted string. A line continuation within it is dropped along with
+// the indentation of the next line.
+func (p *parser) quoted() (*String, error) {
+	pos := p.position()
+	p.next()
+	var b strings.Builder
+	for {
+		switch c := p.peek(); {
+		case c == 0:
+			return nil, p.errorf(pos, "unterminated string")
+		case c == '"':
+			p.next()
+			return &String{Raw: b.String()}, nil
+		case p.continuation():
+			p.next()
+			p.next()
+			for p.peek() == ' ' || p.peek() == '\t' {
+				p.next()
+			}
+		case c == '\\' && p.offset+1 < len(p.src):
+			b.WriteByte(p.next())
+			b.WriteByte(p.next())
+		default:
+			b.WriteByte(p.next())
+		}
+	}
+}
+
+// expression returns the text of a ( ... ) expression, nested parentheses and strings included
+func (p *parser) expression() (string, error) {
+	pos := p.position()
+	p.next()
+	var b strings.Builder
+	depth := 1
+	for {
+		switch c := p.peek(); {
+		case c == 0:
+			return "", p.errorf(pos, "missing ')'")
+		case c == '"':
+			s, err := p.quoted()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(`"` + s.Raw + `"`)
+		case p.continuation():
+			p.skipSpace()
+			b.WriteByte(' ')
+		case c == '(':
+			depth++
+			b.WriteByte(p.next())
+		case c == ')':
+			depth--
+			p.next()
+			if depth == 0 {
+				return b.String(), nil
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(p.next())
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package rsc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Statement
+	}{
+		{
+			name: "menu and relative command",
+			src:  "/ip address\nadd address=10.0.0.1/24 interface=ether1\n",
+			want: []Statement{
+				&Menu{Position: Position{1, 1}, Path: []string{"ip", "address"}},
+				&Command{Position: Position{2, 1}, Name: "add", Args: []Arg{
+					{Name: "address", Value: &Word{Text: "10.0.0.1/24"}},
+					{Name: "interface", Value: &Word{Text: "ether1"}},
+				}},
+			},
+		},
+		{
+			name: "slash separated path",
+			src:  "/ip/firewall/filter/add chain=input",
+			want: []Statement{
+				&Command{Position: Position{1, 1}, Absolute: true, Path: []string{"ip", "firewall", "filter"}, Name: "add", Args: []Arg{
+					{Name: "chain", Value: &Word{Text: "input"}},
+				}},
+			},
+		},
+		{
+			name: "root menu and command without verb",
+			src:  "/\n/tool sniffer quick interface=ether1",
+			want: []Statement{
+				&Menu{Position: Position{1, 1}, Path: []string{}},
+				&Command{Position: Position{2, 1}, Absolute: true, Path: []string{"tool", "sniffer"}, Name: "quick", Args: []Arg{
+					{Name: "interface", Value: &Word{Text: "ether1"}},
+				}},
+			},
+		},
+		{
+			name: "find expression",
+			src:  `set [ find default-name=ether1 ] comment="to \"core\"" disabled=`,
+			want: []Statement{
+				&Command{Position: Position{1, 1}, Name: "set", Args: []Arg{
+					{Value: &Subcommand{Statements: []Statement{
+						&Command{Position: Position{1, 7}, Name: "find", Args: []Arg{{Name: "default-name", Value: &Word{Text: "ether1"}}}},
+					}}},
+					{Name: "comment", Value: &String{Raw: `to \"core\"`}},
+					{Name: "disabled"},
+				}},
+			},
+		},
+		{
+			name: "line continuations",
+			src:  "add comment=\\\n    \"long \\\n    text\" name=\\\n    x",
+			want: []Statement{
+				&Command{Position: Position{1, 1}, Name: "add", Args: []Arg{
+					{Name: "comment", Value: &String{Raw: "long text"}},
+					{Name: "name", Value: &Word{Text: "x"}},
+				}},
+			},
+		},
+		{
+			name: "global commands, blocks and comments",
+			src:  "# check\r\n:if ($n != 0) do={ :put (\"n=\" . $n); $f } ; {}",
+			want: []Statement{
+				&Comment{Position: Position{1, 1}, Text: " check"},
+				&Command{Position: Position{2, 1}, Name: ":if", Args: []Arg{
+					{Value: &Expression{Raw: `$n != 0`}},
+					{Name: "do", Value: &Block{Position: Position{2, 18}, Statements: []Statement{
+						&Command{Position: Position{2, 20}, Name: ":put", Args: []Arg{{Value: &Expression{Raw: `"n=" . $n`}}}},
+						&Command{Position: Position{2, 38}, Name: "$f"},
+					}}},
+				}},
+				&Block{Position: Position{2, 45}},
+			},
+		},
+		{
+			name: "concatenated value",
+			src:  `:put ("a" . $b) ; print where name~"^eth"$x`,
+			want: []Statement{
+				&Command{Position: Position{1, 1}, Name: ":put", Args: []Arg{{Value: &Expression{Raw: `"a" . $b`}}}},
+				&Command{Position: Position{1, 19}, Name: "print", Args: []Arg{
+					{Value: &Word{Text: "where"}},
+					{Value: &Concat{Parts: []Value{&Word{Text: "name~"}, &String{Raw: "^eth"}, &Variable{Name: "x"}}}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(script.Statements, tt.want) {
+				t.Errorf("Parse() =\n%s\nwant\n%s", Format(script), Format(&Script{Statements: tt.want}))
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{src: "add comment=\"open", want: "unterminated string (line 1 column 13)"},
+		{src: ":if (true) do={\n:put 1\n", want: "missing '}' (line 3 column 1)"},
+		{src: "set [ find name=x", want: "missing ']' (line 1 column 18)"},
+		{src: ":put (1 + (2)", want: "missing ')' (line 1 column 6)"},
+		{src: "print }", want: "unexpected '}' (line 1 column 7)"},
+		{src: "name=x", want: "expected command name (line 1 column 1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || err.Error() != tt.want {
+				t.Errorf("Parse() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Fixtures(t *testing.T) {
+	tests := []struct {
+		file string
+		// statements is the number of top-level statements, comments included
+		statements int
+		// resolved holds some lines of the resolved script, by line number
+		resolved map[int]string
+	}{
+		{
+			file:       "ros6_export.rsc",
+			statements: 30,
+			resolved: map[int]string{
+				9:  `/interface ethernet set [ find default-name=ether2 ] comment="uplink to core"`,
+				19: "/ip address add address=192.168.88.1/24 comment=defconf interface=bridge1 network=192.168.88.0",
+				24: `/ip firewall filter add action=accept chain=input comment="defconf: accept established,related,untracked" connection-state=established,related,untracked`,
+				34: `/system scheduler add interval=1d name=backup on-event="/system backup save name=daily" policy=ftp,reboot,read,write,policy,test,password,sniff,sensitive,romon start-date=sep/10/2023 start-time=03:00:00`,
+			},
+		},
+		{
+			file:       "ros7_export.rsc",
+			statements: 13,
+			resolved: map[int]string{
+				4:  "/interface bridge add admin-mac=78:9A:18:00:00:02 auto-mac=no comment=defconf name=bridge1",
+				12: `/system identity set name="core router"`,
+			},
+		},
+		{
+			file:       "script.rsc",
+			statements: 8,
+			resolved: map[int]string{
+				3:  `:local name ("vlan" . $vlanId)`,
+				6:  `:if ([:len [find where name=$name]] = 0) do={ add interface=bridge1 name=$name vlan-id=$vlanId } else={ :log info "$name already present" }`,
+				12: `:foreach i in=[ /ip address find where interface~"^ether" ] do={ :put [ /ip address get $i address ] }`,
+				16: `{ :local count 0; :set count ($count + 1); :do { /system script run cleanup } on-error={ :log warning "no cleanup script" } }`,
+				20: `/tool fetch url="https://example.com/config?router=$[/system identity get name]" dst-path=config.rsc`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			script, err := Parse(string(src))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(script.Statements) != tt.statements {
+				t.Errorf("Parse() = %d statements, want %d", len(script.Statements), tt.statements)
+			}
+			lines := map[int]string{}
+			for _, statement := range Resolve(script) {
+				lines[statement.Pos().Line] = statement.String()
+			}
+			for line, want := range tt.resolved {
+				if lines[line] != want {
+					t.Errorf("line %d = %q, want %q", line, lines[line], want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	script, err := Parse("add name=a\n/ip address\n# comment\nadd address=10.0.0.1/24\n:put done\n/system identity set name=r1\nprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, statement := range Resolve(script) {
+		got = append(got, statement.String())
+	}
+	want := []string{
+		"add name=a",
+		"/ip address add address=10.0.0.1/24",
+		":put done",
+		"/system identity set name=r1",
+		"/ip address print",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve() = %q, want %q", got, want)
+	}
+	// The parsed script is left as it is
+	if command := script.Statements[3].(*Command); command.Absolute || len(command.Path) != 0 {
+		t.Errorf("Resolve() modified the script: %s", command)
+	}
+}
+
+func TestParse_MenuOrCommand(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{src: "/certificate sign ca-template", want: []string{"/certificate sign ca-template"}},
+		{src: "/log info hello", want: []string{"/log info hello"}},
+		{src: "/ip dhcp-client renew 0", want: []string{"/ip dhcp-client renew 0"}},
+		{src: "/tool mac-server ping\nset enabled=no", want: []string{"/tool mac-server ping set enabled=no"}},
+		{src: "/certificate\nsign ca-template name=ca", want: []string{"/certificate sign ca-template name=ca"}},
+		{src: "/interface wifi radio-settings\nset country=Switzerland", want: []string{"/interface wifi radio-settings set country=Switzerland"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			script, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var got []string
+			for _, statement := range Resolve(script) {
+				got = append(got, statement.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The command is the word following the menu, not the last one
+	script, err := Parse("/certificate sign ca-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Command{Position: Position{1, 1}, Absolute: true, Path: []string{"certificate"}, Name: "sign", Args: []Arg{{Value: &Word{Text: "ca-template"}}}}
+	if !reflect.DeepEqual(script.Statements[0], want) {
+		t.Errorf("Parse() = %#v, want %#v", script.Statements[0], want)
+	}
+}
+
+func TestText(t *testing.T) {
+	script, err := Parse(`add name=ether1 comment="a \"b\"\_c\41\n" vlan=$id disabled=`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := script.Statements[0].(*Command)
+	tests := map[string]string{
+		"name":     "ether1",
+		"comment":  "a \"b\" cA\n",
+		"vlan":     "$id",
+		"disabled": "",
+	}
+	for name, want := range tests {
+		value, ok := command.Arg(name)
+		if !ok {
+			t.Errorf("Arg(%s) not found", name)
+			continue
+		}
+		if got := Text(value); got != want {
+			t.Errorf("Text(%s) = %q, want %q", name, got, want)
+		}
+	}
+	if _, ok := command.Arg("missing"); ok {
+		t.Error("Arg(missing) found")
+	}
+	if !strings.HasPrefix(command.String(), "add name=ether1") {
+		t.Errorf("String() = %q", command.String())
+	}
+}